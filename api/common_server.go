@@ -5,9 +5,11 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/gorilla/mux"
@@ -15,6 +17,7 @@ import (
 	"github.com/rs/cors"
 	"github.com/urfave/negroni"
 
+	"github.com/readium/readium-lcp-server/apikey"
 	"github.com/readium/readium-lcp-server/problem"
 )
 
@@ -26,6 +29,8 @@ const (
 	ContentType_LSD_JSON  = "application/vnd.readium.license.status.v1.0+json"
 	ContentType_TEXT_HTML = "text/html"
 
+	ContentType_ODL_INFO_JSON = "application/vnd.odl.info+json"
+
 	ContentType_JSON = "application/json"
 
 	ContentType_FORM_URL_ENCODED = "application/x-www-form-urlencoded"
@@ -142,11 +147,59 @@ func CORSHeaders(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc)
 }
 
 func CheckAuth(authenticator *auth.BasicAuth, w http.ResponseWriter, r *http.Request) bool {
+	return CheckUser(authenticator, w, r) != ""
+}
+
+// CheckUser checks the credentials of a request like CheckAuth, and returns the name of the user,
+// or an empty string if the credentials are rejected
+func CheckUser(authenticator *auth.BasicAuth, w http.ResponseWriter, r *http.Request) string {
 	var username string
 	if username = authenticator.CheckAuth(r); username == "" {
 		w.Header().Set("WWW-Authenticate", `Basic realm="`+authenticator.Realm+`"`)
 		problem.Error(w, r, problem.Problem{Detail: "User or password do not match!"}, http.StatusUnauthorized)
-		return false
 	}
-	return true
+	return username
+}
+
+// CheckAPIKey checks the API key of a request, which must grant a scope.
+// found is false if the request holds no API key; otherwise the key is nil if it is invalid
+// or does not grant the scope, and the error has been written.
+func CheckAPIKey(st apikey.Store, scope string, w http.ResponseWriter, r *http.Request) (key *apikey.Key, found bool) {
+	token := apikey.Token(r)
+	if token == "" || st == nil {
+		return nil, false
+	}
+	k, err := apikey.Check(st, token)
+	if err == apikey.ErrInvalid {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusUnauthorized)
+		return nil, true
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return nil, true
+	}
+	if !k.Allows(scope) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+		problem.Error(w, r, problem.Problem{Detail: "The API key does not grant the " + scope + " scope"}, http.StatusForbidden)
+		return nil, true
+	}
+	return &k, true
+}
+
+// ParsePage returns the page and per_page parameters of a request, 1 and 30 by default
+func ParsePage(r *http.Request) (page int, perPage int, err error) {
+	page, perPage = 1, 30
+	if r.FormValue("page") != "" {
+		page, err = strconv.Atoi(r.FormValue("page"))
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("page must be positive integer")
+		}
+	}
+	if r.FormValue("per_page") != "" {
+		perPage, err = strconv.Atoi(r.FormValue("per_page"))
+		if err != nil || perPage < 1 || perPage > 1000 {
+			return 0, 0, errors.New("per_page must be an integer between 1 and 1000")
+		}
+	}
+	return page, perPage, nil
 }
@@ -0,0 +1,133 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package apikey manages the API keys of the License Server and the Status Server.
+// An API key is sent as a bearer token (Authorization: Bearer <token>); it grants a set of scopes,
+// and on the License Server it may be restricted to a tenant. Only a hash of the secret part of a token is stored.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scopes of the API keys
+const (
+	ContentRead  = "content:read"
+	ContentWrite = "content:write"
+	LicenseRead  = "license:read"
+	LicenseWrite = "license:write"
+	PolicyWrite  = "policy:write"
+	StatusAdmin  = "status:admin"
+	ReportsRead  = "reports:read"
+	AuditRead    = "audit:read"
+)
+
+// Scopes lists the valid scopes
+var Scopes = []string{ContentRead, ContentWrite, LicenseRead, LicenseWrite, PolicyWrite, StatusAdmin, ReportsRead, AuditRead}
+
+// ErrInvalid signals an unknown key or a wrong secret
+var ErrInvalid = errors.New("Invalid API key")
+
+// Key is an API key, without its secret
+type Key struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Tenant string   `json:"tenant,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Hash is the hex-encoded sha256 hash of the secret
+	Hash    string    `json:"-"`
+	Created time.Time `json:"created"`
+}
+
+// Allows tells if a key grants a scope
+func (k Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// New creates a key with a random id and secret, and returns it with its token.
+// The token is only known by the caller, it cannot be recovered from the key.
+func New(name string, tenant string, scopes []string) (Key, string, error) {
+	if name == "" {
+		return Key{}, "", errors.New("the name of a key is required")
+	}
+	if len(scopes) == 0 {
+		return Key{}, "", errors.New("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !validScope(s) {
+			return Key{}, "", errors.New("unknown scope " + s)
+		}
+	}
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, "", err
+	}
+	k := Key{
+		ID:      hex.EncodeToString(id),
+		Name:    name,
+		Tenant:  tenant,
+		Scopes:  scopes,
+		Hash:    hash(hex.EncodeToString(secret)),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	return k, k.ID + "." + hex.EncodeToString(secret), nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Token returns the bearer token of a request, an empty string if none
+func Token(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// Check returns the key of a token
+func Check(st Store, token string) (Key, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok {
+		return Key{}, ErrInvalid
+	}
+	k, err := st.Get(id)
+	if err == ErrNotFound {
+		return k, ErrInvalid
+	}
+	if err != nil {
+		return k, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(k.Hash)) != 1 {
+		return Key{}, ErrInvalid
+	}
+	return k, nil
+}
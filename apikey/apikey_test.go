@@ -0,0 +1,113 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apikey
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func openTestStore(t *testing.T) Store {
+	database := "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	st, err := Open(db, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestNew(t *testing.T) {
+	if _, _, err := New("cms", "", nil); err == nil {
+		t.Error("Expected an error without scopes")
+	}
+	if _, _, err := New("cms", "", []string{"license:delete"}); err == nil {
+		t.Error("Expected an error for an unknown scope")
+	}
+	k, token, err := New("cms", "acme", []string{LicenseRead, LicenseWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, k.ID+".") || strings.Contains(k.Hash, strings.TrimPrefix(token, k.ID+".")) {
+		t.Errorf("Unexpected token %s for key %+v", token, k)
+	}
+	if !k.Allows(LicenseWrite) || k.Allows(ContentWrite) {
+		t.Errorf("Unexpected scopes %v", k.Scopes)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	st := openTestStore(t)
+
+	k, token, err := New("cms", "acme", []string{LicenseRead, ReportsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Add(k); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/licenses", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	found, err := Check(st, Token(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != k.ID || found.Tenant != "acme" || !found.Allows(ReportsRead) {
+		t.Errorf("Unexpected key %+v", found)
+	}
+
+	for _, invalid := range []string{"", k.ID, k.ID + ".00", "unknown." + strings.Split(token, ".")[1]} {
+		if _, err = Check(st, invalid); err != ErrInvalid {
+			t.Errorf("Expected an invalid token %q, got %v", invalid, err)
+		}
+	}
+
+	// a revoked key is invalid
+	if err = st.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Check(st, token); err != ErrInvalid {
+		t.Errorf("Expected a revoked key, got %v", err)
+	}
+	if err = st.Delete(k.ID); err != ErrNotFound {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	st := openTestStore(t)
+
+	for _, name := range []string{"reports", "cms"} {
+		k, _, err := New(name, "", []string{ReportsRead})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = st.Add(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var names []string
+	fn := st.List()
+	k, err := fn()
+	for ; err == nil; k, err = fn() {
+		names = append(names, k.Name)
+	}
+	if err != ErrNotFound || strings.Join(names, ",") != "cms,reports" {
+		t.Errorf("Unexpected keys %v, %v", names, err)
+	}
+}
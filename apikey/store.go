@@ -0,0 +1,114 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrNotFound signals a key not found
+var ErrNotFound = errors.New("API key not found")
+
+// Store is the interface of the api_key table
+type Store interface {
+	Add(k Key) error
+	Get(id string) (Key, error)
+	List() func() (Key, error)
+	Delete(id string) error
+}
+
+type sqlStore struct {
+	db       *sql.DB
+	database string
+}
+
+// Add records a key; its scopes are stored as a comma separated list
+func (s *sqlStore) Add(k Key) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "INSERT INTO api_key (id, name, tenant, scopes, hash, created) VALUES (?, ?, ?, ?, ?, ?)"),
+		k.ID, k.Name, k.Tenant, strings.Join(k.Scopes, ","), k.Hash, k.Created)
+	return err
+}
+
+// Get returns a key by id
+func (s *sqlStore) Get(id string) (Key, error) {
+	row := s.db.QueryRow(dbutils.GetParamQuery(s.database, "SELECT id, name, tenant, scopes, hash, created FROM api_key WHERE id=?"), id)
+	k, err := scan(row)
+	if err == sql.ErrNoRows {
+		return k, ErrNotFound
+	}
+	return k, err
+}
+
+// List lists all keys by name
+func (s *sqlStore) List() func() (Key, error) {
+	rows, err := s.db.Query("SELECT id, name, tenant, scopes, hash, created FROM api_key ORDER BY name")
+	if err != nil {
+		return func() (Key, error) { return Key{}, err }
+	}
+	return func() (Key, error) {
+		if rows.Next() {
+			return scan(rows)
+		}
+		rows.Close()
+		return Key{}, ErrNotFound
+	}
+}
+
+// Delete revokes a key
+func (s *sqlStore) Delete(id string) error {
+	result, err := s.db.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM api_key WHERE id=?"), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row scanner) (Key, error) {
+	var k Key
+	var scopes string
+	err := row.Scan(&k.ID, &k.Name, &k.Tenant, &scopes, &k.Hash, &k.Created)
+	if err == nil && scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	return k, err
+}
+
+// Open creates a key store in the database of a server,
+// whose connection string is used to adapt the queries to the driver
+func Open(db *sql.DB, database string) (Store, error) {
+
+	driver, _ := config.GetDatabase(database)
+
+	// if sqlite, create the api_key table if it does not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite api_key table")
+			return nil, err
+		}
+	}
+	return &sqlStore{db, database}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS api_key (" +
+	"id varchar(16) PRIMARY KEY," +
+	"name varchar(255) NOT NULL," +
+	"tenant varchar(64) NOT NULL DEFAULT ''," +
+	"scopes varchar(255) NOT NULL," +
+	"hash varchar(64) NOT NULL," +
+	"created datetime NOT NULL)"
@@ -0,0 +1,182 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package audit records the requests of the private routes which change the data of a server:
+// who made the request, from where, on which target, with which result and which changes.
+// The audit log is append-only; old entries are only removed by the retention policy.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Entry is a record of the audit log
+type Entry struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Principal string    `json:"principal"`
+	Tenant    string    `json:"tenant,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	// Action is the method and the path template of the route, e.g. DELETE /contents/{content_id}
+	Action string `json:"action"`
+	// Target is the id of the changed object, by default the variables of the path
+	Target string `json:"target"`
+	Status int    `json:"status"`
+	// Changes holds the fields changed by the request, with their value before and after it
+	Changes map[string]Change `json:"changes,omitempty"`
+}
+
+// Change is the value of a field before and after a request
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type contextKey struct{}
+
+// RequestIDHeader is the header holding the id of a request, set by the caller or generated
+const RequestIDHeader = "X-Request-ID"
+
+// Handle runs a handler, then records an entry if the request changes data, i.e. if it is not a GET request.
+// The entry is available to the handler, which may describe the changes with Describe.
+func Handle(st Store, principal string, tenant string, w http.ResponseWriter, r *http.Request, fn func(w http.ResponseWriter, r *http.Request)) {
+	if st == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		fn(w, r)
+		return
+	}
+
+	reqID := r.Header.Get(RequestIDHeader)
+	if reqID == "" {
+		if uid, err := uuid.NewV4(); err == nil {
+			reqID = uid.String()
+		}
+	}
+	w.Header().Set(RequestIDHeader, reqID)
+
+	e := &Entry{
+		RequestID: reqID,
+		Principal: principal,
+		Tenant:    tenant,
+		SourceIP:  sourceIP(r),
+		Action:    r.Method + " " + r.URL.Path,
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			e.Action = r.Method + " " + tpl
+			e.Target = target(tpl, mux.Vars(r))
+		}
+	}
+
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	fn(sw, r.WithContext(context.WithValue(r.Context(), contextKey{}, e)))
+
+	e.Status = sw.status
+	e.Time = time.Now().UTC().Truncate(time.Second)
+	if err := st.Add(*e); err != nil {
+		log.Println("Error recording the audit entry of request " + reqID + ": " + err.Error())
+	}
+}
+
+// Describe sets the target of the audit entry of a request, if not empty, and the changes between
+// the states of the target before and after the request; before is nil for a creation, after for a deletion.
+// It does nothing if the request is not audited.
+func Describe(r *http.Request, target string, before interface{}, after interface{}) {
+	e, ok := r.Context().Value(contextKey{}).(*Entry)
+	if !ok {
+		return
+	}
+	if target != "" {
+		e.Target = target
+	}
+	e.Changes = diff(before, after)
+}
+
+// diff returns the top level fields of two objects whose json values differ
+func diff(before interface{}, after interface{}) map[string]Change {
+	b, a := fields(before), fields(after)
+	changes := make(map[string]Change)
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			changes[k] = Change{Before: v, After: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: v}
+		}
+	}
+	return changes
+}
+
+// fields returns the top level json fields of an object
+func fields(o interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	if o == nil || reflect.ValueOf(o).Kind() == reflect.Ptr && reflect.ValueOf(o).IsNil() {
+		return m
+	}
+	data, err := json.Marshal(o)
+	if err == nil {
+		err = json.Unmarshal(data, &m)
+	}
+	if err != nil {
+		log.Println("Error reading the fields of an audited object: " + err.Error())
+	}
+	return m
+}
+
+var pathVar = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// target returns the values of the path variables of a route, in their order; the tenant is recorded apart
+func target(tpl string, vars map[string]string) string {
+	var values []string
+	for _, m := range pathVar.FindAllStringSubmatch(tpl, -1) {
+		if m[1] != "tenant" {
+			values = append(values, vars[m[1]])
+		}
+	}
+	return strings.Join(values, "/")
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Run removes the entries older than a retention period, every interval. It never returns.
+func Run(st Store, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := st.Purge(time.Now().UTC().Add(-retention)); err != nil {
+			log.Println("Error purging the audit log: " + err.Error())
+		}
+		<-ticker.C
+	}
+}
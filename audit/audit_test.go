@@ -0,0 +1,189 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package audit
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func openTestStore(t *testing.T) Store {
+	database := "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	st, err := Open(db, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func listAll(t *testing.T, st Store, f Filter) []Entry {
+	if f.PerPage == 0 {
+		f.PerPage = 100
+	}
+	var entries []Entry
+	fn := st.List(f)
+	e, err := fn()
+	for ; err == nil; e, err = fn() {
+		entries = append(entries, e)
+	}
+	if err != ErrNotFound {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+type testContent struct {
+	ID       string `json:"id"`
+	Location string `json:"location"`
+	Length   int64  `json:"length"`
+}
+
+func TestHandle(t *testing.T) {
+	st := openTestStore(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/{tenant}/contents/{content_id}", func(w http.ResponseWriter, r *http.Request) {
+		Handle(st, "apikey:0123", mux.Vars(r)["tenant"], w, r, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "PUT":
+				before := testContent{ID: "c1", Location: "a.epub", Length: 10}
+				after := testContent{ID: "c1", Location: "b.epub", Length: 10}
+				Describe(r, "", before, after)
+			case "DELETE":
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+	})
+
+	send := func(method string, requestID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/acme/contents/c1", nil)
+		r.RemoteAddr = "192.0.2.1:4321"
+		if requestID != "" {
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// a read is not recorded
+	if w := send("GET", ""); w.Header().Get(RequestIDHeader) != "" {
+		t.Error("Unexpected request id for a read")
+	}
+	if w := send("PUT", "req-1"); w.Header().Get(RequestIDHeader) != "req-1" {
+		t.Errorf("Expected the request id of the caller, got %q", w.Header().Get(RequestIDHeader))
+	}
+	w := send("DELETE", "")
+	generated := w.Header().Get(RequestIDHeader)
+	if generated == "" {
+		t.Error("Expected a generated request id")
+	}
+
+	entries := listAll(t, st, Filter{})
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	del, put := entries[0], entries[1]
+	if del.Action != "DELETE /{tenant}/contents/{content_id}" || del.Status != http.StatusNotFound || del.RequestID != generated {
+		t.Errorf("Unexpected entry %+v", del)
+	}
+	if put.Principal != "apikey:0123" || put.Tenant != "acme" || put.Target != "c1" || put.SourceIP != "192.0.2.1" ||
+		put.Status != http.StatusOK || put.RequestID != "req-1" {
+		t.Errorf("Unexpected entry %+v", put)
+	}
+	if len(put.Changes) != 1 || put.Changes["location"].Before != "a.epub" || put.Changes["location"].After != "b.epub" {
+		t.Errorf("Unexpected changes %+v", put.Changes)
+	}
+}
+
+func TestDescribeDeletion(t *testing.T) {
+	changes := diff(testContent{ID: "c1", Location: "a.epub"}, nil)
+	if len(changes) != 3 || changes["id"].Before != "c1" || changes["id"].After != nil {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+	var none *testContent
+	if changes = diff(none, testContent{ID: "c1"}); len(changes) != 3 || changes["id"].After != "c1" {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+}
+
+func TestListAndPurge(t *testing.T) {
+	st := openTestStore(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, e := range []Entry{
+		{Time: now.AddDate(0, 0, -40), Principal: "admin", Action: "DELETE /contents/{content_id}", Target: "c1"},
+		{Time: now.AddDate(0, 0, -2), Principal: "admin", Tenant: "acme", Action: "PATCH /licenses/{license_id}", Target: "l1"},
+		{Time: now, Principal: "apikey:0123", Action: "PATCH /licenses/{license_id}", Target: "l2"},
+	} {
+		e.RequestID = "req-" + string(rune('a'+i))
+		if err := st.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := now.AddDate(0, 0, -7)
+	for _, c := range []struct {
+		filter  Filter
+		targets string
+	}{
+		{Filter{}, "l2,l1,c1"},
+		{Filter{Principal: "admin"}, "l1,c1"},
+		{Filter{Tenant: "acme"}, "l1"},
+		{Filter{Action: "PATCH /licenses/{license_id}"}, "l2,l1"},
+		{Filter{Target: "c1"}, "c1"},
+		{Filter{Since: &since}, "l2,l1"},
+		{Filter{Until: &since}, "c1"},
+		{Filter{Page: 1, PerPage: 2}, "c1"},
+	} {
+		var targets string
+		for i, e := range listAll(t, st, c.filter) {
+			if i > 0 {
+				targets += ","
+			}
+			targets += e.Target
+		}
+		if targets != c.targets {
+			t.Errorf("Filter %+v: expected %s, got %s", c.filter, c.targets, targets)
+		}
+	}
+
+	if err := st.Purge(now.AddDate(0, 0, -30)); err != nil {
+		t.Fatal(err)
+	}
+	if entries := listAll(t, st, Filter{}); len(entries) != 2 {
+		t.Errorf("Expected 2 entries after the purge, got %d", len(entries))
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter(httptest.NewRequest("GET", "/audit?principal=admin&since=2026-01-01T00:00:00Z&page=3&per_page=50", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Principal != "admin" || f.Since == nil || f.Since.Year() != 2026 || f.Until != nil || f.Page != 2 || f.PerPage != 50 {
+		t.Errorf("Unexpected filter %+v", f)
+	}
+	for _, query := range []string{"until=yesterday", "page=0", "per_page=5000"} {
+		if _, err := ParseFilter(httptest.NewRequest("GET", "/audit?"+query, nil)); err == nil {
+			t.Errorf("Expected an error for %s", query)
+		}
+	}
+}
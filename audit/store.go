@@ -0,0 +1,203 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrNotFound signals the end of a list of entries
+var ErrNotFound = errors.New("Audit entry not found")
+
+// Filter selects audit entries; empty criteria are ignored
+type Filter struct {
+	Principal string
+	Tenant    string
+	Action    string
+	Target    string
+	Since     *time.Time
+	Until     *time.Time
+	Page      int
+	PerPage   int
+}
+
+// Store is the interface of the audit_log table, to which entries are only appended
+type Store interface {
+	Add(e Entry) error
+	// List lists the entries selected by a filter, most recent first
+	List(f Filter) func() (Entry, error)
+	// Purge removes the entries recorded before a given time
+	Purge(before time.Time) error
+}
+
+type sqlStore struct {
+	db       *sql.DB
+	database string
+}
+
+// Add records an entry; its changes are stored as a json object
+func (s *sqlStore) Add(e Entry) error {
+	var changes sql.NullString
+	if len(e.Changes) > 0 {
+		data, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		changes = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, `INSERT INTO audit_log (created, request_id, principal, tenant, source_ip, action, target, status, changes)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`), e.Time, clip(e.RequestID, 255), clip(e.Principal, 255), e.Tenant, clip(e.SourceIP, 64),
+		clip(e.Action, 255), clip(e.Target, 255), e.Status, changes)
+	return err
+}
+
+// clip truncates a value set by the caller to the size of its column, so that the entry is recorded anyway
+func clip(value string, size int) string {
+	if len(value) > size {
+		return value[:size]
+	}
+	return value
+}
+
+// List lists the entries selected by a filter, most recent first
+func (s *sqlStore) List(f Filter) func() (Entry, error) {
+
+	var where []string
+	var args []interface{}
+	for _, c := range []struct{ column, value string }{
+		{"principal", f.Principal}, {"tenant", f.Tenant}, {"action", f.Action}, {"target", f.Target},
+	} {
+		if c.value != "" {
+			where = append(where, c.column+"=?")
+			args = append(args, c.value)
+		}
+	}
+	if f.Since != nil {
+		where = append(where, "created>=?")
+		args = append(args, f.Since.UTC())
+	}
+	if f.Until != nil {
+		where = append(where, "created<?")
+		args = append(args, f.Until.UTC())
+	}
+
+	query := "SELECT id, created, request_id, principal, tenant, source_ip, action, target, status, changes FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	driver, _ := config.GetDatabase(s.database)
+	if driver == "mssql" {
+		query += " OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+		args = append(args, f.Page*f.PerPage, f.PerPage)
+	} else {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.PerPage, f.Page*f.PerPage)
+	}
+	rows, err := s.db.Query(dbutils.GetParamQuery(s.database, query), args...)
+	if err != nil {
+		return func() (Entry, error) { return Entry{}, err }
+	}
+	return func() (Entry, error) {
+		var e Entry
+		var changes sql.NullString
+		var err error
+		if rows.Next() {
+			err = rows.Scan(&e.ID, &e.Time, &e.RequestID, &e.Principal, &e.Tenant, &e.SourceIP, &e.Action, &e.Target, &e.Status, &changes)
+			if err == nil && changes.String != "" {
+				err = json.Unmarshal([]byte(changes.String), &e.Changes)
+			}
+		} else {
+			rows.Close()
+			err = ErrNotFound
+		}
+		return e, err
+	}
+}
+
+// Purge removes the entries recorded before a given time
+func (s *sqlStore) Purge(before time.Time) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM audit_log WHERE created<?"), before.UTC())
+	return err
+}
+
+// Open creates an audit store in the database of a server,
+// whose connection string is used to adapt the queries to the driver
+func Open(db *sql.DB, database string) (Store, error) {
+
+	driver, _ := config.GetDatabase(database)
+
+	// if sqlite, create the audit_log table if it does not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite audit_log table")
+			return nil, err
+		}
+	}
+	return &sqlStore{db, database}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS audit_log (" +
+	"id INTEGER PRIMARY KEY," +
+	"created datetime NOT NULL," +
+	"request_id varchar(255) NOT NULL," +
+	"principal varchar(255) NOT NULL," +
+	"tenant varchar(64) NOT NULL DEFAULT ''," +
+	"source_ip varchar(64) NOT NULL," +
+	"action varchar(255) NOT NULL," +
+	"target varchar(255) NOT NULL," +
+	"status int NOT NULL," +
+	"changes text DEFAULT NULL);" +
+	"CREATE INDEX IF NOT EXISTS audit_log_created_index ON audit_log (created);" +
+	"CREATE INDEX IF NOT EXISTS audit_log_target_index ON audit_log (target);"
+
+// ParseFilter reads a filter from the parameters of a request:
+// principal, action, target, since and until (RFC 3339 dates), page (from 1) and per_page (default 30, max 1000)
+func ParseFilter(r *http.Request) (Filter, error) {
+	f := Filter{
+		Principal: r.FormValue("principal"),
+		Action:    r.FormValue("action"),
+		Target:    r.FormValue("target"),
+		PerPage:   30,
+	}
+	for _, d := range []struct {
+		name string
+		date **time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := r.FormValue(d.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, errors.New(d.name + " must be formatted as RFC 3339")
+			}
+			*d.date = &t
+		}
+	}
+	if v := r.FormValue("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return f, errors.New("page must be positive integer")
+		}
+		f.Page = page - 1
+	}
+	if v := r.FormValue("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > 1000 {
+			return f, errors.New("per_page must be an integer between 1 and 1000")
+		}
+		f.PerPage = perPage
+	}
+	return f, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package bulk runs the jobs which update the rights of many licenses at once.
+// Jobs are recorded in a rights_job table, then processed in the background one license at a time;
+// a job interrupted by a restart of the server is resumed from its start, as applying rights is idempotent.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/readium/readium-lcp-server/license"
+)
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Selection holds the criteria which select the licenses of a job.
+// The criteria are combined; an explicit list of license ids replaces the other criteria.
+type Selection struct {
+	ContentID  string     `json:"content_id,omitempty"`
+	UserID     string     `json:"user_id,omitempty"`
+	IssuedFrom *time.Time `json:"issued_from,omitempty"`
+	IssuedTo   *time.Time `json:"issued_to,omitempty"`
+	LicenseIDs []string   `json:"license_ids,omitempty"`
+}
+
+// Rights holds the rights applied to the selected licenses; absent rights are unchanged.
+// As in the update of a license, a negative print or copy right, or a zero end date, removes the constraint.
+type Rights struct {
+	Print *int32     `json:"print,omitempty"`
+	Copy  *int32     `json:"copy,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// Job is a bulk update of the rights of licenses, with its progress
+type Job struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"-"`
+	Status    string    `json:"status"`
+	Selection Selection `json:"selection"`
+	Rights    Rights    `json:"rights"`
+	Total     int       `json:"total"`
+	Processed int       `json:"processed"`
+	Failed    int       `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Validate checks that a job selects licenses and changes rights
+func (j Job) Validate() error {
+	s := j.Selection
+	if s.ContentID == "" && s.UserID == "" && s.IssuedFrom == nil && s.IssuedTo == nil && len(s.LicenseIDs) == 0 {
+		return errors.New("at least one selection criterion is required")
+	}
+	if j.Rights.Print == nil && j.Rights.Copy == nil && j.Rights.End == nil {
+		return errors.New("at least one right is required")
+	}
+	return nil
+}
+
+// ApplyFunc applies the rights of a job to a license of a tenant
+type ApplyFunc func(tenant string, licenseID string, rights Rights) error
+
+// Runner records jobs and processes them
+type Runner struct {
+	Store
+	licenses license.Store
+	apply    ApplyFunc
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	running  atomic.Bool
+	// StaleAfter is the delay after which a running job whose progress is not saved is resumed
+	StaleAfter time.Duration
+	// progressEvery is the number of licenses processed between two saves of the progress
+	progressEvery int
+}
+
+// NewRunner creates a job runner, which selects licenses in a license store and applies rights with a function
+func NewRunner(st Store, licenses license.Store, apply ApplyFunc) *Runner {
+	return &Runner{
+		Store:         st,
+		licenses:      licenses,
+		apply:         apply,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		StaleAfter:    10 * time.Minute,
+		progressEvery: 100,
+	}
+}
+
+// Submit records a pending job and wakes up the runner
+func (r *Runner) Submit(j *Job) error {
+	err := r.Add(j)
+	if err == nil {
+		r.Wake()
+	}
+	return err
+}
+
+// Wake triggers the processing of the pending jobs without waiting for the next tick
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes the pending jobs every interval, or when woken up, until the runner is shut down
+func (r *Runner) Run(interval time.Duration) {
+	r.running.Store(true)
+	defer close(r.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Process(); err != nil {
+			log.Println("Error processing the rights jobs: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Shutdown stops the runner, or returns when the context is done. The job being processed
+// is interrupted after the current license and set back to pending, so that it is resumed after the next start.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	if !r.running.Load() {
+		return nil
+	}
+	select {
+	case <-r.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopping tells if the runner is shut down
+func (r *Runner) stopping() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Process runs the jobs which are pending, or stale, until there are none or the runner is shut down
+func (r *Runner) Process() error {
+	for {
+		if r.stopping() {
+			return nil
+		}
+		j, err := r.Claim(time.Now().UTC().Add(-r.StaleAfter))
+		if err != nil || j == nil {
+			return err
+		}
+		if err = r.run(j); err != nil {
+			return err
+		}
+	}
+}
+
+// run processes a claimed job
+func (r *Runner) run(j *Job) error {
+	log.Println("Run the rights job " + j.ID)
+
+	ids, err := r.selectLicenses(j)
+	if err != nil {
+		j.Status, j.LastError = StatusFailed, err.Error()
+		return r.Finish(*j)
+	}
+	j.Total = len(ids)
+	if err = r.Progress(*j); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if r.stopping() {
+			log.Println("Rights job " + j.ID + " interrupted by the shutdown of the server")
+			j.Status = StatusPending
+			return r.Finish(*j)
+		}
+		if err := r.apply(j.Tenant, id, j.Rights); err != nil {
+			j.Failed++
+			j.LastError = id + ": " + err.Error()
+		}
+		j.Processed++
+		if j.Processed%r.progressEvery == 0 {
+			if err = r.Progress(*j); err != nil {
+				return err
+			}
+		}
+	}
+	j.Status = StatusDone
+	log.Printf("Rights job %s done, %d licenses updated, %d failed", j.ID, j.Processed-j.Failed, j.Failed)
+	return r.Finish(*j)
+}
+
+// selectLicenses returns the ids of the licenses selected by a job.
+// The ids are read before any update, so that updated licenses do not move between pages.
+func (r *Runner) selectLicenses(j *Job) ([]string, error) {
+	if len(j.Selection.LicenseIDs) > 0 {
+		return j.Selection.LicenseIDs, nil
+	}
+	licenses := r.licenses
+	if j.Tenant != "" {
+		licenses = licenses.ForTenant(j.Tenant)
+	}
+	f := license.SearchFilter{
+		ContentID:  j.Selection.ContentID,
+		UserID:     j.Selection.UserID,
+		IssuedFrom: j.Selection.IssuedFrom,
+		IssuedTo:   j.Selection.IssuedTo,
+		Sort:       "issued",
+		PerPage:    500,
+	}
+	var ids []string
+	for {
+		_, fn, err := licenses.Search(f)
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		for l, err := fn(); err == nil; l, err = fn() {
+			ids = append(ids, l.ID)
+			count++
+		}
+		if count < f.PerPage {
+			return ids, nil
+		}
+		f.Page++
+	}
+}
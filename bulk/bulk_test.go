@@ -0,0 +1,164 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package bulk
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+)
+
+func openTestStores(t *testing.T) (Store, license.Store) {
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	lst, err := license.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, lst
+}
+
+func TestValidate(t *testing.T) {
+	print := int32(10)
+	if err := (Job{Rights: Rights{Print: &print}}).Validate(); err == nil {
+		t.Error("Expected an error without selection")
+	}
+	if err := (Job{Selection: Selection{ContentID: "c1"}}).Validate(); err == nil {
+		t.Error("Expected an error without rights")
+	}
+	if err := (Job{Selection: Selection{ContentID: "c1"}, Rights: Rights{Print: &print}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	st, lst := openTestStores(t)
+
+	var ids []string
+	for _, contentID := range []string{"c1", "c1", "c2", "c1"} {
+		var l license.License
+		l.User.ID = "u1"
+		license.Initialize(contentID, &l)
+		l.Rights = new(license.UserRights)
+		if err := lst.Add(l); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, l.ID)
+	}
+
+	applied := make(map[string]bool)
+	runner := NewRunner(st, lst, func(tenant string, licenseID string, rights Rights) error {
+		if licenseID == ids[3] {
+			return errors.New("update failed")
+		}
+		applied[licenseID] = true
+		return nil
+	})
+	runner.progressEvery = 1
+
+	end := time.Now().UTC().Truncate(time.Second).AddDate(0, 1, 0)
+	j := Job{Selection: Selection{ContentID: "c1"}, Rights: Rights{End: &end}}
+	if err := runner.Submit(&j); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Process(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := runner.Get(j.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != StatusDone || j.Total != 3 || j.Processed != 3 || j.Failed != 1 || j.LastError == "" {
+		t.Errorf("Unexpected job %+v", j)
+	}
+	if !applied[ids[0]] || !applied[ids[1]] || applied[ids[2]] {
+		t.Errorf("Unexpected updated licenses %v", applied)
+	}
+	if !j.Rights.End.Equal(end) {
+		t.Errorf("Unexpected rights %v", j.Rights.End)
+	}
+
+	// a job is not visible to another tenant
+	if _, err = runner.Get(j.ID, "other"); err != ErrNotFound {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	// there is nothing left to claim
+	if next, err := st.Claim(time.Now().UTC()); err != nil || next != nil {
+		t.Errorf("Unexpected claimed job %v, %v", next, err)
+	}
+}
+
+func TestResumeStaleJob(t *testing.T) {
+	st, _ := openTestStores(t)
+
+	print := int32(5)
+	j := Job{Selection: Selection{LicenseIDs: []string{"l1"}}, Rights: Rights{Print: &print}}
+	if err := st.Add(&j); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := st.Claim(time.Now().UTC().Add(-time.Hour))
+	if err != nil || claimed == nil || claimed.Status != StatusRunning {
+		t.Fatalf("Unexpected claimed job %v, %v", claimed, err)
+	}
+	// a running job is not claimed again while its progress is recent
+	if again, err := st.Claim(time.Now().UTC().Add(-time.Hour)); err != nil || again != nil {
+		t.Errorf("Unexpected claimed job %v, %v", again, err)
+	}
+	// a running job is resumed once stale
+	again, err := st.Claim(time.Now().UTC().Add(time.Hour))
+	if err != nil || again == nil || again.ID != j.ID || again.Processed != 0 {
+		t.Errorf("Unexpected resumed job %v, %v", again, err)
+	}
+}
+
+func TestShutdownJob(t *testing.T) {
+	st, lst := openTestStores(t)
+
+	var applied []string
+	var runner *Runner
+	runner = NewRunner(st, lst, func(tenant string, licenseID string, rights Rights) error {
+		applied = append(applied, licenseID)
+		// the server stops while the job is processed
+		return runner.Shutdown(context.Background())
+	})
+
+	print := int32(5)
+	j := Job{Selection: Selection{LicenseIDs: []string{"l1", "l2", "l3"}}, Rights: Rights{Print: &print}}
+	if err := runner.Submit(&j); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("Expected the job to be interrupted after the first license, got %v", applied)
+	}
+	// the job is resumed after the next start
+	j, err := runner.Get(j.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != StatusPending {
+		t.Errorf("Expected a pending job, got %s", j.Status)
+	}
+}
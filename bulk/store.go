@@ -0,0 +1,171 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package bulk
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrNotFound signals a job not found
+var ErrNotFound = errors.New("Job not found")
+
+// Store is the interface of the rights_job table
+type Store interface {
+	Add(j *Job) error
+	// Get returns a job; a job of another tenant is not found
+	Get(id string, tenant string) (Job, error)
+	// Claim starts a pending job, or resumes a running job whose progress has not been saved since a given time,
+	// e.g. because the server was stopped
+	Claim(staleBefore time.Time) (*Job, error)
+	// Progress saves the progress of a running job
+	Progress(j Job) error
+	// Finish ends a job with its final status
+	Finish(j Job) error
+}
+
+type sqlStore struct {
+	db       *sql.DB
+	database string
+}
+
+const columns = "id, tenant, status, selection, rights, total, processed, failed, last_error, created, updated"
+
+// Add records a pending job and sets its id
+func (s *sqlStore) Add(j *Job) error {
+	selection, err := json.Marshal(j.Selection)
+	if err != nil {
+		return err
+	}
+	rights, err := json.Marshal(j.Rights)
+	if err != nil {
+		return err
+	}
+	uid, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	j.ID, j.Status, j.Created, j.Updated = uid.String(), StatusPending, now, now
+
+	_, err = s.db.Exec(dbutils.GetParamQuery(s.database, `INSERT INTO rights_job (id, tenant, status, selection, rights, total, processed, failed, created, updated)
+	VALUES (?, ?, ?, ?, ?, 0, 0, 0, ?, ?)`), j.ID, j.Tenant, j.Status, string(selection), string(rights), now, now)
+	return err
+}
+
+// Get returns a job of a tenant
+func (s *sqlStore) Get(id string, tenant string) (Job, error) {
+	row := s.db.QueryRow(dbutils.GetParamQuery(s.database, "SELECT "+columns+" FROM rights_job WHERE id=? AND tenant=?"), id, tenant)
+	j, err := scan(row)
+	if err == sql.ErrNoRows {
+		return j, ErrNotFound
+	}
+	return j, err
+}
+
+// Claim selects the oldest job to run and marks it as running, unless another server has claimed it meanwhile
+func (s *sqlStore) Claim(staleBefore time.Time) (*Job, error) {
+
+	query := "SELECT " + columns + " FROM rights_job WHERE status=? OR (status=? AND updated<?) ORDER BY created"
+	driver, _ := config.GetDatabase(s.database)
+	if driver == "mssql" {
+		query += " OFFSET 0 ROWS FETCH NEXT 1 ROWS ONLY"
+	} else {
+		query += " LIMIT 1"
+	}
+	row := s.db.QueryRow(dbutils.GetParamQuery(s.database, query), StatusPending, StatusRunning, staleBefore.UTC())
+	j, err := scan(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := s.db.Exec(dbutils.GetParamQuery(s.database, `UPDATE rights_job SET status=?, processed=0, failed=0, updated=?
+	WHERE id=? AND status=? AND updated=?`), StatusRunning, now, j.ID, j.Status, j.Updated)
+	if err != nil {
+		return nil, err
+	}
+	if r, err := result.RowsAffected(); err != nil || r == 0 {
+		return nil, err
+	}
+	j.Status, j.Processed, j.Failed, j.Updated = StatusRunning, 0, 0, now
+	return &j, nil
+}
+
+// Progress saves the counters of a running job
+func (s *sqlStore) Progress(j Job) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, `UPDATE rights_job SET total=?, processed=?, failed=?, last_error=?, updated=?
+	WHERE id=?`), j.Total, j.Processed, j.Failed, nullString(j.LastError), time.Now().UTC().Truncate(time.Second), j.ID)
+	return err
+}
+
+// Finish saves the final status and counters of a job
+func (s *sqlStore) Finish(j Job) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, `UPDATE rights_job SET status=?, total=?, processed=?, failed=?, last_error=?, updated=?
+	WHERE id=?`), j.Status, j.Total, j.Processed, j.Failed, nullString(j.LastError), time.Now().UTC().Truncate(time.Second), j.ID)
+	return err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// scan reads a job from a row
+func scan(row *sql.Row) (Job, error) {
+	var j Job
+	var selection, rights string
+	var lastErr sql.NullString
+	err := row.Scan(&j.ID, &j.Tenant, &j.Status, &selection, &rights, &j.Total, &j.Processed, &j.Failed, &lastErr, &j.Created, &j.Updated)
+	if err != nil {
+		return j, err
+	}
+	j.LastError = lastErr.String
+	if err = json.Unmarshal([]byte(selection), &j.Selection); err != nil {
+		return j, err
+	}
+	err = json.Unmarshal([]byte(rights), &j.Rights)
+	return j, err
+}
+
+// Open creates a job store in the database of the License Server
+func Open(db *sql.DB, database string) (Store, error) {
+
+	driver, _ := config.GetDatabase(database)
+
+	// if sqlite, create the rights_job table if it does not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite rights_job table")
+			return nil, err
+		}
+	}
+	return &sqlStore{db, database}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS rights_job (" +
+	"id varchar(36) PRIMARY KEY," +
+	"tenant varchar(64) NOT NULL DEFAULT ''," +
+	"status varchar(16) NOT NULL," +
+	"selection text NOT NULL," +
+	"rights text NOT NULL," +
+	"total int NOT NULL DEFAULT 0," +
+	"processed int NOT NULL DEFAULT 0," +
+	"failed int NOT NULL DEFAULT 0," +
+	"last_error text DEFAULT NULL," +
+	"created datetime NOT NULL," +
+	"updated datetime NOT NULL);" +
+	"CREATE INDEX IF NOT EXISTS rights_job_status_index ON rights_job (status);"
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -23,12 +24,16 @@ type Configuration struct {
 	LsdNotifyAuth  Auth               `yaml:"lsd_notify_auth"`
 	LcpUpdateAuth  Auth               `yaml:"lcp_update_auth"`
 	CMSAccessAuth  Auth               `yaml:"cms_access_auth"`
+	ClientTLS      ClientTLS          `yaml:"client_tls,omitempty"`
 	LicenseStatus  LicenseStatus      `yaml:"license_status"`
 	Localization   Localization       `yaml:"localization"`
 	Logging        Logging            `yaml:"logging"`
 	TestMode       bool               `yaml:"test_mode"`
 	GoofyMode      bool               `yaml:"goofy_mode"`
 	Profile        string             `yaml:"profile,omitempty"`
+	// external user key transforms, by profile URL
+	UserKeyTransforms map[string]UserKeyTransform `yaml:"user_key_transforms,omitempty"`
+	Tenants           []Tenant                    `yaml:"tenants,omitempty"`
 
 	// DISABLED, see https://github.com/readium/readium-lcp-server/issues/109
 	//AES256_CBC_OR_GCM string             `yaml:"aes256_cbc_or_gcm,omitempty"`
@@ -43,12 +48,61 @@ type ServerInfo struct {
 	Database      string `yaml:"database,omitempty"`
 	CertDate      string `yaml:"cert_date,omitempty"`
 	Resources     string `yaml:"resources,omitempty"`
+	// number of days the audit entries are kept, forever if 0
+	AuditRetentionDays int `yaml:"audit_retention_days,omitempty"`
+	// number of seconds given to the requests and background tasks to finish when the server stops
+	ShutdownTimeout int `yaml:"shutdown_timeout,omitempty"`
+	// https listener, plain http if not set
+	TLS ServerTLS `yaml:"tls,omitempty"`
+	// hex encoded 256 bit key which encrypts the passphrase hashes stored with the licenses;
+	// the passphrase hashes are not stored if not set
+	UserKeySecret string `yaml:"user_key_secret,omitempty"`
+}
+
+// scheme returns the scheme of the urls of a server
+func (si ServerInfo) scheme() string {
+	if si.TLS.Cert != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// ShutdownDelay returns the time given to the server to stop gracefully, 30 seconds by default
+func (si ServerInfo) ShutdownDelay() time.Duration {
+	if si.ShutdownTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(si.ShutdownTimeout) * time.Second
 }
 
 type LsdServerInfo struct {
 	ServerInfo     `yaml:",inline"`
-	LicenseLinkUrl string `yaml:"license_link_url,omitempty"`
-	UserDataUrl    string `yaml:"user_data_url,omitempty"`
+	LicenseLinkUrl string    `yaml:"license_link_url,omitempty"`
+	UserDataUrl    string    `yaml:"user_data_url,omitempty"`
+	RateLimit      RateLimit `yaml:"rate_limit,omitempty"`
+}
+
+// RateLimit defines the limits of the public routes of the Status Server, by client ip and by license
+type RateLimit struct {
+	// memory (default), or database to share the limits between replicas
+	Store string `yaml:"store,omitempty"`
+	// the client ip is read from the X-Forwarded-For header set by a trusted reverse proxy
+	TrustProxy bool `yaml:"trust_proxy,omitempty"`
+	// limits by route: status, license, register, return or renew
+	Routes map[string]RouteRateLimit `yaml:"routes,omitempty"`
+}
+
+// RouteRateLimit defines the budgets of a route, for each client ip and for each license
+type RouteRateLimit struct {
+	PerIP      Bucket `yaml:"per_ip,omitempty"`
+	PerLicense Bucket `yaml:"per_license,omitempty"`
+}
+
+// Bucket is a token bucket: each request takes a token, tokens are refilled at a rate per minute
+// and up to a burst. A zero rate means no limit.
+type Bucket struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
 }
 
 type FrontendServerInfo struct {
@@ -57,15 +111,49 @@ type FrontendServerInfo struct {
 	ProviderUri         string `yaml:"provider_uri"`
 	RightPrint          int32  `yaml:"right_print"`
 	RightCopy           int32  `yaml:"right_copy"`
+	RightsPolicy        string `yaml:"rights_policy,omitempty"`
 	MasterRepository    string `yaml:"master_repository"`
 	EncryptedRepository string `yaml:"encrypted_repository"`
 }
 
+// Tenant defines a publisher served by a shared License Server,
+// with its own provider uri, signing certificate, default links, storage prefix and credentials
+type Tenant struct {
+	Name          string            `yaml:"name"`
+	Provider      string            `yaml:"provider"`
+	Certificate   Certificate       `yaml:"certificate"`
+	Links         map[string]string `yaml:"links,omitempty"`
+	StoragePrefix string            `yaml:"storage_prefix,omitempty"`
+	AuthFile      string            `yaml:"auth_file"`
+}
+
 type Auth struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 }
 
+// ServerTLS defines the https listener of a server and the authentication of the callers of its private routes
+// by a client certificate
+type ServerTLS struct {
+	// paths to the PEM encoded certificate and private key of the server
+	Cert       string `yaml:"cert,omitempty"`
+	PrivateKey string `yaml:"private_key,omitempty"`
+	// path to a bundle of PEM encoded CA certificates; a client certificate issued by one of them
+	// authenticates the caller of a private route, as an alternative to basic auth
+	ClientCA string `yaml:"client_ca,omitempty"`
+	// common names of the accepted client certificates; any certificate issued by the CAs if empty
+	ClientNames []string `yaml:"client_names,omitempty"`
+}
+
+// ClientTLS defines the certificate presented by a server when it calls another server,
+// and the CAs which verify the certificates of the other servers
+type ClientTLS struct {
+	Cert       string `yaml:"cert,omitempty"`
+	PrivateKey string `yaml:"private_key,omitempty"`
+	// path to a bundle of PEM encoded CA certificates; the system roots if not set
+	CA string `yaml:"ca,omitempty"`
+}
+
 type Certificate struct {
 	Cert       string `yaml:"cert"`
 	PrivateKey string `yaml:"private_key"`
@@ -77,16 +165,18 @@ type FileSystem struct {
 }
 
 type Storage struct {
-	FileSystem FileSystem `yaml:"filesystem"`
-	AccessId   string     `yaml:"access_id"`
-	DisableSSL bool       `yaml:"disable_ssl"`
-	PathStyle  bool       `yaml:"path_style"`
-	Mode       string     `yaml:"mode"`
-	Secret     string     `yaml:"secret"`
-	Endpoint   string     `yaml:"endpoint"`
-	Bucket     string     `yaml:"bucket"`
-	Region     string     `yaml:"region"`
-	Token      string     `yaml:"token"`
+	FileSystem  FileSystem `yaml:"filesystem"`
+	AccessId    string     `yaml:"access_id"`
+	DisableSSL  bool       `yaml:"disable_ssl"`
+	PathStyle   bool       `yaml:"path_style"`
+	Mode        string     `yaml:"mode"`
+	Secret      string     `yaml:"secret"`
+	Endpoint    string     `yaml:"endpoint"`
+	Bucket      string     `yaml:"bucket"`
+	Region      string     `yaml:"region"`
+	Token       string     `yaml:"token"`
+	PartSize    int64      `yaml:"part_size"`
+	Concurrency int        `yaml:"concurrency"`
 }
 
 type License struct {
@@ -103,6 +193,53 @@ type LicenseStatus struct {
 	RenewCustomUrl string `yaml:"renew_custom_url,omitempty"`
 	RenewExpired   bool   `yaml:"renew_expired"`
 	RenewFromNow   bool   `yaml:"renew_from_now"`
+	// named loan policies, attached to license statuses when they are created
+	Policies map[string]LoanPolicy `yaml:"policies,omitempty"`
+}
+
+// LoanPolicy defines the renewal and return rules of a loan
+type LoanPolicy struct {
+	Name string `yaml:"-" json:"name,omitempty"`
+	// maximum total duration of a loan in days, from the license issue date
+	MaxDays int  `yaml:"max_days" json:"max_days"`
+	Renew   bool `yaml:"renew" json:"renew"`
+	// number of additional days of a renewal
+	RenewDays int `yaml:"renew_days" json:"renew_days"`
+	// maximum number of renewals, 0 if unlimited
+	MaxRenewals  int  `yaml:"max_renewals" json:"max_renewals"`
+	RenewExpired bool `yaml:"renew_expired" json:"renew_expired"`
+	RenewFromNow bool `yaml:"renew_from_now" json:"renew_from_now"`
+	Return       bool `yaml:"return" json:"return"`
+}
+
+// DefaultLoanPolicy is the loan policy defined by the global license status settings
+func (ls LicenseStatus) DefaultLoanPolicy() LoanPolicy {
+	return LoanPolicy{
+		MaxDays:      ls.RentingDays,
+		Renew:        ls.Renew,
+		RenewDays:    ls.RenewDays,
+		RenewExpired: ls.RenewExpired,
+		RenewFromNow: ls.RenewFromNow,
+		Return:       ls.Return,
+	}
+}
+
+// GetLoanPolicy returns a named loan policy; the default policy is returned if the name is empty
+func (ls LicenseStatus) GetLoanPolicy(name string) (LoanPolicy, bool) {
+	if name == "" {
+		return ls.DefaultLoanPolicy(), true
+	}
+	p, ok := ls.Policies[name]
+	p.Name = name
+	return p, ok
+}
+
+// UserKeyTransform is an external process which derives user keys for a production profile
+type UserKeyTransform struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	// maximum duration of a transform, in seconds
+	Timeout int `yaml:"timeout,omitempty"`
 }
 
 type Localization struct {
@@ -192,15 +329,15 @@ func SetPublicUrls() error {
 	}
 
 	if lcpPublicBaseUrl = Config.LcpServer.PublicBaseUrl; lcpPublicBaseUrl == "" {
-		lcpPublicBaseUrl = "http://" + lcpHost + ":" + strconv.Itoa(lcpPort)
+		lcpPublicBaseUrl = Config.LcpServer.scheme() + "://" + lcpHost + ":" + strconv.Itoa(lcpPort)
 		Config.LcpServer.PublicBaseUrl = lcpPublicBaseUrl
 	}
 	if lsdPublicBaseUrl = Config.LsdServer.PublicBaseUrl; lsdPublicBaseUrl == "" {
-		lsdPublicBaseUrl = "http://" + lsdHost + ":" + strconv.Itoa(lsdPort)
+		lsdPublicBaseUrl = Config.LsdServer.scheme() + "://" + lsdHost + ":" + strconv.Itoa(lsdPort)
 		Config.LsdServer.PublicBaseUrl = lsdPublicBaseUrl
 	}
 	if frontendPublicBaseUrl = Config.FrontendServer.PublicBaseUrl; frontendPublicBaseUrl == "" {
-		frontendPublicBaseUrl = "http://" + frontendHost + ":" + strconv.Itoa(frontendPort)
+		frontendPublicBaseUrl = Config.FrontendServer.scheme() + "://" + frontendHost + ":" + strconv.Itoa(frontendPort)
 		Config.FrontendServer.PublicBaseUrl = frontendPublicBaseUrl
 	}
 
@@ -7,6 +7,9 @@ CREATE TABLE license_status (
   potential_rights_end timestamp(3) DEFAULT NULL,
   license_ref varchar(255) NOT NULL,
   rights_end timestamp(3) DEFAULT NULL,
+  version int NOT NULL DEFAULT 0,
+  loan_policy text DEFAULT NULL,
+  renew_count int NOT NULL DEFAULT 0,
   CONSTRAINT license_status_pkey PRIMARY KEY (id)
 );
 
@@ -19,8 +22,87 @@ CREATE TABLE event (
 	type int NOT NULL,
 	device_id varchar(255) DEFAULT NULL,
 	license_status_fk int NOT NULL,
+	reason varchar(255) DEFAULT NULL,
+	related_license varchar(255) DEFAULT NULL,
   CONSTRAINT event_pkey PRIMARY KEY (id),
   FOREIGN KEY(license_status_fk) REFERENCES license_status(id)
 );
 
-CREATE INDEX license_status_fk_index on event (license_status_fk);
\ No newline at end of file
+CREATE INDEX license_status_fk_index on event (license_status_fk);
+
+CREATE TABLE outbox (
+  id serial4 NOT NULL,
+  method varchar(16) NOT NULL,
+  url text NOT NULL,
+  content_type varchar(255) NOT NULL,
+  body text NOT NULL,
+  ref varchar(255) NOT NULL,
+  status varchar(16) NOT NULL,
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt timestamp(3) NOT NULL,
+  last_error text DEFAULT NULL,
+  created timestamp(3) NOT NULL,
+  CONSTRAINT outbox_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX outbox_status_index ON outbox (status, next_attempt);
+
+CREATE TABLE odl_license (
+  id varchar(255) NOT NULL,
+  content_id varchar(255) NOT NULL,
+  checkouts int DEFAULT NULL,
+  concurrency int NOT NULL,
+  expires timestamp(3) DEFAULT NULL,
+  length int NOT NULL DEFAULT 0,
+  checkouts_left int DEFAULT NULL,
+  created timestamp(3) NOT NULL,
+  version int NOT NULL DEFAULT 0,
+  CONSTRAINT odl_license_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE odl_checkout (
+  odl_license_id varchar(255) NOT NULL,
+  id varchar(255) NOT NULL,
+  patron_id varchar(255) NOT NULL,
+  license_ref varchar(255) NOT NULL DEFAULT '',
+  loan_end timestamp(3) NOT NULL,
+  created timestamp(3) NOT NULL,
+  CONSTRAINT odl_checkout_pkey PRIMARY KEY (odl_license_id, id)
+);
+
+CREATE INDEX odl_checkout_license_ref_index ON odl_checkout (license_ref);
+
+CREATE TABLE rate_limit (
+  bucket varchar(255) PRIMARY KEY NOT NULL,
+  tokens bigint NOT NULL,
+  updated bigint NOT NULL,
+  full_at bigint NOT NULL
+);
+
+CREATE INDEX rate_limit_full_index ON rate_limit (full_at);
+
+CREATE TABLE api_key (
+  id varchar(16) PRIMARY KEY NOT NULL,
+  name varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  scopes varchar(255) NOT NULL,
+  hash varchar(64) NOT NULL,
+  created timestamp(3) NOT NULL
+);
+
+CREATE TABLE audit_log (
+  id serial4 NOT NULL,
+  created timestamp(3) NOT NULL,
+  request_id varchar(255) NOT NULL,
+  principal varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  source_ip varchar(64) NOT NULL,
+  action varchar(255) NOT NULL,
+  target varchar(255) NOT NULL,
+  status int NOT NULL,
+  changes text DEFAULT NULL,
+  CONSTRAINT audit_log_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX audit_log_created_index ON audit_log (created);
+CREATE INDEX audit_log_target_index ON audit_log (target);
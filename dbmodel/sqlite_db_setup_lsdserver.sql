@@ -6,7 +6,10 @@ CREATE TABLE license_status (
   device_count int DEFAULT NULL,
   potential_rights_end datetime DEFAULT NULL,
   license_ref varchar(255) NOT NULL,
-  rights_end datetime DEFAULT NULL 
+  rights_end datetime DEFAULT NULL,
+  version int NOT NULL DEFAULT 0,
+  loan_policy text DEFAULT NULL,
+  renew_count int NOT NULL DEFAULT 0
 );
 
 CREATE INDEX license_ref_index ON license_status (license_ref);
@@ -18,7 +21,83 @@ CREATE TABLE event (
 	type int NOT NULL,
 	device_id varchar(255) DEFAULT NULL,
 	license_status_fk int NOT NULL,
+	reason varchar(255) DEFAULT NULL,
+	related_license varchar(255) DEFAULT NULL,
   FOREIGN KEY(license_status_fk) REFERENCES license_status(id)
 );
 
-CREATE INDEX license_status_fk_index on event (license_status_fk);
\ No newline at end of file
+CREATE INDEX license_status_fk_index on event (license_status_fk);
+
+CREATE TABLE outbox (
+  id INTEGER PRIMARY KEY,
+  method varchar(16) NOT NULL,
+  url text NOT NULL,
+  content_type varchar(255) NOT NULL,
+  body text NOT NULL,
+  ref varchar(255) NOT NULL,
+  status varchar(16) NOT NULL,
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt datetime NOT NULL,
+  last_error text DEFAULT NULL,
+  created datetime NOT NULL
+);
+
+CREATE INDEX outbox_status_index ON outbox (status, next_attempt);
+
+CREATE TABLE odl_license (
+  id varchar(255) PRIMARY KEY,
+  content_id varchar(255) NOT NULL,
+  checkouts int DEFAULT NULL,
+  concurrency int NOT NULL,
+  expires datetime DEFAULT NULL,
+  length int NOT NULL DEFAULT 0,
+  checkouts_left int DEFAULT NULL,
+  created datetime NOT NULL,
+  version int NOT NULL DEFAULT 0
+);
+
+CREATE TABLE odl_checkout (
+  odl_license_id varchar(255) NOT NULL,
+  id varchar(255) NOT NULL,
+  patron_id varchar(255) NOT NULL,
+  license_ref varchar(255) NOT NULL DEFAULT '',
+  loan_end datetime NOT NULL,
+  created datetime NOT NULL,
+  PRIMARY KEY (odl_license_id, id)
+);
+
+CREATE INDEX odl_checkout_license_ref_index ON odl_checkout (license_ref);
+
+CREATE TABLE rate_limit (
+  bucket varchar(255) PRIMARY KEY NOT NULL,
+  tokens bigint NOT NULL,
+  updated bigint NOT NULL,
+  full_at bigint NOT NULL
+);
+
+CREATE INDEX rate_limit_full_index ON rate_limit (full_at);
+
+CREATE TABLE api_key (
+  id varchar(16) PRIMARY KEY NOT NULL,
+  name varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  scopes varchar(255) NOT NULL,
+  hash varchar(64) NOT NULL,
+  created datetime NOT NULL
+);
+
+CREATE TABLE audit_log (
+  id INTEGER PRIMARY KEY,
+  created datetime NOT NULL,
+  request_id varchar(255) NOT NULL,
+  principal varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  source_ip varchar(64) NOT NULL,
+  action varchar(255) NOT NULL,
+  target varchar(255) NOT NULL,
+  status int NOT NULL,
+  changes text DEFAULT NULL
+);
+
+CREATE INDEX audit_log_created_index ON audit_log (created);
+CREATE INDEX audit_log_target_index ON audit_log (target);
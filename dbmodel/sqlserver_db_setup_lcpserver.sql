@@ -4,7 +4,9 @@ CREATE TABLE content (
     location text NOT NULL,
     length bigint,
     sha256 varchar(64),
-    type varchar(255)
+    type varchar(255),
+    metadata text,
+    tenant varchar(255) NOT NULL DEFAULT ''
 );
 
 CREATE TABLE license (
@@ -19,5 +21,93 @@ CREATE TABLE license (
     rights_end datetime DEFAULT NULL,
     content_fk varchar(255) NOT NULL,
     lsd_status tinyint default 0,
+    tenant varchar(255) NOT NULL DEFAULT '',
+    user_email varchar(255) DEFAULT NULL,
+    user_key_hint varchar(255) DEFAULT NULL,
+    user_key_value varchar(128) DEFAULT NULL,
     FOREIGN KEY(content_fk) REFERENCES content(id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE rights_policy (
+    name varchar(64) PRIMARY KEY NOT NULL,
+    description text DEFAULT NULL,
+    rights_print int DEFAULT NULL,
+    rights_copy int DEFAULT NULL,
+    rights_start datetime DEFAULT NULL,
+    rights_end datetime DEFAULT NULL,
+    duration varchar(64) DEFAULT NULL,
+    updated datetime NOT NULL
+);
+
+CREATE TABLE tenant (
+    name varchar(64) PRIMARY KEY NOT NULL,
+    provider varchar(255) NOT NULL,
+    cert text NOT NULL,
+    private_key text NOT NULL,
+    links text DEFAULT NULL,
+    storage_prefix varchar(255) DEFAULT NULL,
+    auth_file text NOT NULL
+);
+
+CREATE TABLE outbox (
+  id integer IDENTITY PRIMARY KEY,
+  method varchar(16) NOT NULL,
+  url text NOT NULL,
+  content_type varchar(255) NOT NULL,
+  body nvarchar(max) NOT NULL,
+  ref varchar(255) NOT NULL,
+  status varchar(16) NOT NULL,
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt datetime NOT NULL,
+  last_error text DEFAULT NULL,
+  created datetime NOT NULL
+);
+
+CREATE TABLE rights_job (
+  id varchar(36) PRIMARY KEY NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  status varchar(16) NOT NULL,
+  selection nvarchar(max) NOT NULL,
+  rights nvarchar(max) NOT NULL,
+  total int NOT NULL DEFAULT 0,
+  processed int NOT NULL DEFAULT 0,
+  failed int NOT NULL DEFAULT 0,
+  last_error text DEFAULT NULL,
+  created datetime NOT NULL,
+  updated datetime NOT NULL
+);
+
+CREATE INDEX license_user_id_index ON license (user_id);
+CREATE INDEX license_user_email_index ON license (user_email);
+CREATE INDEX license_provider_index ON license (provider);
+CREATE INDEX license_content_fk_index ON license (content_fk);
+CREATE INDEX license_issued_index ON license (issued);
+CREATE INDEX license_rights_end_index ON license (rights_end);
+CREATE INDEX license_updated_index ON license (updated);
+CREATE INDEX outbox_status_index ON outbox (status, next_attempt);
+CREATE INDEX rights_job_status_index ON rights_job (status);
+
+CREATE TABLE api_key (
+  id varchar(16) PRIMARY KEY NOT NULL,
+  name varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  scopes varchar(255) NOT NULL,
+  hash varchar(64) NOT NULL,
+  created datetime NOT NULL
+);
+
+CREATE TABLE audit_log (
+  id integer IDENTITY PRIMARY KEY,
+  created datetime NOT NULL,
+  request_id varchar(255) NOT NULL,
+  principal varchar(255) NOT NULL,
+  tenant varchar(64) NOT NULL DEFAULT '',
+  source_ip varchar(64) NOT NULL,
+  action varchar(255) NOT NULL,
+  target varchar(255) NOT NULL,
+  status int NOT NULL,
+  changes text DEFAULT NULL
+);
+
+CREATE INDEX audit_log_created_index ON audit_log (created);
+CREATE INDEX audit_log_target_index ON audit_log (target);
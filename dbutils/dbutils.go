@@ -2,6 +2,7 @@ package dbutils
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"strings"
 )
@@ -29,3 +30,21 @@ func GetParamQuery(database, query string) string {
 		return query
 	}
 }
+
+// AddColumn adds a column to an existing table if it is not already present.
+// This is used to upgrade databases created by a previous version of the servers.
+// The definition is the type and constraints of the column, e.g. "integer DEFAULT 0".
+func AddColumn(db *sql.DB, database, table, column, definition string) error {
+	// the query fails if the column does not exist
+	rows, err := db.Query("SELECT " + column + " FROM " + table + " WHERE 1=0")
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+	add := " ADD COLUMN "
+	if strings.HasPrefix(database, "mssql") {
+		add = " ADD "
+	}
+	_, err = db.Exec("ALTER TABLE " + table + add + column + " " + definition)
+	return err
+}
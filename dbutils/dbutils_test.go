@@ -1,6 +1,11 @@
 package dbutils
 
-import "testing"
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
 
 const demo_query = "SELECT * FROM test WHERE id = ? AND test = ? LIMIT 1"
 
@@ -15,3 +20,27 @@ func TestGetParamQuery(t *testing.T) {
 		t.Fatalf("Incorrect sqlite3 query")
 	}
 }
+
+func TestAddColumn(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec("CREATE TABLE test (id varchar(255) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO test (id) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+	// the second call must be a no-op
+	for i := 0; i < 2; i++ {
+		if err = AddColumn(db, "sqlite3://:memory:", "test", "tenant", "varchar(255) NOT NULL DEFAULT ''"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tenant string
+	if err = db.QueryRow("SELECT tenant FROM test WHERE id='a'").Scan(&tenant); err != nil || tenant != "" {
+		t.Fatalf("Unexpected tenant column %q, %v", tenant, err)
+	}
+}
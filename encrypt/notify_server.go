@@ -16,6 +16,7 @@ import (
 	"time"
 
 	apilcp "github.com/readium/readium-lcp-server/lcpserver/api"
+	"github.com/readium/readium-lcp-server/rwpm"
 )
 
 // LCPServerMsgV2 is used for notifying an LCP Server V2
@@ -55,6 +56,10 @@ type CMSMsg struct {
 	Publisher     []Entity `json:"publisher,omitempty"`
 	Author        []Entity `json:"author,omitempty"`
 	Category      []Entity `json:"category,omitempty"`
+	Duration      float32  `json:"duration,omitempty"`
+	Identifiers   []string `json:"identifiers,omitempty"`
+	// full metadata, in the Readium Web Publication Manifest format
+	Metadata *rwpm.Metadata `json:"metadata,omitempty"`
 }
 
 // NotifyLCPServer notifies the License Server of the encryption of a publication.
@@ -111,6 +116,12 @@ func NotifyLCPServer(pub Publication, update bool, prov, lcpsv string, v2 bool,
 		msg.ContentType = pub.ContentType
 		msg.Size = int64(pub.Size)
 		msg.Checksum = pub.Checksum
+		if pub.Metadata != nil {
+			msg.Metadata, err = json.Marshal(pub.Metadata)
+			if err != nil {
+				return err
+			}
+		}
 
 		jsonBody, err = json.Marshal(msg)
 		if err != nil {
@@ -257,6 +268,9 @@ func NotifyCMS(pub Publication, notifyURL string, verbose bool) error {
 	msg.DatePublished = pub.Date
 	msg.Description = pub.Description
 	msg.CoverUrl = pub.CoverUrl
+	msg.Duration = pub.Duration
+	msg.Identifiers = pub.Identifiers
+	msg.Metadata = pub.Metadata
 	var lg Coded
 	for _, v := range pub.Language {
 		lg.Code = v
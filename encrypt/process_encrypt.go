@@ -6,6 +6,7 @@ package encrypt
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -19,8 +20,10 @@ import (
 
 	"github.com/readium/readium-lcp-server/crypto"
 	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/epub/opf"
 	apilcp "github.com/readium/readium-lcp-server/lcpserver/api"
 	"github.com/readium/readium-lcp-server/pack"
+	"github.com/readium/readium-lcp-server/rwpm"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -47,11 +50,15 @@ type Publication struct {
 	ContentType   string
 	Size          uint32
 	Checksum      string
+	Duration      float32
+	Identifiers   []string
+	Metadata      *rwpm.Metadata
+	ThumbnailSize int
 }
 
 // ProcessEncryption encrypts a publication
 // inputPath must contain a processable file extension.
-func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, storageRepo, storageURL, storageFilename string, extractCover, pdfNoMeta bool, s3opts S3Options) (*Publication, error) {
+func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, storageRepo, storageURL, storageFilename string, extractCover, pdfNoMeta bool, thumbnailSize int, s3opts S3Options) (*Publication, error) {
 
 	if inputPath == "" {
 		return nil, errors.New("ProcessEncryption, missing input path")
@@ -61,6 +68,7 @@ func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, s
 	var pub Publication
 	pub.OutputRepo = outputRepo
 	pub.ExtractCover = extractCover
+	pub.ThumbnailSize = thumbnailSize
 	pub.InputPath = inputPath
 
 	// if contentID is not set, generate a random UUID
@@ -84,6 +92,25 @@ func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, s
 		tempRepo, _ = os.Getwd()
 	}
 
+	// a publication encrypted by an interrupted run is stored without being encrypted again
+	if s3opts.Resume && strings.HasPrefix(storageRepo, "s3:") {
+		prev, err := loadResumeJournal(tempRepo, contentID, contentKey)
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("The publication is encrypted again:", err.Error())
+		}
+		if err == nil {
+			log.Println("Resume the storage of", prev.FileName)
+			err = storePublicationOnS3(prev, tempRepo, storageRepo, storageURL, s3opts)
+			if err != nil {
+				return nil, err
+			}
+			if prev.ExtractCover && prev.CoverName != "" {
+				prev.CoverUrl, _ = url.JoinPath(storageURL, prev.CoverName)
+			}
+			return prev, nil
+		}
+	}
+
 	// if the input file is stored on a remote server, fetch it and store it into a temp folder
 	tempPath, err := fetchInputFile(inputPath, tempRepo, contentID)
 	if err != nil {
@@ -137,7 +164,10 @@ func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, s
 	}
 
 	// select the encryption process from the input file extension
-	inputExt := filepath.Ext(inputPath)
+	inputExt, err := inputExtension(inputPath)
+	if err != nil {
+		return nil, err
+	}
 	switch inputExt {
 	case ".epub":
 		err = processEPUB(&pub, encrypter, contentKey)
@@ -147,6 +177,12 @@ func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, s
 		err = processLPF(&pub, encrypter, contentKey)
 	case ".audiobook", ".divina", ".webpub", ".rpf":
 		err = processRPF(&pub, encrypter, contentKey)
+	case ".zip":
+		err = processAudioTracks(&pub, encrypter, contentKey)
+	case ".cbz":
+		err = processCBZ(&pub, encrypter, contentKey)
+	case ".json":
+		err = processDivinaManifest(&pub, encrypter, contentKey)
 	default:
 		return nil, errors.New("unprocessable extension " + inputExt)
 	}
@@ -182,23 +218,7 @@ func ProcessEncryption(contentID, contentKey, inputPath, tempRepo, outputRepo, s
 	case apilcp.Storage_s3:
 		// the encryption tool stores the encrypted publication in an S3 storage
 		// and delete the temp file
-		fromPath := filepath.Join(pub.OutputRepo, pub.FileName)
-		err = StoreFileOnS3(fromPath, storageRepo, pub.FileName, s3opts)
-		if err != nil {
-			return nil, err
-		}
-		// if a cover was extracted (pub.CoverName not empty), store it in S3 too
-		// and delete the cover
-		if pub.ExtractCover && pub.CoverName != "" {
-			fromPath := filepath.Join(pub.OutputRepo, pub.CoverName)
-			err = StoreFileOnS3(fromPath, storageRepo, pub.CoverName, s3opts)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		// location indicates the url of the publication on S3
-		pub.Location, err = url.JoinPath(storageURL, pub.FileName)
+		err = storePublicationOnS3(&pub, tempRepo, storageRepo, storageURL, s3opts)
 		if err != nil {
 			return nil, err
 		}
@@ -267,8 +287,12 @@ func fetchInputFile(inputPath, tempRepo, contentID string) (string, error) {
 // which will be used during future downloads
 func setTargetFileInfo(pub *Publication, storageFilename string) error {
 
+	inputExt, err := inputExtension(pub.InputPath)
+	if err != nil {
+		return err
+	}
 	var targetExt string
-	switch filepath.Ext(pub.InputPath) {
+	switch inputExt {
 	case ".epub":
 		targetExt = ".epub"
 		// epub is a special case, as the content type does not change for encrypted files
@@ -276,10 +300,10 @@ func setTargetFileInfo(pub *Publication, storageFilename string) error {
 	case ".pdf":
 		targetExt = ".lcpdf"
 		pub.ContentType = "application/pdf+lcp"
-	case ".audiobook":
+	case ".audiobook", ".zip":
 		targetExt = ".lcpa"
 		pub.ContentType = "application/audiobook+lcp"
-	case ".divina":
+	case ".divina", ".cbz", ".json":
 		targetExt = ".lcpdi"
 		pub.ContentType = "application/divina+lcp"
 	case ".webpub", ".rpf", ".lpf":
@@ -287,7 +311,7 @@ func setTargetFileInfo(pub *Publication, storageFilename string) error {
 		// Temporary value. The conformsTo property of the manifest will be checked later
 		pub.ContentType = "application/webpub+lcp"
 	default:
-		return errors.New("unprocessable extension " + filepath.Ext(pub.InputPath))
+		return errors.New("unprocessable extension " + inputExt)
 	}
 
 	// if the storage filename is imposed, use it
@@ -305,6 +329,32 @@ func setTargetFileInfo(pub *Publication, storageFilename string) error {
 	return nil
 }
 
+// inputExtension returns the extension of the input file.
+// A folder or a zip is processed from its content: as audio tracks if it holds audio tracks and no manifest,
+// as a Readium package (a zip) or a standalone manifest (a folder) if it holds a manifest;
+// it cannot be processed otherwise. A json file is a standalone Divina manifest.
+func inputExtension(inputPath string) (string, error) {
+	ext := filepath.Ext(inputPath)
+	info, err := os.Stat(inputPath)
+	if err != nil || !info.IsDir() && ext != ".zip" {
+		return ext, nil
+	}
+	content, err := pack.InspectZip(inputPath)
+	if err != nil {
+		return "", err
+	}
+	switch content {
+	case pack.ZipAudioTracks:
+		return ".zip", nil
+	case pack.ZipPackage:
+		if info.IsDir() {
+			return ".json", nil
+		}
+		return ".rpf", nil
+	}
+	return "", errors.New(inputPath + " holds neither audio tracks nor a manifest")
+}
+
 // checksum calculates the checksum of a file
 func checksum(file *os.File) string {
 
@@ -335,13 +385,21 @@ func processEPUB(pub *Publication, encrypter crypto.Encrypter, contentKey string
 	}
 
 	// set publication metadata
-	pub.Title = epub.Package[0].Metadata.Title[0]
-	pub.Date = epub.Package[0].Metadata.Date
-	pub.Description = epub.Package[0].Metadata.Description
-	pub.Language = epub.Package[0].Metadata.Language
-	pub.Publisher = epub.Package[0].Metadata.Publisher
-	pub.Author = epub.Package[0].Metadata.Author
-	pub.Subject = epub.Package[0].Metadata.Subject
+	opfMetadata := epub.Package[0].Metadata
+	metadata := pack.EPUBMetadata(epub.Package[0])
+	pub.Metadata = &metadata
+	pub.Identifiers = opf.Values(opfMetadata.Identifier)
+	pub.Title = metadata.Title.Text()
+	if metadata.Published != nil {
+		pub.Date = metadata.Published.String()
+	}
+	pub.Description = metadata.Description
+	pub.Language = metadata.Language
+	pub.Publisher = opfMetadata.Publisher
+	for _, author := range metadata.Author {
+		pub.Author = append(pub.Author, author.Name.Text())
+	}
+	pub.Subject = opf.Values(opfMetadata.Subject)
 
 	// create the output file
 	outputFile, err := os.Create(filepath.Join(pub.OutputRepo, pub.FileName))
@@ -370,44 +428,23 @@ func processEPUB(pub *Publication, encrypter crypto.Encrypter, contentKey string
 		return errors.New("empty output file")
 	}
 
-	// look for the cover image, in case its extraction is requested
-	var coverImageID string
-	var coverPath string
+	// extract the cover image if requested, resized as a thumbnail
 	if pub.ExtractCover {
-		for _, meta := range epub.Package[0].Metadata.Metas {
-			if meta.Name == "cover" {
-				coverImageID = meta.Content
-			}
+		found, cover := epub.Cover()
+		if !found {
+			log.Println("No cover found in the EPUB")
+			return nil
 		}
-		for _, item := range epub.Package[0].Manifest.Items {
-			if strings.Contains(item.Properties, "cover-image") ||
-				item.ID == coverImageID {
-				// re-construct a path, avoid insertion of backslashes as separator on Windows
-				coverPath = filepath.ToSlash(filepath.Join(epub.Package[0].BasePath, item.Href))
-			}
-		}
-		// extract the cover image and store it at the target location
+		// the resource content is consumed by the encryption, the cover is read again from the zip archive
+		coverPath := filepath.ToSlash(filepath.Clean(cover.Path))
 		for _, f := range zr.File {
 			if f.Name == coverPath {
-				epubCover, err := f.Open()
-				if err != nil {
-					log.Printf("Error opening the cover in %s, %s", coverPath, err.Error())
-					break // move out of the loop
-				}
-				defer epubCover.Close()
-				// create the output cover file
-				pub.CoverName = strings.TrimSuffix(pub.FileName, filepath.Ext(pub.FileName)) + filepath.Ext(coverPath)
-				coverFile, err := os.Create(filepath.Join(pub.OutputRepo, pub.CoverName))
-				if err != nil {
-					return err
-				}
-				defer coverFile.Close()
-				_, err = io.Copy(coverFile, epubCover)
+				err = extractThumbnail(pub, f, coverPath)
 				if err != nil {
 					// we do not consider it as a fatal error
-					log.Printf("Error copying cover data, %s", err.Error())
+					log.Printf("Error extracting the cover in %s, %s", coverPath, err.Error())
+					pub.CoverName = ""
 				}
-				// we found the cover, exit the loop
 				break
 			}
 		}
@@ -415,6 +452,28 @@ func processEPUB(pub *Publication, encrypter crypto.Encrypter, contentKey string
 	return nil
 }
 
+// extractThumbnail stores a thumbnail of the cover image in the output repository
+func extractThumbnail(pub *Publication, f *zip.File, coverPath string) error {
+
+	epubCover, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer epubCover.Close()
+
+	var thumbnail bytes.Buffer
+	ext, err := makeThumbnail(epubCover, &thumbnail, pub.ThumbnailSize)
+	if err != nil {
+		return err
+	}
+	// the original extension is preserved if the image was not resized
+	if ext == "" {
+		ext = filepath.Ext(coverPath)
+	}
+	pub.CoverName = strings.TrimSuffix(pub.FileName, filepath.Ext(pub.FileName)) + ext
+	return os.WriteFile(filepath.Join(pub.OutputRepo, pub.CoverName), thumbnail.Bytes(), 0644)
+}
+
 // processPDF wraps a PDF file inside a Readium Package and encrypts its resources
 func processPDF(pub *Publication, encrypter crypto.Encrypter, contentKey string, pdfNoMeta bool) error {
 
@@ -512,6 +571,125 @@ func processLPF(pub *Publication, encrypter crypto.Encrypter, contentKey string)
 	return buildEncryptedRPF(pub, encrypter, contentKey)
 }
 
+// processAudioTracks builds a Readium audiobook out of a folder or zip of audio tracks and encrypts its resources
+func processAudioTracks(pub *Publication, encrypter crypto.Encrypter, contentKey string) error {
+
+	log.Println("Process as audio tracks")
+
+	// generate a tmp Readium Package (rwpp) out of the audio tracks
+	tmpPackagePath := filepath.Join(pub.OutputRepo, pub.FileName+".tmp")
+	rwpInfo, err := pack.BuildRPFFromAudioTracks(pub.InputPath, tmpPackagePath)
+	// will remove the tmp file even if an error is returned
+	defer os.Remove(tmpPackagePath)
+	// process error
+	if err != nil {
+		return err
+	}
+
+	// set publication metadata
+	pub.Title = rwpInfo.Title
+	pub.Date = rwpInfo.Date
+	pub.Description = rwpInfo.Description
+	pub.Language = rwpInfo.Language
+	pub.Publisher = rwpInfo.Publisher
+	pub.Author = rwpInfo.Author
+	pub.Subject = rwpInfo.Subject
+	pub.Duration = rwpInfo.Duration
+
+	// extract the cover from the package if requested
+	if pub.ExtractCover {
+		// the cover is copied to outputRepo. Its original extension is preserved
+		coverPath, err := pack.ExtractCoverFromRPF(tmpPackagePath, pub.OutputRepo)
+		// we do not consider err as a fatal error
+		if err != nil {
+			log.Println("No cover extracted from the audio tracks. Error:", err.Error())
+		} else {
+			pub.CoverName = filepath.Base(coverPath)
+		}
+	}
+
+	// build an encrypted package from a new input file
+	pub.InputPath = tmpPackagePath
+	return buildEncryptedRPF(pub, encrypter, contentKey)
+}
+
+// processCBZ builds a Readium Divina package out of a CBZ archive and encrypts its resources
+func processCBZ(pub *Publication, encrypter crypto.Encrypter, contentKey string) error {
+
+	log.Println("Process as CBZ archive")
+
+	// generate a tmp Readium Package (rwpp) out of the comic archive
+	tmpPackagePath := filepath.Join(pub.OutputRepo, pub.FileName+".tmp")
+	rwpInfo, err := pack.BuildRPFFromCBZ(pub.InputPath, tmpPackagePath)
+	// will remove the tmp file even if an error is returned
+	defer os.Remove(tmpPackagePath)
+	// process error
+	if err != nil {
+		return err
+	}
+
+	// set publication metadata
+	pub.Title = rwpInfo.Title
+	pub.Date = rwpInfo.Date
+	pub.Description = rwpInfo.Description
+	pub.Language = rwpInfo.Language
+	pub.Publisher = rwpInfo.Publisher
+	pub.Author = rwpInfo.Author
+	pub.Subject = rwpInfo.Subject
+
+	// extract the cover from the package if requested
+	if pub.ExtractCover {
+		// the cover is the first page, unless ComicInfo.xml flags another one
+		coverPath, err := pack.ExtractCoverFromRPF(tmpPackagePath, pub.OutputRepo)
+		// we do not consider err as a fatal error
+		if err != nil {
+			log.Println("No cover extracted from the CBZ. Error:", err.Error())
+		} else {
+			pub.CoverName = filepath.Base(coverPath)
+		}
+	}
+
+	// build an encrypted package from a new input file
+	pub.InputPath = tmpPackagePath
+	return buildEncryptedRPF(pub, encrypter, contentKey)
+}
+
+// processDivinaManifest builds a Readium Divina package out of a standalone Divina manifest and encrypts its resources
+func processDivinaManifest(pub *Publication, encrypter crypto.Encrypter, contentKey string) error {
+
+	log.Println("Process as Divina manifest")
+
+	// generate a tmp Readium Package (rwpp) out of the manifest and its resources
+	tmpPackagePath := filepath.Join(pub.OutputRepo, pub.FileName+".tmp")
+	rwpInfo, err := pack.BuildRPFFromDivinaManifest(pub.InputPath, tmpPackagePath)
+	// will remove the tmp file even if an error is returned
+	defer os.Remove(tmpPackagePath)
+	// process error
+	if err != nil {
+		return err
+	}
+
+	// set publication metadata
+	pub.Title = rwpInfo.Title
+	pub.Description = rwpInfo.Description
+	pub.Language = rwpInfo.Language
+
+	// extract the cover from the package if requested
+	if pub.ExtractCover {
+		coverPath, err := pack.ExtractCoverFromRPF(tmpPackagePath, pub.OutputRepo)
+		// we do not consider err as a fatal error
+		if err != nil {
+			log.Println("No cover extracted from the Divina manifest. Error:", err.Error())
+		} else {
+			pub.CoverName = filepath.Base(coverPath)
+		}
+	}
+
+	// build an encrypted package from a new input file
+	pub.InputPath = tmpPackagePath
+	return buildEncryptedRPF(pub, encrypter, contentKey)
+}
+
 // buildEncryptedRPF builds an encrypted Readium package out of an un-encrypted one
 func buildEncryptedRPF(pub *Publication, encrypter crypto.Encrypter, contentKey string) error {
 
@@ -533,9 +711,13 @@ func buildEncryptedRPF(pub *Publication, encrypter crypto.Encrypter, contentKey
 	case "https://readium.org/webpub-manifest/profiles/audiobook":
 		pub.FileName = strings.TrimSuffix(pub.FileName, ext) + ".lcpa"
 		pub.ContentType = "application/audiobook+lcp"
-	case "https://readium.org/webpub-manifest/profiles/divina":
+	case pack.DivinaProfile:
 		pub.FileName = strings.TrimSuffix(pub.FileName, ext) + ".lcpdi"
 		pub.ContentType = "application/divina+lcp"
+		// readers lay out pages from their dimensions
+		if err = reader.SetImageDimensions(); err != nil {
+			return err
+		}
 	case "https://readium.org/webpub-manifest/profiles/pdf":
 		pub.FileName = strings.TrimSuffix(pub.FileName, ext) + ".lcpdf"
 		pub.ContentType = "application/pdf+lcp"
@@ -5,8 +5,15 @@
 package encrypt
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"log"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/readium/readium-lcp-server/storage"
@@ -17,9 +24,18 @@ type S3Options struct {
 	Endpoint       string
 	ForcePathStyle bool
 	DisableSSL     bool
+	// PartSize is the size in bytes of the parts of a multipart upload (0 for the default size)
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel (0 for the default value)
+	Concurrency int
+	// Resume indicates that a publication encrypted by an interrupted run must be stored
+	// without being encrypted again
+	Resume bool
 }
 
 // StoreFileOnS3 stores an encrypted file or cover image into its definitive storage.
+// Large files are sent as multipart uploads; the progress of the upload is saved
+// next to the input file, so that the upload can be resumed after a crash.
 // it then deletes the input file.
 func StoreFileOnS3(inputPath, storageRepo, name string, opts S3Options) error {
 
@@ -31,6 +47,9 @@ func StoreFileOnS3(inputPath, storageRepo, name string, opts S3Options) error {
 	s3conf.Endpoint = opts.Endpoint
 	s3conf.ForcePathStyle = opts.ForcePathStyle
 	s3conf.DisableSSL = opts.DisableSSL
+	s3conf.PartSize = opts.PartSize
+	s3conf.Concurrency = opts.Concurrency
+	s3conf.StateDir = filepath.Dir(inputPath)
 
 	var store storage.Store
 	// init the S3 storage
@@ -39,21 +58,124 @@ func StoreFileOnS3(inputPath, storageRepo, name string, opts S3Options) error {
 		return errors.New("could not init the S3 storage")
 	}
 
-	// open the input file, defer its deletion
+	// open the input file
 	file, err := os.Open(inputPath)
 	if err != nil {
 		return err
 	}
-	defer cleanupTempFile(file)
 
 	// add the file to the storage with the name passed as parameter
 	_, err = store.Add(name, file)
 	if err != nil {
+		// keep the input file, a later run may resume the upload
+		file.Close()
 		return err
 	}
+	cleanupTempFile(file)
 	return nil
 }
 
+// resumeJournalPath returns the path of the file describing a publication
+// encrypted but not yet stored on S3.
+func resumeJournalPath(tempRepo, contentID string) string {
+	return filepath.Join(tempRepo, contentID+".resume.json")
+}
+
+// resumeJournal is the information about an encrypted publication saved in a resume journal.
+// The content key is not saved, only its hash, which checks the key given again on resume.
+type resumeJournal struct {
+	Publication
+	KeyCheck []byte
+}
+
+// saveResumeJournal saves the information about an encrypted publication,
+// so that its storage can be resumed after a crash. The file is only readable by its owner.
+func saveResumeJournal(pub *Publication, tempRepo string) error {
+	sum := sha256.Sum256(pub.EncryptionKey)
+	journal := resumeJournal{Publication: *pub, KeyCheck: sum[:]}
+	journal.EncryptionKey = nil
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(resumeJournalPath(tempRepo, pub.UUID), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// the mode of an existing file is not changed by OpenFile
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// loadResumeJournal returns the publication encrypted by an interrupted run,
+// if the journal and the encrypted file are still present. As the content key is not saved,
+// the publication can only be resumed with the base64 encoded content key used by the interrupted run.
+func loadResumeJournal(tempRepo, contentID, contentKey string) (*Publication, error) {
+	data, err := os.ReadFile(resumeJournalPath(tempRepo, contentID))
+	if err != nil {
+		return nil, err
+	}
+	if contentKey == "" {
+		return nil, errors.New("no content key to resume the publication with")
+	}
+	var journal resumeJournal
+	if err = json.Unmarshal(data, &journal); err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(key); !bytes.Equal(sum[:], journal.KeyCheck) {
+		return nil, errors.New("the content key differs from the one of the interrupted run")
+	}
+	if _, err = os.Stat(filepath.Join(journal.OutputRepo, journal.FileName)); err != nil {
+		return nil, err
+	}
+	pub := journal.Publication
+	pub.EncryptionKey = key
+	return &pub, nil
+}
+
+// storePublicationOnS3 stores an encrypted publication and its cover on S3, then sets its location.
+// The resume journal is deleted once everything is stored.
+func storePublicationOnS3(pub *Publication, tempRepo, storageRepo, storageURL string, opts S3Options) error {
+
+	err := saveResumeJournal(pub, tempRepo)
+	if err != nil {
+		log.Println("Error saving the resume journal:", err.Error())
+	}
+
+	fromPath := filepath.Join(pub.OutputRepo, pub.FileName)
+	err = StoreFileOnS3(fromPath, storageRepo, pub.FileName, opts)
+	if err != nil {
+		return err
+	}
+	// if a cover was extracted (pub.CoverName not empty), store it in S3 too
+	// and delete the cover
+	if pub.ExtractCover && pub.CoverName != "" {
+		fromPath := filepath.Join(pub.OutputRepo, pub.CoverName)
+		// on resume, the cover may have been stored and deleted already
+		if _, err := os.Stat(fromPath); err == nil || !opts.Resume {
+			err = StoreFileOnS3(fromPath, storageRepo, pub.CoverName, opts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	os.Remove(resumeJournalPath(tempRepo, pub.UUID))
+
+	// location indicates the url of the publication on S3
+	pub.Location, err = url.JoinPath(storageURL, pub.FileName)
+	return err
+}
+
 // cleanupTempFile closes and deletes a temporary file
 func cleanupTempFile(f *os.File) {
 	if f == nil {
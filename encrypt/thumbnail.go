@@ -0,0 +1,90 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package encrypt
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// makeThumbnail reads an image and writes a version which fits in a maxSize square.
+// A zero maxSize keeps the original image.
+// PNG images stay PNG, other formats become JPEG; the returned extension matches the output format.
+// Images which are already small enough, or cannot be decoded (e.g. svg), are copied as-is
+// and an empty extension is returned.
+func makeThumbnail(r io.Reader, w io.Writer, maxSize int) (string, error) {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || maxSize <= 0 {
+		_, err = w.Write(data)
+		return "", err
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		_, err = w.Write(data)
+		return "", err
+	}
+
+	// keep the aspect ratio
+	tw, th := maxSize, height*maxSize/width
+	if height > width {
+		tw, th = width*maxSize/height, maxSize
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	dst := downscale(src, tw, th)
+
+	if format == "png" {
+		return ".png", png.Encode(w, dst)
+	}
+	return ".jpg", jpeg.Encode(w, dst, &jpeg.Options{Quality: 85})
+}
+
+// downscale reduces an image by averaging the source pixels covered by each target pixel
+func downscale(src image.Image, tw, th int) *image.NRGBA {
+
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*sh/th, (y+1)*sh/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*sw/tw, (x+1)*sw/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(bounds.Min.X+sx, bounds.Min.Y+sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
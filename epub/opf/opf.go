@@ -7,40 +7,94 @@ package opf
 import (
 	"encoding/xml"
 	"io"
+	"strings"
 
 	"golang.org/x/net/html/charset"
 )
 
 // Package is the main opf structure
 type Package struct {
-	BasePath string   `xml:"-"`
-	Metadata Metadata `xml:"http://www.idpf.org/2007/opf metadata"`
-	Manifest Manifest `xml:"http://www.idpf.org/2007/opf manifest"`
+	BasePath         string   `xml:"-"`
+	Version          string   `xml:"version,attr"`
+	UniqueIdentifier string   `xml:"unique-identifier,attr"`
+	Lang             string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Metadata         Metadata `xml:"http://www.idpf.org/2007/opf metadata"`
+	Manifest         Manifest `xml:"http://www.idpf.org/2007/opf manifest"`
 }
 
 // Metadata is the package metadata structure
 type Metadata struct {
-	Identifier  string   `json:"identifier" xml:"http://purl.org/dc/elements/1.1/ identifier"`
-	Title       []string `json:"title" xml:"http://purl.org/dc/elements/1.1/ title"`
-	Description string   `json:"description" xml:"http://purl.org/dc/elements/1.1/ description"`
-	Date        string   `json:"date" xml:"http://purl.org/dc/elements/1.1/ date"`
-	Author      []string `json:"author" xml:"http://purl.org/dc/elements/1.1/ creator"`
-	Contributor []string `json:"contributor" xml:"http://purl.org/dc/elements/1.1/ contributor"`
-	Publisher   []string `json:"publisher" xml:"http://purl.org/dc/elements/1.1/ publisher"`
-	Language    []string `json:"language" xml:"http://purl.org/dc/elements/1.1/ language"`
-	Subject     []string `json:"subject" xml:"http://purl.org/dc/elements/1.1/ subject"`
-	Metas       []Meta   `xml:"http://www.idpf.org/2007/opf meta"`
+	Identifier  []Element `json:"identifier" xml:"http://purl.org/dc/elements/1.1/ identifier"`
+	Title       []Element `json:"title" xml:"http://purl.org/dc/elements/1.1/ title"`
+	Description string    `json:"description" xml:"http://purl.org/dc/elements/1.1/ description"`
+	Date        []Element `json:"date" xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      []Element `json:"author" xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Contributor []Element `json:"contributor" xml:"http://purl.org/dc/elements/1.1/ contributor"`
+	Publisher   []string  `json:"publisher" xml:"http://purl.org/dc/elements/1.1/ publisher"`
+	Language    []string  `json:"language" xml:"http://purl.org/dc/elements/1.1/ language"`
+	Subject     []Element `json:"subject" xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Metas       []Meta    `xml:"http://www.idpf.org/2007/opf meta"`
+}
+
+// Element is a Dublin Core metadata element
+// EPUB 3 refines elements by their id, EPUB 2 uses opf attributes
+type Element struct {
+	ID     string `xml:"id,attr"`
+	Lang   string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Role   string `xml:"http://www.idpf.org/2007/opf role,attr"`    // EPUB 2
+	FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr"` // EPUB 2
+	Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr"`  // EPUB 2
+	Event  string `xml:"http://www.idpf.org/2007/opf event,attr"`   // EPUB 2
+	Value  string `xml:",chardata"`
 }
 
 // Meta is the metadata item structure
 type Meta struct {
 	Name     string `xml:"name,attr"` // EPUB 2
 	Content  string `xml:"content,attr"`
+	ID       string `xml:"id,attr"`
 	Property string `xml:"property,attr"` // EPUB 3
 	Refines  string `xml:"refines,attr"`
+	Scheme   string `xml:"scheme,attr"`
+	Lang     string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
 	Text     string `xml:",chardata"`
 }
 
+// Values returns the trimmed values of a list of elements
+func Values(elements []Element) []string {
+	var values []string
+	for _, e := range elements {
+		if v := strings.TrimSpace(e.Value); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Refinements returns the metas refining the element with the given id
+func (m Metadata) Refinements(id string) []Meta {
+	var metas []Meta
+	if id == "" {
+		return metas
+	}
+	for _, meta := range m.Metas {
+		if meta.Refines == "#"+id {
+			metas = append(metas, meta)
+		}
+	}
+	return metas
+}
+
+// Refinement returns the value of the first meta refining the element with the given id by the given property
+func (m Metadata) Refinement(id, property string) string {
+	for _, meta := range m.Refinements(id) {
+		if meta.Property == property {
+			return strings.TrimSpace(meta.Text)
+		}
+	}
+	return ""
+}
+
 // Manifest is the package manifest structure
 type Manifest struct {
 	Items []Item `xml:"http://www.idpf.org/2007/opf item"`
@@ -5,9 +5,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -30,6 +32,7 @@ import (
 	"github.com/readium/readium-lcp-server/frontend/webpurchase"
 	"github.com/readium/readium-lcp-server/frontend/webrepository"
 	"github.com/readium/readium-lcp-server/frontend/webuser"
+	"github.com/readium/readium-lcp-server/mtls"
 )
 
 func main() {
@@ -46,6 +49,14 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	tlsConfig, err := mtls.ServerConfig(config.Config.FrontendServer.TLS)
+	if err != nil {
+		panic(err)
+	}
+	// the calls to the License Server and the Status Server present a client certificate, if configured
+	if err = mtls.InitClient(config.Config.ClientTLS); err != nil {
+		panic(err)
+	}
 
 	//log.Println("LCP server = " + config.Config.LcpServer.PublicBaseUrl)
 	//log.Println("using login  " + config.Config.LcpUpdateAuth.Username)
@@ -126,7 +137,7 @@ func main() {
 	// log.Println(configJs)
 
 	fileConfigJs.WriteString(configJs)
-	HandleSignals()
+	quit := HandleSignals()
 
 	// basic authentication, optional in the frontend server.
 	// Authentication is used for getting user info from a license id.
@@ -142,16 +153,41 @@ func main() {
 	}
 
 	s := frontend.New(":"+strconv.Itoa(config.Config.FrontendServer.Port), static, repoManager, publicationDB, userDB, dashboardDB, licenseDB, purchaseDB, authenticator)
+	s.TLSConfig = tlsConfig
 	log.Println("Frontend webserver for LCP running on " + config.Config.FrontendServer.Host + ":" + strconv.Itoa(config.Config.FrontendServer.Port))
 
-	if err := s.ListenAndServe(); err != nil {
-		log.Println("Error " + err.Error())
+	go func() {
+		var err error
+		if s.TLSConfig != nil {
+			// the certificate and private key are held by the tls configuration
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("Error " + err.Error())
+			os.Exit(1)
+		}
+	}()
+	<-quit
+
+	// stop accepting connections and let the requests in progress finish before closing the database
+	ctx, cancel := context.WithTimeout(context.Background(), config.Config.FrontendServer.ShutdownDelay())
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Println("Error draining the requests: " + err.Error())
+	}
+	if err := db.Close(); err != nil {
+		log.Println("Error closing the database: " + err.Error())
 	}
+	log.Println("Frontend server stopped")
 }
 
-// HandleSignals handles system signals and adds a log before quitting
-func HandleSignals() {
-	sigChan := make(chan os.Signal)
+// HandleSignals prints the stack traces on SIGQUIT and returns a channel which is closed on SIGINT or SIGTERM;
+// a second SIGINT or SIGTERM exits immediately
+func HandleSignals() <-chan struct{} {
+	quit := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
 	go func() {
 		stacktrace := make([]byte, 1<<20)
 		for sig := range sigChan {
@@ -162,10 +198,17 @@ func HandleSignals() {
 			case syscall.SIGINT:
 				fallthrough
 			case syscall.SIGTERM:
-				fmt.Println("Shutting down...")
-				os.Exit(0)
+				select {
+				case <-quit:
+					fmt.Println("Forced shutdown")
+					os.Exit(1)
+				default:
+					fmt.Println("Shutting down...")
+					close(quit)
+				}
 			}
 		}
 	}()
 	signal.Notify(sigChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+	return quit
 }
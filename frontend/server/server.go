@@ -46,6 +46,7 @@ import (
 	"github.com/readium/readium-lcp-server/frontend/webpurchase"
 	"github.com/readium/readium-lcp-server/frontend/webrepository"
 	"github.com/readium/readium-lcp-server/frontend/webuser"
+	"github.com/readium/readium-lcp-server/mtls"
 )
 
 // Server struct contains server info and  db interfaces
@@ -186,7 +187,7 @@ func fetchLicenseStatusesTask(s *Server) {
 	auth := config.Config.LsdNotifyAuth
 
 	// prepare the request
-	client := &http.Client{}
+	client := mtls.Client(0)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		panic(err)
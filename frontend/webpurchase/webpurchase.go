@@ -21,6 +21,7 @@ import (
 	"github.com/readium/readium-lcp-server/frontend/webuser"
 	"github.com/readium/readium-lcp-server/license"
 	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/mtls"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -224,13 +225,18 @@ func (pManager PurchaseManager) GenerateOrGetLicense(purchase Purchase) (license
 	// In case of a creation of license, add the user rights
 	var copy, print int32
 	if purchase.LicenseUUID == nil {
-		// in case of undefined conf values for copy and print rights,
-		// these rights will be set to zero
-		copy = config.Config.FrontendServer.RightCopy
-		print = config.Config.FrontendServer.RightPrint
 		userRights := license.UserRights{}
-		userRights.Copy = &copy
-		userRights.Print = &print
+		if config.Config.FrontendServer.RightsPolicy != "" {
+			// copy and print rights are defined by a policy of the License Server
+			partialLicense.Policy = config.Config.FrontendServer.RightsPolicy
+		} else {
+			// in case of undefined conf values for copy and print rights,
+			// these rights will be set to zero
+			copy = config.Config.FrontendServer.RightCopy
+			print = config.Config.FrontendServer.RightPrint
+			userRights.Copy = &copy
+			userRights.Print = &print
+		}
 
 		// if this is a loan, include start and end dates from the purchase info
 		if purchase.Type == LOAN {
@@ -273,9 +279,7 @@ func (pManager PurchaseManager) GenerateOrGetLicense(purchase Purchase) (license
 	// the body is a partial license in json format
 	req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
 
-	var lcpClient = &http.Client{
-		Timeout: time.Second * 10,
-	}
+	var lcpClient = mtls.Client(10 * time.Second)
 	// POST the request
 	resp, err := lcpClient.Do(req)
 	if err != nil {
@@ -334,9 +338,7 @@ func (pManager PurchaseManager) GetPartialLicense(purchase Purchase) (license.Li
 		req.SetBasicAuth(lcpUpdateAuth.Username, lcpUpdateAuth.Password)
 	}
 	// send the request
-	var lcpClient = &http.Client{
-		Timeout: time.Second * 10,
-	}
+	var lcpClient = mtls.Client(10 * time.Second)
 	resp, err := lcpClient.Do(req)
 	if err != nil {
 		return license.License{}, err
@@ -375,9 +377,7 @@ func (pManager PurchaseManager) GetLicenseStatusDocument(purchase Purchase) (lic
 	}
 	req.Header.Add("Content-Type", api.ContentType_JSON)
 
-	var lsdClient = &http.Client{
-		Timeout: time.Second * 10,
-	}
+	var lsdClient = mtls.Client(10 * time.Second)
 
 	resp, err := lsdClient.Do(req)
 	if err != nil {
@@ -515,9 +515,7 @@ func (pManager PurchaseManager) Update(p Purchase) error {
 			req.SetBasicAuth(lsdAuth.Username, lsdAuth.Password)
 		}
 		// call the lsd server
-		var lsdClient = &http.Client{
-			Timeout: time.Second * 10,
-		}
+		var lsdClient = mtls.Client(10 * time.Second)
 		resp, err := lsdClient.Do(req)
 		if err != nil {
 			return err
@@ -0,0 +1,157 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/storage"
+)
+
+// ProbePrefix is the prefix of the keys of the objects written, read and removed by the storage check
+const ProbePrefix = "lcp-health-probe"
+
+// probeKey returns a key unique to this instance and to a probe, so that the instances
+// sharing a storage, and the concurrent probes of an instance, do not remove each other's object
+func probeKey() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return ProbePrefix + "-" + url.PathEscape(host) + "-" + hex.EncodeToString(suffix)
+}
+
+// Database checks that the database can be reached
+func Database(db *sql.DB) Check {
+	return Check{Name: "database", Critical: true, Run: func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}}
+}
+
+// Storage checks that a probe object can be written to a storage, read back and removed.
+// As it writes to the storage, it should be throttled, see Throttle.
+func Storage(st storage.Store) Check {
+	return Check{Name: "storage", Critical: true, Run: func(ctx context.Context) error {
+		if st == nil {
+			return errors.New("no storage")
+		}
+		key := probeKey()
+		probe := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+		if _, err := st.Add(key, bytes.NewReader(probe)); err != nil {
+			return err
+		}
+		err := readProbe(st, key, probe)
+		// the probe object is removed even if it cannot be read back
+		if rerr := st.Remove(key); err == nil {
+			err = rerr
+		}
+		return err
+	}}
+}
+
+// readProbe checks that a probe object is read back from a storage
+func readProbe(st storage.Store, key string, probe []byte) error {
+	item, err := st.Get(key)
+	if err != nil {
+		return err
+	}
+	rc, err := item.Contents()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, probe) {
+		return errors.New("the probe object read from the storage differs from the one written")
+	}
+	return nil
+}
+
+// Certificate checks that the current time is within the validity window of a certificate
+func Certificate(name string, cert *tls.Certificate) Check {
+	return Check{Name: name, Critical: true, Run: func(ctx context.Context) error {
+		if cert == nil || len(cert.Certificate) == 0 {
+			return errors.New("no certificate")
+		}
+		leaf := cert.Leaf
+		if leaf == nil {
+			var err error
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if now.Before(leaf.NotBefore) {
+			return errors.New("the certificate is not valid before " + leaf.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if now.After(leaf.NotAfter) {
+			return errors.New("the certificate expired on " + leaf.NotAfter.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}}
+}
+
+// Reachable checks that an http server answers on the origin of a URL, which may be a URL template.
+// Any response but a server error is accepted, as the check is not authenticated.
+func Reachable(name string, rawURL string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return errors.New("invalid url " + rawURL)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", u.Scheme+"://"+u.Host+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return errors.New("the server answered with the status " + strconv.Itoa(resp.StatusCode))
+		}
+		return nil
+	}}
+}
+
+// Peer checks that the other server of a deployment is running, using its ping endpoint.
+// Its readiness is not checked, as it would check this server in turn.
+func Peer(name string, baseURL string) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/ping", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := mtls.Client(0).Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.New("the server answered with the status " + strconv.Itoa(resp.StatusCode))
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,154 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package health checks the dependencies of the License Server and the Status Server,
+// so that an orchestrator may tell if a server is alive and if it is ready to serve requests.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of a report
+const (
+	StatusOK = "ok"
+	// StatusDegraded means that a non critical check failed; the server is still ready
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+)
+
+// Check is a check of a dependency of a server
+type Check struct {
+	Name string
+	// Critical tells if the server is not ready when the check fails
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the result of a check
+type Result struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	// Duration is the duration of the check in milliseconds
+	Duration int64 `json:"duration_ms"`
+}
+
+// Report is the result of all the checks of a server
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Throttle returns a check which is not run again for an interval after it succeeded,
+// e.g. a check which writes to a storage and would otherwise be run by every readiness probe of an orchestrator.
+// A failed check is run again at the next probe.
+func Throttle(check Check, interval time.Duration) Check {
+	var mu sync.Mutex
+	var last time.Time
+	run := check.Run
+	check.Run = func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !last.IsZero() && time.Since(last) < interval {
+			return nil
+		}
+		err := run(ctx)
+		if err == nil {
+			last = time.Now()
+		}
+		return err
+	}
+	return check
+}
+
+// Checker runs the checks of a server
+type Checker struct {
+	checks []Check
+	// Timeout is the maximum duration of a check
+	Timeout time.Duration
+}
+
+// New creates a checker, with a timeout of 5 seconds per check
+func New(checks ...Check) *Checker {
+	return &Checker{checks: checks, Timeout: 5 * time.Second}
+}
+
+// Add adds checks to a checker
+func (c *Checker) Add(checks ...Check) {
+	c.checks = append(c.checks, checks...)
+}
+
+// Run runs the checks concurrently and returns their results, in the order of the checks
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make([]Result, len(c.checks))}
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+	for _, r := range report.Checks {
+		if r.Status == StatusOK {
+			continue
+		}
+		if r.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs a check, which fails if it does not end before the timeout
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timeout after " + c.Timeout.String())
+	}
+	r := Result{Name: check.Name, Status: StatusOK, Critical: check.Critical, Duration: time.Since(start).Milliseconds()}
+	if err != nil {
+		r.Status, r.Error = StatusFail, err.Error()
+	}
+	return r
+}
+
+// Live tells that the server is running; it checks no dependency, so that a server
+// is not restarted by an orchestrator because of a failure of another server
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Report{Status: StatusOK, Checks: []Result{}})
+}
+
+// Ready runs the checks and returns their results, with a 503 status if a critical check failed
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Run(r.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == StatusFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
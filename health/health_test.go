@@ -0,0 +1,194 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/readium/readium-lcp-server/storage"
+)
+
+func check(name string, critical bool, err error) Check {
+	return Check{Name: name, Critical: critical, Run: func(ctx context.Context) error { return err }}
+}
+
+func TestRun(t *testing.T) {
+	failure := errors.New("unreachable")
+	for _, c := range []struct {
+		checks []Check
+		status string
+	}{
+		{[]Check{check("database", true, nil), check("lsd", false, nil)}, StatusOK},
+		{[]Check{check("database", true, nil), check("lsd", false, failure)}, StatusDegraded},
+		{[]Check{check("database", true, failure), check("lsd", false, failure)}, StatusFail},
+	} {
+		report := New(c.checks...).Run(context.Background())
+		if report.Status != c.status || len(report.Checks) != len(c.checks) {
+			t.Errorf("Expected the status %s, got %+v", c.status, report)
+		}
+		for i, r := range report.Checks {
+			if r.Name != c.checks[i].Name {
+				t.Errorf("Unexpected order of the results %+v", report.Checks)
+			}
+		}
+	}
+
+	// a check which does not end in time fails
+	checker := New(Check{Name: "slow", Critical: true, Run: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	checker.Timeout = 10 * time.Millisecond
+	if report := checker.Run(context.Background()); report.Status != StatusFail || report.Checks[0].Error == "" {
+		t.Errorf("Expected a timeout, got %+v", report)
+	}
+}
+
+func TestReady(t *testing.T) {
+	for _, c := range []struct {
+		checker *Checker
+		code    int
+		status  string
+	}{
+		{New(check("database", true, nil), check("lsd", false, errors.New("down"))), http.StatusOK, StatusDegraded},
+		{New(check("database", true, errors.New("down"))), http.StatusServiceUnavailable, StatusFail},
+	} {
+		w := httptest.NewRecorder()
+		c.checker.Ready(w, httptest.NewRequest("GET", "/health/ready", nil))
+		var report Report
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != c.code || report.Status != c.status {
+			t.Errorf("Expected %d %s, got %d %+v", c.code, c.status, w.Code, report)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Live(w, httptest.NewRequest("GET", "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected liveness status %d", w.Code)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	// concurrent probes, e.g. of several instances sharing a storage, use their own probe object
+	check := Storage(storage.NewFileSystem(dir, "http://localhost/files"))
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- check.Run(context.Background()) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if probes, _ := filepath.Glob(filepath.Join(dir, ProbePrefix+"*")); len(probes) != 0 {
+		t.Errorf("Expected the probe objects to be removed, got %v", probes)
+	}
+	// the storage directory cannot be created over a file
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Storage(storage.NewFileSystem(file, "http://localhost/files")).Run(context.Background()); err == nil {
+		t.Error("Expected an error for an unusable storage")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	runs := 0
+	var failure error
+	check := Throttle(Check{Name: "storage", Run: func(ctx context.Context) error {
+		runs++
+		return failure
+	}}, time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := check.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("Expected a single run within the interval, got %d", runs)
+	}
+
+	// a failed check is run again
+	failure = errors.New("down")
+	check = Throttle(Check{Name: "storage", Run: func(ctx context.Context) error {
+		runs++
+		return failure
+	}}, time.Hour)
+	runs = 0
+	check.Run(context.Background())
+	check.Run(context.Background())
+	if runs != 2 {
+		t.Errorf("Expected a failed check to be run again, got %d runs", runs)
+	}
+}
+
+func testCertificate(t *testing.T, notBefore, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notBefore, NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertificate(t *testing.T) {
+	now := time.Now()
+	if err := Certificate("certificate", testCertificate(t, now.Add(-time.Hour), now.AddDate(1, 0, 0))).Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := Certificate("certificate", testCertificate(t, now.AddDate(-1, 0, 0), now.Add(-time.Hour))).Run(context.Background()); err == nil {
+		t.Error("Expected an expired certificate")
+	}
+	if err := Certificate("certificate", testCertificate(t, now.Add(time.Hour), now.AddDate(1, 0, 0))).Run(context.Background()); err == nil {
+		t.Error("Expected a certificate which is not valid yet")
+	}
+}
+
+func TestReachable(t *testing.T) {
+	codes := map[string]int{"/": http.StatusNotFound, "/ping": http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	if err := Peer("lsd", srv.URL).Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+	// the origin of a url template is reached, and a client error is accepted
+	if err := Reachable("cms", srv.URL+"/users/{license_id}").Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+	codes["/"] = http.StatusBadGateway
+	if err := Reachable("cms", srv.URL+"/users/{license_id}").Run(context.Background()); err == nil {
+		t.Error("Expected a server error")
+	}
+	srv.Close()
+	if err := Peer("lsd", srv.URL).Run(context.Background()); err == nil {
+		t.Error("Expected an unreachable server")
+	}
+}
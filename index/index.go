@@ -6,6 +6,7 @@ package index
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
 
@@ -22,8 +23,10 @@ type Index interface {
 	GetFromLicense(id string) (Content, error)
 	Add(c Content) error
 	Update(c Content) error
+	UpdateLocations(locations map[string]string) error
 	Delete(id string) error
 	List() func() (Content, error)
+	ForTenant(name string) Index
 }
 
 // Content represents an encrypted resource
@@ -34,6 +37,11 @@ type Content struct {
 	Length        int64  `json:"length"`
 	Sha256        string `json:"sha256"`
 	Type          string `json:"type"`
+	// Metadata is the metadata of the publication in the Readium Web Publication Manifest format,
+	// as extracted by lcpencrypt
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// Tenant is the name of the tenant of the content, empty if the content belongs to no tenant
+	Tenant string `json:"-"`
 }
 
 type dbIndex struct {
@@ -41,13 +49,42 @@ type dbIndex struct {
 	dbGetByID      *sql.Stmt
 	dbGetByLicense *sql.Stmt
 	dbList         *sql.Stmt
+	// statements restricted to a tenant
+	dbGetByIDInTenant      *sql.Stmt
+	dbGetByLicenseInTenant *sql.Stmt
+	dbListInTenant         *sql.Stmt
+	// tenant is the name of the tenant the index is restricted to;
+	// scoped is false if the index gives access to the content of every tenant.
+	tenant string
+	scoped bool
+}
+
+// ForTenant returns an index restricted to the content of a tenant.
+// New content is attached to this tenant.
+func (i dbIndex) ForTenant(name string) Index {
+	i.tenant = name
+	i.scoped = true
+	return i
+}
+
+// inTenant completes a query and its arguments with a tenant restriction, if the index is scoped
+func (i dbIndex) inTenant(query string, args ...interface{}) (string, []interface{}) {
+	if i.scoped {
+		query += " AND tenant=?"
+		args = append(args, i.tenant)
+	}
+	return dbutils.GetParamQuery(config.Config.LcpServer.Database, query), args
 }
 
 // Get returns a record by id
 func (i dbIndex) Get(id string) (Content, error) {
-	row := i.dbGetByID.QueryRow(id)
-	var c Content
-	err := row.Scan(&c.ID, &c.EncryptionKey, &c.Location, &c.Length, &c.Sha256, &c.Type)
+	var row *sql.Row
+	if i.scoped {
+		row = i.dbGetByIDInTenant.QueryRow(id, i.tenant)
+	} else {
+		row = i.dbGetByID.QueryRow(id)
+	}
+	c, err := scanContent(row)
 	if err != nil {
 		err = ErrNotFound
 	}
@@ -55,27 +92,57 @@ func (i dbIndex) Get(id string) (Content, error) {
 }
 
 func (i dbIndex) GetFromLicense(id string) (Content, error) {
-	row := i.dbGetByLicense.QueryRow(id)
-	var c Content
-	err := row.Scan(&c.ID, &c.EncryptionKey, &c.Location, &c.Length, &c.Sha256, &c.Type)
+	var row *sql.Row
+	if i.scoped {
+		row = i.dbGetByLicenseInTenant.QueryRow(id, i.tenant)
+	} else {
+		row = i.dbGetByLicense.QueryRow(id)
+	}
+	c, err := scanContent(row)
 	if err != nil {
 		err = ErrNotFound
 	}
 	return c, err
 }
 
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanContent reads a record, whose columns are selected in the order of the Content fields
+func scanContent(row scanner) (Content, error) {
+	var c Content
+	var metadata sql.NullString
+	err := row.Scan(&c.ID, &c.EncryptionKey, &c.Location, &c.Length, &c.Sha256, &c.Type, &metadata, &c.Tenant)
+	if metadata.Valid {
+		c.Metadata = json.RawMessage(metadata.String)
+	}
+	return c, err
+}
+
+// metadataValue returns the metadata of a record as stored in the database, NULL if there is none
+func metadataValue(c Content) sql.NullString {
+	return sql.NullString{String: string(c.Metadata), Valid: len(c.Metadata) > 0}
+}
+
 // Add inserts a record
+// The content is attached to the tenant of the index, or else to its own tenant
 func (i dbIndex) Add(c Content) error {
 	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+	tenant := c.Tenant
+	if i.scoped {
+		tenant = i.tenant
+	}
 
 	if driver == "postgres" {
-		_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "INSERT INTO content (id,encryption_key,location,length,sha256,type) VALUES (?, ?::bytea, ?, ?, ?, ?)"),
-			c.ID, c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type)
+		_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "INSERT INTO content (id,encryption_key,location,length,sha256,type,metadata,tenant) VALUES (?, ?::bytea, ?, ?, ?, ?, ?, ?)"),
+			c.ID, c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type, metadataValue(c), tenant)
 		return err
 
 	} else {
-		_, err := i.db.Exec("INSERT INTO content (id,encryption_key,location,length,sha256,type) VALUES (?, ?, ?, ?, ?, ?)",
-			c.ID, c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type)
+		_, err := i.db.Exec("INSERT INTO content (id,encryption_key,location,length,sha256,type,metadata,tenant) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			c.ID, c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type, metadataValue(c), tenant)
 		return err
 	}
 
@@ -85,34 +152,57 @@ func (i dbIndex) Add(c Content) error {
 func (i dbIndex) Update(c Content) error {
 	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
 
+	query := "UPDATE content SET encryption_key=? , location=?, length=?, sha256=?, type=?, metadata=? WHERE id=?"
 	if driver == "postgres" {
-		_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "UPDATE content SET encryption_key=?::bytea , location=?, length=?, sha256=?, type=? WHERE id=?"),
-			c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type, c.ID)
-		return err
-	} else {
-		_, err := i.db.Exec("UPDATE content SET encryption_key=? , location=?, length=?, sha256=?, type=? WHERE id=?",
-			c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type, c.ID)
-		return err
+		query = "UPDATE content SET encryption_key=?::bytea , location=?, length=?, sha256=?, type=?, metadata=? WHERE id=?"
 	}
+	query, args := i.inTenant(query, c.EncryptionKey, c.Location, c.Length, c.Sha256, c.Type, metadataValue(c), c.ID)
+	_, err := i.db.Exec(query, args...)
+	return err
 
 }
 
-// Delete deletes a record
-func (i dbIndex) Delete(id string) error {
-	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
-
-	if driver == "postgres" {
-		_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "DELETE FROM content WHERE id=?"), id)
-		return err
-	} else {
-		_, err := i.db.Exec("DELETE FROM content WHERE id=?", id)
+// UpdateLocations updates the location of several records in a single transaction.
+// The map keys are content ids, the values are the new locations.
+func (i dbIndex) UpdateLocations(locations map[string]string) error {
+	tx, err := i.db.Begin()
+	if err != nil {
 		return err
 	}
+	for id, location := range locations {
+		query, args := i.inTenant("UPDATE content SET location=? WHERE id=?", location, id)
+		res, err := tx.Exec(query, args...)
+		if err == nil {
+			var n int64
+			n, err = res.RowsAffected()
+			if err == nil && n == 0 {
+				err = ErrNotFound
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete deletes a record
+func (i dbIndex) Delete(id string) error {
+	query, args := i.inTenant("DELETE FROM content WHERE id=?", id)
+	_, err := i.db.Exec(query, args...)
+	return err
 }
 
 // List lists rows
 func (i dbIndex) List() func() (Content, error) {
-	rows, err := i.dbList.Query()
+	var rows *sql.Rows
+	var err error
+	if i.scoped {
+		rows, err = i.dbListInTenant.Query(i.tenant)
+	} else {
+		rows, err = i.dbList.Query()
+	}
 	if err != nil {
 		return func() (Content, error) { return Content{}, err }
 	}
@@ -120,7 +210,7 @@ func (i dbIndex) List() func() (Content, error) {
 		var c Content
 		var err error
 		if rows.Next() {
-			err = rows.Scan(&c.ID, &c.EncryptionKey, &c.Location, &c.Length, &c.Sha256, &c.Type)
+			c, err = scanContent(rows)
 		} else {
 			rows.Close()
 			err = ErrNotFound
@@ -142,20 +232,45 @@ func Open(db *sql.DB) (i Index, err error) {
 		}
 	}
 
-	var dbGetByID *sql.Stmt
-	dbGetByID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT id,encryption_key,location,length,sha256,type FROM content WHERE id = ?"))
+	// content created before the support of tenants belongs to the default tenant
+	err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "content", "tenant", "varchar(255) NOT NULL DEFAULT ''")
+	if err != nil {
+		log.Println("Error adding a tenant column to the content table")
+		return
+	}
+	err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "content", "metadata", "text")
+	if err != nil {
+		log.Println("Error adding a metadata column to the content table")
+		return
+	}
+
+	var dbGetByID, dbGetByIDInTenant *sql.Stmt
+	dbGetByID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT id,encryption_key,location,length,sha256,type,metadata,tenant FROM content WHERE id = ?"))
+	if err != nil {
+		return
+	}
+	dbGetByIDInTenant, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT id,encryption_key,location,length,sha256,type,metadata,tenant FROM content WHERE id = ? AND tenant = ?"))
+	if err != nil {
+		return
+	}
+	dbGetByLicense, err := db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT c.id,c.encryption_key,c.location,c.length,c.sha256,c.type,c.metadata,c.tenant FROM content c INNER JOIN license l ON c.id = l.content_fk WHERE l.id = ?"))
+	if err != nil {
+		return
+	}
+	dbGetByLicenseInTenant, err := db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT c.id,c.encryption_key,c.location,c.length,c.sha256,c.type,c.metadata,c.tenant FROM content c INNER JOIN license l ON c.id = l.content_fk WHERE l.id = ? AND c.tenant = ?"))
 	if err != nil {
 		return
 	}
-	dbGetByLicense, err := db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT c.id,c.encryption_key,c.location,c.length,c.sha256,c.type FROM content c INNER JOIN license l ON c.id = l.content_fk WHERE l.id = ?"))
+	dbList, err := db.Prepare("SELECT id,encryption_key,location,length,sha256,type,metadata,tenant FROM content")
 	if err != nil {
 		return
 	}
-	dbList, err := db.Prepare("SELECT id,encryption_key,location,length,sha256,type FROM content")
+	dbListInTenant, err := db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT id,encryption_key,location,length,sha256,type,metadata,tenant FROM content WHERE tenant = ?"))
 	if err != nil {
 		return
 	}
-	i = dbIndex{db, dbGetByID, dbGetByLicense, dbList}
+	i = dbIndex{db: db, dbGetByID: dbGetByID, dbGetByLicense: dbGetByLicense, dbList: dbList,
+		dbGetByIDInTenant: dbGetByIDInTenant, dbGetByLicenseInTenant: dbGetByLicenseInTenant, dbListInTenant: dbListInTenant}
 	return
 }
 
@@ -165,4 +280,6 @@ const tableDef = "CREATE TABLE IF NOT EXISTS content (" +
 	"location text NOT NULL," +
 	"length bigint," +
 	"sha256 varchar(64)," +
-	"\"type\" varchar(255) NOT NULL default 'application/epub+zip')"
+	"\"type\" varchar(255) NOT NULL default 'application/epub+zip'," +
+	"metadata text," +
+	"tenant varchar(255) NOT NULL DEFAULT '')"
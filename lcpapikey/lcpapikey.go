@@ -0,0 +1,129 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
+
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// showHelpAndExit displays some help and exits.
+func showHelpAndExit() {
+
+	fmt.Println("lcpapikey manages the API keys of the License Server or the Status Server, stored in their database.")
+	fmt.Println("The configuration is read from the file referenced by READIUM_LCPSERVER_CONFIG, or READIUM_LSDSERVER_CONFIG with -server lsd.")
+	fmt.Println("-server   optional, server whose keys are managed, 'lcp' (default) or 'lsd'")
+	fmt.Println("-create   name of a key to create; its token is displayed once, only a hash is stored")
+	fmt.Println("-scopes   used with -create, comma separated list of scopes among " + strings.Join(apikey.Scopes, ", "))
+	fmt.Println("-tenant   optional, used with -create; restricts the key to a tenant of the License Server")
+	fmt.Println("-list     lists the keys")
+	fmt.Println("-revoke   id of a key to revoke")
+	fmt.Println("-help :   help information")
+	os.Exit(0)
+}
+
+// exitWithError outputs an error message and exits.
+func exitWithError(context string, err error) {
+
+	fmt.Println(context, ":", err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	server := flag.String("server", "lcp", "server whose keys are managed, lcp or lsd")
+	create := flag.String("create", "", "name of a key to create")
+	scopes := flag.String("scopes", "", "scopes of the created key")
+	tenant := flag.String("tenant", "", "tenant of the created key")
+	list := flag.Bool("list", false, "lists the keys")
+	revoke := flag.String("revoke", "", "id of a key to revoke")
+	help := flag.Bool("help", false, "shows information")
+
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	if *help || (*server != "lcp" && *server != "lsd") || (*create == "" && !*list && *revoke == "") {
+		showHelpAndExit()
+	}
+
+	envVar := "READIUM_LCPSERVER_CONFIG"
+	if *server == "lsd" {
+		envVar = "READIUM_LSDSERVER_CONFIG"
+	}
+	configFile := os.Getenv(envVar)
+	if configFile == "" {
+		configFile = "config.yaml"
+	}
+	config.ReadConfig(configFile)
+
+	database := config.Config.LcpServer.Database
+	if *server == "lsd" {
+		database = config.Config.LsdServer.Database
+		if *tenant != "" {
+			exitWithError("Error creating the key", errors.New("tenants are only defined on the License Server"))
+		}
+	}
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		exitWithError("Error opening the database", err)
+	}
+	st, err := apikey.Open(db, database)
+	if err != nil {
+		exitWithError("Error opening the API key table", err)
+	}
+
+	switch {
+	case *create != "":
+		var list []string
+		if *scopes != "" {
+			list = strings.Split(*scopes, ",")
+		}
+		k, token, err := createKey(st, *create, *tenant, list)
+		if err != nil {
+			exitWithError("Error creating the key", err)
+		}
+		fmt.Println("Created the key " + k.ID + " (" + k.Name + ")")
+		fmt.Println("Token: " + token)
+	case *revoke != "":
+		if err = st.Delete(*revoke); err != nil {
+			exitWithError("Error revoking the key", err)
+		}
+		fmt.Println("Revoked the key " + *revoke)
+	default:
+		fn := st.List()
+		var k apikey.Key
+		for k, err = fn(); err == nil; k, err = fn() {
+			fmt.Printf("%s  %-24s  %-12s  %s  %s\n", k.ID, k.Name, k.Tenant, k.Created.Format("2006-01-02"), strings.Join(k.Scopes, ","))
+		}
+		if err != apikey.ErrNotFound {
+			exitWithError("Error listing the keys", err)
+		}
+	}
+}
+
+// createKey creates and records a key, and returns it with its token
+func createKey(st apikey.Store, name string, tenant string, scopes []string) (apikey.Key, string, error) {
+	for i := range scopes {
+		scopes[i] = strings.TrimSpace(scopes[i])
+	}
+	k, token, err := apikey.New(name, tenant, scopes)
+	if err != nil {
+		return k, "", err
+	}
+	return k, token, st.Add(k)
+}
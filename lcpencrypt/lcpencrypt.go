@@ -27,16 +27,20 @@ func showHelpAndExit() {
 
 	fmt.Println("lcpencrypt encrypts a publication using the LCP DRM.")
 	fmt.Println("Software Version " + Software_Version)
-	fmt.Println("-input      source epub/pdf/lpf/audiobook file locator (file system or http GET)")
+	fmt.Println("-input      source epub/pdf/lpf/audiobook/divina/cbz file locator (file system or http GET), Divina manifest (json), or folder or zip of mp3/m4a audio tracks")
 	fmt.Println("-provider   publication provider (URI)")
 	fmt.Println("-storage    optional, target location of the encrypted publication, without filename. File system path or s3 bucket")
 	fmt.Println("-url        optional, base url associated with the storage, without filename")
 	fmt.Println("-s3-endpoint           optional, custom S3 endpoint URL for S3-compatible providers (e.g. Cloudflare R2, MinIO)")
 	fmt.Println("-s3-force-path-style   optional, boolean, use path-style S3 URLs; required by some S3-compatible providers")
 	fmt.Println("-s3-disable-ssl        optional, boolean, disable SSL when talking to the S3 endpoint")
+	fmt.Println("-s3-part-size          optional, size in MB of the parts of a multipart upload to S3; 16 by default, 5 minimum")
+	fmt.Println("-s3-concurrency        optional, number of parts uploaded to S3 in parallel; 4 by default")
+	fmt.Println("-resume     optional, boolean, stores on S3 a publication encrypted by an interrupted run with the same contentid and content key, instead of encrypting it again; the content key is not saved by the interrupted run, it must be set by -contentkey or retrieved from the License Server")
 	fmt.Println("-filename   optional, file name for the encrypted publication; if omitted, contentid is used")
 	fmt.Println("-temp       optional, working folder for temporary files. If not set, the current directory will be used.")
 	fmt.Println("-cover      optional, boolean, indicates that a cover should be generated")
+	fmt.Println("-thumbnail  optional, maximum width and height in pixels of the cover extracted from an EPUB; if omitted, the original image is kept")
 	fmt.Println("-pdfnometa  optional, boolean, indicates that PDF metadata must not be extracted")
 	fmt.Println("-contentid  optional, publication identifier; if omitted a uuid is generated")
 	fmt.Println("-contentkey optional, base64 encoded content key; if omitted a random content key is generated, or the content key is retrieved from the License Server")
@@ -68,6 +72,7 @@ func main() {
 	outputRepo := flag.String("output", "", "target folder of encrypted publications")
 	tempRepo := flag.String("temp", "", "working folder for temporary files")
 	cover := flag.Bool("cover", false, "boolean, indicates that covers must be generated when possible")
+	thumbnail := flag.Int("thumbnail", 0, "maximum size in pixels of the cover thumbnail, 0 keeps the original image")
 	pdfnometa := flag.Bool("pdfnometa", false, "boolean, indicates that PDF metadata must not be extracted")
 	useFilenameAs := flag.String("usefnas", "", "if set to 'uuid', the file name is used as publication uuid")
 	contentid := flag.String("contentid", "", "imposed publication UUID, used to update an existing publication")
@@ -81,6 +86,9 @@ func main() {
 	s3Endpoint := flag.String("s3-endpoint", "", "optional, custom S3 endpoint for S3-compatible storage providers (e.g. Cloudflare R2, MinIO, Backblaze B2)")
 	s3ForcePathStyle := flag.Bool("s3-force-path-style", false, "optional, use path-style S3 URLs (bucket in path instead of subdomain); often required by S3-compatible providers")
 	s3DisableSSL := flag.Bool("s3-disable-ssl", false, "optional, disable SSL when talking to the S3 endpoint; intended for local/dev S3-compatible servers")
+	s3PartSize := flag.Int64("s3-part-size", 0, "optional, size in MB of the parts of a multipart upload to S3")
+	s3Concurrency := flag.Int("s3-concurrency", 0, "optional, number of parts uploaded to S3 in parallel")
+	resume := flag.Bool("resume", false, "optional, stores on S3 a publication encrypted by an interrupted run, instead of encrypting it again")
 
 	help := flag.Bool("help", false, "shows information")
 
@@ -107,6 +115,10 @@ func main() {
 		exitWithError("Parameters", errors.New("incorrect parameters, storage must not contain a file name, for more information type 'lcpencrypt -help' "))
 	}
 
+	if *resume && *contentid == "" && *useFilenameAs != "uuid" {
+		exitWithError("Parameters", errors.New("incorrect parameters, resume requires contentid, for more information type 'lcpencrypt -help' "))
+	}
+
 	start := time.Now()
 
 	// get the file name from the input path, strip the extension
@@ -136,8 +148,11 @@ func main() {
 		Endpoint:       *s3Endpoint,
 		ForcePathStyle: *s3ForcePathStyle,
 		DisableSSL:     *s3DisableSSL,
+		PartSize:       *s3PartSize * 1024 * 1024,
+		Concurrency:    *s3Concurrency,
+		Resume:         *resume,
 	}
-	publication, err := encrypt.ProcessEncryption(*contentid, *contentkey, *inputPath, *tempRepo, *outputRepo, *storageRepo, *storageURL, *storageFilename, *cover, *pdfnometa, s3opts)
+	publication, err := encrypt.ProcessEncryption(*contentid, *contentkey, *inputPath, *tempRepo, *outputRepo, *storageRepo, *storageURL, *storageFilename, *cover, *pdfnometa, *thumbnail, s3opts)
 	if err != nil {
 		exitWithError("Error processing a publication", err)
 	}
@@ -0,0 +1,75 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+)
+
+// Options are the parameters of a license generated offline
+type Options struct {
+	Certificate *tls.Certificate
+	Provider    string
+	// the encrypted publication
+	Content index.Content
+	User    license.UserInfo
+	// the passphrase of the user, in clear, and its hint
+	Passphrase string
+	Hint       string
+	Rights     license.UserRights
+	// hint page and status document urls; they may contain a {license_id} template
+	HintURL   string
+	StatusURL string
+}
+
+// generateLicense builds and signs a license like the License Server does, without any database
+func generateLicense(opt Options) (*license.License, error) {
+
+	if opt.Content.ID == "" || len(opt.Content.EncryptionKey) == 0 {
+		return nil, errors.New("the content id and content key are mandatory")
+	}
+	if opt.User.ID == "" || opt.Passphrase == "" || opt.Hint == "" || opt.HintURL == "" {
+		return nil, errors.New("the user id, passphrase, hint and hint url are mandatory")
+	}
+
+	var l license.License
+	l.Provider = opt.Provider
+	l.User = opt.User
+	rights := opt.Rights
+	l.Rights = &rights
+	hash := sha256.Sum256([]byte(opt.Passphrase))
+	l.Encryption.UserKey.Hint = opt.Hint
+	l.Encryption.UserKey.Value = hash[:]
+	license.Initialize(opt.Content.ID, &l)
+
+	err := license.SetLicenseProfile(&l)
+	if err != nil {
+		return nil, err
+	}
+	l.Encryption.UserKey.Algorithm = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+	links := map[string]string{"hint": opt.HintURL}
+	if opt.StatusURL != "" {
+		links["status"] = opt.StatusURL
+	}
+	err = license.SetLicenseLinksFrom(&l, opt.Content, links)
+	if err != nil {
+		return nil, err
+	}
+	err = license.EncryptLicenseFields(&l, opt.Content)
+	if err != nil {
+		return nil, err
+	}
+	err = license.SignLicense(&l, opt.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/crypto"
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+)
+
+func testOptions(t *testing.T) Options {
+	cert, err := tls.LoadX509KeyPair("../test/cert/cert-edrlab-test.pem", "../test/cert/privkey-edrlab-test.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Config.Profile = "basic"
+	end := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, 30)
+	return Options{
+		Certificate: &cert,
+		Provider:    "https://www.edrlab.org",
+		Content: index.Content{ID: "c1", EncryptionKey: bytes.Repeat([]byte{1}, 32),
+			Location: "https://example.com/c1.epub", Type: epub.ContentType_EPUB},
+		User:       license.UserInfo{ID: "u1", Email: "user@example.com", Encrypted: []string{"email"}},
+		Passphrase: "passphrase",
+		Hint:       "The passphrase",
+		Rights:     license.UserRights{End: &end},
+		HintURL:    "https://example.com/hint",
+		StatusURL:  "https://lsd.example.com/licenses/{license_id}/status",
+	}
+}
+
+func TestGenerateLicense(t *testing.T) {
+	opt := testOptions(t)
+	lic, err := generateLicense(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lic.Signature == nil || lic.Encryption.Profile != license.BasicProfileURL || !lic.Rights.End.Equal(*opt.Rights.End) {
+		t.Errorf("Unexpected license %+v", lic)
+	}
+	if lic.User.Email == opt.User.Email {
+		t.Error("Expected an encrypted email")
+	}
+
+	// the key check and the content key are decrypted with the user key
+	userKey := sha256.Sum256([]byte(opt.Passphrase))
+	decrypter := crypto.NewAESEncrypter_USER_KEY_CHECK().(crypto.Decrypter)
+	var out bytes.Buffer
+	if err = decrypter.Decrypt(userKey[:], bytes.NewReader(lic.Encryption.UserKey.Check), &out); err != nil || out.String() != lic.ID {
+		t.Errorf("Unexpected key check %q, %v", out.String(), err)
+	}
+	out.Reset()
+	if err = decrypter.Decrypt(userKey[:], bytes.NewReader(lic.Encryption.ContentKey.Value), &out); err != nil || !bytes.Equal(out.Bytes(), opt.Content.EncryptionKey) {
+		t.Errorf("Unexpected content key %x, %v", out.Bytes(), err)
+	}
+
+	rels := make(map[string]string)
+	for _, link := range lic.Links {
+		rels[link.Rel] = link.Href
+	}
+	if rels["hint"] != opt.HintURL || rels["status"] != "https://lsd.example.com/licenses/"+lic.ID+"/status" || rels["publication"] != opt.Content.Location {
+		t.Errorf("Unexpected links %v", rels)
+	}
+
+	opt.Passphrase = ""
+	if _, err = generateLicense(opt); err == nil {
+		t.Error("Expected an error without passphrase")
+	}
+}
+
+func TestInjectLicense(t *testing.T) {
+	lic, err := generateLicense(testOptions(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := os.ReadFile("../test/samples/sample.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(pub), int64(len(pub)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err = license.WriteProtectedPublication(&out, zr, lic); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err = zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open(epub.LicenseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var injected license.License
+	if err = json.NewDecoder(f).Decode(&injected); err != nil || injected.ID != lic.ID {
+		t.Errorf("Unexpected injected license %s, %v", injected.ID, err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+)
+
+// content types of the encrypted publications, by file extension
+var contentTypes = map[string]string{
+	".epub":   epub.ContentType_EPUB,
+	".lcpdf":  "application/pdf+lcp",
+	".lcpa":   "application/audiobook+lcp",
+	".lcpau":  "application/audiobook+lcp",
+	".lcpdi":  "application/divina+lcp",
+	".webpub": "application/webpub+lcp",
+}
+
+// showHelpAndExit displays some help and exits.
+func showHelpAndExit() {
+
+	fmt.Println("lcplicense generates a signed LCP license without License Server, e.g. for testing reading apps.")
+	fmt.Println("-cert        X509 certificate of the provider (PEM file)")
+	fmt.Println("-key         private key of the certificate (PEM file)")
+	fmt.Println("-contentid   publication identifier")
+	fmt.Println("-contentkey  base64 encoded content key, as used by lcpencrypt")
+	fmt.Println("-url         optional, url of the encrypted publication, set in the publication link")
+	fmt.Println("-type        optional, media type of the encrypted publication; deduced from the extension of the input file")
+	fmt.Println("-provider    optional, provider of the publication (URI)")
+	fmt.Println("-userid      user identifier")
+	fmt.Println("-email       optional, user email, encrypted in the license")
+	fmt.Println("-name        optional, user name, encrypted in the license")
+	fmt.Println("-passphrase  user passphrase, in clear")
+	fmt.Println("-hint        passphrase hint")
+	fmt.Println("-hinturl     url of the hint page")
+	fmt.Println("-statusurl   optional, url of the status document; {license_id} is replaced by the license id")
+	fmt.Println("-start       optional, start of the rights, RFC 3339 date")
+	fmt.Println("-end         optional, end of the rights, RFC 3339 date")
+	fmt.Println("-print       optional, number of pages which may be printed; unlimited if negative (default)")
+	fmt.Println("-copy        optional, number of characters which may be copied; unlimited if negative (default)")
+	fmt.Println("-profile     optional, LCP profile, 'basic' (default) or a production profile such as '1.0'")
+	fmt.Println("-transform   optional, command of the user key transform of a production profile")
+	fmt.Println("-input       optional, encrypted EPUB or Readium package (RPF) in which the license is injected")
+	fmt.Println("-output      optional, target file of the license, or of the protected publication if input is set; stdout by default")
+	fmt.Println("-help :      help information")
+	os.Exit(0)
+}
+
+// exitWithError outputs an error message and exits.
+func exitWithError(context string, err error) {
+
+	fmt.Fprintln(os.Stderr, context, ":", err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	certFile := flag.String("cert", "", "X509 certificate of the provider")
+	keyFile := flag.String("key", "", "private key of the certificate")
+	contentID := flag.String("contentid", "", "publication identifier")
+	contentKey := flag.String("contentkey", "", "base64 encoded content key")
+	contentURL := flag.String("url", "", "url of the encrypted publication")
+	contentType := flag.String("type", "", "media type of the encrypted publication")
+	provider := flag.String("provider", "", "provider of the publication")
+	userID := flag.String("userid", "", "user identifier")
+	email := flag.String("email", "", "user email")
+	name := flag.String("name", "", "user name")
+	passphrase := flag.String("passphrase", "", "user passphrase")
+	hint := flag.String("hint", "", "passphrase hint")
+	hintURL := flag.String("hinturl", "", "url of the hint page")
+	statusURL := flag.String("statusurl", "", "url of the status document")
+	start := flag.String("start", "", "start of the rights")
+	end := flag.String("end", "", "end of the rights")
+	printRight := flag.Int("print", -1, "number of pages which may be printed")
+	copyRight := flag.Int("copy", -1, "number of characters which may be copied")
+	profile := flag.String("profile", "basic", "LCP profile")
+	transform := flag.String("transform", "", "command of the user key transform")
+	inputPath := flag.String("input", "", "encrypted publication")
+	outputPath := flag.String("output", "", "target file")
+	help := flag.Bool("help", false, "shows information")
+
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	if *help || *certFile == "" || *keyFile == "" {
+		showHelpAndExit()
+	}
+	if *inputPath != "" && *outputPath == "" {
+		exitWithError("Parameters", errors.New("incorrect parameters, input requires output, for more information type 'lcplicense -help'"))
+	}
+
+	cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+	if err != nil {
+		exitWithError("Error loading the certificate", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(*contentKey)
+	if err != nil {
+		exitWithError("Error decoding the content key", err)
+	}
+
+	// the user key of a production profile is derived by an external transform
+	config.Config.Profile = *profile
+	var transforms map[string]config.UserKeyTransform
+	if *transform != "" {
+		transforms = map[string]config.UserKeyTransform{"http://readium.org/lcp/profile-" + *profile: {Command: *transform}}
+	}
+	if err = license.InitUserKeyTransforms(transforms); err != nil {
+		exitWithError("Error initializing the user key transform", err)
+	}
+
+	opt := Options{
+		Certificate: &cert,
+		Provider:    *provider,
+		Content:     index.Content{ID: *contentID, EncryptionKey: key, Location: *contentURL, Type: *contentType},
+		User:        license.UserInfo{ID: *userID, Email: *email, Name: *name},
+		Passphrase:  *passphrase,
+		Hint:        *hint,
+		HintURL:     *hintURL,
+		StatusURL:   *statusURL,
+	}
+	// the user email and name are encrypted, like in the fresh licenses requested by the Status Server
+	if *email != "" {
+		opt.User.Encrypted = append(opt.User.Encrypted, "email")
+	}
+	if *name != "" {
+		opt.User.Encrypted = append(opt.User.Encrypted, "name")
+	}
+	if opt.Rights.Start, err = parseDate(*start); err != nil {
+		exitWithError("Error parsing -start", err)
+	}
+	if opt.Rights.End, err = parseDate(*end); err != nil {
+		exitWithError("Error parsing -end", err)
+	}
+	if *printRight >= 0 {
+		p := int32(*printRight)
+		opt.Rights.Print = &p
+	}
+	if *copyRight >= 0 {
+		c := int32(*copyRight)
+		opt.Rights.Copy = &c
+	}
+
+	// the publication link describes the encrypted publication
+	var pub []byte
+	if *inputPath != "" {
+		if pub, err = os.ReadFile(*inputPath); err != nil {
+			exitWithError("Error reading the publication", err)
+		}
+		sum := sha256.Sum256(pub)
+		opt.Content.Length = int64(len(pub))
+		opt.Content.Sha256 = hex.EncodeToString(sum[:])
+		if opt.Content.Type == "" {
+			opt.Content.Type = contentTypes[strings.ToLower(filepath.Ext(*inputPath))]
+		}
+	}
+
+	lic, err := generateLicense(opt)
+	if err != nil {
+		exitWithError("Error generating the license", err)
+	}
+
+	var out bytes.Buffer
+	if pub != nil {
+		zr, err := zip.NewReader(bytes.NewReader(pub), int64(len(pub)))
+		if err != nil {
+			exitWithError("Error reading the publication", err)
+		}
+		err = license.WriteProtectedPublication(&out, zr, lic)
+		if err != nil {
+			exitWithError("Error writing the protected publication", err)
+		}
+	} else {
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		enc.Encode(lic)
+	}
+
+	if *outputPath == "" {
+		os.Stdout.Write(out.Bytes())
+		return
+	}
+	if err = os.WriteFile(*outputPath, out.Bytes(), 0644); err != nil {
+		exitWithError("Error writing the output", err)
+	}
+	fmt.Println("License " + lic.ID + " written to " + *outputPath)
+}
+
+// parseDate parses an optional RFC 3339 date
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
+	"gopkg.in/yaml.v2"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+)
+
+// showHelpAndExit displays some help and exits.
+func showHelpAndExit() {
+
+	fmt.Println("lcpreconcile reports the discrepancies between the licenses of the License Server and the status documents of the Status Server:")
+	fmt.Println("licenses without status document, end dates which differ, status documents without license.")
+	fmt.Println("The License Server configuration is read from the file referenced by READIUM_LCPSERVER_CONFIG;")
+	fmt.Println("it must also define the lsd section, or the Status Server configuration must be passed with -lsdconfig.")
+	fmt.Println("-lsdconfig  optional, path to the configuration file of the Status Server, whose lsd section is used")
+	fmt.Println("-since      optional, date (YYYY-MM-DD); only checks the licenses issued or updated since this date")
+	fmt.Println("-repair     optional, boolean; creates the missing status documents via the Status Server, and re-syncs end dates")
+	fmt.Println("-trust      optional, used with -repair; source of the end dates, 'status' (default) or 'license'")
+	fmt.Println("-pagesize   optional, number of records read at once (default 100)")
+	fmt.Println("-help :     help information")
+	os.Exit(0)
+}
+
+// exitWithError outputs an error message and exits.
+func exitWithError(context string, err error) {
+
+	fmt.Println(context, ":", err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	lsdConfig := flag.String("lsdconfig", "", "configuration file of the Status Server")
+	since := flag.String("since", "", "only checks the licenses issued or updated since this date")
+	repair := flag.Bool("repair", false, "repair the discrepancies")
+	trust := flag.String("trust", "status", "source of the end dates, status or license")
+	pageSize := flag.Int("pagesize", 100, "number of records read at once")
+	help := flag.Bool("help", false, "shows information")
+
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	if *help || (*trust != "status" && *trust != "license") {
+		showHelpAndExit()
+	}
+
+	configFile := os.Getenv("READIUM_LCPSERVER_CONFIG")
+	if configFile == "" {
+		configFile = "config.yaml"
+	}
+	config.ReadConfig(configFile)
+
+	if *lsdConfig != "" {
+		data, err := os.ReadFile(*lsdConfig)
+		if err != nil {
+			exitWithError("Error reading the Status Server configuration", err)
+		}
+		var c config.Configuration
+		if err = yaml.Unmarshal(data, &c); err != nil {
+			exitWithError("Error reading the Status Server configuration", err)
+		}
+		config.Config.LsdServer = c.LsdServer
+	}
+	if config.Config.LsdServer.Database == "" {
+		exitWithError("Error reading the configuration", errors.New("no Status Server database"))
+	}
+
+	opt := Options{PageSize: *pageSize, Repair: *repair, TrustLicense: *trust == "license", CreateStatus: createStatus}
+	if *since != "" {
+		t, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			exitWithError("Error parsing -since", err)
+		}
+		opt.Since = &t
+	}
+	if opt.Repair && config.Config.LsdServer.PublicBaseUrl == "" {
+		exitWithError("Error reading the configuration", errors.New("no Status Server url, status documents cannot be created"))
+	}
+
+	licenses, err := openLicenses()
+	if err != nil {
+		exitWithError("Error opening the License Server database", err)
+	}
+	statuses, err := openStatuses()
+	if err != nil {
+		exitWithError("Error opening the Status Server database", err)
+	}
+
+	report, err := reconcile(licenses, statuses, opt)
+	if err != nil {
+		exitWithError("Error reconciling the servers", err)
+	}
+	report.Print(os.Stdout)
+	if !report.OK() {
+		os.Exit(2)
+	}
+}
+
+// openLicenses opens the license store of the License Server, for all tenants
+func openLicenses() (license.Store, error) {
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		return nil, err
+	}
+	return license.Open(db)
+}
+
+// openStatuses opens the license status store of the Status Server
+func openStatuses() (licensestatuses.LicenseStatuses, error) {
+	driver, cnxn := config.GetDatabase(config.Config.LsdServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		return nil, err
+	}
+	return licensestatuses.Open(db)
+}
+
+// createStatus sends a license to the Status Server, like the License Server does when the license is generated
+func createStatus(l license.License) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", config.Config.LsdServer.PublicBaseUrl+"/licenses", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	notifyAuth := config.Config.LsdNotifyAuth
+	if notifyAuth.Username != "" {
+		req.SetBasicAuth(notifyAuth.Username, notifyAuth.Password)
+	}
+	req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
+
+	client := &http.Client{Timeout: time.Second * 10}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("status server returned %s for license %s", resp.Status, l.ID)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/readium/readium-lcp-server/license"
+	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+)
+
+// Mismatch describes a license whose end date differs from the end date of its status document
+type Mismatch struct {
+	LicenseID  string
+	LicenseEnd *time.Time
+	StatusEnd  *time.Time
+}
+
+// Report lists the discrepancies found between the License Server and the Status Server
+type Report struct {
+	Licenses      int
+	Statuses      int
+	MissingStatus []string   // ids of licenses without a status document
+	EndMismatch   []Mismatch // licenses whose end date differs from the status document
+	OrphanStatus  []string   // license refs of status documents without a license
+	Repaired      int
+	Failed        []string // ids of licenses whose repair failed
+}
+
+// OK indicates that no discrepancy is left
+func (r Report) OK() bool {
+	if len(r.OrphanStatus) > 0 || len(r.Failed) > 0 {
+		return false
+	}
+	return len(r.MissingStatus)+len(r.EndMismatch) == r.Repaired
+}
+
+// Print displays the report
+func (r Report) Print(w io.Writer) {
+	for _, id := range r.MissingStatus {
+		fmt.Fprintln(w, "missing status document for license", id)
+	}
+	for _, m := range r.EndMismatch {
+		fmt.Fprintf(w, "end mismatch for license %s: license %s, status %s\n", m.LicenseID, formatEnd(m.LicenseEnd), formatEnd(m.StatusEnd))
+	}
+	for _, id := range r.OrphanStatus {
+		fmt.Fprintln(w, "orphan status document for license", id)
+	}
+	for _, id := range r.Failed {
+		fmt.Fprintln(w, "repair failed for license", id)
+	}
+	fmt.Fprintf(w, "%d licenses and %d status documents checked: %d missing statuses, %d end mismatches, %d orphan statuses, %d repaired\n",
+		r.Licenses, r.Statuses, len(r.MissingStatus), len(r.EndMismatch), len(r.OrphanStatus), r.Repaired)
+}
+
+func formatEnd(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Options drives a reconciliation
+type Options struct {
+	// Since restricts the check to the licenses issued or updated after this date
+	Since    *time.Time
+	PageSize int
+	// Repair creates the missing status documents and re-syncs the end dates
+	Repair bool
+	// TrustLicense re-syncs the status documents from the licenses;
+	// by default the licenses are re-synced from the status documents,
+	// as renewals and returns are processed by the Status Server.
+	TrustLicense bool
+	// CreateStatus asks the Status Server to create the status document of a license
+	CreateStatus func(l license.License) error
+}
+
+// sameEnd compares two end dates at the precision of the databases
+func sameEnd(a, b *time.Time) bool {
+	if a != nil && a.IsZero() {
+		a = nil
+	}
+	if b != nil && b.IsZero() {
+		b = nil
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// reconcile pages through the licenses and the status documents and reports the discrepancies.
+// Pages are read entirely before being processed, so that repairs do not interfere with open queries.
+func reconcile(licenses license.Store, statuses licensestatuses.LicenseStatuses, opt Options) (Report, error) {
+	var report Report
+	if opt.PageSize <= 0 {
+		opt.PageSize = 100
+	}
+
+	// licenses are sorted by issue date, so that licenses created meanwhile come last
+	for page := 0; ; page++ {
+		_, fn, err := licenses.Search(license.SearchFilter{UpdatedSince: opt.Since, Sort: "issued", Page: page, PerPage: opt.PageSize})
+		if err != nil {
+			return report, err
+		}
+		var reports []license.LicenseReport
+		var l license.LicenseReport
+		for l, err = fn(); err == nil; l, err = fn() {
+			reports = append(reports, l)
+		}
+		if err != license.ErrNotFound {
+			return report, err
+		}
+		for _, l := range reports {
+			report.Licenses++
+			if err = checkLicense(l, licenses, statuses, opt, &report); err != nil {
+				return report, err
+			}
+		}
+		if len(reports) < opt.PageSize {
+			break
+		}
+	}
+
+	for offset := int64(0); ; offset += int64(opt.PageSize) {
+		var refs []string
+		fn := statuses.List(0, int64(opt.PageSize), offset)
+		ls, err := fn()
+		for ; err == nil; ls, err = fn() {
+			refs = append(refs, ls.LicenseRef)
+		}
+		if err != licensestatuses.ErrNotFound {
+			return report, err
+		}
+		for _, ref := range refs {
+			report.Statuses++
+			_, err = licenses.Get(ref)
+			if err == license.ErrNotFound {
+				report.OrphanStatus = append(report.OrphanStatus, ref)
+			} else if err != nil {
+				return report, err
+			}
+		}
+		if len(refs) < opt.PageSize {
+			break
+		}
+	}
+	return report, nil
+}
+
+// checkLicense compares a license with its status document, and repairs them if requested
+func checkLicense(l license.LicenseReport, licenses license.Store, statuses licensestatuses.LicenseStatuses, opt Options, report *Report) error {
+
+	ls, err := statuses.GetByLicenseID(l.ID)
+	if err == licensestatuses.ErrNotFound {
+		report.MissingStatus = append(report.MissingStatus, l.ID)
+		if !opt.Repair {
+			return nil
+		}
+		lic, err := licenses.Get(l.ID)
+		if err != nil {
+			return err
+		}
+		if err = opt.CreateStatus(lic); err != nil {
+			report.Failed = append(report.Failed, l.ID)
+			return nil
+		}
+		report.Repaired++
+		return licenses.UpdateLsdStatus(l.ID, http.StatusCreated)
+	}
+	if err != nil {
+		return err
+	}
+
+	if sameEnd(l.Rights.End, ls.CurrentEndLicense) {
+		return nil
+	}
+	report.EndMismatch = append(report.EndMismatch, Mismatch{LicenseID: l.ID, LicenseEnd: l.Rights.End, StatusEnd: ls.CurrentEndLicense})
+	if !opt.Repair {
+		return nil
+	}
+	if opt.TrustLicense {
+		now := time.Now().UTC().Truncate(time.Second)
+		ls.CurrentEndLicense = l.Rights.End
+		ls.Updated.License = &now
+		err = statuses.Update(*ls)
+	} else {
+		rights := *l.Rights
+		rights.End = ls.CurrentEndLicense
+		err = licenses.UpdateRights(license.License{ID: l.ID, Rights: &rights})
+	}
+	if err != nil {
+		report.Failed = append(report.Failed, l.ID)
+		return nil
+	}
+	report.Repaired++
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/status"
+)
+
+func openTestDB(t *testing.T, database string) *sql.DB {
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestReconcile(t *testing.T) {
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	config.Config.LsdServer.Database = "sqlite3://:memory:"
+	licenses, err := license.Open(openTestDB(t, config.Config.LcpServer.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := licensestatuses.Open(openTestDB(t, config.Config.LsdServer.Database))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	addLicense := func(end *time.Time) string {
+		var l license.License
+		l.User.ID = "u1"
+		license.Initialize("c1", &l)
+		l.Rights = &license.UserRights{End: end}
+		if err := licenses.Add(l); err != nil {
+			t.Fatal(err)
+		}
+		return l.ID
+	}
+	addStatus := func(ref string, end *time.Time) {
+		count := 0
+		ls := licensestatuses.LicenseStatus{LicenseRef: ref, Status: status.STATUS_ACTIVE, CurrentEndLicense: end,
+			Updated: &licensestatuses.Updated{License: &now, Status: &now}, DeviceCount: &count}
+		if err := statuses.Add(ls); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	end := now.AddDate(0, 0, 10)
+	renewed := now.AddDate(0, 0, 20)
+	synced := addLicense(&end)
+	addStatus(synced, &end)
+	missing := addLicense(nil)
+	mismatch := addLicense(&end)
+	addStatus(mismatch, &renewed)
+	addStatus("unknown", nil)
+
+	report, err := reconcile(licenses, statuses, Options{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Licenses != 3 || report.Statuses != 3 {
+		t.Errorf("Expected 3 licenses and 3 statuses checked, got %d and %d", report.Licenses, report.Statuses)
+	}
+	if len(report.MissingStatus) != 1 || report.MissingStatus[0] != missing {
+		t.Errorf("Expected a missing status for %s, got %v", missing, report.MissingStatus)
+	}
+	if len(report.EndMismatch) != 1 || report.EndMismatch[0].LicenseID != mismatch {
+		t.Errorf("Expected an end mismatch for %s, got %v", mismatch, report.EndMismatch)
+	}
+	if len(report.OrphanStatus) != 1 || report.OrphanStatus[0] != "unknown" {
+		t.Errorf("Expected an orphan status, got %v", report.OrphanStatus)
+	}
+	if report.OK() {
+		t.Error("Expected discrepancies")
+	}
+
+	// the status server is simulated by a direct creation of the status document
+	create := func(l license.License) error {
+		addStatus(l.ID, l.Rights.End)
+		return nil
+	}
+	report, err = reconcile(licenses, statuses, Options{Repair: true, CreateStatus: create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Repaired != 2 {
+		t.Errorf("Expected 2 repairs, got %d", report.Repaired)
+	}
+	lic, err := licenses.Get(mismatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lic.Rights.End.Equal(renewed) {
+		t.Errorf("Expected the license end to be re-synced from the status, got %v", lic.Rights.End)
+	}
+	report, err = reconcile(licenses, statuses, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MissingStatus) != 0 || len(report.EndMismatch) != 0 {
+		t.Errorf("Expected no discrepancy after repair, got %v %v", report.MissingStatus, report.EndMismatch)
+	}
+
+	// the license is the source of the end date
+	if err = licenses.UpdateRights(license.License{ID: mismatch, Rights: &license.UserRights{End: &end}}); err != nil {
+		t.Fatal(err)
+	}
+	report, err = reconcile(licenses, statuses, Options{Repair: true, TrustLicense: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := statuses.GetByLicenseID(mismatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Repaired != 1 || ls.CurrentEndLicense == nil || !ls.CurrentEndLicense.Equal(end) {
+		t.Errorf("Expected the status end to be re-synced from the license, got %v", ls.CurrentEndLicense)
+	}
+}
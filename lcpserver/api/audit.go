@@ -0,0 +1,46 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// ListAudit returns the entries of the audit log, most recent first.
+// Parameters: principal, action, target, since, until, page, per_page.
+// A tenant only gets the entries of its own requests.
+func ListAudit(w http.ResponseWriter, r *http.Request, s Server) {
+
+	f, err := audit.ParseFilter(r)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if t := s.Tenant(); t != nil {
+		f.Tenant = t.Name
+	}
+	entries := make([]audit.Entry, 0)
+	fn := s.Audit().List(f)
+	var e audit.Entry
+	for e, err = fn(); err == nil; e, err = fn() {
+		entries = append(entries, e)
+	}
+	if err != audit.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(entries)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+	}
+}
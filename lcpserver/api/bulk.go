@@ -0,0 +1,120 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/bulk"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// CreateRightsJob records a job which updates the rights of a selection of licenses in the background.
+// The body holds the selection (content_id, user_id, issued_from, issued_to or license_ids)
+// and the rights (print, copy, end) applied to every selected license.
+// The job is returned with a 202 status; its progress is available at the url of the Location header.
+func CreateRightsJob(w http.ResponseWriter, r *http.Request, s Server) {
+
+	var j bulk.Job
+	err := json.NewDecoder(r.Body).Decode(&j)
+	if err == nil {
+		err = j.Validate()
+	}
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if t := s.Tenant(); t != nil {
+		j.Tenant = t.Name
+	}
+	err = s.RightsJobs().Submit(&j)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	logging.Print("Create the rights job " + j.ID)
+	audit.Describe(r, j.ID, nil, j)
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	w.Header().Set("Location", r.URL.Path+"/"+j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(j)
+}
+
+// GetRightsJob returns a rights job with its progress
+func GetRightsJob(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	tenant := ""
+	if t := s.Tenant(); t != nil {
+		tenant = t.Name
+	}
+	j, err := s.RightsJobs().Get(vars["job_id"], tenant)
+	if err == bulk.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(j)
+}
+
+// ApplyRights returns the function which applies the rights of a job to a license.
+// The license is updated and, if a Status Server is configured, the notification of the updated license
+// is recorded in the outbox in the same transaction, so that the Status Server syncs its end date.
+func ApplyRights(licenses license.Store, obx *outbox.Outbox) bulk.ApplyFunc {
+	return func(tenant string, licenseID string, rights bulk.Rights) error {
+		st := licenses
+		if tenant != "" {
+			st = st.ForTenant(tenant)
+		}
+		l, err := st.Get(licenseID)
+		if err != nil {
+			return err
+		}
+		if l.Rights == nil {
+			l.Rights = new(license.UserRights)
+		}
+		updateRights(l.Rights, license.UserRights{Print: rights.Print, Copy: rights.Copy, End: rights.End})
+		now := time.Now().UTC().Truncate(time.Second)
+		l.Updated = &now
+
+		notify := config.Config.LsdServer.PublicBaseUrl != ""
+		err = st.UpdateRightsAndNotify(l, func(tx *sql.Tx) error {
+			if !notify {
+				return nil
+			}
+			// the Status Server syncs the end date of the license status with the new rights
+			n, err := lsdNotification(l, url.Values{"sync_end": {"true"}})
+			if err != nil {
+				return err
+			}
+			return obx.AddTx(tx, n)
+		})
+		if err == nil && notify {
+			obx.Wake()
+		}
+		return err
+	}
+}
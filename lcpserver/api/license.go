@@ -7,6 +7,7 @@ package apilcp
 import (
 	"archive/zip"
 	"bytes"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -14,19 +15,24 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
 	"github.com/readium/readium-lcp-server/config"
 	"github.com/readium/readium-lcp-server/epub"
 	"github.com/readium/readium-lcp-server/index"
 	"github.com/readium/readium-lcp-server/license"
 	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/policy"
 	"github.com/readium/readium-lcp-server/problem"
 	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
 )
 
 // ErrMandatoryInfoMissing sets an error message returned to the caller
@@ -38,6 +44,12 @@ var ErrBadHexValue = errors.New("erroneous user_key.hex_value can't be decoded")
 // ErrBadValue sets an error message returned to the caller
 var ErrBadValue = errors.New("erroneous user_key.value, can't be decoded")
 
+// ErrUnknownPolicy sets an error message returned to the caller
+var ErrUnknownPolicy = errors.New("unknown rights policy")
+
+// ErrBadRights sets an error message returned to the caller
+var ErrBadRights = errors.New("invalid rights")
+
 // lastGeneratedLicense is for tests only
 var lastGeneratedLicense license.License
 
@@ -99,13 +111,20 @@ func copyInputToLicense(licIn *license.License, licOut *license.License) {
 	licOut.Links = licIn.Links
 }
 
+// expand the rights policy referenced by the partial license, if any,
 // normalize the start and end date, UTC, no milliseconds
-func setRights(lic *license.License) {
+func setRights(lic *license.License, s Server) error {
 
 	// a rights object is needed before adding a record to the db
 	if lic.Rights == nil {
 		lic.Rights = new(license.UserRights)
 	}
+	if lic.Policy != "" {
+		err := expandPolicy(lic, s)
+		if err != nil {
+			return err
+		}
+	}
 	if lic.Rights.Start != nil {
 		start := lic.Rights.Start.UTC().Truncate(time.Second)
 		lic.Rights.Start = &start
@@ -114,6 +133,53 @@ func setRights(lic *license.License) {
 		end := lic.Rights.End.UTC().Truncate(time.Second)
 		lic.Rights.End = &end
 	}
+	return nil
+}
+
+// expandPolicy sets the rights of a license from a named policy.
+// Rights present in the partial license override the ones of the policy.
+func expandPolicy(lic *license.License, s Server) error {
+
+	p, err := s.Policies().Get(lic.Policy)
+	if err == policy.ErrNotFound {
+		return fmt.Errorf("%w: %s", ErrUnknownPolicy, lic.Policy)
+	} else if err != nil {
+		return err
+	}
+	logging.Print("Apply the rights policy " + p.Name + " to the License " + lic.ID)
+	// the policy name is not part of the license
+	lic.Policy = ""
+
+	rights := lic.Rights
+	if rights.Print == nil {
+		rights.Print = p.Print
+	}
+	if rights.Copy == nil {
+		rights.Copy = p.Copy
+	}
+	if rights.Start == nil {
+		rights.Start = p.Start
+	}
+	if rights.End == nil {
+		// a relative policy starts with the license
+		start := lic.Issued
+		if rights.Start != nil {
+			start = *rights.Start
+		}
+		rights.End, err = p.EndFrom(start)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check the resulting rights
+	if (rights.Print != nil && *rights.Print < 0) || (rights.Copy != nil && *rights.Copy < 0) {
+		return fmt.Errorf("%w: print and copy rights cannot be negative", ErrBadRights)
+	}
+	if rights.Start != nil && rights.End != nil && !rights.End.After(*rights.Start) {
+		return fmt.Errorf("%w: the end date must be after the start date", ErrBadRights)
+	}
+	return nil
 }
 
 // build a license, common to get and generate license, get and generate a protected publication
@@ -136,8 +202,21 @@ func buildLicense(lic *license.License, s Server, updatefix bool) error {
 		return err
 	}
 
-	// set links
-	err = license.SetLicenseLinks(lic, content)
+	// a new license generated on the routes of the administrator belongs to the tenant of its content
+	if s.Tenant() == nil && lic.Tenant == "" {
+		lic.Tenant = content.Tenant
+	}
+	// set links; a tenant has its own links and certificate, and is the provider of its licenses
+	t, err := licenseTenant(lic, s)
+	if err != nil {
+		return err
+	}
+	links, cert := license.DefaultLinks, s.Certificate()
+	if t != nil {
+		lic.Provider = t.Provider
+		links, cert = t.Links, t.Certificate
+	}
+	err = license.SetLicenseLinksFrom(lic, content, links)
 	if err != nil {
 		return err
 	}
@@ -162,54 +241,46 @@ func buildLicense(lic *license.License, s Server, updatefix bool) error {
 	}
 
 	// sign the license
-	err = license.SignLicense(lic, s.Certificate())
+	err = license.SignLicense(lic, cert)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// copyZipFiles copies every file from one zip archive to another
-func copyZipFiles(out *zip.Writer, in *zip.Reader) error {
+// licenseTenant returns the tenant of a license, nil if the license belongs to no tenant.
+// The tenant is selected by the request, or by the license when the request is not restricted
+// to a tenant, e.g. when a stored license is fetched with the administrator credentials.
+func licenseTenant(lic *license.License, s Server) (*tenant.Tenant, error) {
 
-	for _, file := range in.File {
-		newFile, err := out.CreateHeader(&file.FileHeader)
-		if err != nil {
-			return err
-		}
-
-		r, err := file.Open()
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(newFile, r)
-		r.Close()
-		if err != nil {
-			return err
-		}
+	if t := s.Tenant(); t != nil {
+		lic.Tenant = t.Name
+		return t, nil
 	}
-
-	return nil
-}
-
-// isWebPub checks the presence of a REadium manifest is a zip package
-func isWebPub(in *zip.Reader) bool {
-
-	for _, f := range in.File {
-		if f.Name == "manifest.json" {
-			return true
-		}
+	if lic.Tenant == "" {
+		return nil, nil
 	}
-
-	return false
+	t := s.Tenants().Get(lic.Tenant)
+	if t == nil {
+		return nil, errors.New("unknown tenant " + lic.Tenant + " of the license " + lic.ID)
+	}
+	return t, nil
 }
 
 // buildProtectedPublication builds a protected publication, common to get and generate protected publication
 func buildProtectedPublication(lic *license.License, s Server) (buf bytes.Buffer, err error) {
 
+	// the content of a tenant is stored with the prefix of the tenant
+	st := s.Store()
+	if s.Tenant() == nil && lic.Tenant != "" {
+		t, err := licenseTenant(lic, s)
+		if err != nil {
+			return buf, err
+		}
+		st = storage.Prefixed(st, t.StoragePrefix)
+	}
 	// get content info from the bd
-	item, err := s.Store().Get(lic.ContentID)
+	item, err := st.Get(lic.ContentID)
 	if err != nil {
 		return
 	}
@@ -228,37 +299,8 @@ func buildProtectedPublication(lic *license.License, s Server) (buf bytes.Buffer
 		return buf, err
 	}
 
-	zipWriter := zip.NewWriter(&buf)
-	err = copyZipFiles(zipWriter, zr)
-	if err != nil {
-		return buf, err
-	}
-
-	// Encode the license to JSON, remove the trailing newline
-	// write the buffer in the zip
-	licenseBytes, err := json.Marshal(lic)
-	if err != nil {
-		return buf, err
-	}
-
-	licenseBytes = bytes.TrimRight(licenseBytes, "\n")
-
-	location := epub.LicenseFile
-	if isWebPub(zr) {
-		location = "license.lcpl"
-	}
-
-	licenseWriter, err := zipWriter.Create(location)
-	if err != nil {
-		return buf, err
-	}
-
-	_, err = licenseWriter.Write(licenseBytes)
-	if err != nil {
-		return
-	}
-
-	return buf, zipWriter.Close()
+	err = license.WriteProtectedPublication(&buf, zr, lic)
+	return buf, err
 }
 
 // GetTestLicense returns an existing license,
@@ -379,6 +421,19 @@ func GetLicense(w http.ResponseWriter, r *http.Request, s Server) {
 	}
 
 	// an input body was sent with the request:
+	// a partial license without user key is completed with the user key stored with the license
+	if licIn.Encryption.UserKey.Hint == "" && licIn.Encryption.UserKey.HexValue == "" && licIn.Encryption.UserKey.Value == nil {
+		key, err := s.Licenses().GetUserKey(licenseID)
+		if err == license.ErrNotFound {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+			return
+		} else if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		licIn.Encryption.UserKey.Hint = key.Hint
+		licIn.Encryption.UserKey.Value = key.Value
+	}
 	// check mandatory information in the partial license
 	err = checkGetLicenseInput(&licIn)
 	if err != nil {
@@ -440,8 +495,13 @@ func GenerateLicense(w http.ResponseWriter, r *http.Request, s Server) {
 	// add a log
 	logging.Print("Generate the License " + lic.ID + " for Content " + contentID + " and User " + lic.User.ID)
 
-	// normalize the start and end date, UTC, no milliseconds
-	setRights(&lic)
+	// expand the rights policy, normalize the start and end date, UTC, no milliseconds
+	policyName := lic.Policy
+	err = setRights(&lic, s)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
 
 	// build the license
 	err = buildLicense(&lic, s, false)
@@ -454,13 +514,14 @@ func GenerateLicense(w http.ResponseWriter, r *http.Request, s Server) {
 		return
 	}
 
-	// store the license in the db
-	err = s.Licenses().Add(lic)
+	// store the license in the db, with its notification to the lsd server
+	err = storeLicense(lic, policyName, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		//problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: contentID}, http.StatusInternalServerError)
 		return
 	}
+	audit.Describe(r, "", nil, storedLicense(lic))
 
 	// set http headers
 	w.Header().Add("Content-Type", api.ContentType_LCP_JSON)
@@ -471,10 +532,6 @@ func GenerateLicense(w http.ResponseWriter, r *http.Request, s Server) {
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
 	enc.Encode(lic)
-
-	// notify the lsd server of the creation of the license.
-	// this is an asynchronous call.
-	go notifyLsdServer(lic, s)
 }
 
 // GetProtectedPublication returns a protected publication
@@ -572,8 +629,13 @@ func GenerateProtectedPublication(w http.ResponseWriter, r *http.Request, s Serv
 	}
 	// init the license with an id and issue date
 	license.Initialize(contentID, &lic)
-	// normalize the start and end date, UTC, no milliseconds
-	setRights(&lic)
+	// expand the rights policy, normalize the start and end date, UTC, no milliseconds
+	policyName := lic.Policy
+	err = setRights(&lic, s)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
 
 	// build the license
 	err = buildLicense(&lic, s, false)
@@ -581,15 +643,13 @@ func GenerateProtectedPublication(w http.ResponseWriter, r *http.Request, s Serv
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
-	// store the license in the db
-	err = s.Licenses().Add(lic)
+	// store the license in the db, with its notification to the lsd server
+	err = storeLicense(lic, policyName, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: contentID}, http.StatusInternalServerError)
 		return
 	}
-
-	// notify the lsd server of the creation of the license
-	go notifyLsdServer(lic, s)
+	audit.Describe(r, "", nil, storedLicense(lic))
 
 	// build a licenced publication
 	buf, err := buildProtectedPublication(&lic, s)
@@ -655,12 +715,19 @@ func UpdateLicense(w http.ResponseWriter, r *http.Request, s Server) {
 		problem.Error(w, r, problem.Problem{Detail: e.Error()}, http.StatusBadRequest)
 		return
 	}
+	// keep the state of the license for the audit log; the rights are replaced, not modified
+	before := licOut
+	if licOut.Rights != nil {
+		rights := *licOut.Rights
+		before.Rights = &rights
+	}
 	// update licOut using information found in licIn
 	if licIn.User.ID != "" {
 		log.Println("new user id: ", licIn.User.ID)
 		licOut.User.ID = licIn.User.ID
 	}
-	if licIn.Provider != "" {
+	// the provider of the licenses of a tenant cannot be changed
+	if licIn.Provider != "" && s.Tenant() == nil {
 		log.Println("new provider: ", licIn.Provider)
 		licOut.Provider = licIn.Provider
 	}
@@ -668,50 +735,57 @@ func UpdateLicense(w http.ResponseWriter, r *http.Request, s Server) {
 		log.Println("new content id: ", licIn.ContentID)
 		licOut.ContentID = licIn.ContentID
 	}
-	if licIn.Rights.Print != nil {
-		log.Println("new right, print: ", *licIn.Rights.Print)
-		if *licIn.Rights.Print >= 0 {
-			licOut.Rights.Print = licIn.Rights.Print
+	updateRights(licOut.Rights, *licIn.Rights)
+	// update the license in the database
+	err = s.Licenses().Update(licOut)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	audit.Describe(r, "", before, licOut)
+}
+
+// updateRights applies the rights of a partial license to the rights of a license.
+// A negative print or copy right, or a zero date, removes the constraint.
+func updateRights(out *license.UserRights, in license.UserRights) {
+	if in.Print != nil {
+		log.Println("new right, print: ", *in.Print)
+		if *in.Print >= 0 {
+			out.Print = in.Print
 			// a negative value means "unconstrained" in the LCP specification
 		} else {
-			licOut.Rights.Print = nil
+			out.Print = nil
 		}
 	}
-	if licIn.Rights.Copy != nil {
-		log.Println("new right, copy: ", *licIn.Rights.Copy)
-		if *licIn.Rights.Copy >= 0 {
-			licOut.Rights.Copy = licIn.Rights.Copy
+	if in.Copy != nil {
+		log.Println("new right, copy: ", *in.Copy)
+		if *in.Copy >= 0 {
+			out.Copy = in.Copy
 			// a negative value means "unconstrained" in the LCP specification
 		} else {
-			licOut.Rights.Copy = nil
+			out.Copy = nil
 		}
 	}
-	if licIn.Rights.Start != nil {
-		log.Println("new right, start: ", *licIn.Rights.Start)
-		t := *licIn.Rights.Start
+	if in.Start != nil {
+		log.Println("new right, start: ", *in.Start)
+		t := *in.Start
 		if !t.IsZero() {
-			licOut.Rights.Start = licIn.Rights.Start
+			out.Start = in.Start
 			// the zero timestamp value "January 1, year 1, 00:00:00 UTC." means "unconstrained"
 		} else {
-			licOut.Rights.Start = nil
+			out.Start = nil
 		}
 	}
-	if licIn.Rights.End != nil {
-		log.Println("new right, end: ", *licIn.Rights.End)
-		t := *licIn.Rights.End
+	if in.End != nil {
+		log.Println("new right, end: ", *in.End)
+		t := *in.End
 		if !t.IsZero() {
-			licOut.Rights.End = licIn.Rights.End
+			out.End = in.End
 			// the zero timestamp value means "unconstrained"
 		} else {
-			licOut.Rights.End = nil
+			out.End = nil
 		}
 	}
-	// update the license in the database
-	err = s.Licenses().Update(licOut)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
 }
 
 // ListLicenses returns a JSON struct with information about the existing licenses
@@ -853,6 +927,106 @@ func ListLicensesForContent(w http.ResponseWriter, r *http.Request, s Server) {
 
 }
 
+// searchResult is the response of a license search
+type searchResult struct {
+	Total    int             `json:"total"`
+	Page     int             `json:"page"`
+	PerPage  int             `json:"per_page"`
+	Licenses []searchLicense `json:"licenses"`
+}
+
+// searchLicense is a license found by a search, with its content id
+type searchLicense struct {
+	license.LicenseReport
+	ContentID string `json:"content_id"`
+}
+
+// parseSearchDate parses an optional RFC 3339 date-time or a date (YYYY-MM-DD) from a form value
+func parseSearchDate(r *http.Request, name string) (*time.Time, error) {
+
+	value := r.FormValue(name)
+	if value == "" {
+		return nil, nil
+	}
+	d, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		d, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 date-time or a YYYY-MM-DD date", name)
+		}
+	}
+	return &d, nil
+}
+
+// SearchLicenses returns the licenses matching a set of filters, with their total count
+// parameters (all optional):
+//
+//	user_id, email, provider, content_id: exact match
+//	issued_from, issued_to, end_from, end_to: date ranges on the issue date and the end of the rights
+//	updated_since: licenses updated (or issued) since a date
+//	sort: issued, updated, end, user_id or provider, prefixed by "-" for a descending order (default -issued)
+//	page: page number (default 1)
+//	per_page: number of items par page (default 30, max 1000)
+func SearchLicenses(w http.ResponseWriter, r *http.Request, s Server) {
+
+	f := license.SearchFilter{
+		UserID:    r.FormValue("user_id"),
+		UserEmail: r.FormValue("email"),
+		Provider:  r.FormValue("provider"),
+		ContentID: r.FormValue("content_id"),
+		Sort:      r.FormValue("sort"),
+	}
+	var err error
+	dates := []struct {
+		name string
+		date **time.Time
+	}{
+		{"issued_from", &f.IssuedFrom}, {"issued_to", &f.IssuedTo},
+		{"end_from", &f.EndFrom}, {"end_to", &f.EndTo},
+		{"updated_since", &f.UpdatedSince},
+	}
+	for _, d := range dates {
+		*d.date, err = parseSearchDate(r, d.name)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	f.Page, f.PerPage, err = api.ParsePage(r)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	result := searchResult{Page: f.Page, PerPage: f.PerPage, Licenses: make([]searchLicense, 0)}
+	f.Page-- //pagenum starting at 0 in code, but user interface starting at 1
+
+	// add a log
+	logging.Print("Search Licenses (" + r.URL.RawQuery + ")")
+
+	total, fn, err := s.Licenses().Search(f)
+	if errors.Is(err, license.ErrBadSort) {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	result.Total = total
+	for it, err := fn(); err == nil; it, err = fn() {
+		result.Licenses = append(result.Licenses, searchLicense{it, it.ContentID})
+	}
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	// do not escape characters
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(result)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+}
+
 type licenseCount struct {
 	Total int       `json:"total"`
 	From  time.Time `json:"from"`
@@ -928,39 +1102,51 @@ func DecodeJSONLicense(r *http.Request, lic *license.License) error {
 	return err
 }
 
-// notifyLsdServer informs the License Status Server of the creation of a new license
-// and saves the result of the http request in the DB (using *Store)
-func notifyLsdServer(l license.License, s Server) {
+// storeLicense stores a new license. If a License Status Server is configured,
+// its notification is recorded in the outbox in the same transaction, then dispatched asynchronously.
+// The result of the notification is saved in the lsd_status column of the license.
+// The name of the rights policy of the license, if any, is sent as the name of its loan policy.
+func storeLicense(l license.License, policyName string, s Server) error {
 
-	if config.Config.LsdServer.PublicBaseUrl != "" {
-		var lsdClient = &http.Client{
-			Timeout: time.Second * 10,
-		}
-		pr, pw := io.Pipe()
-		defer pr.Close()
-		go func() {
-			_ = json.NewEncoder(pw).Encode(l)
-			pw.Close() // signal end writing
-		}()
-		req, err := http.NewRequest("PUT", config.Config.LsdServer.PublicBaseUrl+"/licenses", pr)
-		if err != nil {
-			return
-		}
-		// set credentials on lsd request
-		notifyAuth := config.Config.LsdNotifyAuth
-		if notifyAuth.Username != "" {
-			req.SetBasicAuth(notifyAuth.Username, notifyAuth.Password)
-		}
+	if config.Config.LsdServer.PublicBaseUrl == "" {
+		return s.Licenses().Add(l)
+	}
+	params := url.Values{}
+	if policyName != "" {
+		params.Set("policy", policyName)
+	}
+	n, err := lsdNotification(l, params)
+	if err != nil {
+		return err
+	}
+	err = s.Licenses().AddAndNotify(l, func(tx *sql.Tx) error {
+		return s.Outbox().AddTx(tx, n)
+	})
+	if err == nil {
+		s.Outbox().Wake()
+	}
+	return err
+}
+
+// storedLicense returns the fields of a license which are stored in the db, as recorded in the audit log
+func storedLicense(l license.License) license.License {
+	return license.License{
+		ID:       l.ID,
+		Provider: l.Provider,
+		Issued:   l.Issued,
+		Updated:  l.Updated,
+		User:     license.UserInfo{ID: l.User.ID},
+		Rights:   l.Rights,
+	}
+}
 
-		req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
+// lsdNotification returns the notification of a new or updated license to the Status Server,
+// with optional query parameters
+func lsdNotification(l license.License, params url.Values) (outbox.Notification, error) {
 
-		response, err := lsdClient.Do(req)
-		if err != nil {
-			log.Println("Error Notify LsdServer of new License (" + l.ID + "):" + err.Error())
-			_ = s.Licenses().UpdateLsdStatus(l.ID, -1)
-		} else {
-			defer req.Body.Close()
-			_ = s.Licenses().UpdateLsdStatus(l.ID, int32(response.StatusCode))
-		}
+	notifyURL := config.Config.LsdServer.PublicBaseUrl + "/licenses"
+	if len(params) > 0 {
+		notifyURL += "?" + params.Encode()
 	}
+	return outbox.NewNotification("PUT", notifyURL, l.ID, api.ContentType_LCP_JSON, l)
 }
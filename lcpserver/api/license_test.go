@@ -0,0 +1,67 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/tenant"
+)
+
+func TestGenerateLicenseOfTenant(t *testing.T) {
+	s, _ := openTestServer(t)
+
+	authFile := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(authFile, []byte("acme:{SHA}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.Config.Tenants = []config.Tenant{{Name: "acme", Provider: "https://acme.org", StoragePrefix: "acme/", AuthFile: authFile,
+		Certificate: config.Certificate{Cert: "../../test/cert/cert-edrlab-test.pem", PrivateKey: "../../test/cert/privkey-edrlab-test.pem"},
+		Links:       map[string]string{"hint": "https://acme.org/hint", "status": "https://lsd.example.com/licenses/{license_id}/status"}}}
+	defer func() { config.Config.Tenants = nil }()
+	var err error
+	if s.tenants, err = tenant.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	err = s.idx.ForTenant("acme").Add(index.Content{ID: "c2", EncryptionKey: bytes.Repeat([]byte{2}, 32),
+		Location: "https://example.com/acme/c2.epub", Type: epub.ContentType_EPUB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a license of the content of a tenant, generated on the routes of the administrator, belongs to the tenant
+	body := `{"provider":"https://example.com","user":{"id":"u1"},"encryption":{"user_key":{"text_hint":"hint","hex_value":"` + strings.Repeat("01", 32) + `"}}}`
+	r := httptest.NewRequest("POST", "/contents/c2/license", strings.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"content_id": "c2"})
+	w := httptest.NewRecorder()
+	GenerateLicense(w, r, s)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var lic license.License
+	if err = json.NewDecoder(w.Body).Decode(&lic); err != nil {
+		t.Fatal(err)
+	}
+	if lic.Provider != "https://acme.org" {
+		t.Errorf("Expected the provider of the tenant, got %s", lic.Provider)
+	}
+	stored, err := s.lst.ForTenant("acme").Get(lic.ID)
+	if err != nil || stored.Tenant != "acme" {
+		t.Errorf("Expected a license of the tenant, got %q, %v", stored.Tenant, err)
+	}
+}
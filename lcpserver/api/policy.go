@@ -0,0 +1,184 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/policy"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// ErrSharedPolicy is returned when a tenant tries to change a rights policy
+var ErrSharedPolicy = errors.New("rights policies are shared by all tenants and can only be changed by the administrator")
+
+// ListPolicies returns the rights policies, sorted by name
+func ListPolicies(w http.ResponseWriter, r *http.Request, s Server) {
+
+	fn := s.Policies().List()
+	policies := make([]policy.Policy, 0)
+	var err error
+	var it policy.Policy
+	for it, err = fn(); err == nil; it, err = fn() {
+		policies = append(policies, it)
+	}
+	if err != policy.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	// add a log
+	logging.Print("List rights policies, total " + strconv.Itoa(len(policies)))
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.Encode(policies)
+}
+
+// GetPolicy returns a rights policy
+func GetPolicy(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	p, err := s.Policies().Get(name)
+	if err == policy.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: name}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: name}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.Encode(p)
+}
+
+// AddPolicy creates a rights policy
+// The policy name is in the request body
+func AddPolicy(w http.ResponseWriter, r *http.Request, s Server) {
+
+	var p policy.Policy
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	savePolicy(w, r, s, p, false)
+}
+
+// UpdatePolicy creates or replaces a rights policy
+// The policy name is in the request URL
+func UpdatePolicy(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	var p policy.Policy
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	p.Name = vars["name"]
+	savePolicy(w, r, s, p, true)
+}
+
+// savePolicy validates and stores a rights policy
+func savePolicy(w http.ResponseWriter, r *http.Request, s Server, p policy.Policy, replace bool) {
+
+	// policies are shared by every tenant, only the administrator can change them
+	if s.Tenant() != nil {
+		problem.Error(w, r, problem.Problem{Detail: ErrSharedPolicy.Error(), Instance: p.Name}, http.StatusForbidden)
+		return
+	}
+
+	err := p.Validate()
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: p.Name}, http.StatusBadRequest)
+		return
+	}
+
+	before, err := s.Policies().Get(p.Name)
+	exists := err == nil
+	if err != nil && err != policy.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: p.Name}, http.StatusInternalServerError)
+		return
+	}
+	if exists && !replace {
+		problem.Error(w, r, problem.Problem{Detail: "the rights policy already exists", Instance: p.Name}, http.StatusConflict)
+		return
+	}
+
+	// add a log
+	logging.Print("Save the rights policy " + p.Name)
+
+	if exists {
+		err = s.Policies().Update(p)
+	} else {
+		err = s.Policies().Add(p)
+	}
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: p.Name}, http.StatusInternalServerError)
+		return
+	}
+
+	p, err = s.Policies().Get(p.Name)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: p.Name}, http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		audit.Describe(r, p.Name, before, p)
+	} else {
+		audit.Describe(r, p.Name, nil, p)
+	}
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	if exists {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	enc := json.NewEncoder(w)
+	enc.Encode(p)
+}
+
+// DeletePolicy deletes a rights policy
+// Licenses generated from the policy keep their rights
+func DeletePolicy(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	if s.Tenant() != nil {
+		problem.Error(w, r, problem.Problem{Detail: ErrSharedPolicy.Error(), Instance: name}, http.StatusForbidden)
+		return
+	}
+
+	// add a log
+	logging.Print("Delete the rights policy " + name)
+
+	// the deleted policy is recorded in the audit log
+	before, err := s.Policies().Get(name)
+	if err == nil {
+		err = s.Policies().Delete(name)
+	}
+	if err == policy.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: name}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error(), Instance: name}, http.StatusInternalServerError)
+		return
+	}
+	audit.Describe(r, "", before, nil)
+	w.WriteHeader(http.StatusOK)
+}
@@ -19,12 +19,17 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/bulk"
 	"github.com/readium/readium-lcp-server/index"
 	"github.com/readium/readium-lcp-server/license"
 	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/outbox"
 	"github.com/readium/readium-lcp-server/pack"
+	"github.com/readium/readium-lcp-server/policy"
 	"github.com/readium/readium-lcp-server/problem"
 	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
 )
 
 // Server groups functions used by the lcp server
@@ -32,8 +37,14 @@ type Server interface {
 	Store() storage.Store
 	Index() index.Index
 	Licenses() license.Store
+	Policies() policy.Store
 	Certificate() *tls.Certificate
 	Source() *pack.ManualSource
+	Tenant() *tenant.Tenant
+	Tenants() *tenant.Registry
+	Outbox() *outbox.Outbox
+	RightsJobs() *bulk.Runner
+	Audit() audit.Store
 }
 
 // Encrypted is used for communication with the License Server
@@ -46,6 +57,8 @@ type Encrypted struct {
 	Size        int64  `json:"protected-content-length"`
 	Checksum    string `json:"protected-content-sha256"`
 	ContentType string `json:"protected-content-type,omitempty"`
+	// metadata of the publication in the Readium Web Publication Manifest format, stored with the content
+	Metadata json.RawMessage `json:"metadata,omitempty"`
 }
 
 const (
@@ -160,6 +173,13 @@ func AddContent(w http.ResponseWriter, r *http.Request, s Server) {
 	var c index.Content
 	c, err = s.Index().Get(contentID)
 	// err checked later ...
+	// the previous state of the content is recorded in the audit log, without its encryption key
+	var before interface{}
+	if err == nil {
+		previous := c
+		previous.EncryptionKey = nil
+		before = previous
+	}
 	c.EncryptionKey = encrypted.ContentKey
 	// the Location field contains either the file name (useful during download)
 	// or the storage URL of the encrypted, depending the storage mode.
@@ -171,6 +191,10 @@ func AddContent(w http.ResponseWriter, r *http.Request, s Server) {
 	c.Length = encrypted.Size
 	c.Sha256 = encrypted.Checksum
 	c.Type = encrypted.ContentType
+	// the metadata of a content is kept when it is updated without metadata
+	if len(encrypted.Metadata) > 0 {
+		c.Metadata = encrypted.Metadata
+	}
 
 	code := http.StatusCreated
 	if err == index.ErrNotFound { //insert into database
@@ -191,6 +215,8 @@ func AddContent(w http.ResponseWriter, r *http.Request, s Server) {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
+	c.EncryptionKey = nil
+	audit.Describe(r, "", before, c)
 
 	// set the response http code
 	w.WriteHeader(code)
@@ -359,7 +385,11 @@ func DeleteContent(w http.ResponseWriter, r *http.Request, s Server) {
 	// add a log
 	logging.Print("Delete publication " + contentID)
 
-	err := s.Index().Delete(contentID)
+	// the deleted content is recorded in the audit log, without its encryption key
+	content, err := s.Index().Get(contentID)
+	if err == nil {
+		err = s.Index().Delete(contentID)
+	}
 	if err != nil { //item probably not found
 		if err == index.ErrNotFound {
 			problem.Error(w, r, problem.Problem{Detail: "Index:" + err.Error(), Instance: contentID}, http.StatusNotFound)
@@ -368,6 +398,8 @@ func DeleteContent(w http.ResponseWriter, r *http.Request, s Server) {
 		}
 		return
 	}
+	content.EncryptionKey = nil
+	audit.Describe(r, "", content, nil)
 	// set the response http code
 	w.WriteHeader(http.StatusOK)
 
@@ -0,0 +1,66 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/index"
+)
+
+func TestAddContentMetadata(t *testing.T) {
+	s, _ := openTestServer(t)
+
+	add := func(body string) int {
+		r := httptest.NewRequest("PUT", "/contents/c2", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"content_id": "c2"})
+		w := httptest.NewRecorder()
+		AddContent(w, r, s)
+		return w.Code
+	}
+	info := func() index.Content {
+		r := httptest.NewRequest("GET", "/contents/c2/info", nil)
+		r = mux.SetURLVars(r, map[string]string{"content_id": "c2"})
+		w := httptest.NewRecorder()
+		GetContentInfo(w, r, s)
+		var c index.Content
+		if err := json.NewDecoder(w.Body).Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// the metadata sent by lcpencrypt is stored with the content
+	metadata := `{"title":"Moby Dick","author":"Herman Melville"}`
+	body := `{"content-encryption-key":"AQID","storage-mode":2,"protected-content-location":"https://example.com/c2.epub",` +
+		`"protected-content-disposition":"c2.epub","metadata":` + metadata + `}`
+	if code := add(body); code != http.StatusCreated {
+		t.Fatalf("Unexpected status %d", code)
+	}
+	if c := info(); string(c.Metadata) != metadata {
+		t.Errorf("Expected the metadata of the content, got %s", c.Metadata)
+	}
+
+	// an update without metadata keeps the stored metadata
+	body = `{"content-encryption-key":"AQID","storage-mode":2,"protected-content-location":"https://example.com/c2-v2.epub",` +
+		`"protected-content-disposition":"c2.epub"}`
+	if code := add(body); code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", code)
+	}
+	if c := info(); c.Location != "https://example.com/c2-v2.epub" || string(c.Metadata) != metadata {
+		t.Errorf("Expected an updated content with its metadata, got %s and %s", c.Location, c.Metadata)
+	}
+
+	// a content without metadata
+	if c, err := s.Index().Get("c1"); err != nil || c.Metadata != nil {
+		t.Errorf("Expected a content without metadata, got %s, %v", c.Metadata, err)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// TransferLicense transfers a license to another user, e.g. a gift: a new license of the same content
+// is issued to the new user with the remaining rights of the transferred license, which is revoked.
+// The body is a partial license: the user and the user key of the new user are mandatory.
+// If a Status Server is configured, it revokes the transferred license and creates the status
+// of the new license, which keeps the loan policy and renewals of the transferred one;
+// both licenses are linked in the events of their status documents. The new license is stored first,
+// see transferWithStatus.
+func TransferLicense(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	licenseID := vars["license_id"]
+
+	var lic license.License
+	err := DecodeJSONLicense(r, &lic)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	// check the user and user key of the new user
+	err = checkGenerateLicenseInput(&lic)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	source, err := s.Licenses().Get(licenseID)
+	if err == license.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+		return
+	} else if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if source.Rights != nil && source.Rights.End != nil && !source.Rights.End.After(now) {
+		problem.Error(w, r, problem.Problem{Detail: "The license has expired, it cannot be transferred"}, http.StatusForbidden)
+		return
+	}
+
+	// the new license has the remaining rights of the transferred license
+	license.Initialize(source.ContentID, &lic)
+	lic.Provider = source.Provider
+	lic.Tenant = source.Tenant
+	lic.Policy = ""
+	lic.Rights = new(license.UserRights)
+	if source.Rights != nil {
+		*lic.Rights = *source.Rights
+	}
+
+	logging.Print("Transfer the License " + licenseID + " to the License " + lic.ID + " of User " + lic.User.ID)
+
+	err = buildLicense(&lic, s, false)
+	if err != nil {
+		if errors.Is(err, index.ErrNotFound) {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+			return
+		}
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if config.Config.LsdServer.PublicBaseUrl != "" {
+		code, err := transferWithStatus(licenseID, lic, s)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, code)
+			return
+		}
+	} else {
+		// the transferred license ends when the new license is stored
+		source.Rights.End = &now
+		source.Updated = &now
+		err = s.Licenses().UpdateRightsAndNotify(source, func(tx *sql.Tx) error {
+			return s.Licenses().AddTx(tx, lic)
+		})
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+	}
+	logging.Print("The License " + licenseID + " has been transferred to the License " + lic.ID)
+	// the new license is recorded in the audit entry of the transferred license
+	audit.Describe(r, "", nil, storedLicense(lic))
+
+	w.Header().Add("Content-Type", api.ContentType_LCP_JSON)
+	w.Header().Add("Content-Disposition", `attachment; filename="license.lcpl"`)
+	w.WriteHeader(http.StatusCreated)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(lic)
+}
+
+// transferWithStatus stores the new license of a transfer, then asks the Status Server to revoke the transferred license.
+// The request to the Status Server is recorded in the outbox in the same transaction as the new license:
+// if the Status Server cannot be reached, or if the server stops before the request is sent,
+// the transfer is completed later by the outbox, so that the transferred license is never revoked
+// without the new license being stored. If the Status Server refuses the transfer, the new license is removed;
+// if it refuses the postponed transfer, the new license ends (see TransferDone).
+// It returns the http status code to send back with an error.
+func transferWithStatus(licenseID string, lic license.License, s Server) (int, error) {
+
+	n, err := outbox.NewNotification("PUT", transferURL(licenseID), lic.ID, api.ContentType_LCP_JSON, lic)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = s.Licenses().AddAndNotify(lic, func(tx *sql.Tx) error {
+		return s.Outbox().AddTx(tx, n)
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	code, err := transferStatus(licenseID, lic)
+	switch {
+	case err == nil:
+		// the transfer is done, the outbox must not send it again
+		if err = s.Outbox().DeleteRef(lic.ID); err != nil {
+			log.Println("Error removing the transfer of the License " + licenseID + " from the outbox: " + err.Error())
+		}
+		_ = s.Licenses().UpdateLsdStatus(lic.ID, http.StatusCreated)
+		return 0, nil
+	case code == http.StatusNotFound || code == http.StatusConflict:
+		// the transfer is refused, the new license is removed with its pending transfer
+		derr := s.Licenses().DeleteAndNotify(lic.ID, func(tx *sql.Tx) error {
+			return s.Outbox().DeleteRefTx(tx, lic.ID)
+		})
+		if derr != nil {
+			log.Println("Error removing the License " + lic.ID + " after a refused transfer: " + derr.Error())
+		}
+		return code, err
+	default:
+		// the Status Server is not available; the outbox sends the transfer later
+		log.Println("The transfer of the License " + licenseID + " is postponed: " + err.Error())
+		return 0, nil
+	}
+}
+
+// TransferDone is called when the outbox has sent a notification, with the http status code of the last attempt.
+// If the outbox gives up sending a postponed transfer to the Status Server, the rights of the new license end:
+// the transferred license is still valid, and the new license has no status document.
+// Other notifications are ignored.
+func TransferDone(lst license.Store, n outbox.Notification, code int) error {
+
+	if code >= 200 && code <= 299 {
+		return nil
+	}
+	if !strings.HasPrefix(n.URL, config.Config.LsdServer.PublicBaseUrl+"/licenses/") || !strings.HasSuffix(n.URL, "/transfer") {
+		return nil
+	}
+	lic, err := lst.Get(n.Ref)
+	if err == license.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if lic.Rights == nil {
+		lic.Rights = new(license.UserRights)
+	}
+	lic.Rights.End = &now
+	log.Println("The transfer to the License " + lic.ID + " failed, the license ends")
+	return lst.UpdateRights(lic)
+}
+
+// transferURL returns the url of the transfer of a license on the Status Server
+func transferURL(licenseID string) string {
+	return config.Config.LsdServer.PublicBaseUrl + "/licenses/" + licenseID + "/transfer"
+}
+
+// transferStatus asks the Status Server to revoke a transferred license and to create the status of the new license.
+// It returns the http status code to send back with an error: a refusal of the Status Server
+// (e.g. a license already revoked or returned) is a conflict.
+func transferStatus(licenseID string, lic license.License) (int, error) {
+
+	body, err := json.Marshal(lic)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	req, err := http.NewRequest("PUT", transferURL(licenseID), bytes.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	auth := config.Config.LsdNotifyAuth
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
+	client := mtls.Client(15 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return http.StatusBadGateway, errors.New("transfer on the Status Server: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusCreated:
+		return 0, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return http.StatusNotFound, errors.New("no status document for the license " + licenseID)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		var p problem.Problem
+		json.NewDecoder(resp.Body).Decode(&p)
+		return http.StatusConflict, errors.New("the Status Server refused the transfer: " + p.Detail)
+	default:
+		return http.StatusBadGateway, errors.New("transfer on the Status Server: " + resp.Status)
+	}
+}
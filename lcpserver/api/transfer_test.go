@@ -0,0 +1,221 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/bulk"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/pack"
+	"github.com/readium/readium-lcp-server/policy"
+	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
+)
+
+type testServer struct {
+	idx     index.Index
+	lst     license.Store
+	obx     *outbox.Outbox
+	cert    *tls.Certificate
+	tenants *tenant.Registry
+}
+
+func (s *testServer) Store() storage.Store          { return nil }
+func (s *testServer) Index() index.Index            { return s.idx }
+func (s *testServer) Licenses() license.Store       { return s.lst }
+func (s *testServer) Policies() policy.Store        { return nil }
+func (s *testServer) Certificate() *tls.Certificate { return s.cert }
+func (s *testServer) Source() *pack.ManualSource    { return nil }
+func (s *testServer) Tenant() *tenant.Tenant        { return nil }
+func (s *testServer) Tenants() *tenant.Registry     { return s.tenants }
+func (s *testServer) Outbox() *outbox.Outbox        { return s.obx }
+func (s *testServer) RightsJobs() *bulk.Runner      { return nil }
+func (s *testServer) Audit() audit.Store            { return nil }
+
+// openTestServer creates a test server on a memory db, holding a content and a license of this content
+func openTestServer(t *testing.T) (*testServer, license.License) {
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	config.Config.Profile = "basic"
+	license.DefaultLinks = map[string]string{
+		"hint":   "https://example.com/hint",
+		"status": "https://lsd.example.com/licenses/{license_id}/status",
+	}
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	s := &testServer{}
+	cert, err := tls.LoadX509KeyPair("../../test/cert/cert-edrlab-test.pem", "../../test/cert/privkey-edrlab-test.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cert = &cert
+	if s.lst, err = license.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	if s.idx, err = index.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	obst, err := outbox.Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.obx = outbox.New(obst, config.Auth{})
+
+	err = s.idx.Add(index.Content{ID: "c1", EncryptionKey: bytes.Repeat([]byte{1}, 32),
+		Location: "https://example.com/c1.epub", Type: epub.ContentType_EPUB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var source license.License
+	license.Initialize("c1", &source)
+	source.User.ID = "u1"
+	end := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, 30)
+	source.Rights = &license.UserRights{End: &end}
+	if err = s.lst.Add(source); err != nil {
+		t.Fatal(err)
+	}
+	return s, source
+}
+
+func TestTransferLicense(t *testing.T) {
+	s, source := openTestServer(t)
+
+	code := http.StatusCreated
+	var transfers int
+	lsd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/licenses/"+source.ID+"/transfer" && code == http.StatusCreated {
+			transfers++
+		}
+		w.WriteHeader(code)
+	}))
+	defer lsd.Close()
+	config.Config.LsdServer.PublicBaseUrl = lsd.URL
+	defer func() { config.Config.LsdServer.PublicBaseUrl = "" }()
+
+	// lastID is the id of the license issued by the last transfer
+	var lastID string
+	transfer := func() int {
+		body := `{"user":{"id":"u2"},"encryption":{"user_key":{"text_hint":"hint","hex_value":"` + strings.Repeat("01", 32) + `"}}}`
+		r := httptest.NewRequest("POST", "/licenses/"+source.ID+"/transfer", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"license_id": source.ID})
+		w := httptest.NewRecorder()
+		TransferLicense(w, r, s)
+		var lic license.License
+		if json.NewDecoder(w.Body).Decode(&lic) == nil {
+			lastID = lic.ID
+		}
+		return w.Code
+	}
+	licenses := func() int {
+		n := 0
+		fn := s.lst.ListByContentID("c1", 10, 0)
+		for _, err := fn(); err == nil; _, err = fn() {
+			n++
+		}
+		return n
+	}
+	pending := func() int {
+		n, err := s.obx.Count(outbox.StatusPending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// a transfer refused by the Status Server leaves no new license and no pending transfer
+	code = http.StatusBadRequest
+	if c := transfer(); c != http.StatusConflict {
+		t.Errorf("Expected a conflict, got %d", c)
+	}
+	if n := licenses(); n != 1 {
+		t.Errorf("Expected the new license to be removed, got %d licenses", n)
+	}
+	if n := pending(); n != 0 {
+		t.Errorf("Expected no pending transfer, got %d", n)
+	}
+
+	// if the Status Server is not available, the new license is stored and the transfer is sent later
+	code = http.StatusServiceUnavailable
+	if c := transfer(); c != http.StatusCreated {
+		t.Errorf("Expected a postponed transfer, got %d", c)
+	}
+	if n, p := licenses(), pending(); n != 2 || p != 1 {
+		t.Errorf("Expected a new license and a pending transfer, got %d licenses and %d transfers", n, p)
+	}
+	code = http.StatusCreated
+	if err := s.obx.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	if p := pending(); p != 0 || transfers != 1 {
+		t.Errorf("Expected the transfer to be sent by the outbox, got %d pending and %d sent", p, transfers)
+	}
+
+	// if the Status Server refuses a postponed transfer, the new license ends
+	s.obx.Done = func(n outbox.Notification, code int) {
+		if err := TransferDone(s.lst, n, code); err != nil {
+			t.Error(err)
+		}
+	}
+	defer func() { s.obx.Done = nil }()
+	code = http.StatusServiceUnavailable
+	if c := transfer(); c != http.StatusCreated {
+		t.Errorf("Expected a postponed transfer, got %d", c)
+	}
+	code = http.StatusBadRequest
+	if err := s.obx.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	refused, err := s.lst.Get(lastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refused.Rights == nil || refused.Rights.End == nil || refused.Rights.End.After(time.Now()) {
+		t.Errorf("Expected the end of the license of a refused transfer, got %+v", refused.Rights)
+	}
+	code = http.StatusCreated
+
+	// a transfer accepted by the Status Server is not sent again by the outbox
+	if c := transfer(); c != http.StatusCreated {
+		t.Errorf("Unexpected transfer status %d", c)
+	}
+	if n, p := licenses(), pending(); n != 4 || p != 0 || transfers != 2 {
+		t.Errorf("Expected a new license and no pending transfer, got %d licenses, %d pending and %d sent", n, p, transfers)
+	}
+
+	// without a Status Server, the transferred license ends when the new license is stored
+	config.Config.LsdServer.PublicBaseUrl = ""
+	if c := transfer(); c != http.StatusCreated {
+		t.Errorf("Unexpected transfer status %d", c)
+	}
+	ended, err := s.lst.Get(source.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := licenses(); n != 5 || ended.Rights.End == nil || ended.Rights.End.After(time.Now()) {
+		t.Errorf("Expected a new license and the end of the transferred one, got %d licenses, %+v", n, ended.Rights)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// PassphraseChange is the result of the change of a user passphrase
+type PassphraseChange struct {
+	UserID   string `json:"user_id"`
+	Licenses int    `json:"licenses"`
+}
+
+// auditedPassphraseChange is the change of a user passphrase recorded in the audit log, without the passphrase hash
+type auditedPassphraseChange struct {
+	Hint     string `json:"hint"`
+	Licenses int    `json:"licenses"`
+}
+
+// ChangePassphrase updates the hint and passphrase hash stored with all the licenses of a user,
+// after the user has changed their passphrase in the CMS. The licenses are marked as updated,
+// and the Status Server is notified, so that reading apps fetch the reissued licenses.
+// The body is a user key: text_hint and hex_value (hex-encoded passphrase hash) are mandatory.
+// The change is not implemented if passphrase hashes are not stored, i.e. without a user_key_secret.
+func ChangePassphrase(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+
+	// without a secret, passphrase hashes are not stored with the licenses and cannot be changed
+	if config.Config.LcpServer.UserKeySecret == "" {
+		problem.Error(w, r, problem.Problem{Detail: "Passphrase hashes are not stored, no user_key_secret is configured"}, http.StatusNotImplemented)
+		return
+	}
+
+	var lic license.License
+	err := json.NewDecoder(r.Body).Decode(&lic.Encryption.UserKey)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	// check user hint and passphrase hash
+	err = checkGetLicenseInput(&lic)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// add a log
+	logging.Print("Change the passphrase of User " + userID)
+
+	notify := config.Config.LsdServer.PublicBaseUrl != ""
+	count, err := s.Licenses().UpdateUserKey(userID, lic.Encryption.UserKey, func(tx *sql.Tx, l license.License) error {
+		if !notify {
+			return nil
+		}
+		n, err := lsdNotification(l, nil)
+		if err != nil {
+			return err
+		}
+		return s.Outbox().AddTx(tx, n)
+	})
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if notify && count > 0 {
+		s.Outbox().Wake()
+	}
+	logging.Print("The passphrase of " + strconv.Itoa(count) + " licenses of User " + userID + " has been changed")
+	audit.Describe(r, "", nil, auditedPassphraseChange{Hint: lic.Encryption.UserKey.Hint, Licenses: count})
+
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(PassphraseChange{UserID: userID, Licenses: count})
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+	}
+}
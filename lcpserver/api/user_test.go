@@ -0,0 +1,52 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func TestChangePassphrase(t *testing.T) {
+	change := func(s Server) *httptest.ResponseRecorder {
+		body := `{"text_hint":"new hint","hex_value":"` + strings.Repeat("02", 32) + `"}`
+		r := httptest.NewRequest("PUT", "/users/u1/passphrase", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"user_id": "u1"})
+		w := httptest.NewRecorder()
+		ChangePassphrase(w, r, s)
+		return w
+	}
+
+	// without a secret, the passphrase hashes are not stored and cannot be changed
+	s, source := openTestServer(t)
+	if w := change(s); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected a change without secret to be rejected, got %d", w.Code)
+	}
+	if l, err := s.lst.Get(source.ID); err != nil || l.Updated != nil {
+		t.Errorf("Expected an unchanged license, got %v, %v", l.Updated, err)
+	}
+
+	config.Config.LcpServer.UserKeySecret = strings.Repeat("ab", 32)
+	defer func() { config.Config.LcpServer.UserKeySecret = "" }()
+	s, source = openTestServer(t)
+	w := change(s)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", w.Code)
+	}
+	var result PassphraseChange
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil || result.Licenses != 1 {
+		t.Errorf("Expected 1 changed license, got %+v, %v", result, err)
+	}
+	if k, err := s.lst.GetUserKey(source.ID); err != nil || k.Hint != "new hint" {
+		t.Errorf("Expected the new hint, got %+v, %v", k, err)
+	}
+}
@@ -5,10 +5,12 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -23,13 +25,22 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/microsoft/go-mssqldb"
 
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/bulk"
 	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/health"
 	"github.com/readium/readium-lcp-server/index"
+	apilcp "github.com/readium/readium-lcp-server/lcpserver/api"
 	lcpserver "github.com/readium/readium-lcp-server/lcpserver/server"
 	"github.com/readium/readium-lcp-server/license"
 	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/outbox"
 	"github.com/readium/readium-lcp-server/pack"
+	"github.com/readium/readium-lcp-server/policy"
 	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
 )
 
 func main() {
@@ -57,6 +68,16 @@ func main() {
 		log.Println("Error setting public urls: " + err.Error())
 		os.Exit(1)
 	}
+	tlsConfig, err := mtls.ServerConfig(config.Config.LcpServer.TLS)
+	if err != nil {
+		log.Println("Error loading the https certificates: " + err.Error())
+		os.Exit(1)
+	}
+	// the calls to the Status Server present a client certificate, if configured
+	if err = mtls.InitClient(config.Config.ClientTLS); err != nil {
+		log.Println("Error loading the client certificates: " + err.Error())
+		os.Exit(1)
+	}
 	if certFile = config.Config.Certificate.Cert; certFile == "" {
 		log.Println("Missing certificate in the configuration")
 		os.Exit(1)
@@ -70,8 +91,8 @@ func main() {
 		log.Println("Error loading X509 cert: " + err.Error())
 		os.Exit(1)
 	}
-	if config.Config.Profile != "basic" && !license.LCP_PRODUCTION_LIB {
-		log.Println("Can't run in production mode, server built with a test LCP lib")
+	if err = license.InitUserKeyTransforms(config.Config.UserKeyTransforms); err != nil {
+		log.Println("Can't run with the LCP profile " + config.Config.Profile + ": " + err.Error())
 		os.Exit(1)
 	}
 	if config.Config.Profile == "basic" {
@@ -115,12 +136,64 @@ func main() {
 		os.Exit(1)
 	}
 
+	pst, err := policy.Open(db)
+	if err != nil {
+		log.Println("Error opening the rights policy db: " + err.Error())
+		os.Exit(1)
+	}
+
+	obst, err := outbox.Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		log.Println("Error opening the outbox db: " + err.Error())
+		os.Exit(1)
+	}
+	// the notifications of new licenses to the Status Server are dispatched in the background;
+	// their result is saved with the license
+	obx := outbox.New(obst, config.Config.LsdNotifyAuth)
+	obx.Done = func(n outbox.Notification, code int) {
+		if err := apilcp.TransferDone(lst, n, code); err != nil {
+			log.Println("Error ending the license of a failed transfer: " + err.Error())
+		}
+		if code == 0 {
+			code = -1
+		}
+		_ = lst.UpdateLsdStatus(n.Ref, int32(code))
+	}
+	if !readonly {
+		go obx.Run(time.Minute)
+	}
+
+	jst, err := bulk.Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		log.Println("Error opening the rights job db: " + err.Error())
+		os.Exit(1)
+	}
+	// the bulk updates of rights are processed in the background
+	jobs := bulk.NewRunner(jst, lst, apilcp.ApplyRights(lst, obx))
+	if !readonly {
+		go jobs.Run(time.Minute)
+	}
+
 	err = license.CreateDefaultLinks()
 	if err != nil {
 		log.Println("Error setting default links: " + err.Error())
 		os.Exit(1)
 	}
 
+	tst, err := tenant.Open(db)
+	if err != nil {
+		log.Println("Error opening the tenant db: " + err.Error())
+		os.Exit(1)
+	}
+	tenants, err := tenant.Load(tst)
+	if err != nil {
+		log.Println("Error loading the tenants: " + err.Error())
+		os.Exit(1)
+	}
+	if tenants.Len() > 0 {
+		log.Println("Serving " + strconv.Itoa(tenants.Len()) + " tenants")
+	}
+
 	var store storage.Store
 	if mode := config.Config.Storage.Mode; mode == "s3" {
 		s3Conf := s3ConfigFromYAML()
@@ -151,10 +224,43 @@ func main() {
 	htpasswd := auth.HtpasswdFileProvider(authFile)
 	authenticator := auth.NewBasicAuthenticator("Readium License Content Protection Server", htpasswd)
 
-	HandleSignals()
+	// API keys with scopes, managed by lcpapikey
+	keys, err := apikey.Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		log.Println("Error opening the API key db: " + err.Error())
+		os.Exit(1)
+	}
+
+	// the changes made through the private routes are recorded in the audit log
+	adt, err := audit.Open(db, config.Config.LcpServer.Database)
+	if err != nil {
+		log.Println("Error opening the audit db: " + err.Error())
+		os.Exit(1)
+	}
+	if days := config.Config.LcpServer.AuditRetentionDays; days > 0 && !readonly {
+		go audit.Run(adt, time.Duration(days)*24*time.Hour, time.Hour)
+	}
+
+	// the readiness of the server depends on the database, the storage, the certificates and the Status Server;
+	// the storage check writes a probe object, it is skipped by a readonly server
+	checker := health.New(health.Database(db), health.Certificate("certificate", &cert))
+	if (config.Config.Storage.Mode == "s3" || config.Config.Storage.FileSystem.Directory != "") && !readonly {
+		checker.Add(health.Throttle(health.Storage(store), time.Minute))
+	}
+	for _, t := range tenants.All() {
+		if t.Certificate != nil {
+			checker.Add(health.Certificate("certificate:"+t.Name, t.Certificate))
+		}
+	}
+	if config.Config.LsdServer.PublicBaseUrl != "" {
+		checker.Add(health.Peer("lsd", config.Config.LsdServer.PublicBaseUrl))
+	}
+
+	quit := HandleSignals()
 
 	parsedPort := strconv.Itoa(config.Config.LcpServer.Port)
-	s := lcpserver.New(":"+parsedPort, readonly, &idx, &store, &lst, &cert, packager, authenticator)
+	s := lcpserver.New(":"+parsedPort, readonly, &idx, &store, &lst, &pst, obx, jobs, &cert, packager, authenticator, keys, adt, tenants, checker)
+	s.TLSConfig = tlsConfig
 	if readonly {
 		log.Println("License server running in readonly mode on port " + parsedPort)
 	} else {
@@ -162,13 +268,47 @@ func main() {
 	}
 	log.Println("Public base URL=" + config.Config.LcpServer.PublicBaseUrl)
 
-	if err := s.ListenAndServe(); err != nil {
-		log.Println("Error " + err.Error())
-	}
+	go func() {
+		var err error
+		if s.TLSConfig != nil {
+			// the certificate and private key are held by the tls configuration
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("Error " + err.Error())
+			os.Exit(1)
+		}
+	}()
+	<-quit
 
+	// stop accepting connections and let the license generations and encryptions in progress finish,
+	// then stop the background tasks before closing the database
+	ctx, cancel := context.WithTimeout(context.Background(), config.Config.LcpServer.ShutdownDelay())
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Println("Error draining the requests: " + err.Error())
+	}
+	if err := packager.Shutdown(ctx); err != nil {
+		log.Println("Error stopping the packager: " + err.Error())
+	}
+	if err := jobs.Shutdown(ctx); err != nil {
+		log.Println("Error stopping the rights jobs: " + err.Error())
+	}
+	if err := obx.Shutdown(ctx); err != nil {
+		log.Println("Error flushing the notifications to the Status Server: " + err.Error())
+	}
+	if err := db.Close(); err != nil {
+		log.Println("Error closing the database: " + err.Error())
+	}
+	log.Println("License server stopped")
 }
 
-func HandleSignals() {
+// HandleSignals prints the stack traces on SIGQUIT and returns a channel which is closed on SIGINT or SIGTERM;
+// a second SIGINT or SIGTERM exits immediately
+func HandleSignals() <-chan struct{} {
+	quit := make(chan struct{})
 	// Buffer size should be >= number of signals we're listening for
 	sigChan := make(chan os.Signal, 1) // or 3 to match the exact number of signals
 	go func() {
@@ -181,12 +321,19 @@ func HandleSignals() {
 			case syscall.SIGINT:
 				fallthrough
 			case syscall.SIGTERM:
-				fmt.Println("Shutting down...")
-				os.Exit(0)
+				select {
+				case <-quit:
+					fmt.Println("Forced shutdown")
+					os.Exit(1)
+				default:
+					fmt.Println("Shutting down...")
+					close(quit)
+				}
 			}
 		}
 	}()
 	signal.Notify(sigChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+	return quit
 }
 
 func s3ConfigFromYAML() storage.S3Config {
@@ -203,5 +350,8 @@ func s3ConfigFromYAML() storage.S3Config {
 	s3config.DisableSSL = config.Config.Storage.DisableSSL
 	s3config.ForcePathStyle = config.Config.Storage.PathStyle
 
+	s3config.PartSize = config.Config.Storage.PartSize * 1024 * 1024
+	s3config.Concurrency = config.Config.Storage.Concurrency
+
 	return s3config
 }
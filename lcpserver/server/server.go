@@ -34,12 +34,21 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/bulk"
 	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/health"
 	"github.com/readium/readium-lcp-server/index"
 	apilcp "github.com/readium/readium-lcp-server/lcpserver/api"
 	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/outbox"
 	"github.com/readium/readium-lcp-server/pack"
+	"github.com/readium/readium-lcp-server/policy"
+	"github.com/readium/readium-lcp-server/problem"
 	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
 )
 
 type Server struct {
@@ -48,8 +57,14 @@ type Server struct {
 	idx      *index.Index
 	st       *storage.Store
 	lst      *license.Store
+	pst      *policy.Store
+	obx      *outbox.Outbox
+	jobs     *bulk.Runner
 	cert     *tls.Certificate
 	source   pack.ManualSource
+	tenants  *tenant.Registry
+	keys     apikey.Store
+	adt      audit.Store
 	testMode bool
 }
 
@@ -65,6 +80,22 @@ func (s *Server) Licenses() license.Store {
 	return *s.lst
 }
 
+func (s *Server) Policies() policy.Store {
+	return *s.pst
+}
+
+func (s *Server) Outbox() *outbox.Outbox {
+	return s.obx
+}
+
+func (s *Server) RightsJobs() *bulk.Runner {
+	return s.jobs
+}
+
+func (s *Server) Audit() audit.Store {
+	return s.adt
+}
+
 func (s *Server) Certificate() *tls.Certificate {
 	return s.cert
 }
@@ -73,11 +104,48 @@ func (s *Server) Source() *pack.ManualSource {
 	return &s.source
 }
 
+// Tenant returns nil, as the server itself is not restricted to a tenant
+func (s *Server) Tenant() *tenant.Tenant {
+	return nil
+}
+
+// Tenants returns the tenants served by the server, nil if there is none
+func (s *Server) Tenants() *tenant.Registry {
+	return s.tenants
+}
+
 func (s *Server) TestMode() bool {
 	return s.testMode
 }
 
-func New(bindAddr string, readonly bool, idx *index.Index, st *storage.Store, lst *license.Store, cert *tls.Certificate, packager *pack.Packager, basicAuth *auth.BasicAuth) *Server {
+// tenantServer is a view of the server restricted to the licenses and content of a tenant,
+// using the certificate, links and storage prefix of the tenant
+type tenantServer struct {
+	*Server
+	tenant *tenant.Tenant
+}
+
+func (ts tenantServer) Store() storage.Store {
+	return storage.Prefixed(*ts.st, ts.tenant.StoragePrefix)
+}
+
+func (ts tenantServer) Index() index.Index {
+	return (*ts.idx).ForTenant(ts.tenant.Name)
+}
+
+func (ts tenantServer) Licenses() license.Store {
+	return (*ts.lst).ForTenant(ts.tenant.Name)
+}
+
+func (ts tenantServer) Certificate() *tls.Certificate {
+	return ts.tenant.Certificate
+}
+
+func (ts tenantServer) Tenant() *tenant.Tenant {
+	return ts.tenant
+}
+
+func New(bindAddr string, readonly bool, idx *index.Index, st *storage.Store, lst *license.Store, pst *policy.Store, obx *outbox.Outbox, jobs *bulk.Runner, cert *tls.Certificate, packager *pack.Packager, basicAuth *auth.BasicAuth, keys apikey.Store, adt audit.Store, tenants *tenant.Registry, checker *health.Checker) *Server {
 
 	sr := api.CreateServerRouter("")
 
@@ -93,8 +161,14 @@ func New(bindAddr string, readonly bool, idx *index.Index, st *storage.Store, ls
 		idx:      idx,
 		st:       st,
 		lst:      lst,
+		pst:      pst,
+		obx:      obx,
+		jobs:     jobs,
 		cert:     cert,
 		source:   pack.ManualSource{},
+		tenants:  tenants,
+		keys:     keys,
+		adt:      adt,
 	}
 
 	// Route.PathPrefix: http://www.gorillatoolkit.org/pkg/mux#Route.PathPrefix
@@ -104,18 +178,39 @@ func New(bindAddr string, readonly bool, idx *index.Index, st *storage.Store, ls
 	// Ping endpoint
 	s.handleFunc(sr.R, "/ping", apilcp.Ping).Methods("GET")
 
+	// Health endpoints, for orchestrators
+	sr.R.HandleFunc("/health/live", health.Live).Methods("GET")
+	sr.R.HandleFunc("/health/ready", checker.Ready).Methods("GET")
+
 	// Serve static resources from a configurable directory.
 	// This is used when lcpencrypt sends encrypted resources and cover images to an fs storage,
 	// and we want this http server to provide such resources to the outside world (e.g. PubStore).
 	resourceDir := config.Config.LcpServer.Resources
 	sr.R.PathPrefix("/resources/").Handler(http.StripPrefix("/resources/", http.FileServer(http.Dir(resourceDir))))
 
+	s.setRoutes(sr.R, readonly, basicAuth)
+
+	// Every route is also available with a path prefix selecting a tenant
+	if tenants != nil && tenants.Len() > 0 {
+		s.setRoutes(sr.R.PathPrefix("/tenants/{tenant}").Subrouter(), readonly, basicAuth)
+	}
+
+	// Notifications to the Status Server, pending or dead-lettered
+	s.handlePrivateFunc(sr.R, "/outbox", apilcp.ListOutbox, apikey.ReportsRead, basicAuth).Methods("GET")
+
+	s.source.Feed(packager.Incoming)
+	return s
+}
+
+// setRoutes sets the content, license, policy and utility routes on a router
+func (s *Server) setRoutes(router *mux.Router, readonly bool, basicAuth *auth.BasicAuth) {
+
 	// Methods related to encrypted content
 
 	contentRoutesPathPrefix := "/contents"
-	contentRoutes := sr.R.PathPrefix(contentRoutesPathPrefix).Subrouter().StrictSlash(false)
+	contentRoutes := router.PathPrefix(contentRoutesPathPrefix).Subrouter().StrictSlash(false)
 
-	s.handleFunc(sr.R, contentRoutesPathPrefix, apilcp.ListContents).Methods("GET")
+	s.handleFunc(router, contentRoutesPathPrefix, apilcp.ListContents).Methods("GET")
 
 	// Public routes
 	// get encrypted content by content id (a uuid)
@@ -123,69 +218,173 @@ func New(bindAddr string, readonly bool, idx *index.Index, st *storage.Store, ls
 
 	// Private routes
 	// get all licenses associated with a given content
-	s.handlePrivateFunc(contentRoutes, "/{content_id}/licenses", apilcp.ListLicensesForContent, basicAuth).Methods("GET")
+	s.handlePrivateFunc(contentRoutes, "/{content_id}/licenses", apilcp.ListLicensesForContent, apikey.LicenseRead, basicAuth).Methods("GET")
 	// get content information by content id (a uuid)
-	s.handlePrivateFunc(contentRoutes, "/{content_id}/info", apilcp.GetContentInfo, basicAuth).Methods("GET")
+	s.handlePrivateFunc(contentRoutes, "/{content_id}/info", apilcp.GetContentInfo, apikey.ContentRead, basicAuth).Methods("GET")
 
 	if !readonly {
 		// create a publication
-		s.handlePrivateFunc(contentRoutes, "/{content_id}", apilcp.AddContent, basicAuth).Methods("PUT")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}", apilcp.AddContent, apikey.ContentWrite, basicAuth).Methods("PUT")
 		// delete a publication
-		s.handlePrivateFunc(contentRoutes, "/{content_id}", apilcp.DeleteContent, basicAuth).Methods("DELETE")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}", apilcp.DeleteContent, apikey.ContentWrite, basicAuth).Methods("DELETE")
 		// generate a license for given content
-		s.handlePrivateFunc(contentRoutes, "/{content_id}/license", apilcp.GenerateLicense, basicAuth).Methods("POST")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}/license", apilcp.GenerateLicense, apikey.LicenseWrite, basicAuth).Methods("POST")
 		// deprecated, from a typo in the lcp server spec
-		s.handlePrivateFunc(contentRoutes, "/{content_id}/licenses", apilcp.GenerateLicense, basicAuth).Methods("POST")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}/licenses", apilcp.GenerateLicense, apikey.LicenseWrite, basicAuth).Methods("POST")
 		// generate a protected publication
-		s.handlePrivateFunc(contentRoutes, "/{content_id}/publication", apilcp.GenerateProtectedPublication, basicAuth).Methods("POST")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}/publication", apilcp.GenerateProtectedPublication, apikey.LicenseWrite, basicAuth).Methods("POST")
 		// deprecated, from a typo in the lcp server spec
-		s.handlePrivateFunc(contentRoutes, "/{content_id}/publications", apilcp.GenerateProtectedPublication, basicAuth).Methods("POST")
+		s.handlePrivateFunc(contentRoutes, "/{content_id}/publications", apilcp.GenerateProtectedPublication, apikey.LicenseWrite, basicAuth).Methods("POST")
 	}
 
 	// Methods related to licenses
 
 	licenseRoutesPathPrefix := "/licenses"
-	licenseRoutes := sr.R.PathPrefix(licenseRoutesPathPrefix).Subrouter().StrictSlash(false)
+	licenseRoutes := router.PathPrefix(licenseRoutesPathPrefix).Subrouter().StrictSlash(false)
 
 	// this is a test route
 	s.handleFunc(licenseRoutes, "/test/{license_id}", apilcp.GetTestLicense).Methods("GET")
 
-	s.handlePrivateFunc(sr.R, licenseRoutesPathPrefix, apilcp.ListLicenses, basicAuth).Methods("GET")
+	s.handlePrivateFunc(router, licenseRoutesPathPrefix, apilcp.ListLicenses, apikey.LicenseRead, basicAuth).Methods("GET")
+	// search licenses; registered before the license id route
+	s.handlePrivateFunc(licenseRoutes, "/search", apilcp.SearchLicenses, apikey.LicenseRead, basicAuth).Methods("GET")
+	// bulk updates of rights; registered before the license id route
+	s.handlePrivateFunc(licenseRoutes, "/bulk/{job_id}", apilcp.GetRightsJob, apikey.LicenseRead, basicAuth).Methods("GET")
+	if !readonly {
+		s.handlePrivateFunc(licenseRoutes, "/bulk", apilcp.CreateRightsJob, apikey.LicenseWrite, basicAuth).Methods("POST")
+	}
 	// get a license
-	s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.GetLicense, basicAuth).Methods("GET")
-	s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.GetLicense, basicAuth).Methods("POST")
+	s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.GetLicense, apikey.LicenseRead, basicAuth).Methods("GET")
+	s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.GetLicense, apikey.LicenseRead, basicAuth).Methods("POST")
 	// get content via licence id
-	s.handlePrivateFunc(licenseRoutes, "/{license_id}/content", apilcp.GetContentInfoFromLicense, basicAuth).Methods("GET")
+	s.handlePrivateFunc(licenseRoutes, "/{license_id}/content", apilcp.GetContentInfoFromLicense, apikey.LicenseRead, basicAuth).Methods("GET")
 	// get a protected publication via a license id
-	s.handlePrivateFunc(licenseRoutes, "/{license_id}/publication", apilcp.GetProtectedPublication, basicAuth).Methods("POST")
+	s.handlePrivateFunc(licenseRoutes, "/{license_id}/publication", apilcp.GetProtectedPublication, apikey.LicenseRead, basicAuth).Methods("POST")
 	if !readonly {
 		// update a license
-		s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.UpdateLicense, basicAuth).Methods("PATCH")
+		s.handlePrivateFunc(licenseRoutes, "/{license_id}", apilcp.UpdateLicense, apikey.LicenseWrite, basicAuth).Methods("PATCH")
+		// transfer a license to another user
+		s.handlePrivateFunc(licenseRoutes, "/{license_id}/transfer", apilcp.TransferLicense, apikey.LicenseWrite, basicAuth).Methods("POST")
+	}
+
+	// Methods related to users
+
+	if !readonly {
+		// change the passphrase of a user, i.e. the user key data of all their licenses
+		s.handlePrivateFunc(router, "/users/{user_id}/passphrase", apilcp.ChangePassphrase, apikey.LicenseWrite, basicAuth).Methods("PUT")
+	}
+
+	// Methods related to rights policies
+
+	policyRoutesPathPrefix := "/policies"
+	policyRoutes := router.PathPrefix(policyRoutesPathPrefix).Subrouter().StrictSlash(false)
+
+	s.handlePrivateFunc(router, policyRoutesPathPrefix, apilcp.ListPolicies, apikey.LicenseRead, basicAuth).Methods("GET")
+	s.handlePrivateFunc(policyRoutes, "/{name}", apilcp.GetPolicy, apikey.LicenseRead, basicAuth).Methods("GET")
+	if !readonly {
+		// create a policy
+		s.handlePrivateFunc(router, policyRoutesPathPrefix, apilcp.AddPolicy, apikey.PolicyWrite, basicAuth).Methods("POST")
+		// create or replace a policy
+		s.handlePrivateFunc(policyRoutes, "/{name}", apilcp.UpdatePolicy, apikey.PolicyWrite, basicAuth).Methods("PUT")
+		// delete a policy
+		s.handlePrivateFunc(policyRoutes, "/{name}", apilcp.DeletePolicy, apikey.PolicyWrite, basicAuth).Methods("DELETE")
 	}
 
 	// Utility methods
 
 	// License Count endpoint
-	s.handlePrivateFunc(sr.R, "/licensecount", apilcp.LicenseCount, basicAuth).Methods("GET")
+	s.handlePrivateFunc(router, "/licensecount", apilcp.LicenseCount, apikey.ReportsRead, basicAuth).Methods("GET")
 
-	s.source.Feed(packager.Incoming)
-	return s
+	// Audit log of the changes, restricted to the tenant if any
+	s.handlePrivateFunc(router, "/audit", apilcp.ListAudit, apikey.AuditRead, basicAuth).Methods("GET")
 }
 
 type HandlerFunc func(w http.ResponseWriter, r *http.Request, s apilcp.Server)
 
 func (s *Server) handleFunc(router *mux.Router, route string, fn HandlerFunc) *mux.Route {
 	return router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+		// a public route with a tenant path prefix is restricted to this tenant
+		if name, prefixed := mux.Vars(r)["tenant"]; prefixed {
+			t := s.tenants.Get(name)
+			if t == nil {
+				problem.Error(w, r, problem.Problem{Detail: "Unknown tenant", Instance: name}, http.StatusNotFound)
+				return
+			}
+			fn(w, r, tenantServer{s, t})
+			return
+		}
 		fn(w, r, s)
 	})
 }
 
 type HandlerPrivateFunc func(w http.ResponseWriter, r *auth.AuthenticatedRequest, s apilcp.Server)
 
-func (s *Server) handlePrivateFunc(router *mux.Router, route string, fn HandlerFunc, authenticator *auth.BasicAuth) *mux.Route {
+// handlePrivateFunc checks the API key or the credentials of the caller, then records the changes
+// made by the request in the audit log.
+// An API key must grant the scope of the route; a key restricted to a tenant only gives access to this tenant.
+// Otherwise, the tenant is selected by the path prefix of the request, or by the credentials of a tenant user;
+// the administrator credentials, or an accepted client certificate, give access to every tenant.
+func (s *Server) handlePrivateFunc(router *mux.Router, route string, fn HandlerFunc, scope string, authenticator *auth.BasicAuth) *mux.Route {
 	return router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
-		if api.CheckAuth(authenticator, w, r) {
-			fn(w, r, s)
+		serve := func(t *tenant.Tenant, principal string) {
+			var srv apilcp.Server = s
+			var tenantName string
+			if t != nil {
+				srv, tenantName = tenantServer{s, t}, t.Name
+			}
+			audit.Handle(s.adt, principal, tenantName, w, r, func(w http.ResponseWriter, r *http.Request) {
+				fn(w, r, srv)
+			})
+		}
+
+		name, prefixed := mux.Vars(r)["tenant"]
+		var t *tenant.Tenant
+		if prefixed {
+			if t = s.tenants.Get(name); t == nil {
+				problem.Error(w, r, problem.Problem{Detail: "Unknown tenant", Instance: name}, http.StatusNotFound)
+				return
+			}
+		}
+		if key, found := api.CheckAPIKey(s.keys, scope, w, r); found {
+			if key == nil {
+				return
+			}
+			if key.Tenant != "" {
+				if prefixed && key.Tenant != name {
+					problem.Error(w, r, problem.Problem{Detail: "The API key is restricted to another tenant"}, http.StatusForbidden)
+					return
+				}
+				if s.tenants != nil {
+					t = s.tenants.Get(key.Tenant)
+				}
+				if t == nil {
+					problem.Error(w, r, problem.Problem{Detail: "Unknown tenant", Instance: key.Tenant}, http.StatusForbidden)
+					return
+				}
+			}
+			serve(t, "apikey:"+key.ID)
+			return
+		}
+		if principal := mtls.Principal(r, config.Config.LcpServer.TLS.ClientNames); principal != "" {
+			serve(t, principal)
+			return
+		}
+		if prefixed {
+			if user := t.CheckAuth(r); user != "" {
+				serve(t, user)
+			} else if user := api.CheckUser(authenticator, w, r); user != "" {
+				serve(t, user)
+			}
+			return
+		}
+		if s.tenants != nil && authenticator.CheckAuth(r) == "" {
+			if t := s.tenants.Authenticate(r); t != nil {
+				serve(t, t.CheckAuth(r))
+				return
+			}
+		}
+		if user := api.CheckUser(authenticator, w, r); user != "" {
+			serve(nil, user)
 		}
 	})
 }
@@ -0,0 +1,153 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/readium/readium-lcp-server/health"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/storage"
+)
+
+// Report lists the inconsistencies found between the content index and the storage
+type Report struct {
+	Checked        int
+	Missing        []string // content ids whose file is not in the storage
+	Orphans        []string // storage keys not referenced by any content
+	SizeMismatch   []string // content ids whose file size differs from the index
+	Sha256Mismatch []string // content ids whose file checksum differs from the index
+}
+
+// OK indicates that no inconsistency was found
+func (r Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Orphans) == 0 && len(r.SizeMismatch) == 0 && len(r.Sha256Mismatch) == 0
+}
+
+// Print displays the report
+func (r Report) Print(w io.Writer) {
+	for _, id := range r.Missing {
+		fmt.Fprintln(w, "missing file for content", id)
+	}
+	for _, key := range r.Orphans {
+		fmt.Fprintln(w, "orphan file", key)
+	}
+	for _, id := range r.SizeMismatch {
+		fmt.Fprintln(w, "size mismatch for content", id)
+	}
+	for _, id := range r.Sha256Mismatch {
+		fmt.Fprintln(w, "sha256 mismatch for content", id)
+	}
+	fmt.Fprintf(w, "%d contents checked: %d missing, %d orphans, %d size mismatches, %d sha256 mismatches\n",
+		r.Checked, len(r.Missing), len(r.Orphans), len(r.SizeMismatch), len(r.Sha256Mismatch))
+}
+
+// storageKey returns the key of the encrypted file of a content in the storage.
+// If the file was stored by lcpencrypt, the location is a url ending with the file name;
+// if it was stored by the License Server, the key is the content id.
+func storageKey(c index.Content) string {
+	if isURL(c.Location) {
+		u, _ := url.Parse(c.Location)
+		return path.Base(u.Path)
+	}
+	return c.ID
+}
+
+// companionBase returns the name shared by a stored file and its companion files,
+// e.g. the cover (book.jpg) and metadata (book.json) stored next to an encrypted file (book.epub)
+func companionBase(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+// isCompanion indicates if a storage key has the extension of a cover or metadata file
+func isCompanion(key string) bool {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".json":
+		return true
+	}
+	return false
+}
+
+// fileInfo returns the size and sha256 checksum of a stored file
+func fileInfo(item storage.Item) (int64, string, error) {
+	contents, err := item.Contents()
+	if err != nil {
+		return 0, "", err
+	}
+	defer contents.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, contents)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// checkStorage compares the content index with the files in the storage.
+// If skipHash is set, the files are not read and only their presence is checked.
+func checkStorage(idx index.Index, store storage.Store, skipHash bool) (Report, error) {
+	var report Report
+
+	items, err := store.List()
+	if err != nil {
+		return report, err
+	}
+	stored := make(map[string]storage.Item, len(items))
+	for _, item := range items {
+		stored[item.Key()] = item
+	}
+
+	companions := make(map[string]bool)
+	fn := idx.List()
+	for c, err := fn(); err != index.ErrNotFound; c, err = fn() {
+		if err != nil {
+			return report, err
+		}
+		report.Checked++
+		key := storageKey(c)
+		companions[companionBase(key)] = true
+		item, ok := stored[key]
+		if !ok {
+			report.Missing = append(report.Missing, c.ID)
+			continue
+		}
+		delete(stored, key)
+		if skipHash {
+			continue
+		}
+		size, sum, err := fileInfo(item)
+		if err != nil {
+			return report, fmt.Errorf("reading %s: %w", key, err)
+		}
+		if size != c.Length {
+			report.SizeMismatch = append(report.SizeMismatch, c.ID)
+		}
+		if c.Sha256 != "" && sum != c.Sha256 {
+			report.Sha256Mismatch = append(report.Sha256Mismatch, c.ID)
+		}
+	}
+
+	for key := range stored {
+		// the probe objects left by an interrupted storage check of a server are not contents
+		if strings.HasPrefix(key, health.ProbePrefix) {
+			continue
+		}
+		// the cover and metadata files of a content are stored with the same name and another extension
+		if isCompanion(key) && companions[companionBase(key)] {
+			continue
+		}
+		report.Orphans = append(report.Orphans, key)
+	}
+	sort.Strings(report.Orphans)
+	return report, nil
+}
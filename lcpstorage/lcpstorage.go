@@ -0,0 +1,186 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
+	"gopkg.in/yaml.v2"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/storage"
+	"github.com/readium/readium-lcp-server/tenant"
+)
+
+// showHelpAndExit displays some help and exits.
+func showHelpAndExit() {
+
+	fmt.Println("lcpstorage checks the consistency between the License Server index and the storage of encrypted publications,")
+	fmt.Println("or migrates encrypted publications from one storage to another.")
+	fmt.Println("The License Server configuration is read from the file referenced by READIUM_LCPSERVER_CONFIG.")
+	fmt.Println("-check      check the configured storage: missing files, orphan files, size and sha256 mismatches")
+	fmt.Println("-nohash     optional, boolean, used with -check; only checks the presence of files, without reading them")
+	fmt.Println("-migrate    path to a yaml file containing the storage section of the target storage; copies every encrypted publication and updates their location")
+	fmt.Println("-url        optional, used with -migrate; base url of the target storage, used to build the new locations")
+	fmt.Println("-tenant     optional, name of a tenant; restricts the check or migration to the publications of this tenant")
+	fmt.Println("-help :     help information")
+	os.Exit(0)
+}
+
+// exitWithError outputs an error message and exits.
+func exitWithError(context string, err error) {
+
+	fmt.Println(context, ":", err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	check := flag.Bool("check", false, "check the consistency between the index and the storage")
+	noHash := flag.Bool("nohash", false, "only check the presence of files")
+	migrate := flag.String("migrate", "", "yaml file describing the target storage")
+	baseURL := flag.String("url", "", "base url of the target storage")
+	tenantName := flag.String("tenant", "", "name of a tenant")
+	help := flag.Bool("help", false, "shows information")
+
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	if *help || (!*check && *migrate == "") {
+		showHelpAndExit()
+	}
+
+	configFile := os.Getenv("READIUM_LCPSERVER_CONFIG")
+	if configFile == "" {
+		configFile = "config.yaml"
+	}
+	config.ReadConfig(configFile)
+
+	db, idx, err := openIndex()
+	if err != nil {
+		exitWithError("Error opening the index", err)
+	}
+	store, err := storeFromConfig(config.Config.Storage)
+	if err != nil {
+		exitWithError("Error opening the storage", err)
+	}
+	// the publications of a tenant are stored with the storage prefix of the tenant
+	var prefix string
+	if *tenantName != "" {
+		prefix, err = tenantPrefix(db, *tenantName)
+		if err != nil {
+			exitWithError("Error reading the tenant", err)
+		}
+		idx = idx.ForTenant(*tenantName)
+		store = storage.Prefixed(store, prefix)
+	}
+
+	if *check {
+		report, err := checkStorage(idx, store, *noHash)
+		if err != nil {
+			exitWithError("Error checking the storage", err)
+		}
+		report.Print(os.Stdout)
+		if !report.OK() {
+			os.Exit(2)
+		}
+	}
+
+	if *migrate != "" {
+		data, err := os.ReadFile(*migrate)
+		if err != nil {
+			exitWithError("Error reading the target storage", err)
+		}
+		var target config.Configuration
+		if err = yaml.Unmarshal(data, &target); err != nil {
+			exitWithError("Error reading the target storage", err)
+		}
+		to, err := storeFromConfig(target.Storage)
+		if err != nil {
+			exitWithError("Error opening the target storage", err)
+		}
+		count, err := migrateStorage(idx, store, storage.Prefixed(to, prefix), *baseURL)
+		if err != nil {
+			exitWithError("Error migrating the storage, no location was updated", err)
+		}
+		log.Println(count, "publications migrated")
+	}
+}
+
+// openIndex opens the content index of the License Server
+func openIndex() (*sql.DB, index.Index, error) {
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the index references the license table
+	if _, err = license.Open(db); err != nil {
+		return nil, nil, err
+	}
+	idx, err := index.Open(db)
+	return db, idx, err
+}
+
+// tenantPrefix returns the storage prefix of a tenant defined in the configuration or in the database
+func tenantPrefix(db *sql.DB, name string) (string, error) {
+	for _, t := range config.Config.Tenants {
+		if t.Name == name {
+			return t.StoragePrefix, nil
+		}
+	}
+	st, err := tenant.Open(db)
+	if err != nil {
+		return "", err
+	}
+	fn := st.List()
+	var t config.Tenant
+	for t, err = fn(); err == nil; t, err = fn() {
+		if t.Name == name {
+			return t.StoragePrefix, nil
+		}
+	}
+	if err != tenant.ErrNotFound {
+		return "", err
+	}
+	return "", fmt.Errorf("%w: %s", tenant.ErrNotFound, name)
+}
+
+// storeFromConfig inits a storage from a storage configuration section
+func storeFromConfig(c config.Storage) (storage.Store, error) {
+	if c.Mode == "s3" {
+		return storage.S3(storage.S3Config{
+			ID:             c.AccessId,
+			Secret:         c.Secret,
+			Token:          c.Token,
+			Endpoint:       c.Endpoint,
+			Bucket:         c.Bucket,
+			Region:         c.Region,
+			DisableSSL:     c.DisableSSL,
+			ForcePathStyle: c.PathStyle,
+			PartSize:       c.PartSize * 1024 * 1024,
+			Concurrency:    c.Concurrency,
+		})
+	}
+	if c.FileSystem.Directory == "" {
+		return nil, errors.New("no storage configured")
+	}
+	err := os.MkdirAll(c.FileSystem.Directory, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewFileSystem(c.FileSystem.Directory, c.FileSystem.URL), nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/health"
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/storage"
+)
+
+func openTestIndex(t *testing.T) index.Index {
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	// the index references the license table
+	_, err = db.Exec("CREATE TABLE license (id varchar(255) PRIMARY KEY, content_fk varchar(255))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := index.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func addTestContent(t *testing.T, idx index.Index, store storage.Store, id, location, key string, data []byte) {
+	sum := sha256.Sum256(data)
+	err := idx.Add(index.Content{ID: id, EncryptionKey: []byte("1234"), Location: location,
+		Length: int64(len(data)), Sha256: hex.EncodeToString(sum[:]), Type: "application/epub+zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		if _, err = store.Add(key, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	idx := openTestIndex(t)
+	store := storage.NewFileSystem(t.TempDir(), "http://localhost/files")
+
+	addTestContent(t, idx, store, "c1", "book1.epub", "c1", []byte("content 1"))
+	addTestContent(t, idx, store, "c2", "http://localhost/files/book2.epub", "book2.epub", []byte("content 2"))
+	addTestContent(t, idx, store, "c3", "book3.epub", "", []byte("content 3"))
+	addTestContent(t, idx, store, "c4", "book4.epub", "c4", []byte("content 4"))
+	store.Add("c4", bytes.NewReader([]byte("altered content 4")))
+	store.Add("orphan.epub", bytes.NewReader([]byte("orphan")))
+	// the cover and metadata files of a content are not orphans
+	store.Add("book2.jpg", bytes.NewReader([]byte("cover 2")))
+	store.Add("c1.json", bytes.NewReader([]byte("{}")))
+	store.Add("book2.lcpdf", bytes.NewReader([]byte("stale")))
+	// a probe object left by the storage check of a server is not an orphan
+	store.Add(health.ProbePrefix+"-host-0123", bytes.NewReader([]byte("probe")))
+
+	report, err := checkStorage(idx, store, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 4 {
+		t.Errorf("expected 4 contents checked, got %d", report.Checked)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "c3" {
+		t.Errorf("expected c3 to be missing, got %v", report.Missing)
+	}
+	if len(report.Orphans) != 2 || report.Orphans[0] != "book2.lcpdf" || report.Orphans[1] != "orphan.epub" {
+		t.Errorf("expected book2.lcpdf and orphan.epub to be orphans, got %v", report.Orphans)
+	}
+	if len(report.SizeMismatch) != 1 || len(report.Sha256Mismatch) != 1 || report.Sha256Mismatch[0] != "c4" {
+		t.Errorf("expected a mismatch on c4, got %v %v", report.SizeMismatch, report.Sha256Mismatch)
+	}
+
+	report, err = checkStorage(idx, store, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.SizeMismatch) != 0 || len(report.Sha256Mismatch) != 0 {
+		t.Error("expected no file to be read without hash checks")
+	}
+}
+
+func TestCheckPrefixedStorage(t *testing.T) {
+	idx := openTestIndex(t)
+	root := storage.NewFileSystem(t.TempDir(), "http://localhost/files")
+	store := storage.Prefixed(root, "acme/")
+
+	addTestContent(t, idx.ForTenant("acme"), store, "c1", "book1.epub", "c1", []byte("content 1"))
+	addTestContent(t, idx.ForTenant("acme"), store, "c2", "http://localhost/files/acme/book2.epub", "book2.epub", []byte("content 2"))
+	// the files of the other tenants are out of the prefix
+	root.Add("c3", bytes.NewReader([]byte("content 3")))
+
+	report, err := checkStorage(idx.ForTenant("acme"), store, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 2 || !report.OK() {
+		t.Errorf("expected a consistent tenant storage, got %+v", report)
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	idx := openTestIndex(t)
+	from := storage.NewFileSystem(t.TempDir(), "http://old/files")
+	to := storage.NewFileSystem(t.TempDir(), "http://new/files")
+
+	addTestContent(t, idx, from, "c1", "book1.epub", "c1", []byte("content 1"))
+	addTestContent(t, idx, from, "c2", "http://old/files/book2.epub", "book2.epub", []byte("content 2"))
+
+	count, err := migrateStorage(idx, from, to, "https://cdn.example.com/books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 migrated contents, got %d", count)
+	}
+	report, err := checkStorage(idx, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("expected a consistent target storage, got %+v", report)
+	}
+	c1, _ := idx.Get("c1")
+	if c1.Location != "book1.epub" {
+		t.Errorf("expected the file name location to be kept, got %s", c1.Location)
+	}
+	c2, _ := idx.Get("c2")
+	if c2.Location != "https://cdn.example.com/books/book2.epub" {
+		t.Errorf("unexpected location %s", c2.Location)
+	}
+
+	// a corrupted source aborts the migration without updating any location
+	from.Add("book2.epub", bytes.NewReader([]byte("corrupted")))
+	idx.Update(index.Content{ID: "c2", EncryptionKey: c2.EncryptionKey, Location: "http://old/files/book2.epub",
+		Length: c2.Length, Sha256: c2.Sha256, Type: c2.Type})
+	_, err = migrateStorage(idx, from, to, "")
+	if err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	c2, _ = idx.Get("c2")
+	if c2.Location != "http://old/files/book2.epub" {
+		t.Errorf("expected the location to be unchanged, got %s", c2.Location)
+	}
+}
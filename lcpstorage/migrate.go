@@ -0,0 +1,111 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/readium/readium-lcp-server/index"
+	"github.com/readium/readium-lcp-server/storage"
+)
+
+// migrateStorage copies the encrypted file of every content from one storage to another.
+// Each copy is checked against the size and checksum found in the index.
+// Content locations are only updated once every file has been copied, in a single transaction,
+// so that the index never references a partially migrated storage.
+// If baseURL is set, new locations are built from it, otherwise the public url of the target storage is used.
+func migrateStorage(idx index.Index, from, to storage.Store, baseURL string) (int, error) {
+
+	// read the whole index before copying, the list holds a db connection
+	var contents []index.Content
+	fn := idx.List()
+	for c, err := fn(); err != index.ErrNotFound; c, err = fn() {
+		if err != nil {
+			return 0, err
+		}
+		contents = append(contents, c)
+	}
+
+	locations := make(map[string]string)
+	for _, c := range contents {
+		key := storageKey(c)
+		item, err := copyItem(c, key, from, to)
+		if err != nil {
+			return 0, fmt.Errorf("content %s: %w", c.ID, err)
+		}
+		log.Println("Copied", key)
+
+		// a location which is not a url is a file name, the file is then accessed by content id
+		if !isURL(c.Location) {
+			continue
+		}
+		location := item.PublicURL()
+		if baseURL != "" {
+			location, err = url.JoinPath(baseURL, key)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if location != c.Location {
+			locations[c.ID] = location
+		}
+	}
+
+	err := idx.UpdateLocations(locations)
+	if err != nil {
+		return 0, err
+	}
+	return len(contents), nil
+}
+
+// copyItem copies a file from one storage to another, through a temp file
+func copyItem(c index.Content, key string, from, to storage.Store) (storage.Item, error) {
+	src, err := from.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := src.Contents()
+	if err != nil {
+		return nil, err
+	}
+	defer contents.Close()
+
+	file, err := os.CreateTemp("", "readium-lcp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hasher), contents)
+	if err != nil {
+		return nil, err
+	}
+	if size != c.Length {
+		return nil, fmt.Errorf("size is %d, expected %d", size, c.Length)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); c.Sha256 != "" && sum != c.Sha256 {
+		return nil, fmt.Errorf("sha256 is %s, expected %s", sum, c.Sha256)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return to.Add(key, file)
+}
+
+// isURL indicates if a location is an http url
+func isURL(location string) bool {
+	u, err := url.Parse(location)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
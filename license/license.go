@@ -91,6 +91,14 @@ type License struct {
 	Rights     *UserRights     `json:"rights,omitempty"`
 	Signature  *sign.Signature `json:"signature,omitempty"`
 	ContentID  string          `json:"-"`
+	// plain email of the user, stored for searching licenses, as the email of the license may be encrypted
+	UserEmail string `json:"-"`
+	// name of a rights policy, only used in partial licenses; expanded into rights by the server
+	Policy string `json:"policy,omitempty"`
+	// hash of the user passphrase, stored for reissuing the license with the current user key
+	PassphraseHash []byte `json:"-"`
+	// name of the tenant of the license, empty if the license belongs to no tenant
+	Tenant string `json:"-"`
 }
 
 type LicenseReport struct {
@@ -120,12 +128,11 @@ func isValidPositiveDecimal(s string) bool {
 
 // licenseProfileURL converts the profile token in the config to a standard profile URL
 func licenseProfileURL() string {
-	// possible profiles are basic, 1.0 and other decimal values
-	// "2.x" is not processable in this version, because the api of user_key_prod would have to be modified,
-	// and providers must be able to recompile with the original version.
+	// possible profiles are basic, 1.0 and other decimal values;
+	// the user keys of production profiles are derived by a registered user key transform
 	var profileURL string
 	if config.Config.Profile == "basic" {
-		profileURL = "http://readium.org/lcp/basic-profile"
+		profileURL = BasicProfileURL
 	} else if isValidPositiveDecimal(config.Config.Profile) {
 		profileURL = "http://readium.org/lcp/profile-" + config.Config.Profile
 	} else {
@@ -160,6 +167,8 @@ func newUUID() (string, error) {
 }
 
 // Initialize sets a license id and issued date, contentID,
+// and keeps the plain email of the user before it gets encrypted,
+// as well as the passphrase hash before it gets removed from the license
 func Initialize(contentID string, l *License) {
 
 	// random license id
@@ -169,72 +178,90 @@ func Initialize(contentID string, l *License) {
 	l.Issued = time.Now().UTC().Truncate(time.Second)
 	// set the content id
 	l.ContentID = contentID
+	// emails are searched case-insensitively
+	l.UserEmail = strings.ToLower(strings.TrimSpace(l.User.Email))
+	l.PassphraseHash = l.Encryption.UserKey.Value
 }
 
 // CreateDefaultLinks inits the global var DefaultLinks from config data
 func CreateDefaultLinks() error {
 
-	configLinks := config.Config.License.Links
+	var err error
+	DefaultLinks, err = BuildLinks(config.Config.License.Links, "")
+	return err
+}
+
+// BuildLinks returns a set of default links made from config links.
+// The publication link is built from the storage url and a storage prefix, if any.
+func BuildLinks(configLinks map[string]string, storagePrefix string) (map[string]string, error) {
+
 	// the storage url should now be in the storage section.
 	storageURL := config.Config.Storage.FileSystem.URL
 
-	DefaultLinks = make(map[string]string)
+	links := make(map[string]string)
 
 	for key := range configLinks {
-		DefaultLinks[key] = configLinks[key]
+		links[key] = configLinks[key]
 	}
 	// this value supercedes a (deprecated) publication link placed in the license section;
 	// keep backward compatibility.
 	if storageURL != "" {
 		u, err := url.Parse(storageURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if !strings.HasSuffix(u.Path, "/") {
 			u.Path = u.Path + "/"
 		}
-		DefaultLinks["publication"] = u.String() + "{publication_id}"
+		links["publication"] = u.String() + storagePrefix + "{publication_id}"
 	}
-	return nil
+	return links, nil
 }
 
-// setDefaultLinks sets a Link array from config links
-func setDefaultLinks() []Link {
+// setDefaultLinks sets a Link array from default links
+func setDefaultLinks(defaultLinks map[string]string) []Link {
 
 	links := new([]Link)
-	for key := range DefaultLinks {
-		link := Link{Href: DefaultLinks[key], Rel: key}
+	for key := range defaultLinks {
+		link := Link{Href: defaultLinks[key], Rel: key}
 		*links = append(*links, link)
 	}
 	return *links
 }
 
 // appendDefaultLinks appends default links to custom links
-func appendDefaultLinks(inLinks *[]Link) []Link {
+func appendDefaultLinks(inLinks *[]Link, defaultLinks map[string]string) []Link {
 
 	if *inLinks == nil {
 		// if there are no custom links in the partial license, set default links
-		return setDefaultLinks()
+		return setDefaultLinks(defaultLinks)
 	} else {
 		// otherwise append default links to custom links.
 		// If a default Link is already present, override the custom links with the default one
 		links := new([]Link)
 		for _, link := range *inLinks {
 			rel := link.Rel
-			if _, exist := DefaultLinks[rel]; !exist {
+			if _, exist := defaultLinks[rel]; !exist {
 				*links = append(*links, link)
 			}
 		}
-		return append(*links, setDefaultLinks()...)
+		return append(*links, setDefaultLinks(defaultLinks)...)
 	}
 }
 
 // SetLicenseLinks sets publication and status links
 // l.ContentID must have been set before the call
 func SetLicenseLinks(l *License, c index.Content) error {
+	return SetLicenseLinksFrom(l, c, DefaultLinks)
+}
+
+// SetLicenseLinksFrom sets publication and status links from a given set of default links,
+// e.g. the links of a tenant.
+// l.ContentID must have been set before the call
+func SetLicenseLinksFrom(l *License, c index.Content, defaultLinks map[string]string) error {
 
 	// append default links to custom links
-	l.Links = appendDefaultLinks(&l.Links)
+	l.Links = appendDefaultLinks(&l.Links, defaultLinks)
 
 	// check if the publication link is in the content database
 	hasPubLink, err := isURL(c.Location)
@@ -304,9 +331,9 @@ func expandUriTemplate(uriTemplate, variable, value string) string {
 func EncryptLicenseFields(l *License, c index.Content) error {
 
 	// generate the user key
-	encryptionKey := GenerateUserKey(l.Encryption.UserKey)
-	if encryptionKey == nil {
-		return errors.New("incompatible LCP profile; error generating a user key")
+	encryptionKey, err := GenerateUserKey(l.Encryption.Profile, l.Encryption.UserKey)
+	if err != nil {
+		return errors.New("error generating a user key: " + err.Error())
 	}
 
 	// empty the passphrase hash to avoid sending it back to the user
@@ -320,7 +347,7 @@ func EncryptLicenseFields(l *License, c index.Content) error {
 
 	// encrypt the user info fields
 	encrypterFields := crypto.NewAESEncrypter_FIELDS()
-	err := encryptFields(encrypterFields, l, encryptionKey[:])
+	err = encryptFields(encrypterFields, l, encryptionKey[:])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,70 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package license
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/readium/readium-lcp-server/epub"
+)
+
+// WriteProtectedPublication writes an encrypted publication with a license embedded in it.
+// The license is stored in META-INF/license.lcpl for an EPUB, at the root of the package for a Readium package (RPF).
+func WriteProtectedPublication(w io.Writer, in *zip.Reader, l *License) error {
+
+	zipWriter := zip.NewWriter(w)
+	err := copyZipFiles(zipWriter, in)
+	if err != nil {
+		return err
+	}
+
+	// Encode the license to JSON, remove the trailing newline
+	// write the buffer in the zip
+	licenseBytes, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	licenseBytes = bytes.TrimRight(licenseBytes, "\n")
+
+	location := epub.LicenseFile
+	if isWebPub(in) {
+		location = "license.lcpl"
+	}
+	licenseWriter, err := zipWriter.Create(location)
+	if err != nil {
+		return err
+	}
+	_, err = licenseWriter.Write(licenseBytes)
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+// copyZipFiles copies every file from one zip archive to another, without decompressing them.
+func copyZipFiles(out *zip.Writer, in *zip.Reader) error {
+
+	for _, file := range in.File {
+		if err := out.Copy(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWebPub checks the presence of a Readium manifest in a zip package
+func isWebPub(in *zip.Reader) bool {
+
+	for _, f := range in.File {
+		if f.Name == "manifest.json" {
+			return true
+		}
+	}
+
+	return false
+}
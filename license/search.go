@@ -0,0 +1,165 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package license
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrBadSort signals an unknown sort key
+var ErrBadSort = errors.New("unknown sort key")
+
+// SearchFilter holds the criteria of a license search.
+// Empty criteria are ignored; date ranges are inclusive.
+type SearchFilter struct {
+	UserID       string
+	UserEmail    string
+	Provider     string
+	ContentID    string
+	IssuedFrom   *time.Time
+	IssuedTo     *time.Time
+	EndFrom      *time.Time
+	EndTo        *time.Time
+	UpdatedSince *time.Time
+	// Sort is a sort key, prefixed by "-" for a descending order; "-issued" by default
+	Sort string
+	// PerPage is the max number of licenses returned, Page the page number starting at 0
+	Page    int
+	PerPage int
+}
+
+// sortColumns maps the sort keys to indexed columns of the license table
+var sortColumns = map[string]string{
+	"issued":   "issued",
+	"updated":  "updated",
+	"end":      "rights_end",
+	"user_id":  "user_id",
+	"provider": "provider",
+}
+
+// where returns the sql conditions of the filter and their arguments
+func (f SearchFilter) where() (string, []interface{}) {
+
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if f.UserID != "" {
+		add("user_id = ?", f.UserID)
+	}
+	if f.UserEmail != "" {
+		add("user_email = ?", strings.ToLower(strings.TrimSpace(f.UserEmail)))
+	}
+	if f.Provider != "" {
+		add("provider = ?", f.Provider)
+	}
+	if f.ContentID != "" {
+		add("content_fk = ?", f.ContentID)
+	}
+	if f.IssuedFrom != nil {
+		add("issued >= ?", f.IssuedFrom.UTC())
+	}
+	if f.IssuedTo != nil {
+		add("issued <= ?", f.IssuedTo.UTC())
+	}
+	if f.EndFrom != nil {
+		add("rights_end >= ?", f.EndFrom.UTC())
+	}
+	if f.EndTo != nil {
+		add("rights_end <= ?", f.EndTo.UTC())
+	}
+	if f.UpdatedSince != nil {
+		// a license never updated is considered updated when issued
+		conds = append(conds, "(updated >= ? OR (updated IS NULL AND issued >= ?))")
+		args = append(args, f.UpdatedSince.UTC(), f.UpdatedSince.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderBy returns the sql order clause of the filter
+func (f SearchFilter) orderBy() (string, error) {
+
+	key := f.Sort
+	if key == "" {
+		key = "-issued"
+	}
+	order := " ASC"
+	if strings.HasPrefix(key, "-") {
+		key = key[1:]
+		order = " DESC"
+	}
+	column, ok := sortColumns[key]
+	if !ok {
+		return "", ErrBadSort
+	}
+	// the license id makes the order stable between pages
+	return " ORDER BY " + column + order + ", id" + order, nil
+}
+
+// Search returns the number of licenses matching a filter, and an iterator on a page of these licenses
+func (s *sqlStore) Search(f SearchFilter) (int, func() (LicenseReport, error), error) {
+
+	order, err := f.orderBy()
+	if err != nil {
+		return 0, nil, err
+	}
+	where, args := f.where()
+	if s.scoped {
+		if where == "" {
+			where = " WHERE tenant = ?"
+		} else {
+			where += " AND tenant = ?"
+		}
+		args = append(args, s.tenant)
+	}
+
+	var total int
+	row := s.db.QueryRow(dbutils.GetParamQuery(config.Config.LcpServer.Database, "SELECT COUNT(*) FROM license"+where), args...)
+	if err = row.Scan(&total); err != nil {
+		return 0, nil, err
+	}
+
+	query := `SELECT id, user_id, user_email, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk
+	FROM license` + where + order
+	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+	if driver == "mssql" {
+		query += " OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+		args = append(args, f.Page*f.PerPage, f.PerPage)
+	} else {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.PerPage, f.Page*f.PerPage)
+	}
+	rows, err := s.db.Query(dbutils.GetParamQuery(config.Config.LcpServer.Database, query), args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, func() (LicenseReport, error) {
+		var l LicenseReport
+		var err error
+		l.User = UserInfo{}
+		l.Rights = new(UserRights)
+		if rows.Next() {
+			var email sql.NullString
+			err = rows.Scan(&l.ID, &l.User.ID, &email, &l.Provider, &l.Issued, &l.Updated,
+				&l.Rights.Print, &l.Rights.Copy, &l.Rights.Start, &l.Rights.End, &l.ContentID)
+			l.User.Email = email.String
+		} else {
+			rows.Close()
+			err = ErrNotFound
+		}
+		return l, err
+	}, nil
+}
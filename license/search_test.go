@@ -0,0 +1,108 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package license
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func TestSearch(t *testing.T) {
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	add := func(userID, email, provider, contentID string, issued time.Time, end *time.Time) string {
+		var l License
+		l.User.ID = userID
+		l.User.Email = email
+		Initialize(contentID, &l)
+		l.Provider = provider
+		l.Issued = issued
+		l.Rights = &UserRights{End: end}
+		if err := st.Add(l); err != nil {
+			t.Fatal(err)
+		}
+		return l.ID
+	}
+	end1 := now.AddDate(0, 0, 7)
+	end2 := now.AddDate(0, 0, 21)
+	first := add("u1", "Jane@Example.org", "p1", "c1", now.AddDate(0, 0, -10), &end1)
+	add("u1", "jane@example.org", "p1", "c2", now.AddDate(0, 0, -5), &end2)
+	add("u2", "", "p2", "c1", now.AddDate(0, 0, -1), nil)
+	if err = st.UpdateRights(License{ID: first, Rights: &UserRights{End: &end1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(f SearchFilter) (int, []LicenseReport) {
+		if f.PerPage == 0 {
+			f.PerPage = 10
+		}
+		total, fn, err := st.Search(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var licenses []LicenseReport
+		for it, err := fn(); err == nil; it, err = fn() {
+			licenses = append(licenses, it)
+		}
+		return total, licenses
+	}
+
+	if total, ls := search(SearchFilter{}); total != 3 || len(ls) != 3 || ls[0].User.ID != "u2" {
+		t.Errorf("Unexpected default search, %d licenses", total)
+	}
+	if total, ls := search(SearchFilter{UserEmail: "JANE@example.org"}); total != 2 || ls[0].User.Email != "jane@example.org" {
+		t.Errorf("Expected 2 licenses by email, got %d", total)
+	}
+	if total, ls := search(SearchFilter{UserID: "u1", ContentID: "c1"}); total != 1 || ls[0].ContentID != "c1" {
+		t.Errorf("Expected 1 license by user and content, got %d", total)
+	}
+	if total, _ := search(SearchFilter{Provider: "p2"}); total != 1 {
+		t.Errorf("Expected 1 license by provider, got %d", total)
+	}
+	from := now.AddDate(0, 0, -6)
+	if total, _ := search(SearchFilter{IssuedFrom: &from}); total != 2 {
+		t.Errorf("Expected 2 licenses issued since 6 days, got %d", total)
+	}
+	endTo := now.AddDate(0, 0, 10)
+	if total, _ := search(SearchFilter{EndTo: &endTo}); total != 1 {
+		t.Errorf("Expected 1 license ending within 10 days, got %d", total)
+	}
+	since := now.AddDate(0, 0, -2)
+	if total, _ := search(SearchFilter{UpdatedSince: &since}); total != 2 {
+		t.Errorf("Expected 2 licenses updated since 2 days, got %d", total)
+	}
+	// pagination keeps the total
+	if total, ls := search(SearchFilter{Sort: "issued", PerPage: 2, Page: 1}); total != 3 || len(ls) != 1 || ls[0].User.ID != "u2" {
+		t.Errorf("Unexpected second page, total %d", total)
+	}
+	if _, _, err = st.Search(SearchFilter{Sort: "password"}); err != ErrBadSort {
+		t.Errorf("Expected ErrBadSort, got %v", err)
+	}
+	if total, _ := search(SearchFilter{}); total != 3 {
+		t.Error("Unexpected total")
+	}
+	if total, _, _ := st.ForTenant("acme").Search(SearchFilter{PerPage: 10}); total != 0 {
+		t.Errorf("Expected no license in another tenant, got %d", total)
+	}
+}
@@ -6,9 +6,15 @@
 package license
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/readium/readium-lcp-server/config"
@@ -21,12 +27,27 @@ type Store interface {
 	ListAll(page int, pageNum int) func() (LicenseReport, error)
 	ListByContentID(ContentID string, page int, pageNum int) func() (LicenseReport, error)
 	UpdateRights(l License) error
+	// UpdateRightsAndNotify updates the rights and the update date of a license;
+	// notify is called in the same transaction
+	UpdateRightsAndNotify(l License, notify func(tx *sql.Tx) error) error
 	Update(l License) error
 	UpdateLsdStatus(id string, status int32) error
 	Add(l License) error
+	AddAndNotify(l License, notify func(tx *sql.Tx) error) error
+	// AddTx creates a license in a transaction, i.e. only if the transaction is committed
+	AddTx(tx *sql.Tx, l License) error
+	// DeleteAndNotify removes a license, e.g. a license whose issuance is cancelled; notify is called in the same transaction
+	DeleteAndNotify(id string, notify func(tx *sql.Tx) error) error
 	Get(id string) (License, error)
+	// GetUserKey returns the hint and passphrase hash stored with a license, if any
+	GetUserKey(id string) (UserKey, error)
+	// UpdateUserKey updates the hint and passphrase hash of all the licenses of a user, and their update date;
+	// notify is called for each updated license in the same transaction
+	UpdateUserKey(userID string, key UserKey, notify func(tx *sql.Tx, l License) error) (int, error)
 	TouchByContentID(ContentID string) error
 	Count(from time.Time, to time.Time) (int, error)
+	Search(f SearchFilter) (int, func() (LicenseReport, error), error)
+	ForTenant(name string) Store
 }
 
 type sqlStore struct {
@@ -34,6 +55,34 @@ type sqlStore struct {
 	dbGetByID         *sql.Stmt
 	dbList            *sql.Stmt
 	dbListByContentID *sql.Stmt
+	// statements restricted to a tenant
+	dbGetByIDInTenant         *sql.Stmt
+	dbListInTenant            *sql.Stmt
+	dbListByContentIDInTenant *sql.Stmt
+	// tenant is the name of the tenant the store is restricted to;
+	// scoped is false if the store gives access to the licenses of every tenant.
+	tenant string
+	scoped bool
+	// userKeyAEAD encrypts the stored passphrase hashes; they are not stored if nil
+	userKeyAEAD cipher.AEAD
+}
+
+// ForTenant returns a store restricted to the licenses of a tenant.
+// New licenses are attached to this tenant.
+func (s *sqlStore) ForTenant(name string) Store {
+	scoped := *s
+	scoped.tenant = name
+	scoped.scoped = true
+	return &scoped
+}
+
+// inTenant completes a query and its arguments with a tenant restriction, if the store is scoped
+func (s *sqlStore) inTenant(query string, args ...interface{}) (string, []interface{}) {
+	if s.scoped {
+		query += " AND tenant=?"
+		args = append(args, s.tenant)
+	}
+	return dbutils.GetParamQuery(config.Config.LcpServer.Database, query), args
 }
 
 // ListAll lists all licenses in ante-chronological order
@@ -43,10 +92,14 @@ func (s *sqlStore) ListAll(pageSize int, pageNum int) func() (LicenseReport, err
 	var rows *sql.Rows
 	var err error
 	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+	stmt, args := s.dbList, []interface{}{}
+	if s.scoped {
+		stmt, args = s.dbListInTenant, []interface{}{s.tenant}
+	}
 	if driver == "mssql" {
-		rows, err = s.dbList.Query(pageNum*pageSize, pageSize)
+		rows, err = stmt.Query(append(args, pageNum*pageSize, pageSize)...)
 	} else {
-		rows, err = s.dbList.Query(pageSize, pageNum*pageSize)
+		rows, err = stmt.Query(append(args, pageSize, pageNum*pageSize)...)
 	}
 	if err != nil {
 		return func() (LicenseReport, error) { return LicenseReport{}, err }
@@ -74,10 +127,14 @@ func (s *sqlStore) ListByContentID(contentID string, pageSize int, pageNum int)
 	var rows *sql.Rows
 	var err error
 	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+	stmt, args := s.dbListByContentID, []interface{}{contentID}
+	if s.scoped {
+		stmt, args = s.dbListByContentIDInTenant, append(args, s.tenant)
+	}
 	if driver == "mssql" {
-		rows, err = s.dbListByContentID.Query(contentID, pageNum*pageSize, pageSize)
+		rows, err = stmt.Query(append(args, pageNum*pageSize, pageSize)...)
 	} else {
-		rows, err = s.dbListByContentID.Query(contentID, pageSize, pageNum*pageSize)
+		rows, err = stmt.Query(append(args, pageSize, pageNum*pageSize)...)
 	}
 	if err != nil {
 		return func() (LicenseReport, error) { return LicenseReport{}, err }
@@ -101,8 +158,9 @@ func (s *sqlStore) ListByContentID(contentID string, pageSize int, pageNum int)
 // UpdateRights
 func (s *sqlStore) UpdateRights(l License) error {
 
-	result, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "UPDATE license SET rights_print=?, rights_copy=?, rights_start=?, rights_end=?, updated=? WHERE id=?"),
+	query, args := s.inTenant("UPDATE license SET rights_print=?, rights_copy=?, rights_start=?, rights_end=?, updated=? WHERE id=?",
 		l.Rights.Print, l.Rights.Copy, l.Rights.Start, l.Rights.End, time.Now().UTC().Truncate(time.Second), l.ID)
+	result, err := s.db.Exec(query, args...)
 
 	if err == nil {
 		if r, _ := result.RowsAffected(); r == 0 {
@@ -112,29 +170,124 @@ func (s *sqlStore) UpdateRights(l License) error {
 	return err
 }
 
-// Add creates a new record in the license table
-func (s *sqlStore) Add(l License) error {
+// UpdateRightsAndNotify updates the rights of a license, with l.Updated as its update date
+func (s *sqlStore) UpdateRightsAndNotify(l License, notify func(tx *sql.Tx) error) error {
+
+	updated := time.Now().UTC().Truncate(time.Second)
+	if l.Updated != nil {
+		updated = *l.Updated
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	query, args := s.inTenant("UPDATE license SET rights_print=?, rights_copy=?, rights_start=?, rights_end=?, updated=? WHERE id=?",
+		l.Rights.Print, l.Rights.Copy, l.Rights.Start, l.Rights.End, updated, l.ID)
+	result, err := tx.Exec(query, args...)
+	if err == nil {
+		if r, _ := result.RowsAffected(); r == 0 {
+			err = ErrNotFound
+		}
+	}
+	if err == nil {
+		err = notify(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert returns the query and arguments which insert a license in the license table.
+// The license is attached to the tenant of the store, or to its own tenant if the store is not scoped.
+func (s *sqlStore) insert(l License) (string, []interface{}) {
+
+	tenant := l.Tenant
+	if s.scoped {
+		tenant = s.tenant
+	}
+	hint, value := s.sealUserKey(l.User.ID, UserKey{Hint: l.Encryption.UserKey.Hint, Value: l.PassphraseHash})
 
-	_, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `INSERT INTO license (id, user_id, provider, issued, updated,
-	rights_print, rights_copy, rights_start, rights_end, content_fk) 
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?,  ?, ?)`),
+	return dbutils.GetParamQuery(config.Config.LcpServer.Database, `INSERT INTO license (id, user_id, provider, issued, updated,
+	rights_print, rights_copy, rights_start, rights_end, content_fk, tenant, user_email, user_key_hint, user_key_value) 
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?,  ?, ?, ?, ?, ?, ?)`), []interface{}{
 		l.ID, l.User.ID, l.Provider, l.Issued, nil,
 		l.Rights.Print, l.Rights.Copy, l.Rights.Start, l.Rights.End,
-		l.ContentID)
+		l.ContentID, tenant, sql.NullString{String: l.UserEmail, Valid: l.UserEmail != ""}, hint, value}
+}
+
+// Add creates a new record in the license table
+func (s *sqlStore) Add(l License) error {
+
+	query, args := s.insert(l)
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+// AddAndNotify creates a new record in the license table, and records its notification
+// in the same transaction: the license is not stored if the notification cannot be recorded.
+func (s *sqlStore) AddAndNotify(l License, notify func(tx *sql.Tx) error) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	query, args := s.insert(l)
+	if _, err = tx.Exec(query, args...); err == nil {
+		err = notify(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddTx creates a new record in the license table in a transaction
+func (s *sqlStore) AddTx(tx *sql.Tx, l License) error {
+
+	query, args := s.insert(l)
+	_, err := tx.Exec(query, args...)
 	return err
 }
 
+// DeleteAndNotify removes a record from the license table, and calls notify in the same transaction
+func (s *sqlStore) DeleteAndNotify(id string, notify func(tx *sql.Tx) error) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	query, args := s.inTenant("DELETE FROM license WHERE id=?", id)
+	result, err := tx.Exec(query, args...)
+	if err == nil {
+		if r, _ := result.RowsAffected(); r == 0 {
+			err = ErrNotFound
+		}
+	}
+	if err == nil {
+		err = notify(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Update updates a record in the license table
 func (s *sqlStore) Update(l License) error {
 
-	_, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `UPDATE license SET user_id=?,provider=?,updated=?,
+	query, args := s.inTenant(`UPDATE license SET user_id=?,provider=?,updated=?,
 				rights_print=?,	rights_copy=?,	rights_start=?,	rights_end=?, content_fk =?
-				WHERE id=?`),
+				WHERE id=?`,
 		l.User.ID, l.Provider,
 		time.Now().UTC().Truncate(time.Second),
 		l.Rights.Print, l.Rights.Copy, l.Rights.Start, l.Rights.End,
 		l.ContentID,
 		l.ID)
+	_, err := s.db.Exec(query, args...)
 
 	return err
 }
@@ -142,8 +295,8 @@ func (s *sqlStore) Update(l License) error {
 // UpdateLsdStatus
 func (s *sqlStore) UpdateLsdStatus(id string, status int32) error {
 
-	_, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `UPDATE license SET lsd_status =? WHERE id=?`),
-		status, id)
+	query, args := s.inTenant(`UPDATE license SET lsd_status =? WHERE id=?`, status, id)
+	_, err := s.db.Exec(query, args...)
 
 	return err
 }
@@ -151,22 +304,133 @@ func (s *sqlStore) UpdateLsdStatus(id string, status int32) error {
 // Get a license from the db
 func (s *sqlStore) Get(id string) (License, error) {
 
-	row := s.dbGetByID.QueryRow(id)
+	var row *sql.Row
+	if s.scoped {
+		row = s.dbGetByIDInTenant.QueryRow(id, s.tenant)
+	} else {
+		row = s.dbGetByID.QueryRow(id)
+	}
 	var l License
 	l.Rights = new(UserRights)
 	err := row.Scan(&l.ID, &l.User.ID, &l.Provider, &l.Issued, &l.Updated,
-		&l.Rights.Print, &l.Rights.Copy, &l.Rights.Start, &l.Rights.End, &l.ContentID)
+		&l.Rights.Print, &l.Rights.Copy, &l.Rights.Start, &l.Rights.End, &l.ContentID, &l.Tenant)
 	if err == sql.ErrNoRows {
 		err = ErrNotFound
 	}
 	return l, err
 }
 
+// GetUserKey returns the hint and passphrase hash stored with a license;
+// the passphrase hash is nil if the license was generated before they were stored, or if they are not stored
+func (s *sqlStore) GetUserKey(id string) (UserKey, error) {
+
+	var key UserKey
+	var userID string
+	var hint, value sql.NullString
+	query, args := s.inTenant(`SELECT user_id, user_key_hint, user_key_value FROM license WHERE id=?`, id)
+	err := s.db.QueryRow(query, args...).Scan(&userID, &hint, &value)
+	if err == sql.ErrNoRows {
+		return key, ErrNotFound
+	}
+	if err != nil {
+		return key, err
+	}
+	if !value.Valid || s.userKeyAEAD == nil {
+		return key, nil
+	}
+	key.Hint = hint.String
+	key.Value, err = s.openUserKey(userID, value.String)
+	return key, err
+}
+
+// sealUserKey returns the hint and the encrypted passphrase hash of a user key, as stored with a license.
+// The user id is authenticated with the passphrase hash, which cannot be moved to the license of another user.
+// Nothing is stored without a passphrase hash, or if the passphrase hashes are not stored.
+func (s *sqlStore) sealUserKey(userID string, key UserKey) (sql.NullString, sql.NullString) {
+
+	if s.userKeyAEAD == nil || len(key.Value) == 0 {
+		return sql.NullString{}, sql.NullString{}
+	}
+	nonce := make([]byte, s.userKeyAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sql.NullString{}, sql.NullString{}
+	}
+	sealed := s.userKeyAEAD.Seal(nonce, nonce, key.Value, []byte(userID))
+	return sql.NullString{String: key.Hint, Valid: true},
+		sql.NullString{String: base64.StdEncoding.EncodeToString(sealed), Valid: true}
+}
+
+// openUserKey decrypts a stored passphrase hash
+func (s *sqlStore) openUserKey(userID string, stored string) ([]byte, error) {
+
+	sealed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return nil, err
+	}
+	size := s.userKeyAEAD.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("invalid stored passphrase hash")
+	}
+	return s.userKeyAEAD.Open(nil, sealed[:size], sealed[size:], []byte(userID))
+}
+
+// UpdateUserKey updates the user key data of all the licenses of a user in a transaction,
+// with the notification of each updated license; it returns the count of updated licenses
+func (s *sqlStore) UpdateUserKey(userID string, key UserKey, notify func(tx *sql.Tx, l License) error) (int, error) {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	licenses, err := s.listByUser(tx, userID)
+	if err == nil {
+		updated := time.Now().UTC().Truncate(time.Second)
+		hint, value := s.sealUserKey(userID, key)
+		query, args := s.inTenant(`UPDATE license SET user_key_hint=?, user_key_value=?, updated=? WHERE user_id=?`,
+			hint, value, updated, userID)
+		_, err = tx.Exec(query, args...)
+		for i := 0; err == nil && i < len(licenses); i++ {
+			licenses[i].Updated = &updated
+			err = notify(tx, licenses[i])
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return len(licenses), tx.Commit()
+}
+
+// listByUser returns the licenses of a user
+func (s *sqlStore) listByUser(tx *sql.Tx, userID string) ([]License, error) {
+
+	query, args := s.inTenant(`SELECT id, user_id, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk
+	FROM license WHERE user_id=?`, userID)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var licenses []License
+	for rows.Next() {
+		var l License
+		l.Rights = new(UserRights)
+		err = rows.Scan(&l.ID, &l.User.ID, &l.Provider, &l.Issued, &l.Updated,
+			&l.Rights.Print, &l.Rights.Copy, &l.Rights.Start, &l.Rights.End, &l.ContentID)
+		if err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, l)
+	}
+	return licenses, rows.Err()
+}
+
 // TouchByContentID updates the updated field of all licenses for a given contentID
 func (s *sqlStore) TouchByContentID(contentID string) error {
 
-	_, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `UPDATE license SET updated=? WHERE content_fk=?`),
+	query, args := s.inTenant(`UPDATE license SET updated=? WHERE content_fk=?`,
 		time.Now().UTC().Truncate(time.Second), contentID)
+	_, err := s.db.Exec(query, args...)
 	if err != nil {
 		log.Println("Error touching licenses for contentID", contentID)
 	}
@@ -176,10 +440,9 @@ func (s *sqlStore) TouchByContentID(contentID string) error {
 // Count counts the number of licenses generated during a time period
 func (s *sqlStore) Count(from, to time.Time) (int, error) {
 
-	// note: I chose not to add an index on the issued field.
-	// This is to avoid performance issues with high write loads, for a query only made once in a while.
-	row := s.db.QueryRow(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT COUNT(*) FROM license WHERE issued BETWEEN ? AND ?`),
-		from, to)
+	// note: the issued field is indexed, as it is used for searching licenses.
+	query, args := s.inTenant(`SELECT COUNT(*) FROM license WHERE issued BETWEEN ? AND ?`, from, to)
+	row := s.db.QueryRow(query, args...)
 	var count int
 	err := row.Scan(&count)
 
@@ -199,49 +462,113 @@ func Open(db *sql.DB) (store Store, err error) {
 			return nil, err
 		}
 	}
+	// licenses created before the support of tenants belong to the default tenant
+	err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "license", "tenant", "varchar(255) NOT NULL DEFAULT ''")
+	if err != nil {
+		log.Println("Error adding a tenant column to the license table")
+		return
+	}
+	// licenses created before the support of search have no email
+	err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "license", "user_email", "varchar(255) DEFAULT NULL")
+	if err != nil {
+		log.Println("Error adding a user_email column to the license table")
+		return
+	}
+	// licenses created before the storage of user keys cannot be reissued without a passphrase hash
+	err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "license", "user_key_hint", "varchar(255) DEFAULT NULL")
+	if err == nil {
+		err = dbutils.AddColumn(db, config.Config.LcpServer.Database, "license", "user_key_value", "varchar(128) DEFAULT NULL")
+	}
+	if err != nil {
+		log.Println("Error adding user key columns to the license table")
+		return
+	}
+	// indexes used for searching licenses; created by the setup scripts of other databases
+	if driver == "sqlite3" || driver == "postgres" {
+		for _, def := range indexDefs {
+			_, err = db.Exec(strings.Replace(def, "CREATE INDEX", "CREATE INDEX IF NOT EXISTS", 1))
+			if err != nil {
+				log.Println("Error creating a license index")
+				return
+			}
+		}
+	}
 
-	var dbList *sql.Stmt
-	if driver == "mssql" {
-		dbList, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT id, user_id, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk
-	FROM license ORDER BY issued desc OFFSET ? ROWS FETCH NEXT ? ROWS ONLY`))
-	} else {
-		dbList, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT id, user_id, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk
-	FROM license ORDER BY issued desc LIMIT ? OFFSET ?`))
+	const columns = `SELECT id, user_id, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk
+	FROM license `
+	// prepare a paginated list
+	prepareList := func(where string) (*sql.Stmt, error) {
+		if driver == "mssql" {
+			return db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, columns+where+` ORDER BY issued desc OFFSET ? ROWS FETCH NEXT ? ROWS ONLY`))
+		}
+		return db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, columns+where+` ORDER BY issued desc LIMIT ? OFFSET ?`))
+	}
+
+	var dbList, dbListInTenant *sql.Stmt
+	dbList, err = prepareList("")
+	if err == nil {
+		dbListInTenant, err = prepareList("WHERE tenant = ?")
 	}
 	if err != nil {
 		log.Println("Error preparing dbList")
 		return
 	}
 
-	var dbListByContentID *sql.Stmt
-	if driver == "mssql" {
-		dbListByContentID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT id, user_id, provider, issued, updated, 
-		rights_print, rights_copy, rights_start, rights_end, content_fk
-		FROM license WHERE content_fk = ? ORDER BY issued desc OFFSET ? ROWS FETCH NEXT ? ROWS ONLY`))
-	} else {
-		dbListByContentID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT id, user_id, provider, issued, updated, 
-		rights_print, rights_copy, rights_start, rights_end, content_fk
-		FROM license WHERE content_fk = ?  ORDER BY issued desc LIMIT ? OFFSET ?`))
-
+	var dbListByContentID, dbListByContentIDInTenant *sql.Stmt
+	dbListByContentID, err = prepareList("WHERE content_fk = ?")
+	if err == nil {
+		dbListByContentIDInTenant, err = prepareList("WHERE content_fk = ? AND tenant = ?")
 	}
 	if err != nil {
 		log.Println("Error preparing dbListByContentID")
 		return
 	}
 
-	var dbGetByID *sql.Stmt
-	dbGetByID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT id, user_id, provider, issued, updated, rights_print, rights_copy,
-	rights_start, rights_end, content_fk 
-	FROM license WHERE id = ?`))
+	var dbGetByID, dbGetByIDInTenant *sql.Stmt
+	// a single license is read with its tenant
+	const getColumns = `SELECT id, user_id, provider, issued, updated, rights_print, rights_copy, rights_start, rights_end, content_fk, tenant
+	FROM license `
+	dbGetByID, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, getColumns+`WHERE id = ?`))
+	if err == nil {
+		dbGetByIDInTenant, err = db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, getColumns+`WHERE id = ? AND tenant = ?`))
+	}
 	if err != nil {
 		log.Println("Error preparing dbGetByID")
 		return
 	}
 
-	store = &sqlStore{db, dbGetByID, dbList, dbListByContentID}
+	// the passphrase hashes are only stored, encrypted, if a secret is configured
+	var userKeyAEAD cipher.AEAD
+	if secret := config.Config.LcpServer.UserKeySecret; secret != "" {
+		userKeyAEAD, err = newUserKeyAEAD(secret)
+		if err != nil {
+			log.Println("Error in the user key secret")
+			return
+		}
+	}
+
+	store = &sqlStore{db: db, dbGetByID: dbGetByID, dbList: dbList, dbListByContentID: dbListByContentID,
+		dbGetByIDInTenant: dbGetByIDInTenant, dbListInTenant: dbListInTenant, dbListByContentIDInTenant: dbListByContentIDInTenant,
+		userKeyAEAD: userKeyAEAD}
 	return
 }
 
+// newUserKeyAEAD returns the AES-GCM cipher of the stored passphrase hashes, from a hex encoded 256 bit key
+func newUserKeyAEAD(secret string) (cipher.AEAD, error) {
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("the user key secret must be a hex encoded 256 bit key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 const tableDef = "CREATE TABLE IF NOT EXISTS license (" +
 	"id varchar(255) PRIMARY KEY," +
 	"user_id varchar(255) NOT NULL," +
@@ -254,4 +581,19 @@ const tableDef = "CREATE TABLE IF NOT EXISTS license (" +
 	"rights_end datetime DEFAULT NULL," +
 	"content_fk varchar(255) NOT NULL," +
 	"lsd_status integer default 0," +
+	"tenant varchar(255) NOT NULL DEFAULT ''," +
+	"user_email varchar(255) DEFAULT NULL," +
+	"user_key_hint varchar(255) DEFAULT NULL," +
+	"user_key_value varchar(128) DEFAULT NULL," +
 	"FOREIGN KEY(content_fk) REFERENCES content(id))"
+
+// indexDefs are the indexes of the license table used for searching licenses
+var indexDefs = []string{
+	"CREATE INDEX license_user_id_index ON license (user_id)",
+	"CREATE INDEX license_user_email_index ON license (user_email)",
+	"CREATE INDEX license_provider_index ON license (provider)",
+	"CREATE INDEX license_content_fk_index ON license (content_fk)",
+	"CREATE INDEX license_issued_index ON license (issued)",
+	"CREATE INDEX license_rights_end_index ON license (rights_end)",
+	"CREATE INDEX license_updated_index ON license (updated)",
+}
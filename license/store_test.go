@@ -7,6 +7,9 @@ package license
 import (
 	"bytes"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -140,3 +143,241 @@ func TestCRUD(t *testing.T) {
 	}
 
 }
+
+func TestTenants(t *testing.T) {
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := st.ForTenant("acme")
+	other := st.ForTenant("other")
+
+	var l License
+	Initialize("1234-1234-1234-1234", &l)
+	l.User.ID = "me"
+	l.Provider = "acme.org"
+	l.Rights = new(UserRights)
+	if err = acme.Add(l); err != nil {
+		t.Fatal(err)
+	}
+	acmeID := l.ID
+	Initialize("1234-1234-1234-1234", &l)
+	if err = st.Add(l); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = acme.Get(acmeID); err != nil {
+		t.Error(err)
+	}
+	if _, err = other.Get(acmeID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound from another tenant, got %v", err)
+	}
+	if got, err := st.Get(acmeID); err != nil || got.Tenant != "acme" {
+		t.Errorf("Expected the unscoped store to reach every tenant, got %q, %v", got.Tenant, err)
+	}
+	// a license added without a tenant restriction keeps its own tenant, e.g. a transferred license
+	var transferred License
+	Initialize("1234-1234-1234-1234", &transferred)
+	transferred.Rights = new(UserRights)
+	transferred.Tenant = "acme"
+	if err = st.Add(transferred); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := acme.Get(transferred.ID); err != nil || got.Tenant != "acme" {
+		t.Errorf("Expected the license to be attached to its tenant, got %q, %v", got.Tenant, err)
+	}
+	l.ID = acmeID
+	if err = other.UpdateRights(l); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound on an update from another tenant, got %v", err)
+	}
+
+	count := func(fn func() (LicenseReport, error)) int {
+		n := 0
+		for _, err := fn(); err == nil; _, err = fn() {
+			n++
+		}
+		return n
+	}
+	if n := count(acme.ListAll(10, 0)); n != 2 {
+		t.Errorf("Expected 2 acme licenses, got %d", n)
+	}
+	if n := count(st.ListByContentID("1234-1234-1234-1234", 10, 0)); n != 3 {
+		t.Errorf("Expected 3 licenses, got %d", n)
+	}
+	if n := count(other.ListByContentID("1234-1234-1234-1234", 10, 0)); n != 0 {
+		t.Errorf("Expected no license for another tenant, got %d", n)
+	}
+	n, err := acme.Count(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || n != 2 {
+		t.Errorf("Expected a count of 2 acme licenses, got %d, %v", n, err)
+	}
+}
+
+func TestAddAndNotify(t *testing.T) {
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var l License
+	Initialize("1234-1234-1234-1234", &l)
+	l.User.ID = "me"
+	l.Rights = new(UserRights)
+	// the license is not stored if its notification fails
+	err = st.AddAndNotify(l, func(tx *sql.Tx) error { return errors.New("no outbox") })
+	if err == nil {
+		t.Error("Expected an error from the notification")
+	}
+	if _, err = st.Get(l.ID); err != ErrNotFound {
+		t.Errorf("Expected the license to be rolled back, got %v", err)
+	}
+	notified := false
+	err = st.AddAndNotify(l, func(tx *sql.Tx) error { notified = true; return nil })
+	if err != nil || !notified {
+		t.Fatalf("Expected the license to be notified, got %v", err)
+	}
+	if _, err = st.Get(l.ID); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserKey(t *testing.T) {
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	config.Config.LcpServer.UserKeySecret = strings.Repeat("ab", 32)
+	defer func() { config.Config.LcpServer.UserKeySecret = "" }()
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(userID string, hash []byte) License {
+		l := License{User: UserInfo{ID: userID}, Provider: "my.org", Rights: new(UserRights)}
+		l.Encryption.UserKey.Hint = "old hint"
+		l.Encryption.UserKey.Value = hash
+		Initialize("c1", &l)
+		if err := st.Add(l); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	oldHash := bytes.Repeat([]byte{1}, 32)
+	l1 := add("u1", oldHash)
+	add("u1", oldHash)
+	l3 := add("u2", oldHash)
+	// a license generated before the storage of user keys
+	l4 := add("u1", nil)
+
+	key, err := st.GetUserKey(l1.ID)
+	if err != nil || key.Hint != "old hint" || !bytes.Equal(key.Value, oldHash) {
+		t.Fatalf("Unexpected user key %+v, %v", key, err)
+	}
+	if _, err = st.GetUserKey("unknown"); err != ErrNotFound {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	// the passphrase hash is encrypted, and bound to its user
+	var stored string
+	if err = db.QueryRow("SELECT user_key_value FROM license WHERE id=?", l1.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, hex.EncodeToString(oldHash)) || strings.Contains(stored, string(oldHash)) {
+		t.Errorf("Expected an encrypted passphrase hash, got %s", stored)
+	}
+	if _, err = db.Exec("UPDATE license SET user_key_value=? WHERE id=?", stored, l3.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.GetUserKey(l3.ID); err == nil {
+		t.Error("Expected the passphrase hash of another user to be rejected")
+	}
+	if _, err = st.UpdateUserKey("u2", UserKey{Hint: "old hint", Value: oldHash}, func(tx *sql.Tx, l License) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	newHash := bytes.Repeat([]byte{2}, 32)
+	var notified []string
+	count, err := st.UpdateUserKey("u1", UserKey{Hint: "new hint", Value: newHash}, func(tx *sql.Tx, l License) error {
+		if l.Updated == nil || l.User.ID != "u1" {
+			t.Errorf("Unexpected notified license %+v", l)
+		}
+		notified = append(notified, l.ID)
+		return nil
+	})
+	if err != nil || count != 3 || len(notified) != 3 {
+		t.Fatalf("Expected 3 updated licenses, got %d, %v", count, err)
+	}
+	for _, id := range []string{l1.ID, l4.ID} {
+		key, err = st.GetUserKey(id)
+		if err != nil || key.Hint != "new hint" || !bytes.Equal(key.Value, newHash) {
+			t.Errorf("Unexpected user key %+v, %v", key, err)
+		}
+		if l, _ := st.Get(id); l.Updated == nil {
+			t.Errorf("Expected the license %s to be updated", id)
+		}
+	}
+	if key, _ = st.GetUserKey(l3.ID); !bytes.Equal(key.Value, oldHash) {
+		t.Error("The license of another user has been updated")
+	}
+
+	// a failed notification cancels the update
+	_, err = st.UpdateUserKey("u2", UserKey{Hint: "new hint", Value: newHash}, func(tx *sql.Tx, l License) error {
+		return errors.New("notification failed")
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if key, _ = st.GetUserKey(l3.ID); !bytes.Equal(key.Value, oldHash) {
+		t.Error("The user key has been updated despite the failed notification")
+	}
+
+	// without a secret, the passphrase hashes are not stored
+	config.Config.LcpServer.UserKeySecret = ""
+	plain, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := License{User: UserInfo{ID: "u3"}, Provider: "my.org", Rights: new(UserRights)}
+	l.Encryption.UserKey.Hint = "hint"
+	l.Encryption.UserKey.Value = oldHash
+	Initialize("c1", &l)
+	if err = plain.Add(l); err != nil {
+		t.Fatal(err)
+	}
+	var value sql.NullString
+	if err = db.QueryRow("SELECT user_key_value FROM license WHERE id=?", l.ID).Scan(&value); err != nil || value.Valid {
+		t.Errorf("Expected no stored passphrase hash, got %v, %v", value, err)
+	}
+	if key, err = plain.GetUserKey(l1.ID); err != nil || key.Value != nil {
+		t.Errorf("Expected no passphrase hash without a secret, got %+v, %v", key, err)
+	}
+
+	config.Config.LcpServer.UserKeySecret = "not a key"
+	if _, err = Open(db); err == nil {
+		t.Error("Expected an invalid secret to be rejected")
+	}
+}
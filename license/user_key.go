@@ -6,18 +6,58 @@
 package license
 
 import (
-	"log"
+	"errors"
+	"sync"
+)
+
+// BasicProfileURL is the profile URL of the basic (test) LCP profile
+const BasicProfileURL = "http://readium.org/lcp/basic-profile"
+
+// UserKeyTransform derives the user key of an LCP profile from the hash of the user passphrase
+type UserKeyTransform interface {
+	Transform(profile string, passphraseHash []byte) ([]byte, error)
+}
+
+// UserKeyTransformFunc is a function used as a user key transform
+type UserKeyTransformFunc func(profile string, passphraseHash []byte) ([]byte, error)
 
-	"github.com/readium/readium-lcp-server/config"
+// Transform calls f(profile, passphraseHash)
+func (f UserKeyTransformFunc) Transform(profile string, passphraseHash []byte) ([]byte, error) {
+	return f(profile, passphraseHash)
+}
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]UserKeyTransform{
+		// the user key of the basic profile is the passphrase hash
+		BasicProfileURL: UserKeyTransformFunc(func(profile string, passphraseHash []byte) ([]byte, error) {
+			return passphraseHash, nil
+		}),
+	}
 )
 
-var LCP_PRODUCTION_LIB = false
+// RegisterUserKeyTransform registers the user key transform of an LCP profile, given its URL.
+// Production builds may register their transform from an init function;
+// a transform registered for a profile replaces the previous one.
+func RegisterUserKeyTransform(profile string, t UserKeyTransform) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[profile] = t
+}
+
+// GetUserKeyTransform returns the user key transform of an LCP profile
+func GetUserKeyTransform(profile string) (UserKeyTransform, bool) {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	t, ok := transforms[profile]
+	return t, ok
+}
 
-// GenerateUserKey function prepares the user key
-func GenerateUserKey(key UserKey) []byte {
-	if config.Config.Profile != "basic" {
-		log.Println("Incompatible LCP profile")
-		return nil
+// GenerateUserKey function prepares the user key of a given profile
+func GenerateUserKey(profile string, key UserKey) ([]byte, error) {
+	t, ok := GetUserKeyTransform(profile)
+	if !ok {
+		return nil, errors.New("no user key transform for the LCP profile " + profile)
 	}
-	return key.Value
+	return t.Transform(profile, key.Value)
 }
@@ -0,0 +1,140 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package license
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// default maximum duration of a transform by an external process
+const defaultTransformTimeout = 10 * time.Second
+
+// processTransform is a user key transform implemented by a long-running external process.
+// For each user key, the process reads a line on its standard input, made of the profile URL
+// and the hex-encoded passphrase hash separated by a space, and writes a line on its standard output:
+// the hex-encoded user key, or "ERROR" followed by a message.
+// The process is started on the first transform, and restarted after a failure.
+type processTransform struct {
+	command string
+	args    []string
+	timeout time.Duration
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+// NewProcessTransform returns a user key transform implemented by an external process
+func NewProcessTransform(command string, args []string, timeout time.Duration) UserKeyTransform {
+	if timeout <= 0 {
+		timeout = defaultTransformTimeout
+	}
+	return &processTransform{command: command, args: args, timeout: timeout}
+}
+
+// Transform sends a passphrase hash to the external process and reads the user key
+func (p *processTransform) Transform(profile string, passphraseHash []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return nil, err
+		}
+	}
+	line, err := p.exchange(profile + " " + hex.EncodeToString(passphraseHash) + "\n")
+	if err != nil {
+		// the process is in an unknown state, it is restarted on the next transform
+		p.stop()
+		return nil, errors.New("user key transform " + p.command + ": " + err.Error())
+	}
+	if strings.HasPrefix(line, "ERROR") {
+		return nil, errors.New("user key transform " + p.command + ": " + strings.TrimSpace(strings.TrimPrefix(line, "ERROR")))
+	}
+	key, err := hex.DecodeString(line)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("user key transform " + p.command + ": invalid user key")
+	}
+	return key, nil
+}
+
+func (p *processTransform) start() error {
+	cmd := exec.Command(p.command, p.args...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	log.Println("User key transform " + p.command + " started")
+	p.cmd, p.in, p.out = cmd, in, bufio.NewReader(out)
+	return nil
+}
+
+func (p *processTransform) stop() {
+	p.in.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+	p.cmd = nil
+}
+
+// exchange writes a request line and reads the response line, within the timeout of the transform
+func (p *processTransform) exchange(request string) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func(in io.Writer, out *bufio.Reader) {
+		if _, err := io.WriteString(in, request); err != nil {
+			done <- result{err: err}
+			return
+		}
+		line, err := out.ReadString('\n')
+		done <- result{strings.TrimSpace(line), err}
+	}(p.in, p.out)
+
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-time.After(p.timeout):
+		return "", errors.New("timeout")
+	}
+}
+
+// InitUserKeyTransforms registers the external user key transforms of the configuration,
+// then checks that the configured LCP profile has a user key transform
+func InitUserKeyTransforms(transforms map[string]config.UserKeyTransform) error {
+	for profile, t := range transforms {
+		if _, err := exec.LookPath(t.Command); err != nil {
+			return errors.New("user key transform of profile " + profile + ": " + err.Error())
+		}
+		RegisterUserKeyTransform(profile, NewProcessTransform(t.Command, t.Args, time.Duration(t.Timeout)*time.Second))
+	}
+
+	profile := licenseProfileURL()
+	if _, ok := GetUserKeyTransform(profile); !ok {
+		return errors.New("no user key transform for the LCP profile " + config.Config.Profile)
+	}
+	return nil
+}
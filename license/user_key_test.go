@@ -0,0 +1,103 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package license
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+const testProfile = "http://readium.org/lcp/profile-9.9"
+
+// TestHelperTransform is not a real test: it is the external process used by the process transform tests.
+// It hashes the passphrase hash once more, rejects an empty hash and hangs on a hash of zeros.
+func TestHelperTransform(t *testing.T) {
+	if os.Getenv("LCP_TEST_TRANSFORM") != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		hash, _ := hex.DecodeString(fields[len(fields)-1])
+		switch {
+		case len(fields) != 2 || len(hash) == 0:
+			fmt.Println("ERROR invalid request")
+		case bytes.Equal(hash, make([]byte, 32)):
+			time.Sleep(time.Minute)
+		default:
+			key := sha256.Sum256(hash)
+			fmt.Println(hex.EncodeToString(key[:]))
+		}
+	}
+	os.Exit(0)
+}
+
+func TestBasicUserKey(t *testing.T) {
+	hash := sha256.Sum256([]byte("passphrase"))
+	key, err := GenerateUserKey(BasicProfileURL, UserKey{Value: hash[:]})
+	if err != nil || !bytes.Equal(key, hash[:]) {
+		t.Errorf("Unexpected basic user key %x, %v", key, err)
+	}
+	if _, err = GenerateUserKey("http://readium.org/lcp/profile-0.0", UserKey{Value: hash[:]}); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestProcessTransform(t *testing.T) {
+	t.Setenv("LCP_TEST_TRANSFORM", "1")
+	RegisterUserKeyTransform(testProfile, NewProcessTransform(os.Args[0], []string{"-test.run=^TestHelperTransform$"}, time.Second))
+
+	hash := sha256.Sum256([]byte("passphrase"))
+	expected := sha256.Sum256(hash[:])
+	for i := 0; i < 2; i++ {
+		key, err := GenerateUserKey(testProfile, UserKey{Value: hash[:]})
+		if err != nil || !bytes.Equal(key, expected[:]) {
+			t.Fatalf("Unexpected user key %x, %v", key, err)
+		}
+	}
+
+	// an error reported by the process
+	if _, err := GenerateUserKey(testProfile, UserKey{}); err == nil || !strings.Contains(err.Error(), "invalid request") {
+		t.Errorf("Expected an error of the process, got %v", err)
+	}
+	// a process which does not answer is restarted
+	if _, err := GenerateUserKey(testProfile, UserKey{Value: make([]byte, 32)}); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	key, err := GenerateUserKey(testProfile, UserKey{Value: hash[:]})
+	if err != nil || !bytes.Equal(key, expected[:]) {
+		t.Errorf("Unexpected user key after a restart %x, %v", key, err)
+	}
+}
+
+func TestInitUserKeyTransforms(t *testing.T) {
+	defer func(profile string) { config.Config.Profile = profile }(config.Config.Profile)
+
+	config.Config.Profile = "basic"
+	if err := InitUserKeyTransforms(nil); err != nil {
+		t.Error(err)
+	}
+	config.Config.Profile = "9.8"
+	if err := InitUserKeyTransforms(nil); err == nil {
+		t.Error("Expected an error for a profile without user key transform")
+	}
+	transforms := map[string]config.UserKeyTransform{"http://readium.org/lcp/profile-9.8": {Command: os.Args[0]}}
+	if err := InitUserKeyTransforms(transforms); err != nil {
+		t.Error(err)
+	}
+	transforms = map[string]config.UserKeyTransform{"http://readium.org/lcp/profile-9.7": {Command: "/nonexistent/transform"}}
+	if err := InitUserKeyTransforms(transforms); err == nil {
+		t.Error("Expected an error for a missing command")
+	}
+}
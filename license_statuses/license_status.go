@@ -7,6 +7,7 @@ package licensestatuses
 import (
 	"time"
 
+	"github.com/readium/readium-lcp-server/config"
 	"github.com/readium/readium-lcp-server/transactions"
 )
 
@@ -43,4 +44,18 @@ type LicenseStatus struct {
 	PotentialRights   *PotentialRights     `json:"potential_rights,omitempty"`
 	Events            []transactions.Event `json:"events,omitempty"`
 	CurrentEndLicense *time.Time           `json:"-"`
+	// Version is incremented by each update, see Update
+	Version int `json:"-"`
+	// Policy is the loan policy attached to the license status when it was created;
+	// the global license status settings apply if it is nil
+	Policy     *config.LoanPolicy `json:"-"`
+	RenewCount int                `json:"-"`
+}
+
+// LoanPolicy returns the loan policy which applies to a license status
+func (ls *LicenseStatus) LoanPolicy() config.LoanPolicy {
+	if ls.Policy != nil {
+		return *ls.Policy
+	}
+	return config.Config.LicenseStatus.DefaultLoanPolicy()
 }
@@ -6,6 +6,7 @@ package licensestatuses
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
 	"time"
@@ -18,13 +19,18 @@ import (
 // ErrNotFound is license status not found
 var ErrNotFound = errors.New("license Status not found")
 
+// ErrConflict signals a license status modified since it was read
+var ErrConflict = errors.New("license Status modified concurrently")
+
 // LicenseStatuses is an interface
 type LicenseStatuses interface {
 	GetByID(id int) (*LicenseStatus, error)
 	Add(ls LicenseStatus) error
+	AddTx(tx *sql.Tx, ls LicenseStatus) (int, error)
 	List(deviceLimit int64, limit int64, offset int64) func() (LicenseStatus, error)
 	GetByLicenseID(id string) (*LicenseStatus, error)
 	Update(ls LicenseStatus) error
+	UpdateWith(ls LicenseStatus, within func(tx *sql.Tx) error) error
 	Count(from time.Time, to time.Time) (int, error)
 	CountWithStatus(from time.Time, to time.Time, status string) (int, error)
 }
@@ -44,13 +50,18 @@ func (i dbLicenseStatuses) GetByID(id int) (*LicenseStatus, error) {
 	var potentialRightsEnd *time.Time
 	var licenseUpdate *time.Time
 	var statusUpdate *time.Time
+	var policy sql.NullString
 
 	row := i.dbGet.QueryRow(id)
-	err := row.Scan(&ls.ID, &statusDB, &licenseUpdate, &statusUpdate, &ls.DeviceCount, &potentialRightsEnd, &ls.LicenseRef, &ls.CurrentEndLicense)
+	err := row.Scan(&ls.ID, &statusDB, &licenseUpdate, &statusUpdate, &ls.DeviceCount, &potentialRightsEnd, &ls.LicenseRef, &ls.CurrentEndLicense, &ls.Version, &policy, &ls.RenewCount)
 
 	if err == nil {
 		status.GetStatus(statusDB, &ls.Status)
 
+		if err = decodePolicy(policy, &ls); err != nil {
+			return nil, err
+		}
+
 		ls.Updated = new(Updated)
 
 		if (potentialRightsEnd != nil) && (!(*potentialRightsEnd).IsZero()) {
@@ -82,6 +93,21 @@ func (i dbLicenseStatuses) GetByID(id int) (*LicenseStatus, error) {
 
 // Add adds license status to database
 func (i dbLicenseStatuses) Add(ls LicenseStatus) error {
+	return i.insert(i.db, ls)
+}
+
+// AddTx adds a license status within a db transaction, and returns its id
+func (i dbLicenseStatuses) AddTx(tx *sql.Tx, ls LicenseStatus) (int, error) {
+	err := i.insert(tx, ls)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	err = tx.QueryRow(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT id FROM license_status WHERE license_ref=?"), ls.LicenseRef).Scan(&id)
+	return id, err
+}
+
+func (i dbLicenseStatuses) insert(ex execer, ls LicenseStatus) error {
 
 	statusDB, err := status.SetStatus(ls.Status)
 	if err == nil {
@@ -90,10 +116,15 @@ func (i dbLicenseStatuses) Add(ls LicenseStatus) error {
 		if ls.PotentialRights != nil && ls.PotentialRights.End != nil && !(*ls.PotentialRights.End).IsZero() {
 			end = ls.PotentialRights.End
 		}
-		_, err = i.db.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, `INSERT INTO license_status 
-		(status, license_updated, status_updated, device_count, potential_rights_end, license_ref,  rights_end)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`),
-			statusDB, ls.Updated.License, ls.Updated.Status, ls.DeviceCount, end, ls.LicenseRef, ls.CurrentEndLicense)
+		var policy sql.NullString
+		policy, err = encodePolicy(ls)
+		if err != nil {
+			return err
+		}
+		_, err = ex.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, `INSERT INTO license_status 
+		(status, license_updated, status_updated, device_count, potential_rights_end, license_ref,  rights_end, loan_policy, renew_count)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			statusDB, ls.Updated.License, ls.Updated.Status, ls.DeviceCount, end, ls.LicenseRef, ls.CurrentEndLicense, policy, ls.RenewCount)
 	}
 
 	return err
@@ -143,13 +174,18 @@ func (i dbLicenseStatuses) GetByLicenseID(licenseID string) (*LicenseStatus, err
 	var potentialRightsEnd *time.Time
 	var licenseUpdate *time.Time
 	var statusUpdate *time.Time
+	var policy sql.NullString
 
 	row := i.dbGetByLicenseID.QueryRow(licenseID)
-	err := row.Scan(&ls.ID, &statusDB, &licenseUpdate, &statusUpdate, &ls.DeviceCount, &potentialRightsEnd, &ls.LicenseRef, &ls.CurrentEndLicense)
+	err := row.Scan(&ls.ID, &statusDB, &licenseUpdate, &statusUpdate, &ls.DeviceCount, &potentialRightsEnd, &ls.LicenseRef, &ls.CurrentEndLicense, &ls.Version, &policy, &ls.RenewCount)
 
 	if err == nil {
 		status.GetStatus(statusDB, &ls.Status)
 
+		if err = decodePolicy(policy, &ls); err != nil {
+			return nil, err
+		}
+
 		ls.Updated = new(Updated)
 
 		if (potentialRightsEnd != nil) && (!(*potentialRightsEnd).IsZero()) {
@@ -179,8 +215,56 @@ func (i dbLicenseStatuses) GetByLicenseID(licenseID string) (*LicenseStatus, err
 	return &ls, err
 }
 
-// Update updates a license status
+// decodePolicy sets the loan policy of a license status from its json representation in the db
+func decodePolicy(policy sql.NullString, ls *LicenseStatus) error {
+	if !policy.Valid || policy.String == "" {
+		return nil
+	}
+	ls.Policy = new(config.LoanPolicy)
+	return json.Unmarshal([]byte(policy.String), ls.Policy)
+}
+
+// encodePolicy returns the json representation of the loan policy of a license status
+func encodePolicy(ls LicenseStatus) (sql.NullString, error) {
+	if ls.Policy == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(ls.Policy)
+	return sql.NullString{String: string(data), Valid: true}, err
+}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Update updates a license status, if it has not been modified since it was read;
+// otherwise ErrConflict is returned and the license status must be read again.
 func (i dbLicenseStatuses) Update(ls LicenseStatus) error {
+	return i.update(i.db, ls)
+}
+
+// UpdateWith updates a license status like Update, and runs within in the same transaction,
+// e.g. to record the event which caused the update. Nothing is recorded in case of error.
+func (i dbLicenseStatuses) UpdateWith(ls LicenseStatus, within func(tx *sql.Tx) error) error {
+
+	tx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = i.update(tx, ls)
+	if err == nil {
+		err = within(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (i dbLicenseStatuses) update(ex execer, ls LicenseStatus) error {
 
 	statusInt, err := status.SetStatus(ls.Status)
 	if err != nil {
@@ -193,17 +277,31 @@ func (i dbLicenseStatuses) Update(ls LicenseStatus) error {
 		potentialRightsEnd = ls.PotentialRights.End
 	}
 
-	var result sql.Result
-	result, err = i.db.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, `UPDATE license_status SET status=?, license_updated=?, status_updated=?, 
-	device_count=?,potential_rights_end=?, rights_end=?  WHERE id=?`),
-		statusInt, ls.Updated.License, ls.Updated.Status, ls.DeviceCount, potentialRightsEnd, ls.CurrentEndLicense, ls.ID)
+	policy, err := encodePolicy(ls)
+	if err != nil {
+		return err
+	}
 
-	if err == nil {
-		if r, _ := result.RowsAffected(); r == 0 {
+	// the version is incremented by each update
+	var result sql.Result
+	result, err = ex.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, `UPDATE license_status SET status=?, license_updated=?, status_updated=?, 
+	device_count=?,potential_rights_end=?, rights_end=?, loan_policy=?, renew_count=?, version=version+1  WHERE id=? AND version=?`),
+		statusInt, ls.Updated.License, ls.Updated.Status, ls.DeviceCount, potentialRightsEnd, ls.CurrentEndLicense, policy, ls.RenewCount, ls.ID, ls.Version)
+	if err != nil {
+		return err
+	}
+	if r, _ := result.RowsAffected(); r == 0 {
+		var count int
+		row := ex.QueryRow(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT COUNT(*) FROM license_status WHERE id=?"), ls.ID)
+		if err = row.Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
 			return ErrNotFound
 		}
+		return ErrConflict
 	}
-	return err
+	return nil
 }
 
 // Count counts the number of license statuses in a time period
@@ -249,7 +347,23 @@ func Open(db *sql.DB) (l LicenseStatuses, err error) {
 		}
 	}
 
-	dbGet, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT * FROM license_status WHERE id = ?"))
+	// the version column was added to existing databases
+	err = dbutils.AddColumn(db, config.Config.LsdServer.Database, "license_status", "version", "int NOT NULL DEFAULT 0")
+	if err != nil {
+		log.Println("Error adding the version column to license_status")
+		return
+	}
+	// so were the loan policy columns
+	err = dbutils.AddColumn(db, config.Config.LsdServer.Database, "license_status", "loan_policy", "text DEFAULT NULL")
+	if err == nil {
+		err = dbutils.AddColumn(db, config.Config.LsdServer.Database, "license_status", "renew_count", "int NOT NULL DEFAULT 0")
+	}
+	if err != nil {
+		log.Println("Error adding the loan policy columns to license_status")
+		return
+	}
+
+	dbGet, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT "+columns+" FROM license_status WHERE id = ?"))
 	if err != nil {
 		return
 	}
@@ -267,7 +381,7 @@ func Open(db *sql.DB) (l LicenseStatuses, err error) {
 		return
 	}
 
-	dbGetByLicenseID, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT * FROM license_status where license_ref = ?"))
+	dbGetByLicenseID, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT "+columns+" FROM license_status where license_ref = ?"))
 	if err != nil {
 		return
 	}
@@ -276,6 +390,9 @@ func Open(db *sql.DB) (l LicenseStatuses, err error) {
 	return
 }
 
+// columns are the columns of a license status, in their scan order
+const columns = "id, status, license_updated, status_updated, device_count, potential_rights_end, license_ref, rights_end, version, loan_policy, renew_count"
+
 const tableDef = "CREATE TABLE IF NOT EXISTS license_status (" +
 	"id INTEGER PRIMARY KEY," +
 	"status int(11) NOT NULL," +
@@ -284,6 +401,9 @@ const tableDef = "CREATE TABLE IF NOT EXISTS license_status (" +
 	"device_count int(11) DEFAULT NULL," +
 	"potential_rights_end datetime DEFAULT NULL," +
 	"license_ref varchar(255) NOT NULL," +
-	"rights_end datetime DEFAULT NULL  " +
+	"rights_end datetime DEFAULT NULL," +
+	"version int NOT NULL DEFAULT 0," +
+	"loan_policy text DEFAULT NULL," +
+	"renew_count int NOT NULL DEFAULT 0" +
 	");" +
 	"CREATE INDEX IF NOT EXISTS license_ref_index on license_status (license_ref);"
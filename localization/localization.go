@@ -0,0 +1,130 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package localization translates the messages sent to the users of the servers.
+// A message catalog is a JSON object mapping message ids to translated messages;
+// there is one catalog per configured language, named <language>.json in the localization folder.
+package localization
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/text/language"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// DefaultLanguage is used when no default language is configured
+const DefaultLanguage = "en"
+
+var (
+	// catalogs of messages, by configured language
+	catalogs = map[string]map[string]string{}
+	// supported languages, the default language first
+	languages = []string{DefaultLanguage}
+	matcher   = language.NewMatcher([]language.Tag{language.Make(DefaultLanguage)})
+)
+
+// Init loads the message catalogs of the configured languages
+func Init(localization config.Localization) error {
+
+	def := localization.DefaultLanguage
+	if def == "" {
+		def = DefaultLanguage
+	}
+	langs := []string{def}
+	for _, lang := range localization.Languages {
+		if lang != def {
+			langs = append(langs, lang)
+		}
+	}
+
+	cats := make(map[string]map[string]string)
+	tags := make([]language.Tag, 0, len(langs))
+	for _, lang := range langs {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return fmt.Errorf("invalid language %s: %w", lang, err)
+		}
+		tags = append(tags, tag)
+		if localization.Folder == "" {
+			continue
+		}
+		catalog, err := loadCatalog(filepath.Join(localization.Folder, lang+".json"))
+		if os.IsNotExist(err) {
+			// the built-in english messages are used
+			log.Println("No message catalog for language " + lang)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		cats[lang] = catalog
+	}
+
+	catalogs = cats
+	languages = langs
+	matcher = language.NewMatcher(tags)
+	return nil
+}
+
+func loadCatalog(path string) (map[string]string, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var catalog map[string]string
+	if err = json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid message catalog %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// Negotiate returns the configured language which best matches an Accept-Language header,
+// or the default language
+func Negotiate(acceptLanguage string) string {
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return languages[0]
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return languages[0]
+	}
+	return languages[index]
+}
+
+// Lookup returns the message of a given id in a language; the default language
+// and then the built-in english messages are used if the message is not translated
+func Lookup(lang, id string) (string, bool) {
+
+	if msg, ok := catalogs[lang][id]; ok {
+		return msg, true
+	}
+	if msg, ok := catalogs[languages[0]][id]; ok {
+		return msg, true
+	}
+	msg, ok := messages[id]
+	return msg, ok
+}
+
+// Message returns the message of a given id in a language, formatted with its arguments;
+// the id is returned if the message is unknown
+func Message(lang, id string, args ...interface{}) string {
+
+	msg, ok := Lookup(lang, id)
+	if !ok {
+		return id
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
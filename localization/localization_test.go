@@ -0,0 +1,102 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package localization
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func TestNegotiate(t *testing.T) {
+	err := Init(config.Localization{Languages: []string{"en-US", "fr-FR", "de"}, DefaultLanguage: "en-US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Init(config.Localization{})
+
+	cases := map[string]string{
+		"":                        "en-US",
+		"fr":                      "fr-FR",
+		"fr-CA,fr;q=0.9,en;q=0.8": "fr-FR",
+		"de-AT":                   "de",
+		"it, en;q=0.5":            "en-US",
+		"ja":                      "en-US",
+		"invalid;;q=x":            "en-US",
+	}
+	for header, expected := range cases {
+		if lang := Negotiate(header); lang != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, header, lang)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"status.ready": "prête", "renew.max_renewals": "%d fois"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"status.active": "in use"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// there is no catalog for german
+	err := Init(config.Localization{Languages: []string{"fr", "de"}, Folder: dir, DefaultLanguage: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Init(config.Localization{})
+
+	if msg := Message("fr", "status.ready"); msg != "prête" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+	if msg := Message("fr", "renew.max_renewals", 2); msg != "2 fois" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+	// fallback to the catalog of the default language, then to the built-in messages
+	if msg := Message("de", "status.active"); msg != "in use" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+	if msg := Message("fr", "status.expired"); msg != messages["status.expired"] {
+		t.Errorf("Unexpected message %s", msg)
+	}
+	if msg := Message("fr", "unknown.id"); msg != "unknown.id" {
+		t.Errorf("Unexpected message %s", msg)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"status.ready": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(config.Localization{Languages: []string{"de"}, Folder: dir}); err == nil {
+		t.Error("Expected an error for an invalid catalog")
+	}
+}
+
+// the catalogs provided with the server translate every built-in message with the same arguments
+func TestCatalogs(t *testing.T) {
+	files, err := filepath.Glob("catalogs/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatal("No catalog found")
+	}
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for _, file := range files {
+		catalog, err := loadCatalog(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, msg := range messages {
+			translated, ok := catalog[id]
+			if !ok {
+				t.Errorf("%s: missing message %s", file, id)
+				continue
+			}
+			if expected, got := verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1); len(expected) != len(got) {
+				t.Errorf("%s: the arguments of message %s do not match", file, id)
+			}
+		}
+	}
+}
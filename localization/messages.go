@@ -0,0 +1,35 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package localization
+
+// messages are the built-in english messages, by id.
+// The titles of problems are identified by http.<status code>; their default is the standard http status text.
+var messages = map[string]string{
+	// messages of the status documents
+	"status.ready":     "The license is in ready state",
+	"status.active":    "The license is in active state",
+	"status.revoked":   "The license is in revoked state",
+	"status.returned":  "The license is in returned state",
+	"status.cancelled": "The license is in cancelled state",
+	"status.expired":   "The license is in expired state",
+
+	// details of the problems returned by the status server
+	"license.not_found":       "The license %s was not found",
+	"license.conflict":        "The license %s was modified concurrently; please retry",
+	"device.invalid":          "device id and device name are mandatory and their maximum length is 255 bytes",
+	"register.not_usable":     "License is neither ready or active",
+	"return.not_allowed":      "The loan policy does not allow returns",
+	"return.already":          "The license has already been returned before",
+	"return.forbidden":        "The current license status is %s; return forbidden",
+	"renew.expired":           "The license has expired; it cannot be renewed",
+	"renew.forbidden":         "The license status is %s; it cannot be renewed",
+	"renew.not_allowed":       "The loan policy does not allow renewals",
+	"renew.max_renewals":      "The license has already been renewed %d times; it cannot be renewed",
+	"renew.no_end":            "This license has no end date; it cannot be renewed",
+	"renew.no_max_end":        "This license has no maximum end date; it cannot be renewed",
+	"renew.no_configured_end": "No explicit end value in the request and no configured value",
+	"renew.invalid_end":       "The end date must be formatted as RFC 3339",
+	"rate.exceeded":           "Too many requests; please retry in %d seconds",
+}
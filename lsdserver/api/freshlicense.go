@@ -18,6 +18,7 @@ import (
 	"github.com/readium/readium-lcp-server/api"
 	"github.com/readium/readium-lcp-server/config"
 	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/mtls"
 	"github.com/readium/readium-lcp-server/problem"
 )
 
@@ -71,6 +72,13 @@ func GetFreshLicense(w http.ResponseWriter, r *http.Request, s Server) {
 // GetLicense gets a fresh license from the License Server
 func getLicense(licenseID string) (lic []byte, err error) {
 
+	// without a CMS, the License Server reissues the license with the user key it has stored
+	var plic license.License
+	if config.Config.LsdServer.UserDataUrl == "" {
+		plic.ID = licenseID
+		return fetchLicense(plic)
+	}
+
 	// get user data from the CMS
 	var userData UserData
 	userData, err = getUserData(licenseID)
@@ -79,7 +87,6 @@ func getLicense(licenseID string) (lic []byte, err error) {
 	}
 
 	// init the partial license to be sent to the License Server
-	var plic license.License
 	plic, err = initPartialLicense(licenseID, userData)
 	if err != nil {
 		return
@@ -165,7 +172,7 @@ func fetchLicense(plic license.License) (lic []byte, err error) {
 
 	// send the partial license to the License Server and get back a fresh license
 	licenseUrl := config.Config.LcpServer.PublicBaseUrl + "/licenses/" + plic.ID
-	client := &http.Client{}
+	client := mtls.Client(0)
 	req, err := http.NewRequest("POST", licenseUrl, bytes.NewReader(jplic))
 	if err != nil {
 		return
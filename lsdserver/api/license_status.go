@@ -6,23 +6,28 @@ package apilsd
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jtacoma/uritemplates"
 	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
 	"github.com/readium/readium-lcp-server/config"
 	apilcp "github.com/readium/readium-lcp-server/lcpserver/api"
 	"github.com/readium/readium-lcp-server/license"
 	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/localization"
 	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/outbox"
 	"github.com/readium/readium-lcp-server/problem"
 	"github.com/readium/readium-lcp-server/status"
 	"github.com/readium/readium-lcp-server/transactions"
@@ -33,10 +38,19 @@ type Server interface {
 	Transactions() transactions.Transactions
 	LicenseStatuses() licensestatuses.LicenseStatuses
 	GoofyMode() bool
+	Outbox() *outbox.Outbox
+	ODL() odl.Store
+	Audit() audit.Store
 }
 
 // CreateLicenseStatusDocument creates a license status and adds it to database
 // It is triggered by a notification from the license server
+//
+// parameters:
+//
+//	policy: name of the loan policy attached to the license status (optional);
+//	the policy may also be set in the license, the global settings apply by default
+//	sync_end: if true, the end date of an existing license status is set from the rights of an updated license
 func CreateLicenseStatusDocument(w http.ResponseWriter, r *http.Request, s Server) {
 	var lic license.License
 	err := apilcp.DecodeJSONLicense(r, &lic)
@@ -49,18 +63,100 @@ func CreateLicenseStatusDocument(w http.ResponseWriter, r *http.Request, s Serve
 	logging.Print("Create a Status Doc for License " + lic.ID)
 
 	var ls licensestatuses.LicenseStatus
+	// attach the loan policy to the license status
+	policyName := r.FormValue("policy")
+	if policyName == "" {
+		policyName = lic.Policy
+	}
+	if policyName != "" {
+		if policy, ok := config.Config.LicenseStatus.GetLoanPolicy(policyName); ok {
+			logging.Print("Apply the loan policy " + policyName + " to the License " + lic.ID)
+			ls.Policy = &policy
+		} else {
+			// the policy name may be the one of a rights policy of the license server
+			log.Println("No loan policy " + policyName + ", the default settings apply to the License " + lic.ID)
+		}
+	}
 	makeLicenseStatus(lic, &ls)
 
-	err = s.LicenseStatuses().Add(ls)
+	existing, err := addLicenseStatus(ls, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
+	// the notification of an updated license (e.g. reissued after a passphrase change)
+	// sets the license update date of its status, so that reading apps fetch the new license;
+	// the end date of a license in use follows its rights if requested, e.g. after a bulk update
+	if existing != nil && lic.Updated != nil {
+		sync := r.FormValue("sync_end") == "true"
+		updated := lic.Updated.UTC().Truncate(time.Second)
+		var before auditedStatus
+		licenseStatus, serr := changeStatus(lic.ID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+			before = auditState(licenseStatus)
+			if licenseStatus.Updated.License != nil && !updated.After(*licenseStatus.Updated.License) {
+				return nil, nil
+			}
+			logging.Print("The License " + lic.ID + " was updated on " + updated.Format(time.RFC3339))
+			licenseStatus.Updated.License = &updated
+			if sync && lic.Rights != nil && (licenseStatus.Status == status.STATUS_READY || licenseStatus.Status == status.STATUS_ACTIVE) {
+				syncEnd(licenseStatus, lic.Rights.End)
+			}
+			return &statusChange{}, nil
+		})
+		if serr != nil {
+			problem.Error(w, r, serr.Problem, serr.code)
+			return
+		}
+		audit.Describe(r, lic.ID, before, auditState(licenseStatus))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if existing == nil {
+		audit.Describe(r, lic.ID, nil, auditState(&ls))
+	}
 
 	// must come *after* w.Header().Add()/Set(), but before w.Write()
 	w.WriteHeader(http.StatusCreated)
 }
 
+// syncEnd sets the end date of a license status from the rights of its license.
+// The potential end is pushed back if the new end is later, so that renewals remain possible.
+func syncEnd(ls *licensestatuses.LicenseStatus, end *time.Time) {
+	if end == nil {
+		ls.CurrentEndLicense = nil
+		return
+	}
+	if ls.CurrentEndLicense != nil && ls.CurrentEndLicense.Equal(*end) {
+		return
+	}
+	e := end.UTC()
+	ls.CurrentEndLicense = &e
+	if ls.PotentialRights != nil && ls.PotentialRights.End != nil && e.After(*ls.PotentialRights.End) {
+		ls.PotentialRights.End = &e
+	}
+}
+
+// createMutex serializes the creation of license statuses, which are created by the notifications
+// of the License Server and by ODL checkouts
+var createMutex sync.Mutex
+
+// addLicenseStatus adds a license status unless its license already has one, e.g. because a notification
+// of the License Server has been sent twice. It returns the license status found in the db, if any.
+func addLicenseStatus(ls licensestatuses.LicenseStatus, s Server) (*licensestatuses.LicenseStatus, error) {
+	createMutex.Lock()
+	defer createMutex.Unlock()
+
+	existing, err := s.LicenseStatuses().GetByLicenseID(ls.LicenseRef)
+	if err == nil {
+		logging.Print("The Status Doc of License " + ls.LicenseRef + " already exists")
+		return existing, nil
+	}
+	if err != licensestatuses.ErrNotFound {
+		return nil, err
+	}
+	return nil, s.LicenseStatuses().Add(ls)
+}
+
 // GetLicenseStatusDocument gets a license status from the db by license id
 // checks potential_rights_end and fill it
 func GetLicenseStatusDocument(w http.ResponseWriter, r *http.Request, s Server) {
@@ -71,40 +167,31 @@ func GetLicenseStatusDocument(w http.ResponseWriter, r *http.Request, s Server)
 	// add a log
 	logging.Print("Get a Status Doc for License " + licenseID)
 
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
-			return
-		}
-
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-
-	currentDateTime := time.Now().UTC().Truncate(time.Second)
-
-	// if a rights end date is set, check if the license has expired
-	if licenseStatus.CurrentEndLicense != nil {
-		diff := currentDateTime.Sub(*(licenseStatus.CurrentEndLicense))
-
-		// if the rights end date has passed for a ready or active license
-		if (diff > 0) && ((licenseStatus.Status == status.STATUS_ACTIVE) || (licenseStatus.Status == status.STATUS_READY)) {
-			// the license has expired
-			licenseStatus.Status = status.STATUS_EXPIRED
-			// set the updated status time
-			currentTime := time.Now().UTC().Truncate(time.Second)
-			licenseStatus.Updated.Status = &currentTime
-			// update the db
-			err = s.LicenseStatuses().Update(*licenseStatus)
-			if err != nil {
-				problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-				return
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		currentDateTime := time.Now().UTC().Truncate(time.Second)
+
+		// if a rights end date is set, check if the license has expired
+		if licenseStatus.CurrentEndLicense != nil {
+			diff := currentDateTime.Sub(*(licenseStatus.CurrentEndLicense))
+
+			// if the rights end date has passed for a ready or active license
+			if (diff > 0) && ((licenseStatus.Status == status.STATUS_ACTIVE) || (licenseStatus.Status == status.STATUS_READY)) {
+				// the license has expired
+				licenseStatus.Status = status.STATUS_EXPIRED
+				// set the updated status time
+				licenseStatus.Updated.Status = &currentDateTime
+				// update the db
+				return &statusChange{}, nil
 			}
 		}
+		return nil, nil
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
 	}
 
-	err = fillLicenseStatus(licenseStatus, s)
+	err := fillLicenseStatus(licenseStatus, r, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
@@ -131,8 +218,6 @@ func RegisterDevice(w http.ResponseWriter, r *http.Request, s Server) {
 	w.Header().Set("Content-Type", api.ContentType_LSD_JSON)
 	vars := mux.Vars(r)
 
-	var msg string
-
 	// get the license id from the url
 	licenseID := vars["key"]
 
@@ -147,57 +232,39 @@ func RegisterDevice(w http.ResponseWriter, r *http.Request, s Server) {
 
 	// check the mandatory request parameters
 	if (dILen == 0) || (dILen > 255) || (dNLen == 0) || (dNLen > 255) {
-		msg = "device id and device name are mandatory and their maximum length is 255 bytes"
-		problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
+		problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, MessageID: "device.invalid"}, http.StatusBadRequest)
 		return
 	}
 
-	// check the existence of the license in the lsd server
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
-			return
-		}
-		// unknown error
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-
-	// in case we want to test the resilience of an app to registering failures
-	if s.GoofyMode() {
-		msg = "**goofy mode** registering error"
-		problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
+	// check the existence of the license in the lsd server,
+	// then register the device with an event and one more device in the license status
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
 
-	// check the status of the license.
-	// the device cannot be registered if the license has been revoked, returned, cancelled or expired
-	if (licenseStatus.Status != status.STATUS_ACTIVE) && (licenseStatus.Status != status.STATUS_READY) {
-		msg = "License is neither ready or active"
-		problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: msg}, http.StatusForbidden)
-		return
-	}
+		// in case we want to test the resilience of an app to registering failures
+		if s.GoofyMode() {
+			msg := "**goofy mode** registering error"
+			return nil, &statusError{problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: msg}, http.StatusBadRequest}
+		}
 
-	// check if the device has already been registered for this license
-	deviceStatus, err := s.Transactions().CheckDeviceStatus(licenseStatus.ID, deviceID)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-	if deviceStatus != "" { // this is not considered a server side error, even if the spec states that devices must not do it.
-		logging.Print("The Device has already been registered")
-		// a status document will be sent back to the caller
+		// check the status of the license.
+		// the device cannot be registered if the license has been revoked, returned, cancelled or expired
+		if (licenseStatus.Status != status.STATUS_ACTIVE) && (licenseStatus.Status != status.STATUS_READY) {
+			return nil, &statusError{problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, MessageID: "register.not_usable"}, http.StatusForbidden}
+		}
 
-	} else {
+		// check if the device has already been registered for this license
+		deviceStatus, err := s.Transactions().CheckDeviceStatus(licenseStatus.ID, deviceID)
+		if err != nil {
+			return nil, &statusError{problem.Problem{Detail: err.Error()}, http.StatusInternalServerError}
+		}
+		if deviceStatus != "" { // this is not considered a server side error, even if the spec states that devices must not do it.
+			logging.Print("The Device has already been registered")
+			// a status document will be sent back to the caller
+			return nil, nil
+		}
 
 		// create a registered event
 		event := makeEvent(status.STATUS_ACTIVE, deviceName, deviceID, licenseStatus.ID)
-		err = s.Transactions().Add(*event, status.STATUS_ACTIVE_INT)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-			return
-		}
 
 		// the license has been updated, the corresponding field is set
 		licenseStatus.Updated.Status = &event.Timestamp
@@ -209,20 +276,18 @@ func RegisterDevice(w http.ResponseWriter, r *http.Request, s Server) {
 		// one more device attached to this license
 		*licenseStatus.DeviceCount++
 
-		// update the license status in db
-		err = s.LicenseStatuses().Update(*licenseStatus)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-			return
-		}
-		// add a log
-		logging.Print("The new Device Count is " + strconv.Itoa(*licenseStatus.DeviceCount))
-
-	} // the device has just been registered for this license
+		return &statusChange{event: event, eventType: status.STATUS_ACTIVE_INT}, nil
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
+	}
+	// add a log
+	logging.Print("The Device Count is " + strconv.Itoa(*licenseStatus.DeviceCount))
 
 	// the device has been registered for the license (now *or before*)
 	// fill the updated license status
-	err = fillLicenseStatus(licenseStatus, s)
+	err := fillLicenseStatus(licenseStatus, r, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
@@ -245,31 +310,52 @@ func LendingReturn(w http.ResponseWriter, r *http.Request, s Server) {
 	vars := mux.Vars(r)
 	licenseID := vars["key"]
 
-	var msg string
+	deviceID := r.FormValue("id")
+	deviceName := r.FormValue("name")
 
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
-			return
+	// check request parameters
+	if (len(deviceName) > 255) || (len(deviceID) > 255) {
+		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, MessageID: "device.invalid"}, http.StatusBadRequest)
+		return
+	}
+
+	// add a log
+	logging.Print("Return the Publication from Device " + deviceName + " with id " + deviceID + " for License " + licenseID)
+
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		// check that the loan policy allows returns; the global return setting only controls
+		// the return link of the license statuses without a loan policy, as before loan policies
+		if licenseStatus.Policy != nil && !licenseStatus.Policy.Return {
+			return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, MessageID: "return.not_allowed"}, http.StatusForbidden}
 		}
+		return returnLicense(licenseStatus, deviceName, deviceID)
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
+	}
 
+	// fill the license status
+	err := fillLicenseStatus(licenseStatus, r, s)
+	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
 
-	deviceID := r.FormValue("id")
-	deviceName := r.FormValue("name")
+	// the device count must not be sent in json to the caller
+	licenseStatus.DeviceCount = nil
+	enc := json.NewEncoder(w)
+	err = enc.Encode(licenseStatus)
 
-	// check request parameters
-	if (len(deviceName) > 255) || (len(deviceID) > 255) {
-		msg = "device id and device name are mandatory and their maximum length is 255 bytes"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
+}
 
-	// add a log
-	logging.Print("Return the Publication from Device " + deviceName + " with id " + deviceID + " for License " + licenseID)
+// returnLicense sets the status of a returned license, depending on its current status.
+// called from the return of a loan by a device and the return of an ODL checkout
+func returnLicense(licenseStatus *licensestatuses.LicenseStatus, deviceName, deviceID string) (*statusChange, *statusError) {
 
 	// check & set the status of the license status according to its current value
 	switch licenseStatus.Status {
@@ -281,36 +367,17 @@ func LendingReturn(w http.ResponseWriter, r *http.Request, s Server) {
 	case status.STATUS_EXPIRED:
 		licenseStatus.Status = status.STATUS_RETURNED
 	case status.STATUS_RETURNED:
-		msg = "The license has already been returned before"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_ALREADY, Detail: msg}, http.StatusForbidden)
-		return
+		return nil, &statusError{problem.Problem{Type: problem.RETURN_ALREADY, MessageID: "return.already"}, http.StatusForbidden}
 	default:
-		msg = "The current license status is " + licenseStatus.Status + "; return forbidden"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusForbidden)
-		return
+		return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, MessageID: "return.forbidden",
+			Args: []interface{}{licenseStatus.Status}}, http.StatusForbidden}
 	}
 
 	// create a return event
 	event := makeEvent(status.STATUS_RETURNED, deviceName, deviceID, licenseStatus.ID)
-	err = s.Transactions().Add(*event, status.STATUS_RETURNED_INT)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
 
-	// update a license via a call to the lcp Server
-	// the event date is sent to the lcp server, covers the case where the lsd server clock is badly sync'd with the lcp server clock
-	httpStatusCode, errorr := updateLicense(event.Timestamp, licenseID)
-	if errorr != nil {
-		problem.Error(w, r, problem.Problem{Detail: errorr.Error()}, http.StatusInternalServerError)
-		return
-	}
-	if httpStatusCode != http.StatusOK && httpStatusCode != http.StatusPartialContent { // 200, 206
-		errorr = errors.New("LCP license PATCH returned HTTP error code " + strconv.Itoa(httpStatusCode))
-
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: errorr.Error()}, httpStatusCode)
-		return
-	}
+	// the license is updated on the lcp Server with the event date,
+	// covers the case where the lsd server clock is badly sync'd with the lcp server clock
 	licenseStatus.CurrentEndLicense = &event.Timestamp
 
 	// update the license status
@@ -320,28 +387,7 @@ func LendingReturn(w http.ResponseWriter, r *http.Request, s Server) {
 	// remove the potential end timestamp
 	licenseStatus.PotentialRights = nil
 
-	err = s.LicenseStatuses().Update(*licenseStatus)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-
-	// fill the license status
-	err = fillLicenseStatus(licenseStatus, s)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-
-	// the device count must not be sent in json to the caller
-	licenseStatus.DeviceCount = nil
-	enc := json.NewEncoder(w)
-	err = enc.Encode(licenseStatus)
-
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
+	return &statusChange{event: event, eventType: status.STATUS_RETURNED_INT, end: &event.Timestamp}, nil
 }
 
 // LendingRenewal checks that the calling device is registered with the license,
@@ -375,135 +421,115 @@ func LendingRenewal(w http.ResponseWriter, r *http.Request, s Server) {
 		return
 	}
 
-	// get the license status
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+	// check if the 'end' request parameter is set
+	var explicitEnd time.Time
+	timeEndString := r.FormValue("end")
+	if timeEndString != "" {
+		var err error
+		explicitEnd, err = time.Parse(time.RFC3339, timeEndString)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, MessageID: "renew.invalid_end"}, http.StatusBadRequest)
 			return
 		}
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
 	}
 
-	// check the status of the license.
-	// note: renewing an unactive (ready) license is forbidden
-	if licenseStatus.Status == status.STATUS_EXPIRED {
-		if !config.Config.LicenseStatus.RenewExpired {
-			msg = "The license has expired; it cannot be renewed"
-			problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-			return
+	// get the license status and renew the loan
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+
+		policy := licenseStatus.LoanPolicy()
+
+		// check the status of the license.
+		// note: renewing an unactive (ready) license is forbidden
+		if licenseStatus.Status == status.STATUS_EXPIRED {
+			if !policy.RenewExpired {
+				return nil, &statusError{problem.Problem{Type: problem.RENEW_BAD_REQUEST, MessageID: "renew.expired"}, http.StatusBadRequest}
+			}
+		} else if licenseStatus.Status != status.STATUS_ACTIVE {
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_BAD_REQUEST, MessageID: "renew.forbidden",
+				Args: []interface{}{licenseStatus.Status}}, http.StatusBadRequest}
 		}
-	} else if licenseStatus.Status != status.STATUS_ACTIVE {
-		msg = "The license status is " + licenseStatus.Status + "; it cannot be renewed"
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
 
-	// check if the license contains a date end property
-	if licenseStatus.CurrentEndLicense == nil || (*licenseStatus.CurrentEndLicense).IsZero() {
-		msg = "This license has no end date; it cannot be renewed"
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
-	currentEnd := *licenseStatus.CurrentEndLicense
+		// check the renewals allowed by the loan policy; the global renew setting only controls
+		// the renew link of the license statuses without a loan policy, as before loan policies
+		if licenseStatus.Policy != nil && !policy.Renew {
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_REJECT, MessageID: "renew.not_allowed"}, http.StatusForbidden}
+		}
+		if policy.MaxRenewals > 0 && licenseStatus.RenewCount >= policy.MaxRenewals {
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_REJECT, MessageID: "renew.max_renewals",
+				Args: []interface{}{licenseStatus.RenewCount}}, http.StatusForbidden}
+		}
 
-	// check if the license has a maximum end date
-	if licenseStatus.PotentialRights == nil || licenseStatus.PotentialRights.End == nil || (*licenseStatus.PotentialRights.End).IsZero() {
-		msg = "This license has no maximum end date; it cannot be renewed"
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
+		// check if the license contains a date end property
+		if licenseStatus.CurrentEndLicense == nil || (*licenseStatus.CurrentEndLicense).IsZero() {
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_BAD_REQUEST, MessageID: "renew.no_end"}, http.StatusBadRequest}
+		}
+		currentEnd := *licenseStatus.CurrentEndLicense
 
-	var suggestedEnd time.Time
-	// check if the 'end' request parameter is empty
-	timeEndString := r.FormValue("end")
-	if timeEndString == "" {
-		// get the config  parameter renew_days
-		renewDays := config.Config.LicenseStatus.RenewDays
-		if renewDays == 0 {
-			msg = "No explicit end value in the request and no configured value"
-			problem.Error(w, r, problem.Problem{Detail: msg}, http.StatusBadRequest)
-			return
+		// check if the license has a maximum end date
+		if licenseStatus.PotentialRights == nil || licenseStatus.PotentialRights.End == nil || (*licenseStatus.PotentialRights.End).IsZero() {
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_BAD_REQUEST, MessageID: "renew.no_max_end"}, http.StatusBadRequest}
 		}
-		// compute a suggested duration from the config value
-		suggestedDuration := 24 * time.Hour * time.Duration(renewDays) // nanoseconds
 
-		// compute the suggested end date from now
-		if config.Config.LicenseStatus.RenewFromNow {
-			suggestedEnd = time.Now().Add(time.Duration(suggestedDuration))
-			// compute the suggested end date from the current end date
+		suggestedEnd := explicitEnd
+		// check if the 'end' request parameter is empty
+		if timeEndString == "" {
+			// get the renew_days parameter of the loan policy
+			renewDays := policy.RenewDays
+			if renewDays == 0 {
+				return nil, &statusError{problem.Problem{MessageID: "renew.no_configured_end"}, http.StatusBadRequest}
+			}
+			// compute a suggested duration from the config value
+			suggestedDuration := 24 * time.Hour * time.Duration(renewDays) // nanoseconds
+
+			// compute the suggested end date from now
+			if policy.RenewFromNow {
+				suggestedEnd = time.Now().Add(time.Duration(suggestedDuration))
+				// compute the suggested end date from the current end date
+			} else {
+				suggestedEnd = currentEnd.Add(time.Duration(suggestedDuration))
+			}
+			log.Print("Default extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
+
+			// if the 'end' request parameter is set
 		} else {
-			suggestedEnd = currentEnd.Add(time.Duration(suggestedDuration))
+			log.Print("Explicit extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
 		}
-		log.Print("Default extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
 
-		// if the 'end' request parameter is set
-	} else {
-		var err error
-		suggestedEnd, err = time.Parse(time.RFC3339, timeEndString)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: err.Error()}, http.StatusBadRequest)
-			return
+		// check the suggested end date vs the upper end date (which is already set in our implementation)
+		// the two issues below are not treated as errors
+		if suggestedEnd.After(*licenseStatus.PotentialRights.End) {
+			log.Print("Attempt to renew with a date greater than the upper limit = " + licenseStatus.PotentialRights.End.UTC().Format(time.RFC3339))
+			return nil, nil
+		}
+		// check the suggested end date vs the current end date
+		if suggestedEnd.Before(currentEnd) {
+			log.Print("Attempt to renew with a date before the current end date: " + currentEnd.UTC().Format(time.RFC3339) + " vs " + suggestedEnd.UTC().Format(time.RFC3339))
+			return nil, nil
 		}
-		log.Print("Explicit extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
-	}
-
-	// check the suggested end date vs the upper end date (which is already set in our implementation)
-	// the two issues below are not treated as errors
-	norenew := false
-	if suggestedEnd.After(*licenseStatus.PotentialRights.End) {
-		norenew = true
-		log.Print("Attempt to renew with a date greater than the upper limit = " + licenseStatus.PotentialRights.End.UTC().Format(time.RFC3339))
-	}
-	// check the suggested end date vs the current end date
-	if suggestedEnd.Before(currentEnd) {
-		norenew = true
-		log.Print("Attempt to renew with a date before the current end date: " + currentEnd.UTC().Format(time.RFC3339) + " vs " + suggestedEnd.UTC().Format(time.RFC3339))
-	}
 
-	if !norenew {
 		// add a log
 		logging.Print("Loan renewed until " + suggestedEnd.UTC().Format(time.RFC3339))
 
 		// create a renew event
 		event := makeEvent(status.EVENT_RENEWED, deviceName, deviceID, licenseStatus.ID)
-		err = s.Transactions().Add(*event, status.EVENT_RENEWED_INT)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-			return
-		}
-
-		// update a license via a call to the lcp Server
-		var httpStatusCode int
-		httpStatusCode, err = updateLicense(suggestedEnd, licenseID)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-			return
-		}
-		if httpStatusCode != http.StatusOK && httpStatusCode != http.StatusPartialContent { // 200, 206
-			err = errors.New("LCP license PATCH returned HTTP error code " + strconv.Itoa(httpStatusCode))
 
-			problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: err.Error()}, httpStatusCode)
-			return
-		}
 		// update the license status fields
 		licenseStatus.Status = status.STATUS_ACTIVE
 		licenseStatus.CurrentEndLicense = &suggestedEnd
 		licenseStatus.Updated.Status = &event.Timestamp
 		licenseStatus.Updated.License = &event.Timestamp
-		//log.Print("Update timestamp ", event.Timestamp.UTC().Format(time.RFC3339))
+		licenseStatus.RenewCount++
 
-		// update the license status in db
-		err = s.LicenseStatuses().Update(*licenseStatus)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-			return
-		}
+		// the license is updated on the lcp Server
+		return &statusChange{event: event, eventType: status.EVENT_RENEWED_INT, end: &suggestedEnd}, nil
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
 	}
 
 	// fill the localized 'message', the 'links' and 'event' objects in the license status
-	err = fillLicenseStatus(licenseStatus, s)
+	err := fillLicenseStatus(licenseStatus, r, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
@@ -532,135 +558,108 @@ func ExtendSubscription(w http.ResponseWriter, r *http.Request, s Server) {
 	w.Header().Set("Content-Type", api.ContentType_LSD_JSON)
 	vars := mux.Vars(r)
 
-	var msg string
-
 	// get the license status by license id
 	licenseID := vars["key"]
 
 	// add a log
 	logging.Print("Extend the Subscription for License " + licenseID)
 
-	// get the license status
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+	// check if the 'end' request parameter is set
+	var explicitEnd time.Time
+	timeEndString := r.FormValue("end")
+	if timeEndString != "" {
+		var err error
+		explicitEnd, err = time.Parse(time.RFC3339, timeEndString)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: err.Error()}, http.StatusBadRequest)
 			return
 		}
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
 	}
 
-	// the max end date must be set
-	if licenseStatus.PotentialRights == nil || licenseStatus.PotentialRights.End == nil {
-		msg := "The maximum end date must be set"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
+	// get the license status and extend the subscription
+	var before auditedStatus
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		before = auditState(licenseStatus)
 
-	// extension is impossible if the status is revoked, cancelled or returned
-	if licenseStatus.Status == status.STATUS_REVOKED || licenseStatus.Status == status.STATUS_CANCELLED || licenseStatus.Status == status.STATUS_RETURNED {
-		msg := "The license cannot be extended as it is " + licenseStatus.Status
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
-	}
+		// the max end date must be set
+		if licenseStatus.PotentialRights == nil || licenseStatus.PotentialRights.End == nil {
+			msg := "The maximum end date must be set"
+			return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest}
+		}
 
-	// check if the license contains a date end property
-	var currentEnd time.Time
-	if licenseStatus.CurrentEndLicense == nil || (*licenseStatus.CurrentEndLicense).IsZero() {
-		msg = "This license has no current end date; it cannot be extended"
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusForbidden)
-		return
-	}
-	currentEnd = *licenseStatus.CurrentEndLicense
-	log.Print("Current end date " + currentEnd.UTC().Format(time.RFC3339))
-	if licenseStatus.Status == status.STATUS_EXPIRED {
-		log.Println("This license had expired and will be re-activated")
-	}
+		// extension is impossible if the status is revoked, cancelled or returned
+		if licenseStatus.Status == status.STATUS_REVOKED || licenseStatus.Status == status.STATUS_CANCELLED || licenseStatus.Status == status.STATUS_RETURNED {
+			msg := "The license cannot be extended as it is " + licenseStatus.Status
+			return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest}
+		}
 
-	var suggestedEnd time.Time
-	// check if the 'end' request parameter is empty
-	timeEndString := r.FormValue("end")
-	if timeEndString == "" {
-		// get the config parameter renew_days
-		renewDays := config.Config.LicenseStatus.RenewDays
-		if renewDays == 0 {
-			msg = "No explicit end value and no configured value"
-			problem.Error(w, r, problem.Problem{Detail: msg}, http.StatusInternalServerError)
-			return
+		// check if the license contains a date end property
+		if licenseStatus.CurrentEndLicense == nil || (*licenseStatus.CurrentEndLicense).IsZero() {
+			msg := "This license has no current end date; it cannot be extended"
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: msg}, http.StatusForbidden}
+		}
+		currentEnd := *licenseStatus.CurrentEndLicense
+		log.Print("Current end date " + currentEnd.UTC().Format(time.RFC3339))
+		if licenseStatus.Status == status.STATUS_EXPIRED {
+			log.Println("This license had expired and will be re-activated")
 		}
-		// compute a suggested duration from the config value
-		suggestedDuration := 24 * time.Hour * time.Duration(renewDays) // nanoseconds
 
-		// compute the suggested end date from the current end date
-		suggestedEnd = currentEnd.Add(time.Duration(suggestedDuration))
-		log.Print("Default extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
+		suggestedEnd := explicitEnd
+		// check if the 'end' request parameter is empty
+		if timeEndString == "" {
+			// get the renew_days parameter of the loan policy
+			renewDays := licenseStatus.LoanPolicy().RenewDays
+			if renewDays == 0 {
+				msg := "No explicit end value and no configured value"
+				return nil, &statusError{problem.Problem{Detail: msg}, http.StatusInternalServerError}
+			}
+			// compute a suggested duration from the config value
+			suggestedDuration := 24 * time.Hour * time.Duration(renewDays) // nanoseconds
 
-		// if the 'end' request parameter is set
-	} else {
-		var err error
-		suggestedEnd, err = time.Parse(time.RFC3339, timeEndString)
-		if err != nil {
-			problem.Error(w, r, problem.Problem{Type: problem.RENEW_BAD_REQUEST, Detail: err.Error()}, http.StatusBadRequest)
-			return
-		}
-		log.Print("Explicit extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
-	}
+			// compute the suggested end date from the current end date
+			suggestedEnd = currentEnd.Add(time.Duration(suggestedDuration))
+			log.Print("Default extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
 
-	// check the suggested end date vs the max end date (which is already set in our implementation)
-	//log.Print("Potential rights end = ", licenseStatus.PotentialRights.End.UTC().Format(time.RFC3339))
-	if suggestedEnd.After(*licenseStatus.PotentialRights.End) {
-		msg := "Attempt to extend with a date greater than max end = " + licenseStatus.PotentialRights.End.UTC().Format(time.RFC3339)
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_REJECT, Detail: msg}, http.StatusForbidden)
-		return
-	}
-	// check the suggested end date vs the current end date
-	if suggestedEnd.Before(currentEnd) {
-		msg := "Attempt to extend with a date before the current end date"
-		problem.Error(w, r, problem.Problem{Type: problem.RENEW_REJECT, Detail: msg}, http.StatusForbidden)
-		return
-	}
+			// if the 'end' request parameter is set
+		} else {
+			log.Print("Explicit extension request until ", suggestedEnd.UTC().Format(time.RFC3339))
+		}
 
-	// add a log
-	logging.Print("License extended until " + suggestedEnd.UTC().Format(time.RFC3339))
+		// check the suggested end date vs the max end date (which is already set in our implementation)
+		if suggestedEnd.After(*licenseStatus.PotentialRights.End) {
+			msg := "Attempt to extend with a date greater than max end = " + licenseStatus.PotentialRights.End.UTC().Format(time.RFC3339)
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_REJECT, Detail: msg}, http.StatusForbidden}
+		}
+		// check the suggested end date vs the current end date
+		if suggestedEnd.Before(currentEnd) {
+			msg := "Attempt to extend with a date before the current end date"
+			return nil, &statusError{problem.Problem{Type: problem.RENEW_REJECT, Detail: msg}, http.StatusForbidden}
+		}
 
-	// create a renew event with a static device name
-	event := makeEvent(status.EVENT_RENEWED, "subscription", "suscription", licenseStatus.ID)
-	err = s.Transactions().Add(*event, status.EVENT_RENEWED_INT)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
+		// add a log
+		logging.Print("License extended until " + suggestedEnd.UTC().Format(time.RFC3339))
 
-	// update a license via a call to the lcp Server
-	var httpStatusCode int
-	httpStatusCode, err = updateLicense(suggestedEnd, licenseID)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
-	if httpStatusCode != http.StatusOK && httpStatusCode != http.StatusPartialContent { // 200, 206
-		err = errors.New("LCP license PATCH returned HTTP error code " + strconv.Itoa(httpStatusCode))
+		// create a renew event with a static device name
+		event := makeEvent(status.EVENT_RENEWED, "subscription", "suscription", licenseStatus.ID)
 
-		problem.Error(w, r, problem.Problem{Type: problem.REGISTRATION_BAD_REQUEST, Detail: err.Error()}, httpStatusCode)
-		return
-	}
-	// update the license status fields; the status is active
-	licenseStatus.Status = status.STATUS_ACTIVE
-	licenseStatus.CurrentEndLicense = &suggestedEnd
-	licenseStatus.Updated.Status = &event.Timestamp
-	licenseStatus.Updated.License = &event.Timestamp
-	log.Print("Update timestamp ", event.Timestamp.UTC().Format(time.RFC3339))
+		// update the license status fields; the status is active
+		licenseStatus.Status = status.STATUS_ACTIVE
+		licenseStatus.CurrentEndLicense = &suggestedEnd
+		licenseStatus.Updated.Status = &event.Timestamp
+		licenseStatus.Updated.License = &event.Timestamp
+		log.Print("Update timestamp ", event.Timestamp.UTC().Format(time.RFC3339))
 
-	// update the license status in db
-	err = s.LicenseStatuses().Update(*licenseStatus)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		// the license is updated on the lcp Server
+		return &statusChange{event: event, eventType: status.EVENT_RENEWED_INT, end: &suggestedEnd}, nil
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
 		return
 	}
+	audit.Describe(r, "", before, auditState(licenseStatus))
 
 	// fill the localized 'message', the 'links' and 'event' objects in the license status
-	err = fillLicenseStatus(licenseStatus, s)
+	err := fillLicenseStatus(licenseStatus, r, s)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
@@ -804,21 +803,9 @@ func LendingCancellation(w http.ResponseWriter, r *http.Request, s Server) {
 
 	logging.Print("Revoke or Cancel the License " + licenseID)
 
-	// get the current license status
-	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
-	if err != nil {
-		// erroneous license id
-		if licenseStatus == nil {
-			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
-			return
-		}
-		// other error
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
 	// get the partial license status document
 	var newStatus licensestatuses.LicenseStatus
-	err = decodeJsonLicenseStatus(r, &newStatus)
+	err := decodeJsonLicenseStatus(r, &newStatus)
 	if err != nil {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
@@ -830,71 +817,189 @@ func LendingCancellation(w http.ResponseWriter, r *http.Request, s Server) {
 		return
 	}
 
+	// get the current license status and cancel or revoke the license
+	var before auditedStatus
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		before = auditState(licenseStatus)
+		return cancelOrRevoke(licenseStatus, newStatus.Status, "", "")
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
+	}
+	audit.Describe(r, "", before, auditState(licenseStatus))
+}
+
+// auditedStatus is the state of a license status recorded in the audit log
+type auditedStatus struct {
+	Status       string     `json:"status"`
+	End          *time.Time `json:"end,omitempty"`
+	PotentialEnd *time.Time `json:"potential_end,omitempty"`
+}
+
+// auditState copies the state of a license status, which is then changed in place
+func auditState(ls *licensestatuses.LicenseStatus) auditedStatus {
+	a := auditedStatus{Status: ls.Status}
+	if ls.CurrentEndLicense != nil {
+		end := *ls.CurrentEndLicense
+		a.End = &end
+	}
+	if ls.PotentialRights != nil && ls.PotentialRights.End != nil {
+		end := *ls.PotentialRights.End
+		a.PotentialEnd = &end
+	}
+	return a
+}
+
+// cancelOrRevoke cancels or revokes a license, depending on its current status;
+// a reason and a related license are recorded with the event, if not empty.
+// called from the cancellation or revocation of a license and from its transfer
+func cancelOrRevoke(licenseStatus *licensestatuses.LicenseStatus, newStatus, reason, relatedLicense string) (*statusChange, *statusError) {
+
 	// cancelling is only possible when the status is ready
-	if newStatus.Status == status.STATUS_CANCELLED && licenseStatus.Status != status.STATUS_READY {
+	if newStatus == status.STATUS_CANCELLED && licenseStatus.Status != status.STATUS_READY {
 		msg := "The license is not on ready state, it can't be cancelled"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
+		return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest}
 	}
 	// revocation is only possible when the status is ready or active
-	if newStatus.Status == status.STATUS_REVOKED && licenseStatus.Status != status.STATUS_READY && licenseStatus.Status != status.STATUS_ACTIVE {
+	if newStatus == status.STATUS_REVOKED && licenseStatus.Status != status.STATUS_READY && licenseStatus.Status != status.STATUS_ACTIVE {
 		msg := "The license is not on ready or active state, it can't be revoked"
-		problem.Error(w, r, problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest)
-		return
+		return nil, &statusError{problem.Problem{Type: problem.RETURN_BAD_REQUEST, Detail: msg}, http.StatusBadRequest}
 	}
 
 	// override the new status, revoked -> cancelled, if the current status is ready
-	if newStatus.Status == status.STATUS_REVOKED && licenseStatus.Status == status.STATUS_READY {
-		newStatus.Status = status.STATUS_CANCELLED
+	st := newStatus
+	if st == status.STATUS_REVOKED && licenseStatus.Status == status.STATUS_READY {
+		st = status.STATUS_CANCELLED
 	}
 
 	// the new expiration time is now
 	currentTime := time.Now().UTC().Truncate(time.Second)
 
-	// update the license with the new expiration time, via a call to the lcp Server
-	httpStatusCode, erru := updateLicense(currentTime, licenseID)
-	if erru != nil {
-		problem.Error(w, r, problem.Problem{Detail: erru.Error()}, http.StatusInternalServerError)
-		return
-	}
-	if httpStatusCode != http.StatusOK && httpStatusCode != http.StatusPartialContent { // 200, 206
-		err = errors.New("License update notif to lcp server failed with http code " + strconv.Itoa(httpStatusCode))
-		problem.Error(w, r, problem.Problem{Type: problem.SERVER_INTERNAL_ERROR, Detail: err.Error()}, httpStatusCode)
-		return
-	}
 	// create a cancel or revoke event
-	var st string
-	var ty int
-	if newStatus.Status == status.STATUS_CANCELLED {
-		st = status.STATUS_CANCELLED
+	ty := status.STATUS_REVOKED_INT
+	if st == status.STATUS_CANCELLED {
 		ty = status.STATUS_CANCELLED_INT
-	} else {
-		st = status.STATUS_REVOKED
-		ty = status.STATUS_REVOKED_INT
 	}
 	// the event source is not a device.
 	deviceName := "system"
 	deviceID := "system"
 	event := makeEvent(st, deviceName, deviceID, licenseStatus.ID)
-	err = s.Transactions().Add(*event, ty)
-	if err != nil {
-		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
-		return
-	}
+	event.Reason = reason
+	event.RelatedLicense = relatedLicense
+
 	// update the license status properties with the new status & expiration item (now)
 	// the potential end timestamp is also removed.
-	licenseStatus.Status = newStatus.Status
+	licenseStatus.Status = st
 	licenseStatus.CurrentEndLicense = &currentTime
 	licenseStatus.Updated.Status = &currentTime
 	licenseStatus.Updated.License = &currentTime
 	licenseStatus.PotentialRights = nil
 
-	// update the license status in db
-	err = s.LicenseStatuses().Update(*licenseStatus)
-	if err != nil {
+	// the license is updated on the lcp Server with the new expiration time
+	return &statusChange{event: event, eventType: ty, end: &currentTime}, nil
+}
+
+// TransferLicense revokes (or cancels) a license transferred to another user and creates the status
+// of the license issued to the new user, in a single db transaction. It is called by the License Server
+// after it has stored the new license. The new license status inherits the loan policy, the renew count
+// and the potential end of the transferred one. Both events record the "transferred" reason and the id of the other license.
+//
+// parameters:
+//
+//	key: id of the transferred license
+//	license: the license issued to the new user
+func TransferLicense(w http.ResponseWriter, r *http.Request, s Server) {
+	vars := mux.Vars(r)
+	licenseID := vars["key"]
+
+	var lic license.License
+	err := apilcp.DecodeJSONLicense(r, &lic)
+	if err != nil || lic.ID == "" {
+		msg := "A license with an id is expected"
+		if err != nil {
+			msg = err.Error()
+		}
+		problem.Error(w, r, problem.Problem{Detail: msg}, http.StatusBadRequest)
+		return
+	}
+
+	logging.Print("Transfer the License " + licenseID + " to the License " + lic.ID)
+
+	// the transfer may be sent again by the outbox of the License Server, e.g. after a lost response:
+	// it is already done if the new license has a status created by the transfer of this license
+	if done, err := transferred(licenseID, lic.ID, s); err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	} else if done {
+		writeStatus(w, r, lic.ID, http.StatusCreated, s)
+		return
+	}
+
+	// the status of the new license is created unless it already exists
+	createMutex.Lock()
+	defer createMutex.Unlock()
+	_, err = s.LicenseStatuses().GetByLicenseID(lic.ID)
+	if err != nil && err != licensestatuses.ErrNotFound {
 		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
 		return
 	}
+	create := err == licensestatuses.ErrNotFound
+
+	// revoke the transferred license and create the status of the new license in the same transaction,
+	// so that a failed transfer can be sent again
+	var before auditedStatus
+	licenseStatus, serr := changeStatus(licenseID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		before = auditState(licenseStatus)
+		ls := licensestatuses.LicenseStatus{Policy: licenseStatus.Policy}
+		makeLicenseStatus(lic, &ls)
+		ls.RenewCount = licenseStatus.RenewCount
+		if ls.PotentialRights != nil && licenseStatus.PotentialRights != nil && licenseStatus.PotentialRights.End != nil {
+			ls.PotentialRights.End = licenseStatus.PotentialRights.End
+		}
+		c, serr := cancelOrRevoke(licenseStatus, status.STATUS_REVOKED, status.EVENT_TRANSFERRED, lic.ID)
+		if serr != nil || !create {
+			return c, serr
+		}
+		c.within = func(tx *sql.Tx) error {
+			id, err := s.LicenseStatuses().AddTx(tx, ls)
+			if err != nil {
+				return err
+			}
+			event := makeEvent(status.EVENT_TRANSFERRED, "system", "system", id)
+			event.Reason = status.EVENT_TRANSFERRED
+			event.RelatedLicense = licenseID
+			return s.Transactions().AddTx(tx, *event, status.EVENT_TRANSFERRED_INT)
+		}
+		return c, nil
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
+	}
+	logging.Print("The License " + licenseID + " has been transferred to the License " + lic.ID)
+	audit.Describe(r, "", before, auditState(licenseStatus))
+
+	writeStatus(w, r, lic.ID, http.StatusCreated, s)
+}
+
+// transferred tells if a license has been transferred to a new license
+func transferred(licenseID, newLicenseID string, s Server) (bool, error) {
+	ls, err := s.LicenseStatuses().GetByLicenseID(newLicenseID)
+	if err == licensestatuses.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err = getEvents(ls, s); err != nil {
+		return false, err
+	}
+	for _, event := range ls.Events {
+		if event.Reason == status.EVENT_TRANSFERRED && event.RelatedLicense == licenseID {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 type licenseCount struct {
@@ -997,13 +1102,13 @@ func LicenseCount(w http.ResponseWriter, r *http.Request, s Server) {
 	}
 }
 
-// makeLicenseStatus sets fields of license status according to the config file
+// makeLicenseStatus sets fields of license status according to its loan policy and the config file
 // and creates needed inner objects of license status
 func makeLicenseStatus(license license.License, ls *licensestatuses.LicenseStatus) {
 	ls.LicenseRef = license.ID
 
 	registerAvailable := config.Config.LicenseStatus.Register
-	renewAvailable := config.Config.LicenseStatus.Renew
+	policy := ls.LoanPolicy()
 
 	// if the license has no end in its rights, it is a purchased publication
 	if license.Rights == nil || license.Rights.End == nil {
@@ -1012,9 +1117,9 @@ func makeLicenseStatus(license license.License, ls *licensestatuses.LicenseStatu
 		// this is a loan: set the end timestamp from license rights
 		endFromLicense := license.Rights.End.Add(0)
 		ls.CurrentEndLicense = &endFromLicense
-		// set potential end from config if loan renewal is possible
-		rentingDays := config.Config.LicenseStatus.RentingDays
-		if renewAvailable && rentingDays > 0 { 
+		// set potential end from the loan policy if loan renewal is possible
+		rentingDays := policy.MaxDays
+		if policy.Renew && rentingDays > 0 {
 			ls.PotentialRights = new(licensestatuses.PotentialRights)
 			endFromConfig := license.Issued.Add(time.Hour * 24 * time.Duration(rentingDays))
 
@@ -1034,6 +1139,9 @@ func makeLicenseStatus(license license.License, ls *licensestatuses.LicenseStatu
 
 	ls.Updated = new(licensestatuses.Updated)
 	ls.Updated.License = &license.Issued
+	if license.Updated != nil {
+		ls.Updated.License = license.Updated
+	}
 
 	currentTime := time.Now().UTC().Truncate(time.Second)
 	ls.Updated.Status = &currentTime
@@ -1070,14 +1178,17 @@ func makeLinks(ls *licensestatuses.LicenseStatus) {
 	usableLicense := (ls.Status == status.STATUS_READY || ls.Status == status.STATUS_ACTIVE)
 	registerAvailable := config.Config.LicenseStatus.Register && usableLicense
 	licenseHasRightsEnd := ls.CurrentEndLicense != nil && !(*ls.CurrentEndLicense).IsZero()
-	returnAvailable := config.Config.LicenseStatus.Return && licenseHasRightsEnd && usableLicense
+	policy := ls.LoanPolicy()
+	returnAvailable := policy.Return && licenseHasRightsEnd && usableLicense
 
 	// add the possibility to renew an expired license
 	statusAllowsRenew := usableLicense
-	if config.Config.LicenseStatus.RenewExpired {
+	if policy.RenewExpired {
 		statusAllowsRenew = usableLicense || ls.Status == status.STATUS_EXPIRED
 	}
-	renewAvailable := config.Config.LicenseStatus.Renew && licenseHasRightsEnd && statusAllowsRenew
+	// no renew link once the maximum number of renewals is reached
+	renewalsLeft := policy.MaxRenewals == 0 || ls.RenewCount < policy.MaxRenewals
+	renewAvailable := policy.Renew && licenseHasRightsEnd && statusAllowsRenew && renewalsLeft
 	renewPageUrl := config.Config.LicenseStatus.RenewPageUrl
 	renewCustomUrl := config.Config.LicenseStatus.RenewCustomUrl
 
@@ -1177,13 +1288,14 @@ func decodeJsonLicenseStatus(r *http.Request, ls *licensestatuses.LicenseStatus)
 	return err
 }
 
-// updateLicense updates a license by calling the License Server
-// called from return, renew and cancel/revoke actions
-func updateLicense(timeEnd time.Time, licenseID string) (int, error) {
+// licenseUpdate returns the notification which updates the end date of a license on the License Server.
+// The notification is recorded in the outbox with the license status, then sent asynchronously,
+// so that it is retried if the License Server is down.
+func licenseUpdate(timeEnd time.Time, licenseID string) (outbox.Notification, error) {
 	// get the lcp server url
 	lcpBaseURL := config.Config.LcpServer.PublicBaseUrl
 	if len(lcpBaseURL) <= 0 {
-		return 0, errors.New("undefined Config.LcpServer.PublicBaseUrl")
+		return outbox.Notification{}, errors.New("undefined Config.LcpServer.PublicBaseUrl")
 	}
 	// create a minimum license object, limited to the license id plus rights
 	// FIXME: remove the id (here and in the lcpserver license.go)
@@ -1191,46 +1303,97 @@ func updateLicense(timeEnd time.Time, licenseID string) (int, error) {
 	// set the new end date
 	minLicense.Rights.End = &timeEnd
 
-	var lcpClient = &http.Client{
-		Timeout: time.Second * 10,
-	}
-	// FIXME: this Pipe thing should be replaced by a json.Marshal
-	pr, pw := io.Pipe()
-	go func() {
-		_ = json.NewEncoder(pw).Encode(minLicense)
-		pw.Close()
-	}()
-	// prepare the request
-	lcpURL := lcpBaseURL + "/licenses/" + licenseID
-	// send the content to the LCP server
-	req, err := http.NewRequest("PATCH", lcpURL, pr)
-	if err != nil {
-		return 0, err
-	}
-	// set the credentials
-	updateAuth := config.Config.LcpUpdateAuth
-	if updateAuth.Username != "" {
-		req.SetBasicAuth(updateAuth.Username, updateAuth.Password)
-	}
-	// set the content type
-	req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
-	// send the request to the lcp server
-	response, err := lcpClient.Do(req)
-	if err == nil {
-		if response.StatusCode != http.StatusOK {
-			log.Println("Notify Lcp Server of License (" + licenseID + ") = " + strconv.Itoa(response.StatusCode))
+	return outbox.NewNotification("PATCH", lcpBaseURL+"/licenses/"+licenseID, licenseID, api.ContentType_LCP_JSON, minLicense)
+}
+
+// maxUpdateAttempts bounds the attempts to update a license status which is modified concurrently
+const maxUpdateAttempts = 5
+
+// statusError is a problem which stops the change of a license status
+type statusError struct {
+	problem.Problem
+	code int
+}
+
+// statusChange describes a change applied to a license status
+type statusChange struct {
+	// event is recorded with the license status, if not nil
+	event     *transactions.Event
+	eventType int
+	// end is sent to the License Server as the new end date of the license, if not nil
+	end *time.Time
+	// within completes the change in the same db transaction, if not nil
+	within func(tx *sql.Tx) error
+}
+
+// changeStatus reads the status of a license and applies a change to it, then updates the license status,
+// the event and the notification to the License Server in a single db transaction.
+// If the license status has been modified concurrently, it is read again and the change applied again.
+// change modifies the license status and describes the change, or returns nil if nothing must be updated.
+// called from register, return, renew, extend and cancel/revoke actions
+func changeStatus(licenseID string, s Server, change func(ls *licensestatuses.LicenseStatus) (*statusChange, *statusError)) (*licensestatuses.LicenseStatus, *statusError) {
+
+	for attempt := 1; ; attempt++ {
+		licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
+		if err != nil {
+			if licenseStatus == nil {
+				return nil, &statusError{problem.Problem{Type: problem.LICENSE_NOT_FOUND, MessageID: "license.not_found",
+					Args: []interface{}{licenseID}}, http.StatusNotFound}
+			}
+			return nil, &statusError{problem.Problem{Detail: err.Error()}, http.StatusInternalServerError}
+		}
+		c, serr := change(licenseStatus)
+		if serr != nil || c == nil {
+			return licenseStatus, serr
 		}
-		return response.StatusCode, nil
-	}
 
-	log.Println("Error Notifying Lcp Server of License update (" + licenseID + "):" + err.Error())
-	return 0, err
+		var n *outbox.Notification
+		if c.end != nil {
+			update, err := licenseUpdate(*c.end, licenseID)
+			if err != nil {
+				return nil, &statusError{problem.Problem{Detail: err.Error()}, http.StatusInternalServerError}
+			}
+			n = &update
+		}
+		err = s.LicenseStatuses().UpdateWith(*licenseStatus, func(tx *sql.Tx) error {
+			if c.event != nil {
+				if err := s.Transactions().AddTx(tx, *c.event, c.eventType); err != nil {
+					return err
+				}
+			}
+			if c.within != nil {
+				if err := c.within(tx); err != nil {
+					return err
+				}
+			}
+			if n != nil {
+				return s.Outbox().AddTx(tx, *n)
+			}
+			return nil
+		})
+		if err == licensestatuses.ErrConflict {
+			if attempt < maxUpdateAttempts {
+				logging.Print("The status of License " + licenseID + " was modified concurrently; retry")
+				continue
+			}
+			return nil, &statusError{problem.Problem{MessageID: "license.conflict", Args: []interface{}{licenseID}}, http.StatusConflict}
+		}
+		if err != nil {
+			return nil, &statusError{problem.Problem{Detail: err.Error()}, http.StatusInternalServerError}
+		}
+		if n != nil {
+			s.Outbox().Wake()
+		}
+		return licenseStatus, nil
+	}
 }
 
-// fillLicenseStatus fills the 'message' field, the 'links' and 'event' objects in the license status
-func fillLicenseStatus(ls *licensestatuses.LicenseStatus, s Server) error {
+// fillLicenseStatus fills the 'message' field, the 'links' and 'event' objects in the license status;
+// the message is localized in the language requested by the caller
+func fillLicenseStatus(ls *licensestatuses.LicenseStatus, r *http.Request, s Server) error {
 	// add the message
-	ls.Message = "The license is in " + ls.Status + " state"
+	lang := localization.Negotiate(r.Header.Get("Accept-Language"))
+	ls.Message = localization.Message(lang, "status."+ls.Status)
 	// add the links
 	makeLinks(ls)
 	// add the events
@@ -0,0 +1,588 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilsd
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/localization"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/problem"
+	"github.com/readium/readium-lcp-server/status"
+	"github.com/readium/readium-lcp-server/transactions"
+)
+
+type testServer struct {
+	trns transactions.Transactions
+	lst  licensestatuses.LicenseStatuses
+	obx  *outbox.Outbox
+	odl  odl.Store
+	adt  audit.Store
+	db   *sql.DB
+}
+
+func (s *testServer) Transactions() transactions.Transactions          { return s.trns }
+func (s *testServer) LicenseStatuses() licensestatuses.LicenseStatuses { return s.lst }
+func (s *testServer) GoofyMode() bool                                  { return false }
+func (s *testServer) Outbox() *outbox.Outbox                           { return s.obx }
+func (s *testServer) ODL() odl.Store                                   { return s.odl }
+func (s *testServer) Audit() audit.Store                               { return s.adt }
+
+// openTestServer creates a test server on a memory db and the router of the status endpoints
+func openTestServer(t *testing.T) (*testServer, *mux.Router) {
+	config.Config.LsdServer.Database = "sqlite3://:memory:"
+	config.Config.LcpServer.PublicBaseUrl = "http://localhost:8989"
+	config.Config.LicenseStatus.Renew = true
+	config.Config.LicenseStatus.Return = true
+	config.Config.LicenseStatus.RenewDays = 7
+	driver, cnxn := config.GetDatabase(config.Config.LsdServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	s := &testServer{db: db}
+	if s.trns, err = transactions.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	if s.lst, err = licensestatuses.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	obst, err := outbox.Open(db, config.Config.LsdServer.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.obx = outbox.New(obst, config.Auth{})
+	if s.odl, err = odl.Open(db); err != nil {
+		t.Fatal(err)
+	}
+	if s.adt, err = audit.Open(db, config.Config.LsdServer.Database); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	handle := func(route string, fn func(w http.ResponseWriter, r *http.Request, s Server)) {
+		router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) { fn(w, r, s) }).Methods("GET", "POST", "PUT")
+	}
+	handle("/licenses", CreateLicenseStatusDocument)
+	handle("/licenses/{key}/register", RegisterDevice)
+	handle("/licenses/{key}/return", LendingReturn)
+	handle("/licenses/{key}/renew", LendingRenewal)
+	handle("/licenses/{key}/transfer", TransferLicense)
+	handle("/odl/licenses", AddODLLicense)
+	handle("/odl/licenses/{key}", GetODLLicenseInfo)
+	handle("/odl/licenses/{key}/checkout", ODLCheckout)
+	handle("/odl/licenses/{key}/checkouts/{checkout}/return", ODLReturn)
+	return s, router
+}
+
+func addTestStatus(t *testing.T, s *testServer, licenseID string, st string) {
+	now := time.Now().UTC().Truncate(time.Second)
+	end := now.AddDate(0, 0, 10)
+	maxEnd := now.AddDate(1, 0, 0)
+	count := 0
+	ls := licensestatuses.LicenseStatus{LicenseRef: licenseID, Status: st, CurrentEndLicense: &end,
+		Updated: &licensestatuses.Updated{License: &now, Status: &now}, DeviceCount: &count,
+		PotentialRights: &licensestatuses.PotentialRights{End: &maxEnd}}
+	if err := s.lst.Add(ls); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hammer sends n concurrent requests and returns the count of responses by status code
+func hammer(router *mux.Router, n int, url func(i int) string) map[int]int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	codes := make(map[int]int)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", url(i), nil))
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+func countEvents(t *testing.T, s *testServer, ls *licensestatuses.LicenseStatus) int {
+	if err := getEvents(ls, s); err != nil {
+		t.Fatal(err)
+	}
+	return len(ls.Events)
+}
+
+func TestConcurrentRegister(t *testing.T) {
+	s, router := openTestServer(t)
+	addTestStatus(t, s, "l1", status.STATUS_READY)
+	addTestStatus(t, s, "l2", status.STATUS_READY)
+
+	// distinct devices: no registration is lost
+	const n = 20
+	codes := hammer(router, n, func(i int) string {
+		return "/licenses/l1/register?id=d" + strconv.Itoa(i) + "&name=device"
+	})
+	// under heavy contention, a request may give up with a conflict
+	if codes[http.StatusOK]+codes[http.StatusConflict] != n || codes[http.StatusOK] == 0 {
+		t.Fatalf("Unexpected responses %v", codes)
+	}
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ls.DeviceCount != codes[http.StatusOK] || ls.Status != status.STATUS_ACTIVE {
+		t.Errorf("Expected %d devices, got %d", codes[http.StatusOK], *ls.DeviceCount)
+	}
+	if events := countEvents(t, s, ls); events != *ls.DeviceCount {
+		t.Errorf("Expected %d events, got %d", *ls.DeviceCount, events)
+	}
+
+	// the same device: it is counted once
+	codes = hammer(router, n, func(i int) string {
+		return "/licenses/l2/register?id=d1&name=device"
+	})
+	if codes[http.StatusOK] == 0 {
+		t.Fatalf("Unexpected responses %v", codes)
+	}
+	ls, err = s.lst.GetByLicenseID("l2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ls.DeviceCount != 1 {
+		t.Errorf("Expected 1 device, got %d", *ls.DeviceCount)
+	}
+	if events := countEvents(t, s, ls); events != 1 {
+		t.Errorf("Expected 1 event, got %d", events)
+	}
+}
+
+func TestConcurrentReturn(t *testing.T) {
+	s, router := openTestServer(t)
+	addTestStatus(t, s, "l1", status.STATUS_ACTIVE)
+
+	codes := hammer(router, 10, func(i int) string {
+		return "/licenses/l1/return?id=d" + strconv.Itoa(i) + "&name=device"
+	})
+	if codes[http.StatusOK] != 1 {
+		t.Fatalf("Expected a single return, got %v", codes)
+	}
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Status != status.STATUS_RETURNED {
+		t.Errorf("Expected a returned license, got %s", ls.Status)
+	}
+	if events := countEvents(t, s, ls); events != 1 {
+		t.Errorf("Expected 1 event, got %d", events)
+	}
+	// the License Server is notified once
+	if count, _ := s.obx.Count(outbox.StatusPending); count != 1 {
+		t.Errorf("Expected 1 notification, got %d", count)
+	}
+}
+
+func TestConcurrentRenew(t *testing.T) {
+	s, router := openTestServer(t)
+	addTestStatus(t, s, "l1", status.STATUS_ACTIVE)
+	before, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := hammer(router, 10, func(i int) string {
+		return "/licenses/l1/renew?id=d1&name=device"
+	})
+	renewed := codes[http.StatusOK]
+	if renewed+codes[http.StatusConflict] != 10 || renewed == 0 {
+		t.Fatalf("Unexpected responses %v", codes)
+	}
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each renewal extends the loan by 7 days
+	expected := before.CurrentEndLicense.AddDate(0, 0, 7*renewed)
+	if !ls.CurrentEndLicense.Equal(expected) {
+		t.Errorf("Expected %d renewals until %v, got %v", renewed, expected, ls.CurrentEndLicense)
+	}
+	if count, _ := s.obx.Count(outbox.StatusPending); count != renewed {
+		t.Errorf("Expected %d notifications, got %d", renewed, count)
+	}
+}
+
+func TestLoanPolicy(t *testing.T) {
+	s, router := openTestServer(t)
+	config.Config.LicenseStatus.Policies = map[string]config.LoanPolicy{
+		"textbook": {MaxDays: 30, Renew: true, RenewDays: 7, MaxRenewals: 1},
+	}
+	defer func() { config.Config.LicenseStatus.Policies = nil }()
+
+	issued := time.Now().UTC().Truncate(time.Second)
+	end := issued.AddDate(0, 0, 7)
+	create := func(id, query string) {
+		body, _ := json.Marshal(license.License{ID: id, Issued: issued, Rights: &license.UserRights{End: &end}})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/licenses"+query, bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Unexpected creation status %d", w.Code)
+		}
+	}
+	create("l1", "?policy=textbook")
+	// an unknown policy falls back to the global settings
+	create("l2", "?policy=unknown")
+
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Policy == nil || ls.Policy.Name != "textbook" || !ls.PotentialRights.End.Equal(issued.AddDate(0, 0, 30)) {
+		t.Fatalf("Expected the textbook policy, got %+v", ls.Policy)
+	}
+	ls, err = s.lst.GetByLicenseID("l2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Policy != nil || ls.LoanPolicy().MaxRenewals != 0 {
+		t.Errorf("Expected the default policy, got %+v", ls.Policy)
+	}
+
+	post := func(url string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", url, nil))
+		return w.Code
+	}
+	if code := post("/licenses/l1/register?id=d1&name=device"); code != http.StatusOK {
+		t.Fatalf("Unexpected register status %d", code)
+	}
+	// the policy allows a single renewal and no return
+	if code := post("/licenses/l1/renew?id=d1&name=device"); code != http.StatusOK {
+		t.Errorf("Unexpected renew status %d", code)
+	}
+	if code := post("/licenses/l1/renew?id=d1&name=device"); code != http.StatusForbidden {
+		t.Errorf("Expected a second renewal to be rejected, got %d", code)
+	}
+	if code := post("/licenses/l1/return?id=d1&name=device"); code != http.StatusForbidden {
+		t.Errorf("Expected the return to be rejected, got %d", code)
+	}
+	ls, err = s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.RenewCount != 1 || !ls.CurrentEndLicense.Equal(end.AddDate(0, 0, 7)) {
+		t.Errorf("Expected a single renewal, got %d until %v", ls.RenewCount, ls.CurrentEndLicense)
+	}
+	makeLinks(ls)
+	for _, link := range ls.Links {
+		if link.Rel == "renew" || link.Rel == "return" {
+			t.Errorf("Unexpected %s link", link.Rel)
+		}
+	}
+
+	// without a loan policy, the global renew and return settings only control the links
+	config.Config.LicenseStatus.RentingDays = 60
+	defer func() { config.Config.LicenseStatus.RentingDays = 0 }()
+	create("l3", "")
+	config.Config.LicenseStatus.Renew = false
+	config.Config.LicenseStatus.Return = false
+	if code := post("/licenses/l3/register?id=d1&name=device"); code != http.StatusOK {
+		t.Fatalf("Unexpected register status %d", code)
+	}
+	if code := post("/licenses/l3/renew?id=d1&name=device"); code != http.StatusOK {
+		t.Errorf("Expected a renewal without loan policy, got %d", code)
+	}
+	if code := post("/licenses/l3/return?id=d1&name=device"); code != http.StatusOK {
+		t.Errorf("Expected a return without loan policy, got %d", code)
+	}
+}
+
+func TestLocalizedMessages(t *testing.T) {
+	s, router := openTestServer(t)
+	err := localization.Init(config.Localization{Languages: []string{"en", "fr"}, Folder: "../../localization/catalogs", DefaultLanguage: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localization.Init(config.Localization{})
+	addTestStatus(t, s, "l1", status.STATUS_READY)
+	addTestStatus(t, s, "l2", status.STATUS_REVOKED)
+
+	post := func(url, lang string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", url, nil)
+		req.Header.Set("Accept-Language", lang)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/licenses/l1/register?id=d1&name=device", "fr-FR,fr;q=0.9")
+	var ls licensestatuses.LicenseStatus
+	if err := json.NewDecoder(w.Body).Decode(&ls); err != nil {
+		t.Fatal(err)
+	}
+	if ls.Message != "La licence est active" {
+		t.Errorf("Unexpected message %q", ls.Message)
+	}
+
+	var p problem.Problem
+	w = post("/licenses/l2/register?id=d1&name=device", "fr")
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusForbidden || p.Title != "Interdit" || p.Detail != "La licence n'est ni prête ni active" {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+	// an unsupported language falls back to the default language
+	w = post("/licenses/l2/return?id=d1&name=device", "ja")
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "Forbidden" || p.Detail != "The current license status is revoked; return forbidden" {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+}
+
+func TestLicenseUpdateNotification(t *testing.T) {
+	s, router := openTestServer(t)
+
+	issued := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	put := func(updated *time.Time) int {
+		body, _ := json.Marshal(license.License{ID: "l1", Issued: issued, Updated: updated, Rights: &license.UserRights{}})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/licenses", bytes.NewReader(body)))
+		return w.Code
+	}
+	if code := put(nil); code != http.StatusCreated {
+		t.Fatalf("Unexpected creation status %d", code)
+	}
+	// the license is reissued, e.g. after a passphrase change
+	updated := issued.Add(30 * time.Minute)
+	if code := put(&updated); code != http.StatusOK {
+		t.Fatalf("Unexpected update status %d", code)
+	}
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ls.Updated.License.Equal(updated) {
+		t.Errorf("Expected a license updated on %v, got %v", updated, ls.Updated.License)
+	}
+	// an older notification is ignored
+	if code := put(&issued); code != http.StatusOK {
+		t.Fatalf("Unexpected update status %d", code)
+	}
+	if ls, _ = s.lst.GetByLicenseID("l1"); !ls.Updated.License.Equal(updated) {
+		t.Errorf("Expected a license updated on %v, got %v", updated, ls.Updated.License)
+	}
+}
+
+func TestSyncEndNotification(t *testing.T) {
+	s, router := openTestServer(t)
+	addTestStatus(t, s, "l1", status.STATUS_ACTIVE)
+
+	end := time.Now().UTC().Truncate(time.Second).AddDate(2, 0, 0)
+	put := func(query string, updated time.Time) {
+		body, _ := json.Marshal(license.License{ID: "l1", Updated: &updated, Rights: &license.UserRights{End: &end}})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/licenses"+query, bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected update status %d", w.Code)
+		}
+	}
+	// the end date is kept by a plain notification, e.g. after a passphrase change
+	put("", time.Now().UTC().Add(time.Minute))
+	ls, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.CurrentEndLicense.Equal(end) {
+		t.Errorf("Unexpected end %v", ls.CurrentEndLicense)
+	}
+	// the end date follows the rights after a bulk update, and allows renewals up to it
+	put("?sync_end=true", time.Now().UTC().Add(2*time.Minute))
+	if ls, err = s.lst.GetByLicenseID("l1"); err != nil {
+		t.Fatal(err)
+	}
+	if !ls.CurrentEndLicense.Equal(end) || !ls.PotentialRights.End.Equal(end) {
+		t.Errorf("Unexpected end %v, potential end %v", ls.CurrentEndLicense, ls.PotentialRights.End)
+	}
+}
+
+func TestTransferLicense(t *testing.T) {
+	s, router := openTestServer(t)
+	config.Config.LicenseStatus.Policies = map[string]config.LoanPolicy{
+		"textbook": {MaxDays: 30, Renew: true, RenewDays: 7, MaxRenewals: 2},
+	}
+	defer func() { config.Config.LicenseStatus.Policies = nil }()
+
+	issued := time.Now().UTC().Truncate(time.Second)
+	end := issued.AddDate(0, 0, 7)
+	send := func(method, url string, lic license.License) int {
+		body, _ := json.Marshal(lic)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, bytes.NewReader(body)))
+		return w.Code
+	}
+	if code := send("PUT", "/licenses?policy=textbook", license.License{ID: "l1", Issued: issued, Rights: &license.UserRights{End: &end}}); code != http.StatusCreated {
+		t.Fatalf("Unexpected creation status %d", code)
+	}
+	if code := send("POST", "/licenses/l1/register?id=d1&name=device", license.License{}); code != http.StatusOK {
+		t.Fatalf("Unexpected register status %d", code)
+	}
+	if code := send("POST", "/licenses/l1/renew?id=d1&name=device", license.License{}); code != http.StatusOK {
+		t.Fatalf("Unexpected renew status %d", code)
+	}
+
+	// the new license is issued later with the remaining rights
+	renewed := end.AddDate(0, 0, 7)
+	gift := license.License{ID: "l2", Issued: issued.Add(time.Hour), Rights: &license.UserRights{End: &renewed}}
+	if code := send("PUT", "/licenses/l1/transfer", gift); code != http.StatusCreated {
+		t.Fatalf("Unexpected transfer status %d", code)
+	}
+	// the same transfer sent again, e.g. by the outbox of the License Server, is already done
+	if code := send("PUT", "/licenses/l1/transfer", gift); code != http.StatusCreated {
+		t.Errorf("Expected a repeated transfer to succeed, got %d", code)
+	}
+	// a license cannot be transferred twice
+	if code := send("PUT", "/licenses/l1/transfer", license.License{ID: "l3", Issued: issued, Rights: &license.UserRights{}}); code != http.StatusBadRequest {
+		t.Errorf("Expected a second transfer to be rejected, got %d", code)
+	}
+	if code := send("PUT", "/licenses/unknown/transfer", gift); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown license, got %d", code)
+	}
+
+	source, err := s.lst.GetByLicenseID("l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.Status != status.STATUS_REVOKED {
+		t.Errorf("Expected a revoked license, got %s", source.Status)
+	}
+	getEvents(source, s)
+	last := source.Events[len(source.Events)-1]
+	if last.Reason != status.EVENT_TRANSFERRED || last.RelatedLicense != "l2" {
+		t.Errorf("Unexpected revocation event %+v", last)
+	}
+
+	ls, err := s.lst.GetByLicenseID("l2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Policy == nil || ls.Policy.Name != "textbook" || ls.RenewCount != 1 ||
+		!ls.PotentialRights.End.Equal(issued.AddDate(0, 0, 30)) || !ls.CurrentEndLicense.Equal(renewed) {
+		t.Errorf("Expected the policy and renewals of the transferred license, got %+v", ls)
+	}
+	getEvents(ls, s)
+	if len(ls.Events) != 1 || ls.Events[0].Type != "transfer" || ls.Events[0].RelatedLicense != "l1" {
+		t.Errorf("Unexpected events %+v", ls.Events)
+	}
+
+	// if the status of the new license cannot be created, the transferred license is not revoked
+	// and the transfer can be sent again
+	addTestStatus(t, s, "l4", status.STATUS_ACTIVE)
+	_, err = s.db.Exec("CREATE TRIGGER fail_l5 BEFORE INSERT ON license_status WHEN NEW.license_ref='l5' BEGIN SELECT RAISE(ABORT, 'failure'); END")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l5 := license.License{ID: "l5", Issued: issued, Rights: &license.UserRights{End: &end}}
+	if code := send("PUT", "/licenses/l4/transfer", l5); code != http.StatusInternalServerError {
+		t.Errorf("Expected a failed transfer, got %d", code)
+	}
+	if source, err = s.lst.GetByLicenseID("l4"); err != nil || source.Status != status.STATUS_ACTIVE {
+		t.Errorf("Expected an active license after a failed transfer, got %+v, %v", source, err)
+	}
+	if _, err = s.db.Exec("DROP TRIGGER fail_l5"); err != nil {
+		t.Fatal(err)
+	}
+	if code := send("PUT", "/licenses/l4/transfer", l5); code != http.StatusCreated {
+		t.Errorf("Expected the transfer sent again to succeed, got %d", code)
+	}
+	if _, err = s.lst.GetByLicenseID("l5"); err != nil {
+		t.Errorf("Expected the status of the new license, got %v", err)
+	}
+}
+
+func TestCancellationAudit(t *testing.T) {
+	s, router := openTestServer(t)
+	router.HandleFunc("/licenses/{key}/status", func(w http.ResponseWriter, r *http.Request) {
+		audit.Handle(s.adt, "admin", "", w, r, func(w http.ResponseWriter, r *http.Request) { LendingCancellation(w, r, s) })
+	}).Methods("PATCH")
+
+	addTestStatus(t, s, "l1", status.STATUS_ACTIVE)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PATCH", "/licenses/l1/status", strings.NewReader(`{"status":"revoked"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected revocation status %d", w.Code)
+	}
+
+	fn := s.adt.List(audit.Filter{Target: "l1", PerPage: 10})
+	e, err := fn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Principal != "admin" || e.Action != "PATCH /licenses/{key}/status" || e.Status != http.StatusOK {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if c := e.Changes["status"]; c.Before != status.STATUS_ACTIVE || c.After != status.STATUS_REVOKED {
+		t.Errorf("Unexpected status change %+v", c)
+	}
+	if c, ok := e.Changes["potential_end"]; !ok || c.After != nil {
+		t.Errorf("Expected the potential end to be removed, got %+v", e.Changes)
+	}
+	if _, ok := e.Changes["end"]; !ok {
+		t.Errorf("Expected the end to be changed, got %+v", e.Changes)
+	}
+}
+
+func TestTransferAudit(t *testing.T) {
+	s, _ := openTestServer(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/licenses/{key}/transfer", func(w http.ResponseWriter, r *http.Request) {
+		audit.Handle(s.adt, "admin", "", w, r, func(w http.ResponseWriter, r *http.Request) { TransferLicense(w, r, s) })
+	}).Methods("PUT")
+
+	addTestStatus(t, s, "l1", status.STATUS_ACTIVE)
+	end := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, 7)
+	body, _ := json.Marshal(license.License{ID: "l2", Issued: time.Now().UTC(), Rights: &license.UserRights{End: &end}})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/licenses/l1/transfer", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected transfer status %d", w.Code)
+	}
+
+	fn := s.adt.List(audit.Filter{Target: "l1", PerPage: 10})
+	e, err := fn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Action != "PUT /licenses/{key}/transfer" || e.Status != http.StatusCreated {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if c := e.Changes["status"]; c.Before != status.STATUS_ACTIVE || c.After != status.STATUS_REVOKED {
+		t.Errorf("Unexpected status change %+v", c)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilsd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/logging"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// AddODLLicense adds an ODL license bought by a library
+func AddODLLicense(w http.ResponseWriter, r *http.Request, s Server) {
+
+	var l odl.License
+	err := json.NewDecoder(r.Body).Decode(&l)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	err = l.Validate()
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if l.Terms.Expires != nil {
+		expires := l.Terms.Expires.UTC().Truncate(time.Second)
+		l.Terms.Expires = &expires
+	}
+
+	logging.Print("Add the ODL License " + l.ID + " for Content " + l.ContentID)
+
+	_, err = s.ODL().Get(l.ID)
+	if err == nil {
+		problem.Error(w, r, problem.Problem{Detail: "The ODL license " + l.ID + " already exists"}, http.StatusConflict)
+		return
+	}
+	if err != odl.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	err = s.ODL().Add(l)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	audit.Describe(r, l.ID, nil, l)
+	writeODLInfo(w, r, l.ID, http.StatusCreated, s)
+}
+
+// GetODLLicenseInfo returns the license info document of an ODL license
+func GetODLLicenseInfo(w http.ResponseWriter, r *http.Request, s Server) {
+	writeODLInfo(w, r, mux.Vars(r)["key"], http.StatusOK, s)
+}
+
+// writeODLInfo writes the license info document of an ODL license
+func writeODLInfo(w http.ResponseWriter, r *http.Request, id string, code int, s Server) {
+
+	l, err := s.ODL().Get(id)
+	if err == odl.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	active, err := s.ODL().Active(id, now)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.ContentType_ODL_INFO_JSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(l.Info(active, now))
+}
+
+// ODLCheckout lends an ODL license to a patron: it consumes a checkout of the ODL license,
+// generates an LCP license for the patron and returns its license status document.
+//
+// parameters:
+//
+//	key: ODL license id
+//	checkout_id: id of the checkout, set by the library
+//	patron_id: id of the patron
+//	passphrase: hex-encoded hash of the passphrase of the patron
+//	hint: passphrase hint
+//	expires: end of the loan requested by the library (optional), limited by the terms of the ODL license
+func ODLCheckout(w http.ResponseWriter, r *http.Request, s Server) {
+
+	id := mux.Vars(r)["key"]
+	checkoutID := r.FormValue("checkout_id")
+	patronID := r.FormValue("patron_id")
+	passphrase := r.FormValue("passphrase")
+	hint := r.FormValue("hint")
+
+	if checkoutID == "" || patronID == "" || passphrase == "" || hint == "" {
+		msg := "checkout_id, patron_id, passphrase and hint are mandatory"
+		problem.Error(w, r, problem.Problem{Detail: msg}, http.StatusBadRequest)
+		return
+	}
+	var expires time.Time
+	if value := r.FormValue("expires"); value != "" {
+		var err error
+		expires, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	logging.Print("Checkout " + checkoutID + " of the ODL License " + id + " for Patron " + patronID)
+
+	// reserve a checkout, the ODL license is read again if another checkout happened meanwhile
+	var l odl.License
+	var c odl.Checkout
+	var err error
+	now := time.Now().UTC().Truncate(time.Second)
+	for attempt := 1; ; attempt++ {
+		l, err = s.ODL().Get(id)
+		if err == odl.ErrNotFound {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		_, err = s.ODL().GetCheckout(id, checkoutID)
+		if err == nil {
+			problem.Error(w, r, problem.Problem{Detail: "The checkout " + checkoutID + " already exists"}, http.StatusConflict)
+			return
+		}
+		if err != odl.ErrNotFound {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		active, err := s.ODL().Active(id, now)
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		info := l.Info(active, now)
+		if info.Status != odl.StatusAvailable {
+			problem.Error(w, r, problem.Problem{Detail: "The ODL license is " + info.Status}, http.StatusForbidden)
+			return
+		}
+		if info.Checkouts.Available == 0 {
+			problem.Error(w, r, problem.Problem{Detail: "No checkout of the ODL license is available"}, http.StatusForbidden)
+			return
+		}
+
+		c = odl.Checkout{ID: checkoutID, PatronID: patronID, End: l.LoanEnd(now, expires)}
+		if !c.End.After(now) {
+			problem.Error(w, r, problem.Problem{Detail: "The end of the checkout must be in the future"}, http.StatusBadRequest)
+			return
+		}
+		if l.CheckoutsLeft != nil {
+			left := *l.CheckoutsLeft - 1
+			l.CheckoutsLeft = &left
+		}
+		err = s.ODL().Checkout(l, c)
+		if err == odl.ErrConflict && attempt < maxUpdateAttempts {
+			continue
+		}
+		if err == odl.ErrConflict {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	// generate the LCP license of the patron; the checkout is given back if it fails
+	var plic license.License
+	plic.User.ID = patronID
+	plic.Encryption.UserKey.Algorithm = Sha256_URL
+	plic.Encryption.UserKey.Hint = hint
+	plic.Encryption.UserKey.HexValue = passphrase
+	plic.Rights = &license.UserRights{Start: &now, End: &c.End}
+	lic, err := generateLicense(l.ContentID, plic)
+	if err != nil {
+		if cerr := s.ODL().Cancel(l, checkoutID); cerr != nil {
+			logging.Print("Error cancelling the checkout " + checkoutID + ": " + cerr.Error())
+		}
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	err = s.ODL().SetLicenseRef(id, checkoutID, lic.ID)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	c.LicenseRef = lic.ID
+	audit.Describe(r, id+"/"+checkoutID, nil, c)
+
+	// create the license status with the ODL loan policy, unless the notification
+	// of the License Server has already created it
+	policy := odlPolicy()
+	var ls licensestatuses.LicenseStatus
+	ls.Policy = &policy
+	makeLicenseStatus(lic, &ls)
+	existing, err := addLicenseStatus(ls, s)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if existing != nil && existing.Policy == nil {
+		_, serr := changeStatus(lic.ID, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+			licenseStatus.Policy = ls.Policy
+			licenseStatus.PotentialRights = ls.PotentialRights
+			return &statusChange{}, nil
+		})
+		if serr != nil {
+			problem.Error(w, r, serr.Problem, serr.code)
+			return
+		}
+	}
+	writeStatus(w, r, lic.ID, http.StatusCreated, s)
+}
+
+// ODLReturn returns the LCP license of a checkout, which makes the checkout available again
+//
+// parameters:
+//
+//	key: ODL license id
+//	checkout: id of the checkout
+func ODLReturn(w http.ResponseWriter, r *http.Request, s Server) {
+
+	vars := mux.Vars(r)
+	id := vars["key"]
+	checkoutID := vars["checkout"]
+
+	logging.Print("Return the checkout " + checkoutID + " of the ODL License " + id)
+
+	c, err := s.ODL().GetCheckout(id, checkoutID)
+	if err == odl.ErrNotFound {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if c.LicenseRef == "" {
+		problem.Error(w, r, problem.Problem{Detail: "The license of the checkout is being generated"}, http.StatusConflict)
+		return
+	}
+	// the return is made by the library on behalf of the patron
+	var before auditedStatus
+	licenseStatus, serr := changeStatus(c.LicenseRef, s, func(licenseStatus *licensestatuses.LicenseStatus) (*statusChange, *statusError) {
+		before = auditState(licenseStatus)
+		return returnLicense(licenseStatus, "system", "system")
+	})
+	if serr != nil {
+		problem.Error(w, r, serr.Problem, serr.code)
+		return
+	}
+	audit.Describe(r, "", before, auditState(licenseStatus))
+	writeStatus(w, r, c.LicenseRef, http.StatusOK, s)
+}
+
+// writeStatus writes the license status document of a license
+func writeStatus(w http.ResponseWriter, r *http.Request, licenseID string, code int, s Server) {
+
+	licenseStatus, err := s.LicenseStatuses().GetByLicenseID(licenseID)
+	if err == nil {
+		err = fillLicenseStatus(licenseStatus, r, s)
+	}
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	// the device count must not be sent in json to the caller
+	licenseStatus.DeviceCount = nil
+	w.Header().Set("Content-Type", api.ContentType_LSD_JSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(licenseStatus)
+}
+
+// odlPolicy returns the loan policy of ODL checkouts: the "odl" loan policy if it is configured,
+// otherwise a policy which allows returns but no renewal
+func odlPolicy() config.LoanPolicy {
+	if policy, ok := config.Config.LicenseStatus.GetLoanPolicy("odl"); ok {
+		return policy
+	}
+	return config.LoanPolicy{Name: "odl", Return: true}
+}
+
+// generateLicense generates a license on the License Server from a partial license
+func generateLicense(contentID string, plic license.License) (lic license.License, err error) {
+	jplic, err := json.Marshal(plic)
+	if err != nil {
+		return
+	}
+	lcpBaseURL := config.Config.LcpServer.PublicBaseUrl
+	if lcpBaseURL == "" {
+		err = errors.New("undefined Config.LcpServer.PublicBaseUrl")
+		return
+	}
+	req, err := http.NewRequest("POST", lcpBaseURL+"/contents/"+url.PathEscape(contentID)+"/license", bytes.NewReader(jplic))
+	if err != nil {
+		return
+	}
+	auth := config.Config.LcpUpdateAuth
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	req.Header.Add("Content-Type", api.ContentType_LCP_JSON)
+	client := mtls.Client(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		var errStatus problem.Problem
+		if dec.Decode(&errStatus) != nil {
+			errStatus.Detail = resp.Status
+		}
+		err = errors.New("Generate License: " + errStatus.Title + " - " + errStatus.Detail)
+		return
+	}
+	err = dec.Decode(&lic)
+	return
+}
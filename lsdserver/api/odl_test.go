@@ -0,0 +1,128 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilsd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/status"
+)
+
+// newTestLcpServer simulates the generation of licenses by the License Server
+func newTestLcpServer() *httptest.Server {
+	var count int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/contents/c1/license" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var lic license.License
+		json.NewDecoder(r.Body).Decode(&lic)
+		lic.ID = "lic" + strconv.Itoa(int(atomic.AddInt32(&count, 1)))
+		lic.Issued = time.Now().UTC().Truncate(time.Second)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(lic)
+	}))
+}
+
+func getODLInfo(t *testing.T, router *mux.Router, id string) odl.Info {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/odl/licenses/"+id, nil))
+	var info odl.Info
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&info) != nil {
+		t.Fatalf("Unexpected info document, status %d", w.Code)
+	}
+	return info
+}
+
+func TestODLCheckout(t *testing.T) {
+	s, router := openTestServer(t)
+	lcp := newTestLcpServer()
+	defer lcp.Close()
+	config.Config.LcpServer.PublicBaseUrl = lcp.URL
+
+	add := func(id, contentID string) {
+		checkouts := 3
+		body, _ := json.Marshal(odl.License{ID: id, ContentID: contentID,
+			Terms: odl.Terms{Checkouts: &checkouts, Concurrency: 2, Length: 86400}})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/odl/licenses", bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Unexpected creation status %d", w.Code)
+		}
+	}
+	add("odl1", "c1")
+	checkout := func(id, checkoutID string) string {
+		return "/odl/licenses/" + id + "/checkout?checkout_id=" + checkoutID + "&patron_id=p" + checkoutID + "&passphrase=aa&hint=hint"
+	}
+
+	// concurrent checkouts are limited by the concurrency of the ODL license
+	codes := hammer(router, 5, func(i int) string { return checkout("odl1", strconv.Itoa(i)) })
+	if codes[http.StatusCreated] != 2 {
+		t.Fatalf("Expected 2 checkouts, got %v", codes)
+	}
+	info := getODLInfo(t, router, "odl1")
+	if info.Status != odl.StatusAvailable || info.Checkouts.Available != 0 || *info.Checkouts.Left != 1 {
+		t.Errorf("Unexpected availability %+v", info.Checkouts)
+	}
+
+	// find a checkout and its license status
+	var c odl.Checkout
+	for i := 0; i < 5; i++ {
+		var err error
+		if c, err = s.odl.GetCheckout("odl1", strconv.Itoa(i)); err == nil {
+			break
+		}
+	}
+	ls, err := s.lst.GetByLicenseID(c.LicenseRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Policy == nil || ls.Policy.Name != "odl" || ls.Status == status.STATUS_RETURNED || !ls.CurrentEndLicense.Equal(c.End) {
+		t.Errorf("Unexpected license status %+v", ls)
+	}
+
+	// a return makes a checkout available again
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/odl/licenses/odl1/checkouts/"+c.ID+"/return", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected return status %d", w.Code)
+	}
+	if info = getODLInfo(t, router, "odl1"); info.Checkouts.Available != 1 {
+		t.Errorf("Expected an available checkout, got %+v", info.Checkouts)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", checkout("odl1", "10"), nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected checkout status %d", w.Code)
+	}
+	// all the checkouts of the ODL license have been used
+	if info = getODLInfo(t, router, "odl1"); info.Status != odl.StatusUnavailable || *info.Checkouts.Left != 0 {
+		t.Errorf("Expected an unavailable ODL license, got %+v", info)
+	}
+
+	// a checkout is given back if its license cannot be generated
+	add("odl2", "unknown")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", checkout("odl2", "1"), nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected checkout status %d", w.Code)
+	}
+	if info = getODLInfo(t, router, "odl2"); info.Checkouts.Available != 2 || *info.Checkouts.Left != 3 {
+		t.Errorf("Expected the checkout to be given back, got %+v", info.Checkouts)
+	}
+}
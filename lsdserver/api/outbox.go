@@ -0,0 +1,42 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package apilsd
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/problem"
+)
+
+// ListOutbox returns the license updates to the License Server which are pending or dead-lettered,
+// with their counts. Parameters: status (pending or failed, all by default), page, per_page.
+func ListOutbox(w http.ResponseWriter, r *http.Request, s Server) {
+
+	status := r.FormValue("status")
+	if status != "" && status != outbox.StatusPending && status != outbox.StatusFailed {
+		problem.Error(w, r, problem.Problem{Detail: "status must be pending or failed"}, http.StatusBadRequest)
+		return
+	}
+	page, perPage, err := api.ParsePage(r)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	report, err := s.Outbox().Report(status, page, perPage)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", api.ContentType_JSON)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(report)
+	if err != nil {
+		problem.Error(w, r, problem.Problem{Detail: err.Error()}, http.StatusInternalServerError)
+	}
+}
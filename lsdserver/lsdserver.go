@@ -6,9 +6,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -23,10 +25,18 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/microsoft/go-mssqldb"
 
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/audit"
 	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/health"
 	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
+	"github.com/readium/readium-lcp-server/localization"
 	"github.com/readium/readium-lcp-server/logging"
 	lsdserver "github.com/readium/readium-lcp-server/lsdserver/server"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/ratelimit"
 	"github.com/readium/readium-lcp-server/transactions"
 )
 
@@ -48,6 +58,14 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	tlsConfig, err := mtls.ServerConfig(config.Config.LsdServer.TLS)
+	if err != nil {
+		panic(err)
+	}
+	// the calls to the License Server present a client certificate, if configured
+	if err = mtls.InitClient(config.Config.ClientTLS); err != nil {
+		panic(err)
+	}
 
 	driver, cnxn := config.GetDatabase(config.Config.LsdServer.Database)
 	log.Println("Database driver " + driver)
@@ -80,6 +98,40 @@ func main() {
 		panic(err)
 	}
 
+	obst, err := outbox.Open(db, config.Config.LsdServer.Database)
+	if err != nil {
+		panic(err)
+	}
+	// the license updates sent to the License Server are dispatched in the background
+	obx := outbox.New(obst, config.Config.LcpUpdateAuth)
+	if !readonly {
+		go obx.Run(time.Minute)
+	}
+
+	odlst, err := odl.Open(db)
+	if err != nil {
+		panic(err)
+	}
+
+	// the public routes are rate limited if limits are configured
+	var limiter *ratelimit.Limiter
+	if rl := config.Config.LsdServer.RateLimit; len(rl.Routes) > 0 {
+		var rst ratelimit.Store
+		switch rl.Store {
+		case "", "memory":
+			rst = ratelimit.NewMemoryStore()
+		case "database":
+			rst, err = ratelimit.Open(db, config.Config.LsdServer.Database)
+			if err != nil {
+				panic(err)
+			}
+		default:
+			panic("Unknown rate limit store " + rl.Store)
+		}
+		limiter = ratelimit.New(rst, rl)
+		go limiter.Run(time.Minute)
+	}
+
 	authFile := config.Config.LsdServer.AuthFile
 	if authFile == "" {
 		panic("Must have passwords file")
@@ -93,6 +145,21 @@ func main() {
 	htpasswd := auth.HtpasswdFileProvider(authFile)
 	authenticator := auth.NewBasicAuthenticator("Basic Realm", htpasswd)
 
+	// API keys with scopes, managed by lcpapikey
+	keys, err := apikey.Open(db, config.Config.LsdServer.Database)
+	if err != nil {
+		panic(err)
+	}
+
+	// the changes made through the private routes are recorded in the audit log
+	adt, err := audit.Open(db, config.Config.LsdServer.Database)
+	if err != nil {
+		panic(err)
+	}
+	if days := config.Config.LsdServer.AuditRetentionDays; days > 0 && !readonly {
+		go audit.Run(adt, time.Duration(days)*24*time.Hour, time.Hour)
+	}
+
 	// the server will behave strangely, to test the resilience of LCP compliant apps
 	goofyMode := config.Config.GoofyMode
 
@@ -102,10 +169,26 @@ func main() {
 		panic(err)
 	}
 
-	HandleSignals()
+	// the messages of the status documents and errors are localized with the configured catalogs
+	err = localization.Init(config.Config.Localization)
+	if err != nil {
+		panic(err)
+	}
+
+	// the readiness of the server depends on the database; the License Server and the CMS are checked as well
+	checker := health.New(health.Database(db))
+	if config.Config.LcpServer.PublicBaseUrl != "" {
+		checker.Add(health.Peer("lcp", config.Config.LcpServer.PublicBaseUrl))
+	}
+	if config.Config.LsdServer.UserDataUrl != "" {
+		checker.Add(health.Reachable("cms", config.Config.LsdServer.UserDataUrl))
+	}
+
+	quit := HandleSignals()
 
 	parsedPort := strconv.Itoa(config.Config.LsdServer.Port)
-	s := lsdserver.New(":"+parsedPort, readonly, goofyMode, &hist, &trns, authenticator)
+	s := lsdserver.New(":"+parsedPort, readonly, goofyMode, &hist, &trns, obx, odlst, limiter, authenticator, keys, adt, checker)
+	s.TLSConfig = tlsConfig
 	if readonly {
 		log.Println("License status server running in readonly mode on port " + parsedPort)
 	} else {
@@ -113,14 +196,43 @@ func main() {
 	}
 	log.Println("Public base URL=" + config.Config.LsdServer.PublicBaseUrl)
 
-	if err := s.ListenAndServe(); err != nil {
-		log.Println("Error " + err.Error())
-	}
+	go func() {
+		var err error
+		if s.TLSConfig != nil {
+			// the certificate and private key are held by the tls configuration
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			err = s.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("Error " + err.Error())
+			os.Exit(1)
+		}
+	}()
+	<-quit
 
+	// stop accepting connections and let the requests in progress finish,
+	// then flush the license updates to the License Server before closing the database
+	ctx, cancel := context.WithTimeout(context.Background(), config.Config.LsdServer.ShutdownDelay())
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Println("Error draining the requests: " + err.Error())
+	}
+	if err := obx.Shutdown(ctx); err != nil {
+		log.Println("Error flushing the notifications to the License Server: " + err.Error())
+	}
+	if err := db.Close(); err != nil {
+		log.Println("Error closing the database: " + err.Error())
+	}
+	log.Println("License status server stopped")
 }
 
-func HandleSignals() {
-	sigChan := make(chan os.Signal)
+// HandleSignals prints the stack traces on SIGQUIT and returns a channel which is closed on SIGINT or SIGTERM;
+// a second SIGINT or SIGTERM exits immediately
+func HandleSignals() <-chan struct{} {
+	quit := make(chan struct{})
+	// Buffer size should be >= number of signals we're listening for
+	sigChan := make(chan os.Signal, 1) // or 3 to match the exact number of signals
 	go func() {
 		stacktrace := make([]byte, 1<<20)
 		for sig := range sigChan {
@@ -131,11 +243,18 @@ func HandleSignals() {
 			case syscall.SIGINT:
 				fallthrough
 			case syscall.SIGTERM:
-				fmt.Println("Shutting down...")
-				os.Exit(0)
+				select {
+				case <-quit:
+					fmt.Println("Forced shutdown")
+					os.Exit(1)
+				default:
+					fmt.Println("Shutting down...")
+					close(quit)
+				}
 			}
 		}
 	}()
 
 	signal.Notify(sigChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+	return quit
 }
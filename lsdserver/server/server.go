@@ -6,15 +6,26 @@
 package lsdserver
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/gorilla/mux"
 
 	"github.com/readium/readium-lcp-server/api"
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/audit"
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/health"
 	licensestatuses "github.com/readium/readium-lcp-server/license_statuses"
 	apilsd "github.com/readium/readium-lcp-server/lsdserver/api"
+	"github.com/readium/readium-lcp-server/mtls"
+	"github.com/readium/readium-lcp-server/odl"
+	"github.com/readium/readium-lcp-server/outbox"
+	"github.com/readium/readium-lcp-server/problem"
+	"github.com/readium/readium-lcp-server/ratelimit"
 	"github.com/readium/readium-lcp-server/transactions"
 )
 
@@ -24,6 +35,11 @@ type Server struct {
 	goofyMode bool
 	lst       licensestatuses.LicenseStatuses
 	trns      transactions.Transactions
+	obx       *outbox.Outbox
+	odl       odl.Store
+	limiter   *ratelimit.Limiter
+	keys      apikey.Store
+	adt       audit.Store
 }
 
 func (s *Server) LicenseStatuses() licensestatuses.LicenseStatuses {
@@ -34,11 +50,23 @@ func (s *Server) Transactions() transactions.Transactions {
 	return s.trns
 }
 
+func (s *Server) Outbox() *outbox.Outbox {
+	return s.obx
+}
+
+func (s *Server) ODL() odl.Store {
+	return s.odl
+}
+
+func (s *Server) Audit() audit.Store {
+	return s.adt
+}
+
 func (s *Server) GoofyMode() bool {
 	return s.goofyMode
 }
 
-func New(bindAddr string, readonly bool, goofyMode bool, lst *licensestatuses.LicenseStatuses, trns *transactions.Transactions, basicAuth *auth.BasicAuth) *Server {
+func New(bindAddr string, readonly bool, goofyMode bool, lst *licensestatuses.LicenseStatuses, trns *transactions.Transactions, obx *outbox.Outbox, odlst odl.Store, limiter *ratelimit.Limiter, basicAuth *auth.BasicAuth, keys apikey.Store, adt audit.Store, checker *health.Checker) *Server {
 
 	sr := api.CreateServerRouter("")
 
@@ -53,6 +81,11 @@ func New(bindAddr string, readonly bool, goofyMode bool, lst *licensestatuses.Li
 		readonly:  readonly,
 		lst:       *lst,
 		trns:      *trns,
+		obx:       obx,
+		odl:       odlst,
+		limiter:   limiter,
+		keys:      keys,
+		adt:       adt,
 		goofyMode: goofyMode,
 	}
 
@@ -63,30 +96,53 @@ func New(bindAddr string, readonly bool, goofyMode bool, lst *licensestatuses.Li
 	// Ping endpoint
 	s.handleFunc(sr.R, "/ping", apilsd.Ping).Methods("GET")
 
+	// Health endpoints, for orchestrators
+	sr.R.HandleFunc("/health/live", health.Live).Methods("GET")
+	sr.R.HandleFunc("/health/ready", checker.Ready).Methods("GET")
+
 	licenseRoutesPathPrefix := "/licenses"
 	licenseRoutes := sr.R.PathPrefix(licenseRoutesPathPrefix).Subrouter().StrictSlash(false)
 
-	s.handlePrivateFunc(sr.R, licenseRoutesPathPrefix, apilsd.FilterLicenseStatuses, basicAuth).Methods("GET")
+	s.handlePrivateFunc(sr.R, licenseRoutesPathPrefix, apilsd.FilterLicenseStatuses, apikey.ReportsRead, basicAuth).Methods("GET")
+
+	// the public routes are rate limited, by client ip and by license
+	s.handleLimitedFunc(licenseRoutes, "/{key}/status", "status", apilsd.GetLicenseStatusDocument).Methods("GET")
+	s.handleLimitedFunc(licenseRoutes, "/{key}", "license", apilsd.GetFreshLicense).Methods("GET")
+
+	s.handlePrivateFunc(licenseRoutes, "/{key}/registered", apilsd.ListRegisteredDevices, apikey.ReportsRead, basicAuth).Methods("GET")
+	if !readonly {
+		s.handleLimitedFunc(licenseRoutes, "/{key}/register", "register", apilsd.RegisterDevice).Methods("POST")
+		s.handleLimitedFunc(licenseRoutes, "/{key}/return", "return", apilsd.LendingReturn).Methods("PUT")
+		s.handleLimitedFunc(licenseRoutes, "/{key}/renew", "renew", apilsd.LendingRenewal).Methods("PUT")
+		s.handlePrivateFunc(licenseRoutes, "/{key}/status", apilsd.LendingCancellation, apikey.StatusAdmin, basicAuth).Methods("PATCH")
+		s.handlePrivateFunc(licenseRoutes, "/{key}/extend", apilsd.ExtendSubscription, apikey.StatusAdmin, basicAuth).Methods("PUT")
+		s.handlePrivateFunc(licenseRoutes, "/{key}/transfer", apilsd.TransferLicense, apikey.StatusAdmin, basicAuth).Methods("PUT")
+
+		s.handlePrivateFunc(sr.R, "/licenses", apilsd.CreateLicenseStatusDocument, apikey.StatusAdmin, basicAuth).Methods("PUT")
+		s.handlePrivateFunc(licenseRoutes, "/", apilsd.CreateLicenseStatusDocument, apikey.StatusAdmin, basicAuth).Methods("PUT")
+	}
 
-	s.handleFunc(licenseRoutes, "/{key}/status", apilsd.GetLicenseStatusDocument).Methods("GET")
-	s.handleFunc(licenseRoutes, "/{key}", apilsd.GetFreshLicense).Methods("GET")
+	// ODL licenses bought by libraries
+	odlRoutesPathPrefix := "/odl/licenses"
+	odlRoutes := sr.R.PathPrefix(odlRoutesPathPrefix).Subrouter().StrictSlash(false)
 
-	s.handlePrivateFunc(licenseRoutes, "/{key}/registered", apilsd.ListRegisteredDevices, basicAuth).Methods("GET")
+	s.handlePrivateFunc(odlRoutes, "/{key}", apilsd.GetODLLicenseInfo, apikey.StatusAdmin, basicAuth).Methods("GET")
 	if !readonly {
-		s.handleFunc(licenseRoutes, "/{key}/register", apilsd.RegisterDevice).Methods("POST")
-		s.handleFunc(licenseRoutes, "/{key}/return", apilsd.LendingReturn).Methods("PUT")
-		s.handleFunc(licenseRoutes, "/{key}/renew", apilsd.LendingRenewal).Methods("PUT")
-		s.handlePrivateFunc(licenseRoutes, "/{key}/status", apilsd.LendingCancellation, basicAuth).Methods("PATCH")
-		s.handlePrivateFunc(licenseRoutes, "/{key}/extend", apilsd.ExtendSubscription, basicAuth).Methods("PUT")
-
-		s.handlePrivateFunc(sr.R, "/licenses", apilsd.CreateLicenseStatusDocument, basicAuth).Methods("PUT")
-		s.handlePrivateFunc(licenseRoutes, "/", apilsd.CreateLicenseStatusDocument, basicAuth).Methods("PUT")
+		s.handlePrivateFunc(sr.R, odlRoutesPathPrefix, apilsd.AddODLLicense, apikey.StatusAdmin, basicAuth).Methods("PUT")
+		s.handlePrivateFunc(odlRoutes, "/{key}/checkout", apilsd.ODLCheckout, apikey.StatusAdmin, basicAuth).Methods("POST")
+		s.handlePrivateFunc(odlRoutes, "/{key}/checkouts/{checkout}/return", apilsd.ODLReturn, apikey.StatusAdmin, basicAuth).Methods("PUT")
 	}
 
 	// Utility methods
 
 	// License Count endpoint
-	s.handlePrivateFunc(sr.R, "/licensecount", apilsd.LicenseCount, basicAuth).Methods("GET")
+	s.handlePrivateFunc(sr.R, "/licensecount", apilsd.LicenseCount, apikey.ReportsRead, basicAuth).Methods("GET")
+
+	// License updates to the License Server, pending or dead-lettered
+	s.handlePrivateFunc(sr.R, "/outbox", apilsd.ListOutbox, apikey.ReportsRead, basicAuth).Methods("GET")
+
+	// Audit log of the changes
+	s.handlePrivateFunc(sr.R, "/audit", apilsd.ListAudit, apikey.AuditRead, basicAuth).Methods("GET")
 
 	return s
 }
@@ -99,12 +155,51 @@ func (s *Server) handleFunc(router *mux.Router, route string, fn HandlerFunc) *m
 	})
 }
 
+// handleLimitedFunc handles a public route whose requests are rejected with a 429 status
+// when the budget of the client ip or of the license is exhausted
+func (s *Server) handleLimitedFunc(router *mux.Router, route string, name string, fn HandlerFunc) *mux.Route {
+	return router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter != nil {
+			if wait := s.limiter.Wait(name, s.limiter.ClientIP(r), mux.Vars(r)["key"]); wait > 0 {
+				seconds := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				problem.Error(w, r, problem.Problem{MessageID: "rate.exceeded", Args: []interface{}{seconds}}, http.StatusTooManyRequests)
+				return
+			}
+		}
+		fn(w, r, s)
+	})
+}
+
 type HandlerPrivateFunc func(w http.ResponseWriter, r *http.Request, s apilsd.Server)
 
-func (s *Server) handlePrivateFunc(router *mux.Router, route string, fn HandlerPrivateFunc, authenticator *auth.BasicAuth) *mux.Route {
+// handlePrivateFunc checks the API key of the caller, which must grant the scope of the route,
+// or else its client certificate or its credentials, then records the changes made by the request in the audit log
+func (s *Server) handlePrivateFunc(router *mux.Router, route string, fn HandlerPrivateFunc, scope string, authenticator *auth.BasicAuth) *mux.Route {
 	return router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
-		if api.CheckAuth(authenticator, w, r) {
-			fn(w, r, s)
+		serve := func(principal string) {
+			audit.Handle(s.adt, principal, "", w, r, func(w http.ResponseWriter, r *http.Request) {
+				fn(w, r, s)
+			})
+		}
+		if key, found := api.CheckAPIKey(s.keys, scope, w, r); found {
+			if key == nil {
+				return
+			}
+			// the license statuses are not scoped to a tenant, so a key restricted to a tenant would give access to all of them
+			if key.Tenant != "" {
+				problem.Error(w, r, problem.Problem{Detail: "An API key restricted to a tenant is not accepted by the Status Server", Instance: key.Tenant}, http.StatusForbidden)
+				return
+			}
+			serve("apikey:" + key.ID)
+			return
+		}
+		if principal := mtls.Principal(r, config.Config.LsdServer.TLS.ClientNames); principal != "" {
+			serve(principal)
+			return
+		}
+		if user := api.CheckUser(authenticator, w, r); user != "" {
+			serve(user)
 		}
 	})
 }
@@ -26,8 +26,107 @@
 package lsdserver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/apikey"
+	"github.com/readium/readium-lcp-server/config"
+	apilsd "github.com/readium/readium-lcp-server/lsdserver/api"
 )
 
 func TestSetup(t *testing.T) {
 }
+
+func TestPrivateRouteScopes(t *testing.T) {
+	database := "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	keys, err := apikey.Open(db, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, token, err := apikey.New("reports", "", []string{apikey.ReportsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = keys.Add(k); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{keys: keys}
+	// htpasswd credentials: admin / password
+	basicAuth := auth.NewBasicAuthenticator("Basic Realm", func(user, realm string) string {
+		if user == "admin" {
+			return "$apr1$4vo4F6VH$qaU2bCJ.df7DUN93C.5qH."
+		}
+		return ""
+	})
+	router := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request, s apilsd.Server) {}
+	s.handlePrivateFunc(router, "/licensecount", ok, apikey.ReportsRead, basicAuth)
+	s.handlePrivateFunc(router, "/licenses/{key}/status", ok, apikey.StatusAdmin, basicAuth)
+
+	call := func(path string, authorization string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := call("/licensecount", "Bearer "+token); code != http.StatusOK {
+		t.Errorf("Expected an allowed scope, got %d", code)
+	}
+	if code := call("/licenses/l1/status", "Bearer "+token); code != http.StatusForbidden {
+		t.Errorf("Expected a missing scope, got %d", code)
+	}
+	// a key restricted to a tenant is rejected, as the license statuses are not scoped to a tenant
+	tk, ttoken, err := apikey.New("tenant", "acme", []string{apikey.StatusAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = keys.Add(tk); err != nil {
+		t.Fatal(err)
+	}
+	if code := call("/licenses/l1/status", "Bearer "+ttoken); code != http.StatusForbidden {
+		t.Errorf("Expected a rejected tenant key, got %d", code)
+	}
+	if code := call("/licensecount", "Bearer "+k.ID+".wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected an invalid key, got %d", code)
+	}
+	if code := call("/licensecount", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected missing credentials, got %d", code)
+	}
+	// htpasswd credentials give access to every route
+	if code := call("/licenses/l1/status", "Basic YWRtaW46cGFzc3dvcmQ="); code != http.StatusOK {
+		t.Errorf("Expected valid credentials, got %d", code)
+	}
+
+	// so does a verified client certificate with an accepted name
+	config.Config.LsdServer.TLS.ClientNames = []string{"lcp"}
+	defer func() { config.Config.LsdServer.TLS.ClientNames = nil }()
+	for name, expected := range map[string]int{"lcp": http.StatusOK, "frontend": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/licenses/l1/status", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		router.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Errorf("Expected %d for a client certificate of %s, got %d", expected, name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package mtls sets up the https listeners of the servers, the authentication of the callers of their
+// private routes by a client certificate, and the http clients the servers use to call each other,
+// which present a client certificate and verify the certificates of the other servers.
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// transport is shared by the internal http clients, see InitClient
+var transport http.RoundTripper = http.DefaultTransport
+
+// ServerConfig returns the tls configuration of an https listener, nil if https is not configured.
+// A client certificate is requested if client CAs are configured, but not required, as the public routes
+// and the callers using basic auth or an API key send none.
+func ServerConfig(c config.ServerTLS) (*tls.Config, error) {
+	if c.Cert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCA != "" {
+		if cfg.ClientCAs, err = loadPool(c.ClientCA); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// InitClient sets the certificate presented by the internal http clients and the CAs which verify the servers.
+// It must be called before the clients are created.
+func InitClient(c config.ClientTLS) error {
+	if c.Cert == "" && c.CA == "" {
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.PrivateKey)
+		if err != nil {
+			return err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CA != "" {
+		pool, err := loadPool(c.CA)
+		if err != nil {
+			return err
+		}
+		cfg.RootCAs = pool
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = cfg
+	transport = t
+	return nil
+}
+
+// Client returns an http client for the calls to the other servers
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no PEM certificate found in " + path)
+	}
+	return pool, nil
+}
+
+// Principal returns the name of the caller authenticated by a client certificate, prefixed with "cert:",
+// or an empty string if the request holds no verified certificate, or a certificate whose common name is not accepted
+func Principal(r *http.Request, names []string) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(names) == 0 {
+		return "cert:" + cn
+	}
+	for _, name := range names {
+		if name == cn {
+			return "cert:" + cn
+		}
+	}
+	return ""
+}
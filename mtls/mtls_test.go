@@ -0,0 +1,152 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// testPKI writes the certificates and private keys of a test CA, of a server and of a client in a directory
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	p := &testPKI{dir: t.TempDir()}
+	p.ca, p.caKey = p.issue(t, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return p
+}
+
+// issue creates a certificate signed by the CA, or self-signed if there is no CA yet
+func (p *testPKI) issue(t *testing.T, name string, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	template.SerialNumber = big.NewInt(p.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := p.ca, p.caKey
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.write(t, name+".pem", "CERTIFICATE", der)
+	p.write(t, name+"-key.pem", "EC PRIVATE KEY", keyDer)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func (p *testPKI) write(t *testing.T, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(p.path(name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+func TestMutualTLS(t *testing.T) {
+	defer func() { transport = http.DefaultTransport }()
+
+	p := newTestPKI(t)
+	p.issue(t, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "lcp"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	p.issue(t, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "lsd"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	if cfg, err := ServerConfig(config.ServerTLS{}); cfg != nil || err != nil {
+		t.Errorf("Expected no https listener, got %v, %v", cfg, err)
+	}
+	cfg, err := ServerConfig(config.ServerTLS{Cert: p.path("server.pem"), PrivateKey: p.path("server-key.pem"), ClientCA: p.path("ca.pem")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"lsd"}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, Principal(r, names))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func() string {
+		resp, err := Client(5 * time.Second).Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// the server is verified with the CA bundle, the client presents no certificate
+	if err = InitClient(config.ClientTLS{CA: p.path("ca.pem")}); err != nil {
+		t.Fatal(err)
+	}
+	if principal := get(); principal != "" {
+		t.Errorf("Expected an anonymous caller, got %q", principal)
+	}
+
+	if err = InitClient(config.ClientTLS{Cert: p.path("client.pem"), PrivateKey: p.path("client-key.pem"), CA: p.path("ca.pem")}); err != nil {
+		t.Fatal(err)
+	}
+	if principal := get(); principal != "cert:lsd" {
+		t.Errorf("Expected the caller to be authenticated by its certificate, got %q", principal)
+	}
+	// a certificate whose name is not accepted does not authenticate the caller
+	names = []string{"frontend"}
+	if principal := get(); principal != "" {
+		t.Errorf("Expected a rejected certificate, got %q", principal)
+	}
+
+	// the server is not trusted without the CA bundle
+	transport = http.DefaultTransport
+	if _, err = Client(5 * time.Second).Get(srv.URL); err == nil {
+		t.Error("Expected an unknown authority")
+	}
+}
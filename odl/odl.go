@@ -0,0 +1,122 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package odl manages the ODL (Open Distribution to Libraries) licenses bought by libraries.
+// An ODL license is a pool of loans of a publication, limited by its terms;
+// each checkout by a patron consumes the pool and gives the patron an LCP license.
+package odl
+
+import (
+	"errors"
+	"time"
+)
+
+// ODL license statuses, as exposed in license info documents
+const (
+	StatusAvailable   = "available"
+	StatusUnavailable = "unavailable"
+)
+
+// Terms are the terms of an ODL license
+type Terms struct {
+	// total number of checkouts, unlimited if nil
+	Checkouts *int `json:"checkouts,omitempty"`
+	// number of concurrent checkouts
+	Concurrency int `json:"concurrency"`
+	// expiration date of the ODL license, no checkout is possible after it
+	Expires *time.Time `json:"expires,omitempty"`
+	// maximum duration of a checkout, in seconds
+	Length int64 `json:"length,omitempty"`
+}
+
+// License is an ODL license, i.e. a pool of loans of a publication
+type License struct {
+	ID        string `json:"identifier"`
+	ContentID string `json:"content_id"`
+	Terms     Terms  `json:"terms"`
+	// number of checkouts left, unlimited if nil
+	CheckoutsLeft *int      `json:"-"`
+	Created       time.Time `json:"created"`
+	// Version is incremented by each checkout
+	Version int `json:"-"`
+}
+
+// Checkout is the loan of an ODL license to a patron
+type Checkout struct {
+	ID        string `json:"id"`
+	LicenseID string `json:"-"`
+	PatronID  string `json:"patron_id"`
+	// id of the LCP license generated for the patron, empty while it is generated
+	LicenseRef string    `json:"license_ref"`
+	End        time.Time `json:"end"`
+	Created    time.Time `json:"created"`
+}
+
+// Checkouts is the availability of an ODL license
+type Checkouts struct {
+	Left      *int `json:"left,omitempty"`
+	Available int  `json:"available"`
+}
+
+// Info is an ODL license info document
+type Info struct {
+	Identifier string    `json:"identifier"`
+	Status     string    `json:"status"`
+	Checkouts  Checkouts `json:"checkouts"`
+	Terms      Terms     `json:"terms"`
+	Created    time.Time `json:"created"`
+}
+
+// Validate checks the consistency of an ODL license
+func (l License) Validate() error {
+
+	if l.ID == "" || l.ContentID == "" {
+		return errors.New("the identifier and content id of an ODL license are mandatory")
+	}
+	if l.Terms.Concurrency <= 0 {
+		return errors.New("the concurrency of an ODL license must be positive")
+	}
+	if (l.Terms.Checkouts != nil && *l.Terms.Checkouts < 0) || l.Terms.Length < 0 {
+		return errors.New("the checkouts and length of an ODL license cannot be negative")
+	}
+	if l.Terms.Length == 0 && l.Terms.Expires == nil {
+		return errors.New("an ODL license needs a checkout length or an expiration date")
+	}
+	return nil
+}
+
+// Info returns the info document of an ODL license, given its count of active checkouts
+func (l License) Info(active int, now time.Time) Info {
+
+	info := Info{Identifier: l.ID, Status: StatusAvailable, Terms: l.Terms, Created: l.Created}
+	info.Checkouts.Left = l.CheckoutsLeft
+	if (l.CheckoutsLeft != nil && *l.CheckoutsLeft <= 0) || (l.Terms.Expires != nil && !now.Before(*l.Terms.Expires)) {
+		info.Status = StatusUnavailable
+		return info
+	}
+	if active < l.Terms.Concurrency {
+		info.Checkouts.Available = l.Terms.Concurrency - active
+	}
+	if l.CheckoutsLeft != nil && *l.CheckoutsLeft < info.Checkouts.Available {
+		info.Checkouts.Available = *l.CheckoutsLeft
+	}
+	return info
+}
+
+// LoanEnd returns the end of a checkout starting at a given date, limited by the terms of the ODL license
+// and by the end requested by the library, if not zero.
+func (l License) LoanEnd(start, requested time.Time) time.Time {
+
+	var end time.Time
+	if l.Terms.Length > 0 {
+		end = start.Add(time.Duration(l.Terms.Length) * time.Second)
+	}
+	if l.Terms.Expires != nil && (end.IsZero() || l.Terms.Expires.Before(end)) {
+		end = *l.Terms.Expires
+	}
+	if !requested.IsZero() && requested.Before(end) {
+		end = requested
+	}
+	return end.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package odl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.AddDate(0, 0, 30)
+	left := 3
+	l := License{ID: "odl1", ContentID: "c1", Terms: Terms{Concurrency: 2, Expires: &expires, Length: 14 * 86400}, CheckoutsLeft: &left}
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info := l.Info(1, now); info.Status != StatusAvailable || info.Checkouts.Available != 1 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	if info := l.Info(3, now); info.Checkouts.Available != 0 {
+		t.Errorf("Expected no available checkout, got %d", info.Checkouts.Available)
+	}
+	// the checkouts left limit the available checkouts
+	left = 1
+	if info := l.Info(0, now); info.Checkouts.Available != 1 {
+		t.Errorf("Expected a single available checkout, got %d", info.Checkouts.Available)
+	}
+	left = 0
+	if info := l.Info(0, now); info.Status != StatusUnavailable {
+		t.Errorf("Expected an unavailable license, got %s", info.Status)
+	}
+	left = 3
+	if info := l.Info(0, expires); info.Status != StatusUnavailable {
+		t.Errorf("Expected an expired license, got %s", info.Status)
+	}
+}
+
+func TestLoanEnd(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.AddDate(0, 0, 10)
+	l := License{Terms: Terms{Concurrency: 1, Length: 14 * 86400}}
+
+	if end := l.LoanEnd(now, time.Time{}); !end.Equal(now.AddDate(0, 0, 14)) {
+		t.Errorf("Expected the loan to last the checkout length, got %v", end)
+	}
+	if end := l.LoanEnd(now, now.AddDate(0, 0, 7)); !end.Equal(now.AddDate(0, 0, 7)) {
+		t.Errorf("Expected the requested end, got %v", end)
+	}
+	if end := l.LoanEnd(now, now.AddDate(0, 0, 20)); !end.Equal(now.AddDate(0, 0, 14)) {
+		t.Errorf("Expected the requested end to be limited, got %v", end)
+	}
+	// a loan ends with the ODL license
+	l.Terms.Expires = &expires
+	if end := l.LoanEnd(now, time.Time{}); !end.Equal(expires) {
+		t.Errorf("Expected the loan to end with the license, got %v", end)
+	}
+}
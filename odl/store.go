@@ -0,0 +1,201 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package odl
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+	"github.com/readium/readium-lcp-server/status"
+)
+
+// ErrNotFound signals an ODL license or checkout not found
+var ErrNotFound = errors.New("ODL license or checkout not found")
+
+// ErrConflict signals an ODL license modified since it was read
+var ErrConflict = errors.New("ODL license modified concurrently")
+
+// Store is the interface of the ODL license store
+type Store interface {
+	Add(l License) error
+	Get(id string) (License, error)
+	// Active counts the checkouts of an ODL license which are still running
+	Active(id string, now time.Time) (int, error)
+	// Checkout records a checkout and the count of checkouts left of an ODL license,
+	// if the license has not been modified since it was read
+	Checkout(l License, c Checkout) error
+	// Cancel removes a checkout whose LCP license could not be generated
+	Cancel(l License, checkoutID string) error
+	SetLicenseRef(id, checkoutID, licenseRef string) error
+	GetCheckout(id, checkoutID string) (Checkout, error)
+}
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+func query(q string) string {
+	return dbutils.GetParamQuery(config.Config.LsdServer.Database, q)
+}
+
+// Add inserts an ODL license; all its checkouts are left
+func (s *sqlStore) Add(l License) error {
+
+	_, err := s.db.Exec(query(`INSERT INTO odl_license (id, content_id, checkouts, concurrency, expires, length,
+	checkouts_left, created, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0)`),
+		l.ID, l.ContentID, l.Terms.Checkouts, l.Terms.Concurrency, l.Terms.Expires, l.Terms.Length,
+		l.Terms.Checkouts, time.Now().UTC().Truncate(time.Second))
+	return err
+}
+
+// Get returns an ODL license by id
+func (s *sqlStore) Get(id string) (License, error) {
+
+	var l License
+	row := s.db.QueryRow(query(`SELECT id, content_id, checkouts, concurrency, expires, length,
+	checkouts_left, created, version FROM odl_license WHERE id = ?`), id)
+	err := row.Scan(&l.ID, &l.ContentID, &l.Terms.Checkouts, &l.Terms.Concurrency, &l.Terms.Expires, &l.Terms.Length,
+		&l.CheckoutsLeft, &l.Created, &l.Version)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return l, err
+}
+
+// Active counts the running checkouts of an ODL license.
+// A checkout is running until the end of its LCP license, unless the license has been returned,
+// cancelled or revoked; the end of the checkout is used while the LCP license is generated.
+func (s *sqlStore) Active(id string, now time.Time) (int, error) {
+
+	// license statuses are stored as bit flags
+	ready, _ := status.SetStatus(status.STATUS_READY)
+	active, _ := status.SetStatus(status.STATUS_ACTIVE)
+	var count int
+	row := s.db.QueryRow(query(`SELECT COUNT(*) FROM odl_checkout c
+	LEFT JOIN license_status ls ON ls.license_ref = c.license_ref
+	WHERE c.odl_license_id = ? AND ((ls.id IS NULL AND c.loan_end > ?)
+	OR (ls.status IN (?, ?) AND (ls.rights_end IS NULL OR ls.rights_end > ?)))`),
+		id, now.UTC(), ready, active, now.UTC())
+	err := row.Scan(&count)
+	return count, err
+}
+
+// Checkout records a checkout in a transaction with the update of the ODL license
+func (s *sqlStore) Checkout(l License, c Checkout) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = s.update(tx, l)
+	if err == nil {
+		_, err = tx.Exec(query(`INSERT INTO odl_checkout (odl_license_id, id, patron_id, license_ref, loan_end, created)
+		VALUES (?, ?, ?, ?, ?, ?)`), l.ID, c.ID, c.PatronID, c.LicenseRef, c.End.UTC(), time.Now().UTC().Truncate(time.Second))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cancel removes a checkout and gives it back to the ODL license
+func (s *sqlStore) Cancel(l License, checkoutID string) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query("DELETE FROM odl_checkout WHERE odl_license_id = ? AND id = ?"), l.ID, checkoutID)
+	if err == nil {
+		_, err = tx.Exec(query(`UPDATE odl_license SET checkouts_left=checkouts_left+1, version=version+1
+		WHERE id = ? AND checkouts_left IS NOT NULL`), l.ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// update updates the checkouts left of an ODL license if its version has not changed
+func (s *sqlStore) update(tx *sql.Tx, l License) error {
+
+	result, err := tx.Exec(query("UPDATE odl_license SET checkouts_left=?, version=version+1 WHERE id=? AND version=?"),
+		l.CheckoutsLeft, l.ID, l.Version)
+	if err != nil {
+		return err
+	}
+	if r, _ := result.RowsAffected(); r == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// SetLicenseRef sets the id of the LCP license generated for a checkout
+func (s *sqlStore) SetLicenseRef(id, checkoutID, licenseRef string) error {
+
+	result, err := s.db.Exec(query("UPDATE odl_checkout SET license_ref=? WHERE odl_license_id=? AND id=?"),
+		licenseRef, id, checkoutID)
+	if err == nil {
+		if r, _ := result.RowsAffected(); r == 0 {
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+// GetCheckout returns a checkout of an ODL license
+func (s *sqlStore) GetCheckout(id, checkoutID string) (Checkout, error) {
+
+	var c Checkout
+	row := s.db.QueryRow(query(`SELECT odl_license_id, id, patron_id, license_ref, loan_end, created
+	FROM odl_checkout WHERE odl_license_id = ? AND id = ?`), id, checkoutID)
+	err := row.Scan(&c.LicenseID, &c.ID, &c.PatronID, &c.LicenseRef, &c.End, &c.Created)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return c, err
+}
+
+// Open creates the ODL license store in the database of the Status Server
+func Open(db *sql.DB) (Store, error) {
+
+	driver, _ := config.GetDatabase(config.Config.LsdServer.Database)
+
+	// if sqlite, create the ODL tables if they do not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite odl tables")
+			return nil, err
+		}
+	}
+	return &sqlStore{db}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS odl_license (" +
+	"id varchar(255) PRIMARY KEY," +
+	"content_id varchar(255) NOT NULL," +
+	"checkouts int DEFAULT NULL," +
+	"concurrency int NOT NULL," +
+	"expires datetime DEFAULT NULL," +
+	"length int NOT NULL DEFAULT 0," +
+	"checkouts_left int DEFAULT NULL," +
+	"created datetime NOT NULL," +
+	"version int NOT NULL DEFAULT 0);" +
+	"CREATE TABLE IF NOT EXISTS odl_checkout (" +
+	"odl_license_id varchar(255) NOT NULL," +
+	"id varchar(255) NOT NULL," +
+	"patron_id varchar(255) NOT NULL," +
+	"license_ref varchar(255) NOT NULL DEFAULT ''," +
+	"loan_end datetime NOT NULL," +
+	"created datetime NOT NULL," +
+	"PRIMARY KEY (odl_license_id, id));" +
+	"CREATE INDEX IF NOT EXISTS odl_checkout_license_ref_index ON odl_checkout (license_ref);"
@@ -0,0 +1,264 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package outbox makes the notifications between the License Server and the Status Server durable.
+// Notifications are recorded in an outbox table, then sent by a dispatcher which retries them
+// with an exponential backoff, until they are delivered or moved to the dead letters.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/mtls"
+)
+
+// Notification statuses
+const (
+	StatusPending = "pending"
+	StatusFailed  = "failed"
+)
+
+// Notification is an http request to another server
+type Notification struct {
+	ID          int64     `json:"id"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"-"`
+	Ref         string    `json:"ref"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+// NewNotification creates a notification with a json body.
+// ref is the id of the object concerned by the notification, a license id.
+func NewNotification(method, url, ref, contentType string, body interface{}) (Notification, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return Notification{}, err
+	}
+	return Notification{Method: method, URL: url, Ref: ref, ContentType: contentType, Body: data}, nil
+}
+
+// Outbox records notifications and dispatches them
+type Outbox struct {
+	Store
+	// Auth holds the credentials sent with every notification
+	Auth config.Auth
+	// MaxAttempts is the number of attempts before a notification is dead-lettered
+	MaxAttempts int
+	// MinDelay is the delay before the first retry, doubled at each attempt up to MaxDelay
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Done is called when a notification is delivered or dead-lettered,
+	// with the http status code of the last attempt, 0 if the server could not be reached
+	Done func(n Notification, code int)
+
+	client   *http.Client
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	running  atomic.Bool
+}
+
+// New creates an outbox with default retry settings: 12 attempts spread over about 8 hours
+func New(st Store, auth config.Auth) *Outbox {
+	return &Outbox{
+		Store:       st,
+		Auth:        auth,
+		MaxAttempts: 12,
+		MinDelay:    30 * time.Second,
+		MaxDelay:    2 * time.Hour,
+		client:      mtls.Client(10 * time.Second),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Send records a notification and wakes up the dispatcher
+func (o *Outbox) Send(n Notification) error {
+	err := o.Add(n)
+	if err == nil {
+		o.Wake()
+	}
+	return err
+}
+
+// Wake triggers a dispatch without waiting for the next tick
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches the notifications every interval, or when woken up, until the outbox is shut down
+func (o *Outbox) Run(interval time.Duration) {
+	o.running.Store(true)
+	defer close(o.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := o.Dispatch(); err != nil {
+			log.Println("Error dispatching notifications: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-o.wake:
+		case <-o.stop:
+			// flush the notifications recorded since the last dispatch
+			if err := o.Dispatch(); err != nil {
+				log.Println("Error dispatching notifications: " + err.Error())
+			}
+			return
+		}
+	}
+}
+
+// Shutdown stops the dispatcher after a last dispatch, or returns when the context is done.
+// The notifications which are not delivered stay in the outbox and are sent after the next start.
+func (o *Outbox) Shutdown(ctx context.Context) error {
+	o.stopOnce.Do(func() { close(o.stop) })
+	if !o.running.Load() {
+		return nil
+	}
+	select {
+	case <-o.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dispatch sends the notifications which are due
+func (o *Outbox) Dispatch() error {
+	// notifications retried during this dispatch are due after now
+	now := time.Now().UTC().Truncate(time.Second)
+	for {
+		due, err := o.Due(now, 100)
+		if err != nil {
+			return err
+		}
+		for _, n := range due {
+			// a notification being sent is not due before the end of the http timeout
+			ok, err := o.Claim(&n, now.Add(2*o.client.Timeout))
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err = o.dispatch(n); err != nil {
+					return err
+				}
+			}
+		}
+		if len(due) < 100 {
+			return nil
+		}
+	}
+}
+
+// dispatch sends a claimed notification and records the result
+func (o *Outbox) dispatch(n Notification) error {
+	code, err := o.deliver(n)
+	if err == nil {
+		if err = o.Delete(n.ID); err == nil && o.Done != nil {
+			o.Done(n, code)
+		}
+		return err
+	}
+	if code != 0 && !retryable(code) || n.Attempts >= o.MaxAttempts {
+		log.Println("Notification " + n.Method + " " + n.URL + " failed: " + err.Error())
+		if err = o.Fail(n.ID, err.Error()); err == nil && o.Done != nil {
+			o.Done(n, code)
+		}
+		return err
+	}
+	return o.Retry(n.ID, time.Now().UTC().Truncate(time.Second).Add(o.backoff(n.Attempts)), err.Error())
+}
+
+// deliver sends a notification and returns the http status code of the response
+func (o *Outbox) deliver(n Notification) (int, error) {
+	req, err := http.NewRequest(n.Method, n.URL, bytes.NewReader(n.Body))
+	if err != nil {
+		return 0, err
+	}
+	if o.Auth.Username != "" {
+		req.SetBasicAuth(o.Auth.Username, o.Auth.Password)
+	}
+	req.Header.Add("Content-Type", n.ContentType)
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.MinDelay
+	for i := 1; i < attempts && delay < o.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > o.MaxDelay {
+		delay = o.MaxDelay
+	}
+	if delay < time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
+// retryable indicates if a request may succeed later
+func retryable(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+// Report is a page of notifications, with the number of pending and failed notifications
+type Report struct {
+	Pending       int            `json:"pending"`
+	Failed        int            `json:"failed"`
+	Page          int            `json:"page"`
+	PerPage       int            `json:"per_page"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// Report returns a page of notifications with a given status, or of all notifications
+// if the status is empty; pages start at 1.
+func (o *Outbox) Report(status string, page, perPage int) (Report, error) {
+	report := Report{Page: page, PerPage: perPage, Notifications: make([]Notification, 0)}
+	var err error
+	if report.Pending, err = o.Count(StatusPending); err != nil {
+		return report, err
+	}
+	if report.Failed, err = o.Count(StatusFailed); err != nil {
+		return report, err
+	}
+	fn := o.List(status, page-1, perPage)
+	var n Notification
+	for n, err = fn(); err == nil; n, err = fn() {
+		report.Notifications = append(report.Notifications, n)
+	}
+	if err != ErrNotFound {
+		return report, err
+	}
+	return report, nil
+}
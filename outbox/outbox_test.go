@@ -0,0 +1,209 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func openTestOutbox(t *testing.T) (*Outbox, *sql.DB) {
+	database := "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	st, err := Open(db, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(st, config.Auth{Username: "user", Password: "pass"}), db
+}
+
+func TestDispatch(t *testing.T) {
+
+	codes := map[string]int{"/ok": http.StatusCreated, "/down": http.StatusServiceUnavailable, "/bad": http.StatusBadRequest}
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/ok" {
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+		}
+		w.WriteHeader(codes[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	ob, _ := openTestOutbox(t)
+	ob.MaxAttempts = 2
+	done := make(map[string]int)
+	ob.Done = func(n Notification, code int) {
+		done[n.Ref] = code
+	}
+	for _, path := range []string{"/ok", "/down", "/bad"} {
+		n, err := NewNotification("PUT", srv.URL+path, path, "application/json", map[string]string{"id": path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ob.Add(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ob.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	if done["/ok"] != http.StatusCreated || body != `{"id":"/ok"}` {
+		t.Errorf("Expected /ok to be delivered, got %d %s", done["/ok"], body)
+	}
+	if done["/bad"] != http.StatusBadRequest {
+		t.Errorf("Expected /bad to be dead-lettered, got %d", done["/bad"])
+	}
+	if _, ok := done["/down"]; ok {
+		t.Error("Expected /down to be retried")
+	}
+	report, err := ob.Report("", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pending != 1 || report.Failed != 1 || len(report.Notifications) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	pending := report.Notifications[0]
+	if pending.Ref != "/down" || pending.Attempts != 1 || pending.LastError == "" || !pending.NextAttempt.After(time.Now()) {
+		t.Errorf("Unexpected pending notification %+v", pending)
+	}
+
+	// the retry is not due yet
+	if err = ob.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ob.Count(StatusPending); n != 1 {
+		t.Errorf("Expected 1 pending notification, got %d", n)
+	}
+	// the last attempt dead-letters the notification
+	if err = ob.Retry(pending.ID, time.Now().Add(-time.Minute), pending.LastError); err != nil {
+		t.Fatal(err)
+	}
+	if err = ob.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	if done["/down"] != http.StatusServiceUnavailable {
+		t.Errorf("Expected /down to be dead-lettered, got %d", done["/down"])
+	}
+	if n, _ := ob.Count(StatusFailed); n != 2 {
+		t.Errorf("Expected 2 failed notifications, got %d", n)
+	}
+}
+
+func TestAddTx(t *testing.T) {
+
+	ob, db := openTestOutbox(t)
+	n := Notification{Method: "PUT", URL: "http://localhost/licenses", Ref: "l1", ContentType: "application/json"}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ob.AddTx(tx, n); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if count, _ := ob.Count(StatusPending); count != 0 {
+		t.Errorf("Expected no notification after a rollback, got %d", count)
+	}
+
+	tx, _ = db.Begin()
+	ob.AddTx(tx, n)
+	tx.Commit()
+	due, err := ob.Due(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Ref != "l1" {
+		t.Fatalf("Expected a due notification, got %v", due)
+	}
+	// a notification is claimed once
+	if ok, _ := ob.Claim(&due[0], time.Now().Add(time.Minute)); !ok || due[0].Attempts != 1 {
+		t.Error("Expected the notification to be claimed")
+	}
+	stale := due[0]
+	stale.Attempts = 0
+	if ok, _ := ob.Claim(&stale, time.Now().Add(time.Minute)); ok {
+		t.Error("Expected the notification to be already claimed")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	ob := New(nil, config.Auth{})
+	if d := ob.backoff(1); d != 30*time.Second {
+		t.Errorf("Unexpected first delay %v", d)
+	}
+	if d := ob.backoff(3); d != 2*time.Minute {
+		t.Errorf("Unexpected third delay %v", d)
+	}
+	if d := ob.backoff(20); d != ob.MaxDelay {
+		t.Errorf("Unexpected max delay %v", d)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ob, _ := openTestOutbox(t)
+	delivered := make(chan string, 2)
+	ob.Done = func(n Notification, code int) {
+		delivered <- n.Ref
+	}
+	add := func(ref string) {
+		n, err := NewNotification("PUT", srv.URL, ref, "application/json", map[string]string{"id": ref})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ob.Add(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add("first")
+	go ob.Run(time.Hour)
+	if ref := <-delivered; ref != "first" {
+		t.Fatalf("Unexpected notification %s", ref)
+	}
+
+	// a notification recorded without waking up the dispatcher is flushed by the shutdown
+	add("last")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ob.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ref := <-delivered:
+		if ref != "last" {
+			t.Errorf("Unexpected notification %s", ref)
+		}
+	default:
+		t.Error("Expected the last notification to be flushed")
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package outbox
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrNotFound signals a notification not found
+var ErrNotFound = errors.New("Notification not found")
+
+// Store is the interface of the outbox table
+type Store interface {
+	Add(n Notification) error
+	// AddTx records a notification in a transaction, i.e. only if the transaction is committed
+	AddTx(tx *sql.Tx, n Notification) error
+	Due(now time.Time, limit int) ([]Notification, error)
+	Claim(n *Notification, until time.Time) (bool, error)
+	Retry(id int64, next time.Time, lastErr string) error
+	Fail(id int64, lastErr string) error
+	Delete(id int64) error
+	// DeleteRef removes the notifications of an object, e.g. when they have been sent by other means
+	DeleteRef(ref string) error
+	// DeleteRefTx removes the notifications of an object in a transaction
+	DeleteRefTx(tx *sql.Tx, ref string) error
+	List(status string, page, perPage int) func() (Notification, error)
+	Count(status string) (int, error)
+}
+
+type sqlStore struct {
+	db       *sql.DB
+	database string
+}
+
+const insertQuery = `INSERT INTO outbox (method, url, content_type, body, ref, status, attempts, next_attempt, created)
+VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?)`
+
+func (s *sqlStore) insertArgs(n Notification) []interface{} {
+	now := time.Now().UTC().Truncate(time.Second)
+	return []interface{}{n.Method, n.URL, n.ContentType, string(n.Body), n.Ref, StatusPending, now, now}
+}
+
+// Add records a pending notification, ready to be sent
+func (s *sqlStore) Add(n Notification) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, insertQuery), s.insertArgs(n)...)
+	return err
+}
+
+// AddTx records a pending notification in a transaction
+func (s *sqlStore) AddTx(tx *sql.Tx, n Notification) error {
+	_, err := tx.Exec(dbutils.GetParamQuery(s.database, insertQuery), s.insertArgs(n)...)
+	return err
+}
+
+// Due returns the pending notifications whose next attempt is due, oldest first.
+// The rows are read entirely, so that they can be updated while being processed.
+func (s *sqlStore) Due(now time.Time, limit int) ([]Notification, error) {
+
+	query := `SELECT id, method, url, content_type, body, ref, status, attempts, next_attempt, last_error, created
+	FROM outbox WHERE status = ? AND next_attempt <= ? ORDER BY next_attempt, id`
+	driver, _ := config.GetDatabase(s.database)
+	if driver == "mssql" {
+		query += " OFFSET 0 ROWS FETCH NEXT ? ROWS ONLY"
+	} else {
+		query += " LIMIT ?"
+	}
+	rows, err := s.db.Query(dbutils.GetParamQuery(s.database, query), StatusPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Notification
+	for rows.Next() {
+		n, err := scan(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, n)
+	}
+	return due, rows.Err()
+}
+
+// Claim counts a new attempt of a notification and postpones the next one until a given time,
+// unless another dispatcher has claimed the notification meanwhile.
+func (s *sqlStore) Claim(n *Notification, until time.Time) (bool, error) {
+
+	result, err := s.db.Exec(dbutils.GetParamQuery(s.database, `UPDATE outbox SET attempts=attempts+1, next_attempt=?
+	WHERE id=? AND attempts=? AND status=?`), until.UTC(), n.ID, n.Attempts, StatusPending)
+	if err != nil {
+		return false, err
+	}
+	r, err := result.RowsAffected()
+	if err != nil || r == 0 {
+		return false, err
+	}
+	n.Attempts++
+	return true, nil
+}
+
+// Retry schedules the next attempt of a notification
+func (s *sqlStore) Retry(id int64, next time.Time, lastErr string) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "UPDATE outbox SET next_attempt=?, last_error=? WHERE id=?"),
+		next.UTC(), lastErr, id)
+	return err
+}
+
+// Fail moves a notification to the dead letters
+func (s *sqlStore) Fail(id int64, lastErr string) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "UPDATE outbox SET status=?, last_error=? WHERE id=?"),
+		StatusFailed, lastErr, id)
+	return err
+}
+
+// Delete removes a delivered notification
+func (s *sqlStore) Delete(id int64) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM outbox WHERE id=?"), id)
+	return err
+}
+
+// DeleteRef removes the pending notifications of an object
+func (s *sqlStore) DeleteRef(ref string) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM outbox WHERE ref=? AND status=?"), ref, StatusPending)
+	return err
+}
+
+// DeleteRefTx removes the pending notifications of an object in a transaction
+func (s *sqlStore) DeleteRefTx(tx *sql.Tx, ref string) error {
+	_, err := tx.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM outbox WHERE ref=? AND status=?"), ref, StatusPending)
+	return err
+}
+
+// List lists the notifications with a given status, or all notifications if the status is empty, oldest first.
+// The body of the notifications is not read.
+func (s *sqlStore) List(status string, page, perPage int) func() (Notification, error) {
+
+	query := "SELECT id, method, url, content_type, ref, status, attempts, next_attempt, last_error, created FROM outbox"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id"
+	driver, _ := config.GetDatabase(s.database)
+	if driver == "mssql" {
+		query += " OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+		args = append(args, page*perPage, perPage)
+	} else {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, perPage, page*perPage)
+	}
+	rows, err := s.db.Query(dbutils.GetParamQuery(s.database, query), args...)
+	if err != nil {
+		return func() (Notification, error) { return Notification{}, err }
+	}
+	return func() (Notification, error) {
+		var n Notification
+		var err error
+		if rows.Next() {
+			n, err = scan(rows, false)
+		} else {
+			rows.Close()
+			err = ErrNotFound
+		}
+		return n, err
+	}
+}
+
+// Count counts the notifications with a given status
+func (s *sqlStore) Count(status string) (int, error) {
+	var count int
+	row := s.db.QueryRow(dbutils.GetParamQuery(s.database, "SELECT COUNT(*) FROM outbox WHERE status = ?"), status)
+	err := row.Scan(&count)
+	return count, err
+}
+
+// scan reads a notification from a row, with or without its body
+func scan(rows *sql.Rows, withBody bool) (Notification, error) {
+	var n Notification
+	var body string
+	var lastErr sql.NullString
+	var err error
+	if withBody {
+		err = rows.Scan(&n.ID, &n.Method, &n.URL, &n.ContentType, &body, &n.Ref, &n.Status, &n.Attempts, &n.NextAttempt, &lastErr, &n.Created)
+		n.Body = []byte(body)
+	} else {
+		err = rows.Scan(&n.ID, &n.Method, &n.URL, &n.ContentType, &n.Ref, &n.Status, &n.Attempts, &n.NextAttempt, &lastErr, &n.Created)
+	}
+	n.LastError = lastErr.String
+	return n, err
+}
+
+// Open creates an outbox store in the database of a server,
+// whose connection string is used to adapt the queries to the driver
+func Open(db *sql.DB, database string) (Store, error) {
+
+	driver, _ := config.GetDatabase(database)
+
+	// if sqlite, create the outbox table if it does not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite outbox table")
+			return nil, err
+		}
+	}
+	return &sqlStore{db, database}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS outbox (" +
+	"id INTEGER PRIMARY KEY," +
+	"method varchar(16) NOT NULL," +
+	"url text NOT NULL," +
+	"content_type varchar(255) NOT NULL," +
+	"body text NOT NULL," +
+	"ref varchar(255) NOT NULL," +
+	"status varchar(16) NOT NULL," +
+	"attempts int NOT NULL DEFAULT 0," +
+	"next_attempt datetime NOT NULL," +
+	"last_error text DEFAULT NULL," +
+	"created datetime NOT NULL);" +
+	"CREATE INDEX IF NOT EXISTS outbox_status_index ON outbox (status, next_attempt);"
@@ -0,0 +1,591 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/readium/readium-lcp-server/rwpm"
+)
+
+// TrackListJSON and TrackListCSV are the names of the optional track lists
+// in a folder or zip of audio tracks
+const (
+	TrackListJSON = "tracks.json"
+	TrackListCSV  = "tracks.csv"
+)
+
+// audioTrack is an entry of a track list
+type audioTrack struct {
+	Href     string  `json:"href"`
+	Title    string  `json:"title,omitempty"`
+	Duration float32 `json:"duration,omitempty"`
+}
+
+// audiobookInfo is the content of a json track list.
+// A json track list may also be a simple array of tracks.
+type audiobookInfo struct {
+	Identifier  string       `json:"identifier,omitempty"`
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Published   string       `json:"published,omitempty"`
+	Language    []string     `json:"language,omitempty"`
+	Author      []string     `json:"author,omitempty"`
+	Narrator    []string     `json:"narrator,omitempty"`
+	Publisher   []string     `json:"publisher,omitempty"`
+	Subject     []string     `json:"subject,omitempty"`
+	Tracks      []audioTrack `json:"tracks"`
+}
+
+// ZipContent is the kind of content of a folder or zip, see InspectZip
+type ZipContent int
+
+const (
+	ZipUnknown ZipContent = iota
+	ZipAudioTracks
+	ZipPackage
+)
+
+// sourceFile is a file found in a folder or zip of audio tracks
+type sourceFile struct {
+	name string // path relative to the root of the folder or zip, with forward slashes
+	open func() (io.ReadCloser, error)
+}
+
+// isAudioTrack indicates if a file name has the extension of a supported audio track
+func isAudioTrack(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp3", ".m4a", ".m4b", ".mp4", ".aac":
+		return true
+	}
+	return false
+}
+
+// audioMediaType returns the media type of an audio track
+func audioMediaType(name string) string {
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".m4a", ".m4b", ".mp4":
+		return "audio/mp4"
+	default:
+		return getMediaType(ext)
+	}
+}
+
+// listSourceFiles lists the files of a folder or zip
+func listSourceFiles(inputPath string) ([]sourceFile, io.Closer, error) {
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []sourceFile
+	if info.IsDir() {
+		err = filepath.Walk(inputPath, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(inputPath, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, sourceFile{
+				name: filepath.ToSlash(rel),
+				open: func() (io.ReadCloser, error) { return os.Open(p) },
+			})
+			return nil
+		})
+		return files, nil, err
+	}
+
+	zr, err := zip.OpenReader(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range zr.File {
+		// filter directories and MacOS specific files
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX") {
+			continue
+		}
+		files = append(files, sourceFile{name: f.Name, open: f.Open})
+	}
+	return files, zr, nil
+}
+
+// InspectZip tells how a folder or zip is processed: ZipAudioTracks if it holds audio tracks and no manifest,
+// ZipPackage if it holds a Readium manifest, ZipUnknown otherwise
+func InspectZip(inputPath string) (ZipContent, error) {
+	files, closer, err := listSourceFiles(inputPath)
+	if err != nil {
+		return ZipUnknown, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	content := ZipUnknown
+	for _, f := range files {
+		if f.name == ManifestLocation {
+			return ZipPackage, nil
+		}
+		if isAudioTrack(f.name) {
+			content = ZipAudioTracks
+		}
+	}
+	return content, nil
+}
+
+// readTrackList reads a json or csv track list
+func readTrackList(f sourceFile) (audiobookInfo, error) {
+
+	var info audiobookInfo
+	r, err := f.open()
+	if err != nil {
+		return info, err
+	}
+	defer r.Close()
+
+	if path.Base(f.name) == TrackListJSON {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return info, err
+		}
+		// the track list is either an object or an array of tracks
+		if err = json.Unmarshal(data, &info); err != nil {
+			err = json.Unmarshal(data, &info.Tracks)
+		}
+		return info, err
+	}
+
+	// a csv track list has a header row with href, title and duration columns
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return info, err
+	}
+	if len(records) == 0 {
+		return info, errors.New("empty track list")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	hrefCol, ok := columns["href"]
+	if !ok {
+		return info, errors.New("missing href column in the track list")
+	}
+	for _, record := range records[1:] {
+		var track audioTrack
+		track.Href = strings.TrimSpace(record[hrefCol])
+		if i, ok := columns["title"]; ok && i < len(record) {
+			track.Title = strings.TrimSpace(record[i])
+		}
+		if i, ok := columns["duration"]; ok && i < len(record) && strings.TrimSpace(record[i]) != "" {
+			d, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 32)
+			if err != nil {
+				return info, fmt.Errorf("invalid duration for %s: %w", track.Href, err)
+			}
+			track.Duration = float32(d)
+		}
+		info.Tracks = append(info.Tracks, track)
+	}
+	return info, nil
+}
+
+// BuildRPFFromAudioTracks builds a Readium audiobook package (rwpp) from a folder or zip of audio tracks.
+// The order and titles of the tracks come from an optional track list (tracks.json or tracks.csv);
+// without a track list, every audio file is used, sorted by name.
+// Durations missing from the track list are probed from the audio files.
+// A file named cover.* (or else the first image found) is used as the cover.
+func BuildRPFFromAudioTracks(inputPath, rwppPath string) (RWPInfo, error) {
+
+	var rwpInfo RWPInfo
+
+	files, closer, err := listSourceFiles(inputPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	byName := make(map[string]sourceFile, len(files))
+	var info audiobookInfo
+	var cover *sourceFile
+	for i, f := range files {
+		byName[f.name] = f
+		base := path.Base(f.name)
+		switch {
+		case base == TrackListJSON || base == TrackListCSV:
+			info, err = readTrackList(f)
+			if err != nil {
+				return rwpInfo, fmt.Errorf("track list %s: %w", f.name, err)
+			}
+		case strings.HasPrefix(getMediaType(strings.ToLower(path.Ext(base))), "image/"):
+			if cover == nil || strings.HasPrefix(strings.ToLower(base), "cover.") {
+				cover = &files[i]
+			}
+		}
+	}
+
+	// without a track list, use every audio file
+	if len(info.Tracks) == 0 {
+		for _, f := range files {
+			if isAudioTrack(f.name) {
+				info.Tracks = append(info.Tracks, audioTrack{Href: f.name})
+			}
+		}
+		sort.Slice(info.Tracks, func(i, j int) bool { return info.Tracks[i].Href < info.Tracks[j].Href })
+	}
+	if len(info.Tracks) == 0 {
+		return rwpInfo, fmt.Errorf("no audio track found in %s", inputPath)
+	}
+
+	// build the reading order, probe missing durations
+	var manifest rwpm.Publication
+	var packaged []sourceFile
+	for _, track := range info.Tracks {
+		f, ok := byName[track.Href]
+		if !ok {
+			return rwpInfo, fmt.Errorf("track %s not found", track.Href)
+		}
+		if track.Duration == 0 {
+			track.Duration, err = probeFileDuration(f)
+			if err != nil {
+				log.Printf("Duration of %s unknown, %s", f.name, err.Error())
+			}
+		}
+		title := track.Title
+		if title == "" {
+			title = strings.TrimSuffix(path.Base(f.name), path.Ext(f.name))
+		}
+		packaged = append(packaged, f)
+		manifest.ReadingOrder = append(manifest.ReadingOrder, rwpm.Link{
+			Href:     hrefFromPath(f.name),
+			Type:     audioMediaType(f.name),
+			Title:    title,
+			Duration: track.Duration,
+		})
+		manifest.Metadata.Duration += track.Duration
+	}
+	if cover != nil {
+		packaged = append(packaged, *cover)
+		manifest.Resources = append(manifest.Resources, rwpm.Link{
+			Href: hrefFromPath(cover.name),
+			Type: getMediaType(strings.ToLower(path.Ext(cover.name))),
+			Rel:  rwpm.MultiString{"cover"},
+		})
+	}
+
+	// set the metadata
+	manifest.Context = "https://readium.org/webpub-manifest/context.jsonld"
+	manifest.Metadata.Type = "https://schema.org/Audiobook"
+	manifest.Metadata.ConformsTo = "https://readium.org/webpub-manifest/profiles/audiobook"
+	if info.Identifier == "" {
+		info.Identifier, _ = newUUID()
+	}
+	manifest.Metadata.Identifier = info.Identifier
+	if info.Title == "" {
+		info.Title = strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	}
+	manifest.Metadata.Title.SetDefault(info.Title)
+	manifest.Metadata.Description = info.Description
+	manifest.Metadata.Language = info.Language
+	for _, name := range info.Author {
+		manifest.Metadata.Author.AddName(name)
+	}
+	for _, name := range info.Narrator {
+		manifest.Metadata.Narrator.AddName(name)
+	}
+	for _, name := range info.Publisher {
+		manifest.Metadata.Publisher.AddName(name)
+	}
+	for _, name := range info.Subject {
+		manifest.Metadata.Subject = append(manifest.Metadata.Subject, rwpm.Subject{Name: name})
+	}
+	if info.Published != "" {
+		var published rwpm.Date
+		if err = published.UnmarshalJSON([]byte(strconv.Quote(info.Published))); err == nil {
+			manifest.Metadata.Published = &published
+		}
+	}
+
+	// set some RWPInfo fields from the manifest
+	rwpInfo.UUID = manifest.Metadata.Identifier
+	rwpInfo.Title = info.Title
+	rwpInfo.Date = info.Published
+	rwpInfo.Description = info.Description
+	rwpInfo.Language = info.Language
+	rwpInfo.Publisher = info.Publisher
+	rwpInfo.Author = info.Author
+	rwpInfo.Subject = info.Subject
+	rwpInfo.Duration = manifest.Metadata.Duration
+
+	// marshal the Readium manifest
+	rwpJSON, err := json.MarshalIndent(manifest, "", " ")
+	if err != nil {
+		return rwpInfo, err
+	}
+
+	// create the rwpp file
+	rwppFile, err := os.Create(rwppPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	defer rwppFile.Close()
+
+	zipWriter := zip.NewWriter(rwppFile)
+	defer zipWriter.Close()
+
+	man, err := zipWriter.Create(RWPManifestName)
+	if err != nil {
+		return rwpInfo, err
+	}
+	if _, err = man.Write(rwpJSON); err != nil {
+		return rwpInfo, err
+	}
+
+	// audio and image files are already compressed, they are stored as-is
+	for _, f := range packaged {
+		err = copySourceFile(zipWriter, f)
+		if err != nil {
+			return rwpInfo, err
+		}
+	}
+	return rwpInfo, nil
+}
+
+// hrefFromPath escapes a file path for use as an href in a Readium manifest
+func hrefFromPath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		// hrefs are unescaped as query strings by the package reader
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+// copySourceFile stores a source file in a zip
+func copySourceFile(zipWriter *zip.Writer, f sourceFile) error {
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	reader, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(writer, reader)
+	return err
+}
+
+// probeFileDuration returns the duration in seconds of an audio file
+func probeFileDuration(f sourceFile) (float32, error) {
+	r, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return probeDuration(f.name, r)
+}
+
+// probeDuration returns the duration in seconds of an MP3 or MPEG-4 audio stream
+func probeDuration(name string, r io.Reader) (float32, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp3":
+		return mp3Duration(r)
+	case ".m4a", ".m4b", ".mp4":
+		return mp4Duration(r)
+	}
+	return 0, errors.New("unsupported audio format")
+}
+
+// MPEG audio bitrates in kbps, indexed by [MPEG1 or MPEG2/2.5][layer I, II, III][bitrate index]
+var mp3Bitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// MPEG audio sample rates, indexed by [MPEG1, MPEG2, MPEG2.5][sample rate index]
+var mp3SampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// mp3FrameInfo decodes an MPEG audio frame header.
+// It returns the frame length in bytes, its number of samples and its sample rate,
+// or a zero length if the input is not a valid header.
+func mp3FrameInfo(h []byte) (length, samples, rate int) {
+
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return
+	}
+	version := (h[1] >> 3) & 0x03 // 0: MPEG2.5, 1: reserved, 2: MPEG2, 3: MPEG1
+	layer := (h[1] >> 1) & 0x03   // 1: layer III, 2: layer II, 3: layer I
+	bitrateIndex := h[2] >> 4
+	rateIndex := (h[2] >> 2) & 0x03
+	padding := int(h[2]>>1) & 0x01
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return
+	}
+
+	v, sr := 0, 0 // MPEG1
+	if version == 2 {
+		v, sr = 1, 1
+	} else if version == 0 {
+		v, sr = 1, 2
+	}
+	l := 3 - int(layer) // 0: layer I, 1: layer II, 2: layer III
+	bitrate := mp3Bitrates[v][l][bitrateIndex] * 1000
+	rate = mp3SampleRates[sr][rateIndex]
+
+	switch {
+	case l == 0:
+		samples = 384
+		length = (12*bitrate/rate + padding) * 4
+	case l == 2 && v == 1:
+		samples = 576
+		length = 72*bitrate/rate + padding
+	default:
+		samples = 1152
+		length = 144*bitrate/rate + padding
+	}
+	return
+}
+
+// mp3Duration computes the duration of an MP3 stream by reading every frame header,
+// which gives an exact result for variable bitrate files.
+func mp3Duration(r io.Reader) (float32, error) {
+
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	// skip an ID3v2 tag
+	head, err := br.Peek(10)
+	if err == nil && string(head[:3]) == "ID3" {
+		size := int(head[6]&0x7f)<<21 | int(head[7]&0x7f)<<14 | int(head[8]&0x7f)<<7 | int(head[9]&0x7f)
+		if head[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		if _, err = br.Discard(10 + size); err != nil {
+			return 0, err
+		}
+	}
+
+	var seconds float64
+	frames := 0
+	for {
+		h, err := br.Peek(4)
+		if err != nil {
+			break
+		}
+		length, samples, rate := mp3FrameInfo(h)
+		if length == 0 {
+			// not a frame header, resync
+			br.Discard(1)
+			continue
+		}
+		seconds += float64(samples) / float64(rate)
+		frames++
+		if _, err = br.Discard(length); err != nil {
+			break
+		}
+	}
+	if frames == 0 {
+		return 0, errors.New("no mp3 frame found")
+	}
+	return float32(seconds), nil
+}
+
+// mp4Duration reads the duration of an MPEG-4 stream from its movie header box (moov/mvhd)
+func mp4Duration(r io.Reader) (float32, error) {
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, errors.New("no mvhd box found")
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4])) - 8
+		boxType := string(header[4:8])
+		if size == -7 {
+			// 64 bits box size
+			if _, err := io.ReadFull(r, header); err != nil {
+				return 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(header)) - 16
+		}
+		switch boxType {
+		case "moov":
+			// the movie header is a child of the movie box
+			continue
+		case "mvhd":
+			return parseMvhd(io.LimitReader(r, size))
+		}
+		if size < 0 {
+			return 0, errors.New("no mvhd box found")
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parseMvhd extracts the duration from the content of a movie header box
+func parseMvhd(r io.Reader) (float32, error) {
+
+	var version [4]byte // version and flags
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return 0, err
+	}
+	var timescale uint32
+	var duration uint64
+	if version[0] == 1 {
+		var box struct {
+			Creation, Modification uint64
+			Timescale              uint32
+			Duration               uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &box); err != nil {
+			return 0, err
+		}
+		timescale, duration = box.Timescale, box.Duration
+	} else {
+		var box struct {
+			Creation, Modification uint32
+			Timescale              uint32
+			Duration               uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &box); err != nil {
+			return 0, err
+		}
+		timescale, duration = box.Timescale, uint64(box.Duration)
+	}
+	if timescale == 0 {
+		return 0, errors.New("invalid mvhd timescale")
+	}
+	return float32(float64(duration) / float64(timescale)), nil
+}
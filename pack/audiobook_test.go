@@ -0,0 +1,203 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sampleMP3 generates an MP3 stream made of silent MPEG1 layer III frames, 128 kbps, 44.1 kHz,
+// preceded by an ID3v2 tag
+func sampleMP3(frames int) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 10})
+	buf.Write(make([]byte, 10))
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+// sampleM4A generates a minimal MPEG-4 stream with a movie header
+func sampleM4A(timescale, duration uint32) []byte {
+	var mvhd bytes.Buffer
+	binary.Write(&mvhd, binary.BigEndian, uint32(108))
+	mvhd.WriteString("mvhd")
+	mvhd.Write(make([]byte, 12)) // version, flags, creation and modification times
+	binary.Write(&mvhd, binary.BigEndian, timescale)
+	binary.Write(&mvhd, binary.BigEndian, duration)
+	mvhd.Write(make([]byte, 80))
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(16))
+	buf.WriteString("ftypM4A ")
+	buf.Write(make([]byte, 4))
+	binary.Write(&buf, binary.BigEndian, uint32(8+mvhd.Len()))
+	buf.WriteString("moov")
+	buf.Write(mvhd.Bytes())
+	return buf.Bytes()
+}
+
+func TestProbeDuration(t *testing.T) {
+
+	d, err := probeDuration("track.mp3", bytes.NewReader(sampleMP3(100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(d)-100*1152/44100.0) > 0.001 {
+		t.Errorf("unexpected mp3 duration %f", d)
+	}
+
+	d, err = probeDuration("track.m4a", bytes.NewReader(sampleM4A(1000, 61500)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 61.5 {
+		t.Errorf("unexpected m4a duration %f", d)
+	}
+
+	_, err = probeDuration("track.mp3", bytes.NewReader([]byte("not an mp3")))
+	if err == nil {
+		t.Error("expected an error on an invalid mp3")
+	}
+}
+
+func TestBuildRPFFromAudioTracksFolder(t *testing.T) {
+
+	dir := filepath.Join(t.TempDir(), "My Audiobook")
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "track1.mp3"), sampleMP3(100), 0644)
+	os.WriteFile(filepath.Join(dir, "track2.m4a"), sampleM4A(1000, 61500), 0644)
+	os.WriteFile(filepath.Join(dir, "cover.jpg"), []byte("jpeg"), 0644)
+	os.WriteFile(filepath.Join(dir, TrackListCSV), []byte("href,title,duration\ntrack2.m4a,Chapter B,\ntrack1.mp3,Chapter A,30\n"), 0644)
+
+	rwppPath := filepath.Join(t.TempDir(), "book.audiobook")
+	info, err := BuildRPFFromAudioTracks(dir, rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "My Audiobook" {
+		t.Errorf("unexpected title %s", info.Title)
+	}
+	if info.Duration != 91.5 {
+		t.Errorf("unexpected total duration %f", info.Duration)
+	}
+
+	reader, err := OpenRPF(rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.ConformsTo() != "https://readium.org/webpub-manifest/profiles/audiobook" {
+		t.Errorf("unexpected profile %s", reader.ConformsTo())
+	}
+	ro := reader.manifest.ReadingOrder
+	if len(ro) != 2 || ro[0].Href != "track2.m4a" || ro[0].Title != "Chapter B" || ro[0].Type != "audio/mp4" || ro[0].Duration != 61.5 {
+		t.Errorf("unexpected first track %+v", ro)
+	}
+	if ro[1].Duration != 30 || ro[1].Type != "audio/mpeg" {
+		t.Errorf("unexpected second track %+v", ro[1])
+	}
+	coverHref, err := reader.ExtractCoverHref()
+	if err != nil || coverHref != "cover.jpg" {
+		t.Errorf("unexpected cover %s", coverHref)
+	}
+	// the track list is not part of the package
+	if len(reader.zipArchive.File) != 4 {
+		t.Errorf("expected 4 files in the package, got %d", len(reader.zipArchive.File))
+	}
+}
+
+func TestBuildRPFFromAudioTracksZip(t *testing.T) {
+
+	zipPath := filepath.Join(t.TempDir(), "tracks.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"audio/01.mp3":  sampleMP3(50),
+		"audio/0 2.mp3": sampleMP3(50),
+		TrackListJSON:   []byte(`{"title":"Zipped","author":["Alpha"],"narrator":["Beta"],"tracks":[{"href":"audio/01.mp3","title":"One"},{"href":"audio/0 2.mp3"}]}`),
+	} {
+		w, _ := zw.Create(name)
+		w.Write(data)
+	}
+	zw.Close()
+	f.Close()
+
+	rwppPath := filepath.Join(t.TempDir(), "book.audiobook")
+	info, err := BuildRPFFromAudioTracks(zipPath, rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Zipped" || len(info.Author) != 1 || info.Author[0] != "Alpha" {
+		t.Errorf("unexpected metadata %+v", info)
+	}
+	if math.Abs(float64(info.Duration)-100*1152/44100.0) > 0.001 {
+		t.Errorf("unexpected total duration %f", info.Duration)
+	}
+
+	reader, err := OpenRPF(rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.manifest.Metadata.Narrator.Name() != "Beta" {
+		t.Error("narrator badly mapped")
+	}
+	if reader.manifest.ReadingOrder[1].Title != "0 2" || reader.manifest.ReadingOrder[1].Href != "audio/0%202.mp3" {
+		t.Errorf("unexpected second track %+v", reader.manifest.ReadingOrder[1])
+	}
+	if len(reader.Resources()) != 2 {
+		t.Errorf("expected 2 resources, got %d", len(reader.Resources()))
+	}
+}
+
+func TestInspectZip(t *testing.T) {
+
+	write := func(files map[string][]byte) string {
+		zipPath := filepath.Join(t.TempDir(), "input.zip")
+		f, err := os.Create(zipPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for name, data := range files {
+			w, _ := zw.Create(name)
+			w.Write(data)
+		}
+		zw.Close()
+		f.Close()
+		return zipPath
+	}
+
+	for _, c := range []struct {
+		name     string
+		files    map[string][]byte
+		expected ZipContent
+	}{
+		{"audio tracks", map[string][]byte{"01.mp3": sampleMP3(10), "cover.jpg": []byte("jpg")}, ZipAudioTracks},
+		{"package", map[string][]byte{ManifestLocation: []byte("{}"), "01.mp3": sampleMP3(10)}, ZipPackage},
+		{"images", map[string][]byte{"page1.jpg": []byte("jpg")}, ZipUnknown},
+	} {
+		content, err := InspectZip(write(c.files))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != c.expected {
+			t.Errorf("%s: expected %d, got %d", c.name, c.expected, content)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/readium/readium-lcp-server/rwpm"
+)
+
+// ComicInfoName is the name of the optional metadata file of a CBZ archive
+const ComicInfoName = "ComicInfo.xml"
+
+// DivinaProfile is the conformance profile of a Readium Divina manifest
+const DivinaProfile = "https://readium.org/webpub-manifest/profiles/divina"
+
+// comicInfo is the subset of the ComicInfo.xml schema used for building a Divina manifest
+type comicInfo struct {
+	Title       string `xml:"Title"`
+	Series      string `xml:"Series"`
+	Number      string `xml:"Number"`
+	Summary     string `xml:"Summary"`
+	Year        int    `xml:"Year"`
+	Month       int    `xml:"Month"`
+	Day         int    `xml:"Day"`
+	Writer      string `xml:"Writer"`
+	Penciller   string `xml:"Penciller"`
+	Inker       string `xml:"Inker"`
+	Colorist    string `xml:"Colorist"`
+	Letterer    string `xml:"Letterer"`
+	CoverArtist string `xml:"CoverArtist"`
+	Editor      string `xml:"Editor"`
+	Translator  string `xml:"Translator"`
+	Publisher   string `xml:"Publisher"`
+	Imprint     string `xml:"Imprint"`
+	Genre       string `xml:"Genre"`
+	Tags        string `xml:"Tags"`
+	LanguageISO string `xml:"LanguageISO"`
+	GTIN        string `xml:"GTIN"`
+	Manga       string `xml:"Manga"`
+	Pages       []struct {
+		Image int    `xml:"Image,attr"`
+		Type  string `xml:"Type,attr"`
+	} `xml:"Pages>Page"`
+}
+
+// splitNames splits a comma separated list of names, as used in ComicInfo.xml
+func splitNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isImage indicates if a file name has the extension of a supported image
+func isImage(name string) bool {
+	return strings.HasPrefix(getMediaType(strings.ToLower(path.Ext(name))), "image/")
+}
+
+// naturalLess compares two file names, numbers being compared by value (page2 < page10)
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ra, rb := rune(a[0]), rune(b[0])
+		if unicode.IsDigit(ra) && unicode.IsDigit(rb) {
+			na, nb := leadingDigits(a), leadingDigits(b)
+			ia, _ := strconv.Atoi(na)
+			ib, _ := strconv.Atoi(nb)
+			if ia != ib {
+				return ia < ib
+			}
+			a, b = a[len(na):], b[len(nb):]
+			continue
+		}
+		la, lb := unicode.ToLower(ra), unicode.ToLower(rb)
+		if la != lb {
+			return la < lb
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingDigits returns the digits at the start of a string
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// imageDimensions returns the width and height of an image, without decoding it entirely
+func imageDimensions(r io.Reader) (int, int, error) {
+	config, _, err := image.DecodeConfig(r)
+	return config.Width, config.Height, err
+}
+
+// BuildRPFFromCBZ builds a Readium Divina package (rwpp) from a CBZ archive.
+// Images form the reading order, sorted by name; their dimensions are set when the format is supported.
+// The cover is the page flagged as FrontCover in ComicInfo.xml, or else the first page.
+// Metadata and reading progression come from ComicInfo.xml when present.
+func BuildRPFFromCBZ(cbzPath, rwppPath string) (RWPInfo, error) {
+
+	var rwpInfo RWPInfo
+
+	zr, err := zip.OpenReader(cbzPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	defer zr.Close()
+
+	var pages []*zip.File
+	var info comicInfo
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX") {
+			continue
+		}
+		if path.Base(f.Name) == ComicInfoName {
+			r, err := f.Open()
+			if err != nil {
+				return rwpInfo, err
+			}
+			err = xml.NewDecoder(r).Decode(&info)
+			r.Close()
+			if err != nil {
+				// ComicInfo is optional, a malformed one is ignored
+				log.Printf("Error reading %s, %s", ComicInfoName, err.Error())
+				info = comicInfo{}
+			}
+			continue
+		}
+		if isImage(f.Name) {
+			pages = append(pages, f)
+		}
+	}
+	if len(pages) == 0 {
+		return rwpInfo, fmt.Errorf("no image found in %s", cbzPath)
+	}
+	sort.Slice(pages, func(i, j int) bool { return naturalLess(pages[i].Name, pages[j].Name) })
+
+	// the cover is the first page, unless ComicInfo flags another one
+	coverIndex := 0
+	for _, p := range info.Pages {
+		if p.Type == "FrontCover" && p.Image >= 0 && p.Image < len(pages) {
+			coverIndex = p.Image
+			break
+		}
+	}
+
+	var manifest rwpm.Publication
+	for i, f := range pages {
+		link := rwpm.Link{
+			Href: hrefFromPath(f.Name),
+			Type: getMediaType(strings.ToLower(path.Ext(f.Name))),
+		}
+		r, err := f.Open()
+		if err != nil {
+			return rwpInfo, err
+		}
+		link.Width, link.Height, err = imageDimensions(r)
+		r.Close()
+		if err != nil {
+			log.Printf("Dimensions of %s unknown, %s", f.Name, err.Error())
+		}
+		if i == coverIndex {
+			link.Rel = rwpm.MultiString{"cover"}
+		}
+		manifest.ReadingOrder = append(manifest.ReadingOrder, link)
+	}
+
+	// set the metadata
+	manifest.Context = "https://readium.org/webpub-manifest/context.jsonld"
+	manifest.Metadata.Type = "http://schema.org/ComicStory"
+	manifest.Metadata.ConformsTo = DivinaProfile
+	if info.GTIN != "" {
+		manifest.Metadata.Identifier = "urn:isbn:" + info.GTIN
+	} else {
+		manifest.Metadata.Identifier, _ = newUUID()
+	}
+	title := info.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(cbzPath), filepath.Ext(cbzPath))
+	}
+	manifest.Metadata.Title.SetDefault(title)
+	manifest.Metadata.Description = info.Summary
+	manifest.Metadata.NumberOfPages = len(pages)
+	if info.LanguageISO != "" {
+		manifest.Metadata.Language = rwpm.MultiString{info.LanguageISO}
+	}
+	manifest.Metadata.ReadingProgression = "ltr"
+	if info.Manga == "YesAndRightToLeft" {
+		manifest.Metadata.ReadingProgression = "rtl"
+	}
+	if info.Year > 0 {
+		month, day := info.Month, info.Day
+		if month == 0 {
+			month = 1
+		}
+		if day == 0 {
+			day = 1
+		}
+		published := rwpm.Date(time.Date(info.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC))
+		manifest.Metadata.Published = &published
+	}
+	if info.Series != "" {
+		series := rwpm.Collection{Name: info.Series}
+		if position, err := strconv.ParseFloat(info.Number, 32); err == nil {
+			series.Position = float32(position)
+		}
+		manifest.Metadata.BelongsTo = &rwpm.BelongsTo{Series: []rwpm.Collection{series}}
+	}
+	contributors := []struct {
+		list string
+		ctor *rwpm.Contributors
+	}{
+		{info.Writer, &manifest.Metadata.Author},
+		{info.Penciller, &manifest.Metadata.Penciler},
+		{info.Inker, &manifest.Metadata.Inker},
+		{info.Colorist, &manifest.Metadata.Colorist},
+		{info.Letterer, &manifest.Metadata.Letterer},
+		{info.CoverArtist, &manifest.Metadata.Artist},
+		{info.Editor, &manifest.Metadata.Editor},
+		{info.Translator, &manifest.Metadata.Translator},
+		{info.Publisher, &manifest.Metadata.Publisher},
+		{info.Imprint, &manifest.Metadata.Imprint},
+	}
+	for _, c := range contributors {
+		for _, name := range splitNames(c.list) {
+			c.ctor.AddName(name)
+		}
+	}
+	for _, name := range append(splitNames(info.Genre), splitNames(info.Tags)...) {
+		manifest.Metadata.Subject = append(manifest.Metadata.Subject, rwpm.Subject{Name: name})
+	}
+
+	// set some RWPInfo fields from the manifest
+	rwpInfo.UUID = manifest.Metadata.Identifier
+	rwpInfo.Title = title
+	if manifest.Metadata.Published != nil {
+		rwpInfo.Date = manifest.Metadata.Published.String()
+	}
+	rwpInfo.Description = info.Summary
+	rwpInfo.Language = manifest.Metadata.Language
+	rwpInfo.Publisher = splitNames(info.Publisher)
+	rwpInfo.Author = splitNames(info.Writer)
+	for _, s := range manifest.Metadata.Subject {
+		rwpInfo.Subject = append(rwpInfo.Subject, s.Name)
+	}
+	rwpInfo.NumPages = len(pages)
+
+	// marshal the Readium manifest
+	rwpJSON, err := json.MarshalIndent(manifest, "", " ")
+	if err != nil {
+		return rwpInfo, err
+	}
+
+	// create the rwpp file
+	rwppFile, err := os.Create(rwppPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	defer rwppFile.Close()
+
+	zipWriter := zip.NewWriter(rwppFile)
+	defer zipWriter.Close()
+
+	man, err := zipWriter.Create(RWPManifestName)
+	if err != nil {
+		return rwpInfo, err
+	}
+	if _, err = man.Write(rwpJSON); err != nil {
+		return rwpInfo, err
+	}
+
+	// images are already compressed, they are stored as-is
+	for _, f := range pages {
+		err = copySourceFile(zipWriter, sourceFile{name: f.Name, open: f.Open})
+		if err != nil {
+			return rwpInfo, err
+		}
+	}
+	return rwpInfo, nil
+}
+
+// BuildRPFFromDivinaManifest builds a Readium Divina package (rwpp) from a standalone Divina manifest,
+// or from a folder holding a manifest.json. The resources of the reading order and resources must be
+// files relative to the manifest; the links with a relative href (e.g. a cover) are packaged as well.
+// The manifest is stored as-is, the missing image dimensions are set when the package is encrypted.
+func BuildRPFFromDivinaManifest(manifestPath, rwppPath string) (RWPInfo, error) {
+
+	var rwpInfo RWPInfo
+
+	if info, err := os.Stat(manifestPath); err == nil && info.IsDir() {
+		manifestPath = filepath.Join(manifestPath, RWPManifestName)
+	}
+	rwpJSON, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	var manifest rwpm.Publication
+	if err = json.Unmarshal(rwpJSON, &manifest); err != nil {
+		return rwpInfo, err
+	}
+	if manifest.Metadata.ConformsTo != DivinaProfile {
+		return rwpInfo, fmt.Errorf("%s is not a Divina manifest", manifestPath)
+	}
+	if len(manifest.ReadingOrder) == 0 {
+		return rwpInfo, fmt.Errorf("no reading order in %s", manifestPath)
+	}
+
+	// list the local files of the publication, once each
+	dir := filepath.Dir(manifestPath)
+	var files []sourceFile
+	seen := make(map[string]bool)
+	add := func(link rwpm.Link, mandatory bool) error {
+		u, err := url.Parse(link.Href)
+		if err != nil {
+			return err
+		}
+		if u.IsAbs() || u.Host != "" || path.IsAbs(u.Path) {
+			if mandatory {
+				return fmt.Errorf("the resource %s is not relative to the manifest", link.Href)
+			}
+			return nil
+		}
+		name := path.Clean(u.Path)
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("the resource %s is outside of the folder of the manifest", link.Href)
+		}
+		if seen[name] || name == RWPManifestName {
+			return nil
+		}
+		seen[name] = true
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(p); err != nil {
+			return err
+		}
+		files = append(files, sourceFile{name: name, open: func() (io.ReadCloser, error) { return os.Open(p) }})
+		return nil
+	}
+	for _, link := range append(manifest.ReadingOrder, manifest.Resources...) {
+		if err = add(link, true); err != nil {
+			return rwpInfo, err
+		}
+	}
+	for _, link := range manifest.Links {
+		if err = add(link, false); err != nil {
+			return rwpInfo, err
+		}
+	}
+
+	// set some RWPInfo fields from the manifest
+	rwpInfo.UUID = manifest.Metadata.Identifier
+	rwpInfo.Title = manifest.Metadata.Title.Text()
+	rwpInfo.Description = manifest.Metadata.Description
+	rwpInfo.Language = manifest.Metadata.Language
+	rwpInfo.NumPages = len(manifest.ReadingOrder)
+
+	// create the rwpp file
+	rwppFile, err := os.Create(rwppPath)
+	if err != nil {
+		return rwpInfo, err
+	}
+	defer rwppFile.Close()
+
+	zipWriter := zip.NewWriter(rwppFile)
+	defer zipWriter.Close()
+
+	man, err := zipWriter.Create(RWPManifestName)
+	if err != nil {
+		return rwpInfo, err
+	}
+	if _, err = man.Write(rwpJSON); err != nil {
+		return rwpInfo, err
+	}
+	for _, f := range files {
+		if err = copySourceFile(zipWriter, f); err != nil {
+			return rwpInfo, err
+		}
+	}
+	return rwpInfo, nil
+}
+
+// SetImageDimensions sets the missing dimensions of the images of the reading order,
+// and the default reading progression of a Divina manifest.
+// The completed manifest is written in the encrypted package.
+func (reader *RPFReader) SetImageDimensions() error {
+
+	if reader.manifest.Metadata.ConformsTo != DivinaProfile {
+		return errors.New("not a Divina manifest")
+	}
+	if reader.manifest.Metadata.ReadingProgression == "" {
+		reader.manifest.Metadata.ReadingProgression = "ltr"
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range reader.zipArchive.File {
+		files[file.Name] = file
+	}
+	for i, link := range reader.manifest.ReadingOrder {
+		if link.Width != 0 && link.Height != 0 {
+			continue
+		}
+		name, err := url.QueryUnescape(link.Href)
+		if err != nil || files[name] == nil {
+			continue
+		}
+		r, err := files[name].Open()
+		if err != nil {
+			return err
+		}
+		width, height, err := imageDimensions(r)
+		r.Close()
+		if err != nil {
+			log.Printf("Dimensions of %s unknown, %s", name, err.Error())
+			continue
+		}
+		reader.manifest.ReadingOrder[i].Width = width
+		reader.manifest.ReadingOrder[i].Height = height
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// samplePNG generates a blank PNG image of the given dimensions
+func samplePNG(width, height int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+func writeTestCBZ(t *testing.T, files map[string][]byte) string {
+	cbzPath := filepath.Join(t.TempDir(), "My Comic.cbz")
+	f, err := os.Create(cbzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range files {
+		w, _ := zw.Create(name)
+		w.Write(data)
+	}
+	zw.Close()
+	f.Close()
+	return cbzPath
+}
+
+func TestNaturalLess(t *testing.T) {
+	if !naturalLess("page2.png", "page10.png") || naturalLess("page10.png", "page2.png") {
+		t.Error("numbers should be compared by value")
+	}
+	if !naturalLess("a/Page1.png", "a/page1b.png") {
+		t.Error("unexpected order")
+	}
+}
+
+func TestBuildRPFFromCBZ(t *testing.T) {
+
+	cbzPath := writeTestCBZ(t, map[string][]byte{
+		"page10.png": samplePNG(30, 40),
+		"page2.png":  samplePNG(20, 30),
+		"page1.png":  samplePNG(10, 20),
+		"notes.txt":  []byte("not a page"),
+		ComicInfoName: []byte(`<?xml version="1.0"?>
+<ComicInfo>
+  <Title>The Issue</Title>
+  <Series>The Series</Series>
+  <Number>3</Number>
+  <Year>2024</Year>
+  <Month>5</Month>
+  <Writer>Alpha, Beta</Writer>
+  <Penciller>Gamma</Penciller>
+  <Genre>Manga</Genre>
+  <LanguageISO>ja</LanguageISO>
+  <Manga>YesAndRightToLeft</Manga>
+  <Pages><Page Image="1" Type="FrontCover"/></Pages>
+</ComicInfo>`),
+	})
+
+	rwppPath := filepath.Join(t.TempDir(), "comic.divina")
+	info, err := BuildRPFFromCBZ(cbzPath, rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "The Issue" || info.Date != "2024-05-01" || len(info.Author) != 2 || info.NumPages != 3 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	reader, err := OpenRPF(rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	md := reader.manifest.Metadata
+	if reader.ConformsTo() != DivinaProfile || md.ReadingProgression != "rtl" {
+		t.Errorf("unexpected profile %s or progression %s", md.ConformsTo, md.ReadingProgression)
+	}
+	if md.BelongsTo == nil || md.BelongsTo.Series[0].Name != "The Series" || md.BelongsTo.Series[0].Position != 3 {
+		t.Error("series badly mapped")
+	}
+	if md.Penciler.Name() != "Gamma" || len(md.Subject) != 1 {
+		t.Error("contributors or subjects badly mapped")
+	}
+	ro := reader.manifest.ReadingOrder
+	if len(ro) != 3 || ro[0].Href != "page1.png" || ro[1].Href != "page2.png" || ro[2].Href != "page10.png" {
+		t.Fatalf("unexpected reading order %+v", ro)
+	}
+	if ro[2].Width != 30 || ro[2].Height != 40 || ro[0].Type != "image/png" {
+		t.Errorf("unexpected page %+v", ro[2])
+	}
+	coverHref, err := reader.ExtractCoverHref()
+	if err != nil || coverHref != "page2.png" {
+		t.Errorf("unexpected cover %s", coverHref)
+	}
+}
+
+func TestBuildRPFFromCBZWithoutComicInfo(t *testing.T) {
+
+	cbzPath := writeTestCBZ(t, map[string][]byte{
+		"pages/01 a.png": samplePNG(10, 20),
+		"pages/02 b.png": samplePNG(10, 20),
+	})
+	rwppPath := filepath.Join(t.TempDir(), "comic.divina")
+	info, err := BuildRPFFromCBZ(cbzPath, rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "My Comic" {
+		t.Errorf("unexpected title %s", info.Title)
+	}
+
+	reader, err := OpenRPF(rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.manifest.Metadata.ReadingProgression != "ltr" {
+		t.Error("expected a left to right progression")
+	}
+	coverHref, err := reader.ExtractCoverHref()
+	if err != nil || coverHref != "pages/01%20a.png" {
+		t.Fatalf("unexpected cover %s", coverHref)
+	}
+	cover, err := reader.ExtractCover(coverHref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(cover)
+	if !bytes.Equal(data, samplePNG(10, 20)) {
+		t.Error("unexpected cover content")
+	}
+
+	// dimensions missing from a Divina manifest are set before encryption
+	reader.manifest.ReadingOrder[1].Width = 0
+	if err = reader.SetImageDimensions(); err != nil {
+		t.Fatal(err)
+	}
+	if reader.manifest.ReadingOrder[1].Width != 10 {
+		t.Error("dimensions not set")
+	}
+}
+
+func TestBuildRPFFromCBZWithoutImage(t *testing.T) {
+	cbzPath := writeTestCBZ(t, map[string][]byte{"notes.txt": []byte("text")})
+	_, err := BuildRPFFromCBZ(cbzPath, filepath.Join(t.TempDir(), "comic.divina"))
+	if err == nil {
+		t.Error("expected an error on a CBZ without image")
+	}
+}
+
+func TestBuildRPFFromDivinaManifest(t *testing.T) {
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"pages/page 1.png": samplePNG(10, 20),
+		"pages/page2.png":  samplePNG(20, 30),
+		"cover.png":        samplePNG(5, 5),
+		RWPManifestName: []byte(`{"metadata":{"title":"The Manifest","conformsTo":"` + DivinaProfile + `"},
+"links":[{"rel":"self","href":"https://example.com/manifest.json"},{"rel":"cover","href":"cover.png","type":"image/png"}],
+"readingOrder":[{"href":"pages/page%201.png","type":"image/png"},{"href":"pages/page2.png","type":"image/png"}]}`),
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rwppPath := filepath.Join(t.TempDir(), "comic.divina")
+	info, err := BuildRPFFromDivinaManifest(filepath.Join(dir, RWPManifestName), rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "The Manifest" || info.NumPages != 2 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	reader, err := OpenRPF(rwppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.ConformsTo() != DivinaProfile {
+		t.Errorf("unexpected profile %s", reader.ConformsTo())
+	}
+	// the manifest, the pages and the cover are packaged, the remote self link is not
+	if len(reader.zipArchive.File) != 4 {
+		t.Errorf("expected 4 files in the package, got %d", len(reader.zipArchive.File))
+	}
+	if len(reader.Resources()) != 2 {
+		t.Errorf("expected 2 encrypted pages, got %d", len(reader.Resources()))
+	}
+
+	// a folder holding the manifest is processed the same way
+	if _, err = BuildRPFFromDivinaManifest(dir, filepath.Join(t.TempDir(), "folder.divina")); err != nil {
+		t.Error(err)
+	}
+
+	// the pages must be local files
+	remote := `{"metadata":{"title":"Remote","conformsTo":"` + DivinaProfile + `"},"readingOrder":[{"href":"https://example.com/page1.png"}]}`
+	os.WriteFile(filepath.Join(dir, "remote.json"), []byte(remote), 0644)
+	if _, err = BuildRPFFromDivinaManifest(filepath.Join(dir, "remote.json"), filepath.Join(t.TempDir(), "remote.divina")); err == nil {
+		t.Error("expected an error for a remote page")
+	}
+}
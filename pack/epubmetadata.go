@@ -0,0 +1,178 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/readium/readium-lcp-server/epub/opf"
+	"github.com/readium/readium-lcp-server/rwpm"
+)
+
+// EPUBMetadata maps the metadata of an EPUB package document to Readium metadata.
+// EPUB 3 refinements (title-type, alternate-script, file-as, role, belongs-to-collection)
+// and EPUB 2 opf attributes and calibre series are taken into account.
+func EPUBMetadata(p opf.Package) rwpm.Metadata {
+
+	var md rwpm.Metadata
+	m := p.Metadata
+
+	// the unique identifier is referenced by the package, or else the first one
+	for _, id := range m.Identifier {
+		if md.Identifier == "" || (p.UniqueIdentifier != "" && id.ID == p.UniqueIdentifier) {
+			md.Identifier = strings.TrimSpace(id.Value)
+		}
+	}
+
+	// the main title has no title-type or is typed main, the first one wins
+	for _, title := range m.Title {
+		value := strings.TrimSpace(title.Value)
+		switch m.Refinement(title.ID, "title-type") {
+		case "", "main":
+			if md.Title != nil {
+				continue
+			}
+			md.Title.SetDefault(value)
+			md.SortAs = m.Refinement(title.ID, "file-as")
+			for _, meta := range m.Refinements(title.ID) {
+				if meta.Property == "alternate-script" && meta.Lang != "" {
+					md.Title.Set(meta.Lang, strings.TrimSpace(meta.Text))
+				}
+			}
+		case "subtitle":
+			if md.Subtitle == nil {
+				md.Subtitle.SetDefault(value)
+			}
+		}
+	}
+
+	md.Description = strings.TrimSpace(m.Description)
+	for _, lang := range m.Language {
+		md.Language.Add(strings.TrimSpace(lang))
+	}
+	for _, publisher := range m.Publisher {
+		md.Publisher.AddName(strings.TrimSpace(publisher))
+	}
+	for _, creator := range m.Author {
+		addContributor(&md, m, creator, "aut")
+	}
+	for _, contributor := range m.Contributor {
+		addContributor(&md, m, contributor, "")
+	}
+
+	for _, subject := range m.Subject {
+		md.Subject.Add(rwpm.Subject{
+			Name:   strings.TrimSpace(subject.Value),
+			Scheme: m.Refinement(subject.ID, "authority"),
+			Code:   m.Refinement(subject.ID, "term"),
+		})
+	}
+
+	// EPUB 2 may list several dates, the publication date has no event or a publication event
+	for _, date := range m.Date {
+		if date.Event != "" && date.Event != "publication" {
+			continue
+		}
+		if published, err := parseOPFDate(strings.TrimSpace(date.Value)); err == nil {
+			pd := rwpm.Date(published)
+			md.Published = &pd
+			break
+		}
+	}
+
+	var calibreSeries rwpm.Collection
+	for _, meta := range m.Metas {
+		switch {
+		case meta.Property == "dcterms:modified":
+			if modified, err := time.Parse(time.RFC3339, strings.TrimSpace(meta.Text)); err == nil {
+				md.Modified = &modified
+			}
+		case meta.Property == "belongs-to-collection" && meta.Refines == "":
+			collection := rwpm.Collection{Name: strings.TrimSpace(meta.Text)}
+			collection.Identifier = m.Refinement(meta.ID, "dcterms:identifier")
+			if position, err := strconv.ParseFloat(m.Refinement(meta.ID, "group-position"), 32); err == nil {
+				collection.Position = float32(position)
+			}
+			addCollection(&md, collection, m.Refinement(meta.ID, "collection-type") == "series")
+		case meta.Name == "calibre:series":
+			calibreSeries.Name = meta.Content
+		case meta.Name == "calibre:series_index":
+			if position, err := strconv.ParseFloat(meta.Content, 32); err == nil {
+				calibreSeries.Position = float32(position)
+			}
+		}
+	}
+	if calibreSeries.Name != "" && md.BelongsTo == nil {
+		addCollection(&md, calibreSeries, true)
+	}
+	return md
+}
+
+// addContributor adds a creator or contributor to the metadata, depending on its MARC relator role
+func addContributor(md *rwpm.Metadata, m opf.Metadata, e opf.Element, defaultRole string) {
+
+	var ctor rwpm.Contributor
+	ctor.Name.SetDefault(strings.TrimSpace(e.Value))
+	ctor.SortAs = e.FileAs
+	if sortAs := m.Refinement(e.ID, "file-as"); sortAs != "" {
+		ctor.SortAs = sortAs
+	}
+	role := e.Role
+	if r := m.Refinement(e.ID, "role"); r != "" {
+		role = r
+	}
+	if role == "" {
+		role = defaultRole
+	}
+	switch role {
+	case "aut":
+		md.Author.Add(ctor)
+	case "trl":
+		md.Translator.Add(ctor)
+	case "edt":
+		md.Editor.Add(ctor)
+	case "ill":
+		md.Illustrator.Add(ctor)
+	case "art":
+		md.Artist.Add(ctor)
+	case "clr":
+		md.Colorist.Add(ctor)
+	case "nrt":
+		md.Narrator.Add(ctor)
+	case "pbl":
+		md.Publisher.Add(ctor)
+	default:
+		ctor.Role = role
+		md.Contributor.Add(ctor)
+	}
+}
+
+// addCollection adds a series or a collection to the metadata
+func addCollection(md *rwpm.Metadata, collection rwpm.Collection, series bool) {
+
+	if md.BelongsTo == nil {
+		md.BelongsTo = &rwpm.BelongsTo{}
+	}
+	if series {
+		md.BelongsTo.Series = append(md.BelongsTo.Series, collection)
+	} else {
+		md.BelongsTo.Collection = append(md.BelongsTo.Collection, collection)
+	}
+}
+
+// parseOPFDate parses a W3CDTF date, as used in package documents
+func parseOPFDate(s string) (time.Time, error) {
+
+	var err error
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006"} {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/epub/opf"
+)
+
+const epub3OPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="isbn">urn:isbn:9780000000001</dc:identifier>
+    <dc:identifier id="uid">urn:uuid:0a2b3c4d</dc:identifier>
+    <dc:title id="t2">A Subtitle</dc:title>
+    <meta refines="#t2" property="title-type">subtitle</meta>
+    <dc:title id="t1">The Title</dc:title>
+    <meta refines="#t1" property="title-type">main</meta>
+    <meta refines="#t1" property="file-as">Title, The</meta>
+    <meta refines="#t1" property="alternate-script" xml:lang="fr">Le Titre</meta>
+    <dc:creator id="c1">Jane Doe</dc:creator>
+    <meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+    <meta refines="#c1" property="file-as">Doe, Jane</meta>
+    <dc:creator id="c2">John Smith</dc:creator>
+    <meta refines="#c2" property="role" scheme="marc:relators">trl</meta>
+    <dc:contributor id="c3">Ann Other</dc:contributor>
+    <meta refines="#c3" property="role" scheme="marc:relators">mrk</meta>
+    <dc:subject id="s1">Fiction</dc:subject>
+    <meta refines="#s1" property="authority">BISAC</meta>
+    <meta refines="#s1" property="term">FIC000000</meta>
+    <dc:date>2021-03-04</dc:date>
+    <meta property="dcterms:modified">2022-01-02T03:04:05Z</meta>
+    <dc:language>en</dc:language>
+    <dc:publisher>Publisher</dc:publisher>
+    <meta property="belongs-to-collection" id="col1">The Saga</meta>
+    <meta refines="#col1" property="collection-type">series</meta>
+    <meta refines="#col1" property="group-position">2</meta>
+  </metadata>
+  <manifest/>
+</package>`
+
+const epub2OPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:opf="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid" opf:scheme="ISBN">9780000000002</dc:identifier>
+    <dc:title>Old Book</dc:title>
+    <dc:creator opf:role="ill" opf:file-as="Painter, Paul">Paul Painter</dc:creator>
+    <dc:date opf:event="modification">2020-01-01</dc:date>
+    <dc:date opf:event="publication">1999</dc:date>
+    <meta name="calibre:series" content="Old Series"/>
+    <meta name="calibre:series_index" content="1.5"/>
+  </metadata>
+  <manifest/>
+</package>`
+
+func TestEPUB3Metadata(t *testing.T) {
+
+	p, err := opf.Parse(strings.NewReader(epub3OPF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := EPUBMetadata(p)
+	if md.Identifier != "urn:uuid:0a2b3c4d" {
+		t.Errorf("unexpected identifier %s", md.Identifier)
+	}
+	if md.Title["und"] != "The Title" || md.Title["fr"] != "Le Titre" || md.SortAs != "Title, The" {
+		t.Errorf("unexpected title %v, %s", md.Title, md.SortAs)
+	}
+	if md.Subtitle.Text() != "A Subtitle" {
+		t.Errorf("unexpected subtitle %v", md.Subtitle)
+	}
+	if len(md.Author) != 1 || md.Author[0].SortAs != "Doe, Jane" || md.Translator.Name() != "John Smith" {
+		t.Errorf("unexpected creators %v %v", md.Author, md.Translator)
+	}
+	if len(md.Contributor) != 1 || md.Contributor[0].Role != "mrk" {
+		t.Errorf("unexpected contributors %v", md.Contributor)
+	}
+	if len(md.Subject) != 1 || md.Subject[0].Scheme != "BISAC" || md.Subject[0].Code != "FIC000000" {
+		t.Errorf("unexpected subjects %v", md.Subject)
+	}
+	if md.Published == nil || md.Published.String() != "2021-03-04" || md.Modified == nil {
+		t.Error("unexpected dates")
+	}
+	if md.BelongsTo == nil || len(md.BelongsTo.Series) != 1 || md.BelongsTo.Series[0].Name != "The Saga" || md.BelongsTo.Series[0].Position != 2 {
+		t.Errorf("unexpected series %+v", md.BelongsTo)
+	}
+	if len(md.Language) != 1 || md.Publisher.Name() != "Publisher" {
+		t.Error("unexpected language or publisher")
+	}
+}
+
+func TestEPUB2Metadata(t *testing.T) {
+
+	p, err := opf.Parse(strings.NewReader(epub2OPF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := EPUBMetadata(p)
+	if md.Identifier != "9780000000002" || md.Title.Text() != "Old Book" {
+		t.Errorf("unexpected identifier %s or title %v", md.Identifier, md.Title)
+	}
+	if len(md.Illustrator) != 1 || md.Illustrator[0].SortAs != "Painter, Paul" {
+		t.Errorf("unexpected illustrator %v", md.Illustrator)
+	}
+	if md.Published == nil || md.Published.String() != "1999-01-01" {
+		t.Error("expected the publication date")
+	}
+	if md.BelongsTo == nil || md.BelongsTo.Series[0].Name != "Old Series" || md.BelongsTo.Series[0].Position != 1.5 {
+		t.Errorf("unexpected series %+v", md.BelongsTo)
+	}
+}
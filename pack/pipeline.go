@@ -6,11 +6,14 @@ package pack
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -80,26 +83,62 @@ func (s *ManualSource) Post(t *Task) Result {
 	return t.Wait()
 }
 
+// ErrShutdown is the error of the tasks posted after the shutdown of the packager
+var ErrShutdown = errors.New("the packager is shut down")
+
 // Packager is a struct
 type Packager struct {
 	Incoming chan *Task
 	done     chan struct{}
+	workers  *sync.WaitGroup
 	store    storage.Store
 	idx      index.Index
 }
 
 func (p Packager) work() {
-	for t := range p.Incoming {
-		log.Println("Packager working on an incoming EPUB, encryption task")
-		r := Result{}
-		p.genKey(&r)
-		zr := p.readZip(&r, t.Body, t.Size)
-		ep := p.readEpub(&r, zr)
-		encrypted, key := p.encrypt(&r, ep)
-		p.addToStore(&r, encrypted)
-		p.addToIndex(&r, key, t.Name, encrypted, epub.ContentType_EPUB)
-
-		t.Done(r)
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		case t := <-p.Incoming:
+			log.Println("Packager working on an incoming EPUB, encryption task")
+			r := Result{}
+			p.genKey(&r)
+			zr := p.readZip(&r, t.Body, t.Size)
+			ep := p.readEpub(&r, zr)
+			encrypted, key := p.encrypt(&r, ep)
+			p.addToStore(&r, encrypted)
+			p.addToIndex(&r, key, t.Name, encrypted, epub.ContentType_EPUB)
+
+			t.Done(r)
+		}
+	}
+}
+
+// Shutdown stops the workers once their current task is done, or returns when the context is done.
+// The tasks are posted by the requests being processed, which are drained before;
+// a task posted after the shutdown fails with ErrShutdown, until the context is done.
+func (p *Packager) Shutdown(ctx context.Context) error {
+	close(p.done)
+	stopped := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(stopped)
+		for {
+			select {
+			case t := <-p.Incoming:
+				t.Done(Result{Error: ErrShutdown})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -189,10 +228,12 @@ func NewPackager(store storage.Store, idx index.Index, concurrency int) *Package
 	packager := Packager{
 		Incoming: make(chan *Task),
 		done:     make(chan struct{}),
+		workers:  &sync.WaitGroup{},
 		store:    store,
 		idx:      idx,
 	}
 
+	packager.workers.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		go packager.work()
 	}
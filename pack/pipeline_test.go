@@ -0,0 +1,32 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package pack
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPackagerShutdown(t *testing.T) {
+	p := NewPackager(nil, nil, 2)
+	var source ManualSource
+	source.Feed(p.Incoming)
+
+	body := []byte("not a zip file")
+	if r := source.Post(NewTask("invalid.epub", bytes.NewReader(body), int64(len(body)))); r.Error == nil || r.Error == ErrShutdown {
+		t.Errorf("Expected the task to be processed, got %v", r.Error)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r := source.Post(NewTask("late.epub", bytes.NewReader(body), int64(len(body)))); r.Error != ErrShutdown {
+		t.Errorf("Expected a task posted after the shutdown to fail, got %v", r.Error)
+	}
+}
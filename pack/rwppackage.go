@@ -27,7 +27,7 @@ import (
 // deemed useful for a notified CMS or LCP Server
 type RWPInfo struct {
 	UUID        string
-	NumPages    int   // only for PDF-based RWPs
+	NumPages    int   // only for PDF-based RWPs and comics
 	Title       string
 	Date        string
 	Description string
@@ -35,6 +35,7 @@ type RWPInfo struct {
 	Publisher   []string
 	Author      []string
 	Subject     []string
+	Duration    float32 // only for audiobooks, in seconds
 }
 
 // RPFReader is a Readium Package reader
@@ -175,6 +176,10 @@ func (reader *RPFReader) Resources() []Resource {
 // ExtractCover extracts the cover image from the Readium Package
 func (reader *RPFReader) ExtractCover(coverHref string) (io.Reader, error) {
 
+	// hrefs are escaped, zip file names are not
+	if name, err := url.QueryUnescape(coverHref); err == nil {
+		coverHref = name
+	}
 	// find the cover file in the zip archive
 	for _, file := range reader.zipArchive.File {
 		if file.Name == coverHref {
@@ -220,6 +225,15 @@ func (reader *RPFReader) ExtractCoverHref() (string, error) {
 		return coverHref, nil
 	}
 
+	// find the cover in the reading order (e.g. the first page of a comic)
+	for _, resource := range reader.manifest.ReadingOrder {
+		for _, rel := range resource.Rel {
+			if rel == "cover" {
+				return resource.Href, nil
+			}
+		}
+	}
+
 	return "", errors.New("no cover found in the manifest")
 }
 
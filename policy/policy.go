@@ -0,0 +1,72 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package policy manages named rights policies, referenced by partial licenses
+// sent to the License Server, e.g. "loan-21d", "purchase" or "school-year".
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/rickb777/date/period"
+)
+
+// Policy is a named set of rights.
+// Start and End are absolute dates; Duration is an ISO 8601 duration (e.g. P21D)
+// which sets the end of the rights relatively to their start.
+type Policy struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Print       *int32     `json:"print,omitempty"`
+	Copy        *int32     `json:"copy,omitempty"`
+	Start       *time.Time `json:"start,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	Updated     time.Time  `json:"updated"`
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// Validate checks the consistency of a policy
+func (p Policy) Validate() error {
+
+	if !validName.MatchString(p.Name) {
+		return errors.New("the policy name must be made of at most 64 letters, digits, dots, dashes or underscores")
+	}
+	if (p.Print != nil && *p.Print < 0) || (p.Copy != nil && *p.Copy < 0) {
+		return errors.New("print and copy rights cannot be negative")
+	}
+	if p.Duration != "" {
+		if p.End != nil {
+			return errors.New("a policy cannot have both an end date and a duration")
+		}
+		d, err := period.Parse(p.Duration)
+		if err != nil {
+			return err
+		}
+		if !d.IsPositive() {
+			return errors.New("the policy duration must be positive")
+		}
+	}
+	if p.Start != nil && p.End != nil && !p.End.After(*p.Start) {
+		return errors.New("the policy end date must be after its start date")
+	}
+	return nil
+}
+
+// EndFrom returns the end of the rights of a license starting at a given date
+func (p Policy) EndFrom(start time.Time) (*time.Time, error) {
+
+	if p.Duration == "" {
+		return p.End, nil
+	}
+	d, err := period.Parse(p.Duration)
+	if err != nil {
+		return nil, err
+	}
+	end, _ := d.AddTo(start)
+	return &end, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package policy
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// ErrNotFound signals a policy not found
+var ErrNotFound = errors.New("Rights policy not found")
+
+// Store is the interface of the rights policy store
+type Store interface {
+	Get(name string) (Policy, error)
+	Add(p Policy) error
+	Update(p Policy) error
+	Delete(name string) error
+	List() func() (Policy, error)
+}
+
+type sqlStore struct {
+	db        *sql.DB
+	dbGetByID *sql.Stmt
+	dbList    *sql.Stmt
+}
+
+// scanPolicy reads a policy from a db row
+func scanPolicy(row interface{ Scan(...interface{}) error }) (Policy, error) {
+
+	var p Policy
+	var description, duration sql.NullString
+	err := row.Scan(&p.Name, &description, &p.Print, &p.Copy, &p.Start, &p.End, &duration, &p.Updated)
+	p.Description = description.String
+	p.Duration = duration.String
+	return p, err
+}
+
+// Get returns a policy by name
+func (s *sqlStore) Get(name string) (Policy, error) {
+
+	p, err := scanPolicy(s.dbGetByID.QueryRow(name))
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return p, err
+}
+
+// Add inserts a policy
+func (s *sqlStore) Add(p Policy) error {
+
+	_, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `INSERT INTO rights_policy (name, description,
+	rights_print, rights_copy, rights_start, rights_end, duration, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		p.Name, p.Description, p.Print, p.Copy, p.Start, p.End, p.Duration, time.Now().UTC().Truncate(time.Second))
+	return err
+}
+
+// Update updates a policy
+func (s *sqlStore) Update(p Policy) error {
+
+	result, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, `UPDATE rights_policy SET description=?,
+	rights_print=?, rights_copy=?, rights_start=?, rights_end=?, duration=?, updated=? WHERE name=?`),
+		p.Description, p.Print, p.Copy, p.Start, p.End, p.Duration, time.Now().UTC().Truncate(time.Second), p.Name)
+	if err == nil {
+		if r, _ := result.RowsAffected(); r == 0 {
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+// Delete deletes a policy
+func (s *sqlStore) Delete(name string) error {
+
+	result, err := s.db.Exec(dbutils.GetParamQuery(config.Config.LcpServer.Database, "DELETE FROM rights_policy WHERE name=?"), name)
+	if err == nil {
+		if r, _ := result.RowsAffected(); r == 0 {
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+// List lists all policies by name
+func (s *sqlStore) List() func() (Policy, error) {
+
+	rows, err := s.dbList.Query()
+	if err != nil {
+		return func() (Policy, error) { return Policy{}, err }
+	}
+	return func() (Policy, error) {
+		var p Policy
+		var err error
+		if rows.Next() {
+			p, err = scanPolicy(rows)
+		} else {
+			rows.Close()
+			err = ErrNotFound
+		}
+		return p, err
+	}
+}
+
+// Open prepares the db statements of the rights policy store
+func Open(db *sql.DB) (store Store, err error) {
+
+	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+
+	// if sqlite, create the rights_policy table if it does not exist
+	if driver == "sqlite3" {
+		_, err = db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite rights_policy table")
+			return
+		}
+	}
+
+	dbGetByID, err := db.Prepare(dbutils.GetParamQuery(config.Config.LcpServer.Database, `SELECT name, description,
+	rights_print, rights_copy, rights_start, rights_end, duration, updated FROM rights_policy WHERE name = ?`))
+	if err != nil {
+		log.Println("Error preparing dbGetByID")
+		return
+	}
+	dbList, err := db.Prepare(`SELECT name, description,
+	rights_print, rights_copy, rights_start, rights_end, duration, updated FROM rights_policy ORDER BY name`)
+	if err != nil {
+		log.Println("Error preparing dbList")
+		return
+	}
+
+	store = &sqlStore{db, dbGetByID, dbList}
+	return
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS rights_policy (" +
+	"name varchar(64) PRIMARY KEY," +
+	"description text DEFAULT NULL," +
+	"rights_print int DEFAULT NULL," +
+	"rights_copy int DEFAULT NULL," +
+	"rights_start datetime DEFAULT NULL," +
+	"rights_end datetime DEFAULT NULL," +
+	"duration varchar(64) DEFAULT NULL," +
+	"updated datetime NOT NULL)"
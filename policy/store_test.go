@@ -0,0 +1,126 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package policy
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func TestCRUD(t *testing.T) {
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	print := int32(10)
+	err = st.Add(Policy{Name: "loan-21d", Description: "3 weeks loan", Print: &print, Duration: "P21D"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Add(Policy{Name: "purchase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Add(Policy{Name: "purchase"}); err == nil {
+		t.Error("expected an error on a duplicate policy")
+	}
+
+	p, err := st.Get("loan-21d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Description != "3 weeks loan" || p.Print == nil || *p.Print != 10 || p.Copy != nil || p.Duration != "P21D" || p.Updated.IsZero() {
+		t.Errorf("unexpected policy %+v", p)
+	}
+
+	p.Print = nil
+	if err = st.Update(p); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = st.Get("loan-21d")
+	if p.Print != nil {
+		t.Error("expected the print right to be removed")
+	}
+	if err = st.Update(Policy{Name: "unknown"}); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	fn := st.List()
+	var names []string
+	for it, err := fn(); err == nil; it, err = fn() {
+		names = append(names, it.Name)
+	}
+	if len(names) != 2 || names[0] != "loan-21d" || names[1] != "purchase" {
+		t.Errorf("unexpected list %v", names)
+	}
+
+	if err = st.Delete("purchase"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.Get("purchase"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err = st.Delete("purchase"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC)
+	negative := int32(-1)
+
+	valid := []Policy{
+		{Name: "purchase"},
+		{Name: "loan-21d", Duration: "P21D"},
+		{Name: "school-year", Start: &start, End: &end},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: unexpected error %v", p.Name, err)
+		}
+	}
+	invalid := []Policy{
+		{Name: ""},
+		{Name: "a/b"},
+		{Name: "neg", Print: &negative},
+		{Name: "both", End: &end, Duration: "P1D"},
+		{Name: "bad-duration", Duration: "21 days"},
+		{Name: "reversed", Start: &end, End: &start},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: expected an error", p.Name)
+		}
+	}
+
+	p := Policy{Name: "loan-21d", Duration: "P21D"}
+	e, err := p.EndFrom(start)
+	if err != nil || !e.Equal(start.AddDate(0, 0, 21)) {
+		t.Errorf("unexpected end %v", e)
+	}
+	p = Policy{Name: "school-year", Start: &start, End: &end}
+	e, _ = p.EndFrom(time.Now())
+	if !e.Equal(end) {
+		t.Errorf("unexpected end %v", e)
+	}
+}
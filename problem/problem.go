@@ -14,7 +14,10 @@ import (
 	"log"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+
+	"github.com/readium/readium-lcp-server/localization"
 )
 
 const (
@@ -28,6 +31,9 @@ type Problem struct {
 	Status   int    `json:"status,omitempty"` //if present = http response code
 	Detail   string `json:"detail,omitempty"`
 	Instance string `json:"instance,omitempty"`
+	// id of a localized message used as the detail, formatted with Args
+	MessageID string        `json:"-"`
+	Args      []interface{} `json:"-"`
 }
 
 // Problem types
@@ -57,8 +63,16 @@ func Error(w http.ResponseWriter, r *http.Request, problem Problem, status int)
 		problem.Type = SERVER_INTERNAL_ERROR
 	}
 
+	// titles and details are localized in the language requested by the caller
+	lang := localization.Negotiate(r.Header.Get("Accept-Language"))
 	if problem.Title == "" { // Title (required) matches http status by default
-		problem.Title = http.StatusText(status)
+		var ok bool
+		if problem.Title, ok = localization.Lookup(lang, "http."+strconv.Itoa(status)); !ok {
+			problem.Title = http.StatusText(status)
+		}
+	}
+	if problem.MessageID != "" {
+		problem.Detail = localization.Message(lang, problem.MessageID, problem.Args...)
 	}
 
 	jsonError, e := json.Marshal(problem)
@@ -0,0 +1,76 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore creates a store which keeps the buckets in memory, for a single server
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take takes a token from a bucket, created full
+func (s *memoryStore) Take(key string, b config.Bucket, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bk, ok := s.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(b.Burst), updated: now}
+		s.buckets[key] = bk
+	}
+	tokens := refill(bk.tokens, bk.updated, b, now)
+	if tokens < 1 {
+		return delay(tokens, b), nil
+	}
+	bk.tokens, bk.updated = tokens-1, now
+	bk.full = fullAt(bk.tokens, b, now)
+	return 0, nil
+}
+
+// Give gives back a token to a bucket; a bucket which does not exist is full
+func (s *memoryStore) Give(key string, b config.Bucket, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bk, ok := s.buckets[key]
+	if !ok {
+		return nil
+	}
+	bk.tokens = math.Min(refill(bk.tokens, bk.updated, b, now)+1, float64(b.Burst))
+	bk.updated = now
+	bk.full = fullAt(bk.tokens, b, now)
+	return nil
+}
+
+// Purge removes the buckets which are full
+func (s *memoryStore) Purge(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, bk := range s.buckets {
+		if !bk.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package ratelimit limits the requests to the public routes of the Status Server.
+// Each route has token buckets by client ip and by license: a request takes a token from both buckets,
+// and is rejected if one of them is empty, in which case the token taken from the other bucket is given back. Buckets are kept in memory, or in the database
+// when the limits are shared between replicas.
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// Store is the interface of the token buckets
+type Store interface {
+	// Take takes a token from a bucket; if the bucket is empty, it returns the delay before a token is available
+	Take(key string, b config.Bucket, now time.Time) (time.Duration, error)
+	// Give gives back a token taken from a bucket, for a request rejected by another bucket
+	Give(key string, b config.Bucket, now time.Time) error
+	// Purge removes the buckets which are full at a given time, as a full bucket is created for a new key
+	Purge(now time.Time) error
+}
+
+// Limiter applies the configured limits of the public routes
+type Limiter struct {
+	store  Store
+	config config.RateLimit
+}
+
+// New creates a limiter of the configured routes, whose buckets are kept in a store
+func New(st Store, cfg config.RateLimit) *Limiter {
+	return &Limiter{store: st, config: cfg}
+}
+
+// Wait takes a token of a route for a client ip and a license, and returns the delay before
+// the request can be retried if a budget is exhausted. Requests are allowed if the store fails.
+func (l *Limiter) Wait(route string, ip string, licenseID string) time.Duration {
+	limits, ok := l.config.Routes[route]
+	if !ok {
+		return 0
+	}
+	now := time.Now().UTC()
+	var wait time.Duration
+	// taken is the key of the bucket a token was taken from, to give it back if the request is rejected
+	var taken string
+	take := func(key string, b config.Bucket) {
+		if b.Rate <= 0 || wait > 0 {
+			return
+		}
+		if b.Burst < 1 {
+			b.Burst = 1
+		}
+		d, err := l.store.Take(key, b, now)
+		if err != nil {
+			log.Println("Error taking a rate limit token: " + err.Error())
+			return
+		}
+		wait = d
+		if d == 0 {
+			taken = key
+		}
+	}
+	if ip != "" {
+		take(route+":ip:"+ip, limits.PerIP)
+	}
+	if licenseID != "" {
+		take(route+":license:"+licenseID, limits.PerLicense)
+	}
+	// a request rejected by the budget of its license does not count in the budget of its client
+	if wait > 0 && taken != "" {
+		b := limits.PerIP
+		if b.Burst < 1 {
+			b.Burst = 1
+		}
+		if err := l.store.Give(taken, b, now); err != nil {
+			log.Println("Error giving back a rate limit token: " + err.Error())
+		}
+	}
+	return wait
+}
+
+// ClientIP returns the ip of the client of a request
+func (l *Limiter) ClientIP(r *http.Request) string {
+	if l.config.TrustProxy {
+		// the last address is the one seen by the proxy, the previous ones may be forged by the client
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			addrs := strings.Split(fwd, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Run purges the full buckets every interval. It never returns.
+func (l *Limiter) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := l.store.Purge(time.Now().UTC()); err != nil {
+			log.Println("Error purging the rate limits: " + err.Error())
+		}
+	}
+}
+
+// refill returns the tokens of a bucket at a given time, from its tokens at the time it was last updated
+func refill(tokens float64, updated time.Time, b config.Bucket, now time.Time) float64 {
+	if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens += elapsed.Minutes() * b.Rate
+	}
+	return math.Min(tokens, float64(b.Burst))
+}
+
+// fullAt returns the time at which a bucket is full again
+func fullAt(tokens float64, b config.Bucket, now time.Time) time.Time {
+	return now.Add(time.Duration(math.Ceil((float64(b.Burst) - tokens) / b.Rate * float64(time.Minute))))
+}
+
+// delay returns the delay before a bucket holds a token
+func delay(tokens float64, b config.Bucket) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / b.Rate * float64(time.Minute)))
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package ratelimit
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+func openTestStore(t *testing.T) Store {
+	database := "sqlite3://:memory:"
+	driver, cnxn := config.GetDatabase(database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	st, err := Open(db, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestStores(t *testing.T) {
+	for name, st := range map[string]Store{"memory": NewMemoryStore(), "database": openTestStore(t)} {
+		// 2 requests at once, then 1 request every 30 seconds
+		b := config.Bucket{Rate: 2, Burst: 2}
+		now := time.Now().UTC().Truncate(time.Second)
+		take := func(at time.Time) time.Duration {
+			wait, err := st.Take("k", b, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return wait
+		}
+		if take(now) != 0 || take(now) != 0 {
+			t.Errorf("%s: expected a burst of 2 requests", name)
+		}
+		if wait := take(now.Add(10 * time.Second)); wait.Round(time.Second) != 20*time.Second {
+			t.Errorf("%s: expected a 20s wait, got %v", name, wait)
+		}
+		if take(now.Add(30*time.Second)) != 0 || take(now.Add(30*time.Second)) == 0 {
+			t.Errorf("%s: expected a single token after 30s", name)
+		}
+		if wait, _ := st.Take("other", b, now); wait != 0 {
+			t.Errorf("%s: expected a separate bucket", name)
+		}
+
+		// a token given back can be taken again, and a bucket is never fuller than its burst
+		if err := st.Give("k", b, now.Add(30*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if take(now.Add(30*time.Second)) != 0 || take(now.Add(30*time.Second)) == 0 {
+			t.Errorf("%s: expected a token given back", name)
+		}
+		if err := st.Give("new", b, now); err != nil {
+			t.Fatal(err)
+		}
+		if wait, _ := st.Take("new", b, now); wait != 0 {
+			t.Errorf("%s: expected a full bucket", name)
+		}
+
+		// the buckets are purged once full
+		if err := st.Purge(now.Add(31 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if take(now.Add(31*time.Second)) == 0 {
+			t.Errorf("%s: expected a bucket kept until full", name)
+		}
+		if err := st.Purge(now.Add(2 * time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if take(now.Add(30*time.Second)) != 0 || take(now.Add(30*time.Second)) != 0 {
+			t.Errorf("%s: expected a new full bucket", name)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(NewMemoryStore(), config.RateLimit{Routes: map[string]config.RouteRateLimit{
+		"renew": {PerIP: config.Bucket{Rate: 1, Burst: 3}, PerLicense: config.Bucket{Rate: 1, Burst: 1}},
+	}})
+	if l.Wait("renew", "10.0.0.1", "l1") != 0 {
+		t.Error("Expected an allowed request")
+	}
+	// the budget of the license is exhausted, whatever the client
+	if l.Wait("renew", "10.0.0.2", "l1") == 0 {
+		t.Error("Expected a limited license")
+	}
+	if l.Wait("renew", "10.0.0.1", "l2") != 0 {
+		t.Error("Expected an allowed request")
+	}
+	// the budget of the client is exhausted, whatever the license
+	if l.Wait("renew", "10.0.0.1", "l3") != 0 || l.Wait("renew", "10.0.0.1", "l4") == 0 {
+		t.Error("Expected a limited client")
+	}
+	// the requests rejected by the budget of a license do not exhaust the budget of the client
+	for i := 0; i < 5; i++ {
+		if l.Wait("renew", "10.0.0.3", "l1") == 0 {
+			t.Fatal("Expected a limited license")
+		}
+	}
+	if l.Wait("renew", "10.0.0.3", "l5") != 0 {
+		t.Error("Expected an allowed request")
+	}
+	// a route without limits
+	for i := 0; i < 10; i++ {
+		if l.Wait("status", "10.0.0.1", "l1") != 0 {
+			t.Fatal("Expected an unlimited route")
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/licenses/l1/status", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+
+	if ip := New(nil, config.RateLimit{}).ClientIP(r); ip != "10.0.0.1" {
+		t.Errorf("Unexpected ip %s", ip)
+	}
+	if ip := New(nil, config.RateLimit{TrustProxy: true}).ClientIP(r); ip != "5.6.7.8" {
+		t.Errorf("Unexpected ip %s", ip)
+	}
+}
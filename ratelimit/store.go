@@ -0,0 +1,128 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package ratelimit
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/dbutils"
+)
+
+// sqlStore stores the tokens of a bucket in thousandths, and its dates in milliseconds since the epoch,
+// so that the concurrent updates of a bucket are detected by an exact comparison
+type sqlStore struct {
+	db       *sql.DB
+	database string
+}
+
+// maxAttempts is the number of attempts to update a bucket which is updated concurrently
+const maxAttempts = 3
+
+// Take takes a token from a bucket, created full.
+// The bucket is updated only if it was not updated by another server meanwhile, else the update is retried.
+func (s *sqlStore) Take(key string, b config.Bucket, now time.Time) (time.Duration, error) {
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var stored, updated int64
+		err := s.db.QueryRow(dbutils.GetParamQuery(s.database, "SELECT tokens, updated FROM rate_limit WHERE bucket=?"), key).Scan(&stored, &updated)
+		if err == sql.ErrNoRows {
+			tokens := float64(b.Burst) - 1
+			_, err = s.db.Exec(dbutils.GetParamQuery(s.database, "INSERT INTO rate_limit (bucket, tokens, updated, full_at) VALUES (?, ?, ?, ?)"),
+				key, thousandths(tokens), now.UnixMilli(), fullAt(tokens, b, now).UnixMilli())
+			if err == nil {
+				return 0, nil
+			}
+			// the bucket may have been created by another server
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		tokens := refill(float64(stored)/1000, time.UnixMilli(updated), b, now)
+		if tokens < 1 {
+			return delay(tokens, b), nil
+		}
+		tokens--
+		result, err := s.db.Exec(dbutils.GetParamQuery(s.database, "UPDATE rate_limit SET tokens=?, updated=?, full_at=? WHERE bucket=? AND tokens=? AND updated=?"),
+			thousandths(tokens), now.UnixMilli(), fullAt(tokens, b, now).UnixMilli(), key, stored, updated)
+		if err != nil {
+			return 0, err
+		}
+		if r, err := result.RowsAffected(); err != nil || r == 1 {
+			return 0, err
+		}
+		lastErr = errors.New("the bucket " + key + " was updated concurrently")
+	}
+	return 0, lastErr
+}
+
+// Give gives back a token to a bucket; a bucket which does not exist is full.
+// As for Take, the update is retried if the bucket was updated by another server meanwhile.
+func (s *sqlStore) Give(key string, b config.Bucket, now time.Time) error {
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		var stored, updated int64
+		err := s.db.QueryRow(dbutils.GetParamQuery(s.database, "SELECT tokens, updated FROM rate_limit WHERE bucket=?"), key).Scan(&stored, &updated)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		tokens := math.Min(refill(float64(stored)/1000, time.UnixMilli(updated), b, now)+1, float64(b.Burst))
+		result, err := s.db.Exec(dbutils.GetParamQuery(s.database, "UPDATE rate_limit SET tokens=?, updated=?, full_at=? WHERE bucket=? AND tokens=? AND updated=?"),
+			thousandths(tokens), now.UnixMilli(), fullAt(tokens, b, now).UnixMilli(), key, stored, updated)
+		if err != nil {
+			return err
+		}
+		if r, err := result.RowsAffected(); err != nil || r == 1 {
+			return err
+		}
+	}
+	return errors.New("the bucket " + key + " was updated concurrently")
+}
+
+// Purge removes the buckets which are full
+func (s *sqlStore) Purge(now time.Time) error {
+	_, err := s.db.Exec(dbutils.GetParamQuery(s.database, "DELETE FROM rate_limit WHERE full_at<=?"), now.UnixMilli())
+	return err
+}
+
+func thousandths(tokens float64) int64 {
+	return int64(math.Floor(tokens * 1000))
+}
+
+// Open creates a store which keeps the buckets in the database of the Status Server,
+// so that the limits are shared between its replicas
+func Open(db *sql.DB, database string) (Store, error) {
+
+	driver, _ := config.GetDatabase(database)
+
+	// if sqlite, create the rate_limit table if it does not exist
+	if driver == "sqlite3" {
+		_, err := db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite rate_limit table")
+			return nil, err
+		}
+	}
+	return &sqlStore{db, database}, nil
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS rate_limit (" +
+	"bucket varchar(255) PRIMARY KEY," +
+	"tokens bigint NOT NULL," +
+	"updated bigint NOT NULL," +
+	"full_at bigint NOT NULL);" +
+	"CREATE INDEX IF NOT EXISTS rate_limit_full_index ON rate_limit (full_at);"
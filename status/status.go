@@ -19,6 +19,8 @@ const (
 	STATUS_CANCELLED = "cancelled"
 	STATUS_EXPIRED   = "expired"
 	EVENT_RENEWED    = "renewed"
+	// reason of the revocation or cancellation of a transferred license
+	EVENT_TRANSFERRED = "transferred"
 )
 
 // List of status values as int
@@ -30,6 +32,8 @@ const (
 	STATUS_CANCELLED_INT = 4
 	STATUS_EXPIRED_INT   = 5
 	EVENT_RENEWED_INT    = 6
+	// a license issued by the transfer of another license
+	EVENT_TRANSFERRED_INT = 7
 )
 
 // StatusValues defines status values logged in license status documents
@@ -43,14 +47,15 @@ var StatusValues = map[int]string{
 }
 
 // EventTypes defines additional event types.
-// It reuses all status values and adds one for renewed licenses.
+// It reuses all status values and adds one for renewed licenses and one for transferred licenses.
 var EventTypes = map[int]string{
-	STATUS_ACTIVE_INT:    "register",
-	STATUS_REVOKED_INT:   "revoke",
-	STATUS_RETURNED_INT:  "return",
-	STATUS_CANCELLED_INT: "cancel",
-	STATUS_EXPIRED_INT:   "expire",
-	EVENT_RENEWED_INT:    "renew",
+	STATUS_ACTIVE_INT:     "register",
+	STATUS_REVOKED_INT:    "revoke",
+	STATUS_RETURNED_INT:   "return",
+	STATUS_CANCELLED_INT:  "cancel",
+	STATUS_EXPIRED_INT:    "expire",
+	EVENT_RENEWED_INT:     "renew",
+	EVENT_TRANSFERRED_INT: "transfer",
 }
 
 // GetStatus translates status number to status string
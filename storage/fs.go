@@ -27,7 +27,7 @@ package storage
 
 import (
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -56,7 +56,12 @@ func (i fsItem) Contents() (io.ReadCloser, error) {
 }
 
 func (s fsStorage) Add(key string, r io.ReadSeeker) (Item, error) {
-	file, err := os.Create(filepath.Join(s.fspath, key))
+	// the key may contain a sub-directory
+	path := filepath.Join(s.fspath, key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
 	if err != nil {
 		return nil, err
 	}
@@ -87,18 +92,26 @@ func (s fsStorage) Remove(key string) error {
 	return os.Remove(filepath.Join(s.fspath, key))
 }
 
+// List returns the items of the storage, including the items of its sub-directories,
+// whose keys are their slash separated paths
 func (s fsStorage) List() ([]Item, error) {
 	var items []Item
 
-	files, err := ioutil.ReadDir(s.fspath)
+	err := filepath.WalkDir(s.fspath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(s.fspath, path)
+		if err != nil {
+			return err
+		}
+		items = append(items, &fsItem{name: filepath.ToSlash(name), storageDir: s.fspath, baseURL: s.url})
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, fi := range files {
-		items = append(items, &fsItem{name: fi.Name(), storageDir: s.fspath, baseURL: s.url})
-	}
-
 	return items, nil
 }
 
@@ -95,3 +95,49 @@ func TestFileSystemStorage(t *testing.T) {
 	}
 
 }
+
+func TestPrefixedStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "lcpserve_test_prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := Prefixed(NewFileSystem(dir, "http://localhost/assets"), "acme/")
+
+	item, err := store.Add("test", bytes.NewReader([]byte("test1234")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Key() != "acme/test" || item.PublicURL() != "http://localhost/assets/acme/test" {
+		t.Errorf("unexpected item %s at %s", item.Key(), item.PublicURL())
+	}
+	if _, err = os.Stat(filepath.Join(dir, "acme", "test")); err != nil {
+		t.Error(err)
+	}
+	if _, err = store.Get("test"); err != nil {
+		t.Error(err)
+	}
+	if _, err = NewFileSystem(dir, "").Get("test"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound out of the prefix, got %v", err)
+	}
+
+	// the listed keys are relative to the prefix, and the items out of the prefix are not listed
+	if _, err = NewFileSystem(dir, "").Add("other", bytes.NewReader([]byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+	items, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Key() != "test" {
+		t.Errorf("expected the test item, got %v", items)
+	}
+	items, err = NewFileSystem(dir, "").List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Key() != "acme/test" || items[1].Key() != "other" {
+		t.Errorf("expected the items of the sub-directory, got %v", items)
+	}
+}
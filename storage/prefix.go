@@ -0,0 +1,62 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package storage
+
+import (
+	"io"
+	"strings"
+)
+
+// prefixStorage stores items in another storage, with keys starting with a given prefix
+type prefixStorage struct {
+	store  Store
+	prefix string
+}
+
+func (s prefixStorage) Add(key string, r io.ReadSeeker) (Item, error) {
+	return s.store.Add(s.prefix+key, r)
+}
+
+func (s prefixStorage) Get(key string) (Item, error) {
+	return s.store.Get(s.prefix + key)
+}
+
+func (s prefixStorage) Remove(key string) error {
+	return s.store.Remove(s.prefix + key)
+}
+
+// List returns the items whose key starts with the prefix, with their keys relative to the prefix
+func (s prefixStorage) List() ([]Item, error) {
+	all, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, item := range all {
+		if key := strings.TrimPrefix(item.Key(), s.prefix); key != item.Key() {
+			items = append(items, prefixItem{item, key})
+		}
+	}
+	return items, nil
+}
+
+// prefixItem is an item of a prefixed storage, whose key does not contain the prefix
+type prefixItem struct {
+	Item
+	key string
+}
+
+func (i prefixItem) Key() string {
+	return i.key
+}
+
+// Prefixed returns a storage which prefixes the keys of its items, e.g. with a folder name
+// With a file system storage, a prefix ending with a slash is a sub-directory
+func Prefixed(store Store, prefix string) Store {
+	if prefix == "" {
+		return store
+	}
+	return prefixStorage{store, prefix}
+}
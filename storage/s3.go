@@ -26,6 +26,8 @@
 package storage
 
 import (
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io"
 
@@ -36,8 +38,11 @@ import (
 )
 
 type s3store struct {
-	bucket string
-	client *s3.S3
+	bucket      string
+	client      *s3.S3
+	partSize    int64
+	concurrency int
+	stateDir    string
 }
 
 type s3item struct {
@@ -63,15 +68,39 @@ func (i s3item) Contents() (io.ReadCloser, error) {
 	return resp.Body, err
 }
 
+// Add stores the content of r under the given key.
+// Small contents are sent in a single request, larger ones are sent as a multipart upload.
 func (s *s3store) Add(key string, r io.ReadSeeker) (Item, error) {
-	_, err := s.client.PutObject(&s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-		Body:   r,
-	})
-
 	item := s3item{bucket: s.bucket, key: key, store: s}
 
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return item, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return item, err
+	}
+
+	if size > s.partSize {
+		err = s.addMultipart(key, r, size)
+		return item, err
+	}
+
+	// let S3 check the integrity of the content
+	hash := md5.New()
+	if _, err = io.Copy(hash, r); err != nil {
+		return item, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return item, err
+	}
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		Body:       r,
+		ContentMD5: aws.String(base64.StdEncoding.EncodeToString(hash.Sum(nil))),
+	})
+
 	return item, err
 }
 
@@ -93,20 +122,22 @@ func (s *s3store) Remove(key string) error {
 }
 
 func (s *s3store) List() ([]Item, error) {
-	objects, err := s.client.ListObjects(&s3.ListObjectsInput{
+	var items []Item
+
+	// a bucket is listed by pages of 1000 objects max
+	err := s.client.ListObjectsPages(&s3.ListObjectsInput{
 		Bucket: aws.String(s.bucket),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, o := range page.Contents {
+			items = append(items, s3item{bucket: s.bucket, key: *o.Key, store: s})
+		}
+		return true
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	var items []Item
-
-	for _, o := range objects.Contents {
-		items = append(items, s3item{bucket: s.bucket, key: *o.Key, store: s})
-	}
-
 	return items, nil
 }
 
@@ -122,6 +153,15 @@ type S3Config struct {
 
 	DisableSSL     bool
 	ForcePathStyle bool
+
+	// PartSize is the size in bytes of each part of a multipart upload;
+	// files smaller than this value are sent in a single request.
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel.
+	Concurrency int
+	// StateDir, if set, is the folder in which the progress of multipart uploads is saved,
+	// so that an interrupted upload can be resumed.
+	StateDir string
 }
 
 // S3 inits and S3 storage
@@ -140,6 +180,23 @@ func S3(config S3Config) (Store, error) {
 		awsConfig.Credentials = credentials.NewStaticCredentials(config.ID, config.Secret, config.Token)
 	}
 
+	partSize := config.PartSize
+	if partSize <= 0 {
+		partSize = S3DefaultPartSize
+	} else if partSize < S3MinPartSize {
+		partSize = S3MinPartSize
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = S3DefaultConcurrency
+	}
+
 	s3session, err := session.NewSession(awsConfig)
-	return &s3store{client: s3.New(s3session), bucket: config.Bucket}, err
+	return &s3store{
+		client:      s3.New(s3session),
+		bucket:      config.Bucket,
+		partSize:    partSize,
+		concurrency: concurrency,
+		stateDir:    config.StateDir,
+	}, err
 }
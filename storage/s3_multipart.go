@@ -0,0 +1,380 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// S3MinPartSize is the minimum size of a part accepted by S3 (except for the last part)
+	S3MinPartSize = 5 * 1024 * 1024
+	// S3DefaultPartSize is the part size used when none is configured
+	S3DefaultPartSize = 16 * 1024 * 1024
+	// S3DefaultConcurrency is the number of parallel part uploads used when none is configured
+	S3DefaultConcurrency = 4
+	// s3MaxParts is the maximum number of parts in a multipart upload
+	s3MaxParts = 10000
+)
+
+// uploadPart is a completed part of a multipart upload
+type uploadPart struct {
+	ETag string `json:"etag"`
+	MD5  string `json:"md5"`
+}
+
+// uploadState is the progress of a multipart upload, saved to disk to allow resuming it
+type uploadState struct {
+	Bucket   string               `json:"bucket"`
+	Key      string               `json:"key"`
+	UploadID string               `json:"upload_id"`
+	Size     int64                `json:"size"`
+	PartSize int64                `json:"part_size"`
+	Parts    map[int64]uploadPart `json:"parts"`
+
+	mutex sync.Mutex
+	path  string
+}
+
+// partJob is a part read from the source, waiting to be uploaded
+type partJob struct {
+	number int64
+	data   []byte
+	md5    []byte
+}
+
+// addMultipart sends the content of r as a multipart upload.
+// Each part is checked by S3 against its MD5 digest.
+// If the upload fails, it is aborted so that no orphan part is left in the bucket.
+// If a state folder is configured, the progress is saved after each part
+// and an upload interrupted by a crash is resumed on the next call with the same key and size.
+func (s *s3store) addMultipart(key string, r io.ReadSeeker, size int64) error {
+
+	partSize := s.partSize
+	// S3 limits the number of parts, large files require larger parts
+	if size/partSize >= s3MaxParts {
+		partSize = size/(s3MaxParts-1) + 1
+	}
+
+	state := s.resumeUpload(key, size, partSize)
+	if state == nil {
+		out, err := s.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		state = &uploadState{
+			Bucket:   s.bucket,
+			Key:      key,
+			UploadID: aws.StringValue(out.UploadId),
+			Size:     size,
+			PartSize: partSize,
+			Parts:    make(map[int64]uploadPart),
+			path:     s.statePath(key),
+		}
+		state.save()
+	}
+
+	err := s.uploadParts(state, r)
+	if err == nil {
+		err = s.completeUpload(state)
+	}
+	if err != nil {
+		log.Println("Abort the multipart upload of", key)
+		_, abortErr := s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(state.UploadID),
+		})
+		if abortErr != nil {
+			log.Println("Error aborting the multipart upload:", abortErr.Error())
+		}
+	}
+	state.remove()
+	return err
+}
+
+// uploadParts reads the source sequentially and uploads its parts in parallel.
+// Parts already uploaded with the same digest are skipped.
+func (s *s3store) uploadParts(state *uploadState, r io.ReadSeeker) error {
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	jobs := make(chan partJob)
+	errs := make(chan error, s.concurrency)
+	done := make(chan struct{})
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			errs <- err
+			close(done)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := s.uploadPart(state, job); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+	var readErr error
+	var number int64 = 1
+	// the memory used is bounded by the part size times the concurrency level
+	for offset := int64(0); offset < state.Size; offset += state.PartSize {
+		length := state.PartSize
+		if offset+length > state.Size {
+			length = state.Size - offset
+		}
+		data := make([]byte, length)
+		if _, readErr = io.ReadFull(r, data); readErr != nil {
+			break
+		}
+		sum := md5.Sum(data)
+		if state.hasPart(number, sum[:]) {
+			number++
+			continue
+		}
+		select {
+		case jobs <- partJob{number: number, data: data, md5: sum[:]}:
+		case <-done:
+		}
+		if stopped(done) {
+			break
+		}
+		number++
+	}
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		return readErr
+	}
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// stopped indicates if the done channel is closed
+func stopped(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// uploadPart sends a part to S3 and records it in the upload state
+func (s *s3store) uploadPart(state *uploadState, job partJob) error {
+
+	out, err := s.client.UploadPart(&s3.UploadPartInput{
+		Bucket:        aws.String(state.Bucket),
+		Key:           aws.String(state.Key),
+		UploadId:      aws.String(state.UploadID),
+		PartNumber:    aws.Int64(job.number),
+		Body:          bytes.NewReader(job.data),
+		ContentLength: aws.Int64(int64(len(job.data))),
+		ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(job.md5)),
+	})
+	if err != nil {
+		return fmt.Errorf("upload of part %d failed: %w", job.number, err)
+	}
+	state.addPart(job.number, uploadPart{ETag: aws.StringValue(out.ETag), MD5: hex.EncodeToString(job.md5)})
+	return nil
+}
+
+// completeUpload assembles the uploaded parts and checks the size of the resulting object
+func (s *s3store) completeUpload(state *uploadState) error {
+
+	numbers := make([]int64, 0, len(state.Parts))
+	for n := range state.Parts {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	if int64(len(numbers)) != (state.Size+state.PartSize-1)/state.PartSize {
+		return errors.New("multipart upload is missing parts")
+	}
+
+	parts := make([]*s3.CompletedPart, 0, len(numbers))
+	for _, n := range numbers {
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       aws.String(state.Parts[n].ETag),
+			PartNumber: aws.Int64(n),
+		})
+	}
+	_, err := s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(state.Bucket),
+		Key:             aws.String(state.Key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return err
+	}
+
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(state.Bucket),
+		Key:    aws.String(state.Key),
+	})
+	if err != nil {
+		return err
+	}
+	if aws.Int64Value(head.ContentLength) != state.Size {
+		return fmt.Errorf("uploaded object size is %d, expected %d", aws.Int64Value(head.ContentLength), state.Size)
+	}
+	return nil
+}
+
+// resumeUpload returns the saved state of an interrupted upload of the same content, if any.
+// Only the parts still known by S3 are kept.
+func (s *s3store) resumeUpload(key string, size, partSize int64) *uploadState {
+
+	path := s.statePath(key)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state uploadState
+	if err = json.Unmarshal(data, &state); err != nil {
+		os.Remove(path)
+		return nil
+	}
+	state.path = path
+	if state.Bucket != s.bucket || state.Key != key || state.Size != size || state.PartSize != partSize {
+		// the content has changed, the previous upload is useless
+		s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(state.Bucket),
+			Key:      aws.String(state.Key),
+			UploadId: aws.String(state.UploadID),
+		})
+		os.Remove(path)
+		return nil
+	}
+
+	// check which parts are really stored
+	listed := make(map[int64]string)
+	err = s.client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(state.UploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, p := range page.Parts {
+			listed[aws.Int64Value(p.PartNumber)] = aws.StringValue(p.ETag)
+		}
+		return true
+	})
+	if err != nil {
+		// the upload has expired or was aborted, start again
+		log.Println("Cannot resume the upload of", key, ":", err.Error())
+		os.Remove(path)
+		return nil
+	}
+	if state.Parts == nil {
+		state.Parts = make(map[int64]uploadPart)
+	}
+	for n, p := range state.Parts {
+		if listed[n] != p.ETag {
+			delete(state.Parts, n)
+		}
+	}
+	log.Printf("Resume the upload of %s, %d parts already stored", key, len(state.Parts))
+	return &state
+}
+
+// statePath returns the path of the file storing the progress of the upload of a key,
+// or an empty string if the progress is not saved.
+func (s *s3store) statePath(key string) string {
+
+	if s.stateDir == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(s.bucket + "/" + key))
+	return filepath.Join(s.stateDir, "s3upload-"+hex.EncodeToString(hash[:8])+".json")
+}
+
+// hasPart indicates if a part with the same digest has already been uploaded
+func (st *uploadState) hasPart(number int64, sum []byte) bool {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	p, ok := st.Parts[number]
+	return ok && p.MD5 == hex.EncodeToString(sum)
+}
+
+// addPart records an uploaded part and saves the state
+func (st *uploadState) addPart(number int64, part uploadPart) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.Parts[number] = part
+	st.write()
+}
+
+// save writes the state to disk
+func (st *uploadState) save() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.write()
+}
+
+// write writes the state to disk, the caller must hold the mutex.
+// Errors are only logged, as they just prevent a later resume.
+func (st *uploadState) write() {
+	if st.path == "" {
+		return
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		log.Println("Error saving the upload state:", err.Error())
+		return
+	}
+	// write then rename, so that a crash never leaves a truncated state
+	tmp := st.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err == nil {
+		err = os.Rename(tmp, st.path)
+	}
+	if err != nil {
+		log.Println("Error saving the upload state:", err.Error())
+	}
+}
+
+// remove deletes the state from disk
+func (st *uploadState) remove() {
+	if st.path != "" {
+		os.Remove(st.path)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a minimal in-memory S3 server supporting single and multipart uploads
+type fakeS3 struct {
+	mutex    sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	failPart int
+	puts     int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	q := r.URL.Query()
+	key := r.URL.Path
+	uploadID := q.Get("uploadId")
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && uploadID != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Error><Code>BadDigest</Code></Error>")
+			return
+		}
+		if n == f.failPart {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<Error><Code>AccessDenied</Code></Error>")
+			return
+		}
+		f.puts++
+		f.uploads[uploadID][n] = body
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodGet && uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchUpload</Code></Error>")
+			return
+		}
+		fmt.Fprint(w, "<ListPartsResult>")
+		for n, p := range parts {
+			sum := md5.Sum(p)
+			fmt.Fprintf(w, "<Part><PartNumber>%d</PartNumber><ETag>\"%s\"</ETag></Part>", n, hex.EncodeToString(sum[:]))
+		}
+		fmt.Fprint(w, "</ListPartsResult>")
+	case r.Method == http.MethodPost && uploadID != "":
+		parts := f.uploads[uploadID]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var object []byte
+		for _, n := range numbers {
+			object = append(object, parts[n]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, uploadID)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newTestS3Store(t *testing.T, url, stateDir string) *s3store {
+	store, err := S3(S3Config{
+		Bucket:         "bucket",
+		Endpoint:       url,
+		Region:         "us-east-1",
+		ID:             "id",
+		Secret:         "secret",
+		DisableSSL:     true,
+		ForcePathStyle: true,
+		PartSize:       S3MinPartSize,
+		Concurrency:    3,
+		StateDir:       stateDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*s3store)
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	stateDir := t.TempDir()
+	store := newTestS3Store(t, server.URL, stateDir)
+
+	content := make([]byte, 2*S3MinPartSize+1234)
+	rand.Read(content)
+
+	// a failing part aborts the upload
+	fake.failPart = 2
+	_, err := store.Add("book.lcpa", bytes.NewReader(content))
+	if err == nil {
+		t.Fatal("expected an error when a part fails")
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("expected the upload to be aborted, %d uploads remain", len(fake.uploads))
+	}
+	files, _ := os.ReadDir(stateDir)
+	if len(files) != 0 {
+		t.Errorf("expected the upload state to be removed, found %d files", len(files))
+	}
+
+	fake.failPart = 0
+	_, err = store.Add("book.lcpa", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fake.objects["/bucket/book.lcpa"], content) {
+		t.Error("the stored object differs from the source")
+	}
+
+	// small contents are sent in a single request
+	_, err = store.Add("cover.jpg", bytes.NewReader([]byte("cover")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["/bucket/cover.jpg"]) != "cover" {
+		t.Error("the stored cover differs from the source")
+	}
+}
+
+func TestS3MultipartResume(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	stateDir := t.TempDir()
+	store := newTestS3Store(t, server.URL, stateDir)
+
+	content := make([]byte, 3*S3MinPartSize)
+	rand.Read(content)
+
+	// simulate a crash after the first part was uploaded
+	state := &uploadState{
+		Bucket:   "bucket",
+		Key:      "book.lcpa",
+		UploadID: "upload-1",
+		Size:     int64(len(content)),
+		PartSize: S3MinPartSize,
+		Parts:    make(map[int64]uploadPart),
+		path:     store.statePath("book.lcpa"),
+	}
+	fake.uploads["upload-1"] = map[int][]byte{1: content[:S3MinPartSize]}
+	sum := md5.Sum(content[:S3MinPartSize])
+	state.Parts[1] = uploadPart{ETag: `"` + hex.EncodeToString(sum[:]) + `"`, MD5: hex.EncodeToString(sum[:])}
+	state.save()
+
+	_, err := store.Add("book.lcpa", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.puts != 2 {
+		t.Errorf("expected 2 parts to be uploaded after resume, got %d", fake.puts)
+	}
+	if !bytes.Equal(fake.objects["/bucket/book.lcpa"], content) {
+		t.Error("the stored object differs from the source")
+	}
+	if _, err = os.Stat(state.path); !os.IsNotExist(err) {
+		t.Error("expected the upload state to be removed")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package tenant
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// ErrNotFound signals a tenant not found
+var ErrNotFound = errors.New("Tenant not found")
+
+// Store is the interface of the tenant store.
+// Tenants are read when the License Server starts.
+type Store interface {
+	List() func() (config.Tenant, error)
+}
+
+type sqlStore struct {
+	dbList *sql.Stmt
+}
+
+// List lists all tenant definitions by name
+func (s *sqlStore) List() func() (config.Tenant, error) {
+
+	rows, err := s.dbList.Query()
+	if err != nil {
+		return func() (config.Tenant, error) { return config.Tenant{}, err }
+	}
+	return func() (config.Tenant, error) {
+		var t config.Tenant
+		var err error
+		if rows.Next() {
+			var links, prefix sql.NullString
+			err = rows.Scan(&t.Name, &t.Provider, &t.Certificate.Cert, &t.Certificate.PrivateKey, &links, &prefix, &t.AuthFile)
+			if err == nil && links.String != "" {
+				// links are stored as a json object, keyed by rel
+				err = json.Unmarshal([]byte(links.String), &t.Links)
+			}
+			t.StoragePrefix = prefix.String
+		} else {
+			rows.Close()
+			err = ErrNotFound
+		}
+		return t, err
+	}
+}
+
+// Open prepares the db statements of the tenant store
+func Open(db *sql.DB) (store Store, err error) {
+
+	driver, _ := config.GetDatabase(config.Config.LcpServer.Database)
+
+	// if sqlite, create the tenant table if it does not exist
+	if driver == "sqlite3" {
+		_, err = db.Exec(tableDef)
+		if err != nil {
+			log.Println("Error creating sqlite tenant table")
+			return
+		}
+	}
+
+	dbList, err := db.Prepare(`SELECT name, provider, cert, private_key, links, storage_prefix, auth_file FROM tenant ORDER BY name`)
+	if err != nil {
+		log.Println("Error preparing dbList")
+		return
+	}
+
+	store = &sqlStore{dbList}
+	return
+}
+
+const tableDef = "CREATE TABLE IF NOT EXISTS tenant (" +
+	"name varchar(64) PRIMARY KEY," +
+	"provider varchar(255) NOT NULL," +
+	"cert text NOT NULL," +
+	"private_key text NOT NULL," +
+	"links text DEFAULT NULL," +
+	"storage_prefix varchar(255) DEFAULT NULL," +
+	"auth_file text NOT NULL)"
@@ -0,0 +1,157 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+// Package tenant lets a single License Server serve several publishers (tenants).
+// Each tenant has its own provider uri, signing certificate, default license links,
+// storage prefix and API credentials; its licenses and content are isolated from other tenants.
+package tenant
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/readium/readium-lcp-server/config"
+	"github.com/readium/readium-lcp-server/license"
+)
+
+// Tenant is a publisher served by the License Server
+type Tenant struct {
+	Name          string
+	Provider      string
+	Certificate   *tls.Certificate
+	Links         map[string]string
+	StoragePrefix string
+	authenticator *auth.BasicAuth
+}
+
+// CheckAuth returns the name of the user if the request holds valid credentials for the tenant,
+// an empty string otherwise
+func (t *Tenant) CheckAuth(r *http.Request) string {
+	return t.authenticator.CheckAuth(r)
+}
+
+// Registry holds the tenants of the License Server
+type Registry struct {
+	tenants []*Tenant
+	byName  map[string]*Tenant
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// Load creates a registry from the tenants defined in the configuration and in the database.
+// A tenant defined in the configuration takes precedence over a tenant with the same name in the database.
+// st may be nil if tenants are only defined in the configuration.
+func Load(st Store) (*Registry, error) {
+
+	defs := append([]config.Tenant{}, config.Config.Tenants...)
+	if st != nil {
+		fn := st.List()
+		var err error
+		var def config.Tenant
+		for def, err = fn(); err == nil; def, err = fn() {
+			defs = append(defs, def)
+		}
+		if err != ErrNotFound {
+			return nil, err
+		}
+	}
+
+	reg := &Registry{byName: make(map[string]*Tenant)}
+	for _, def := range defs {
+		if _, exists := reg.byName[def.Name]; exists {
+			log.Println("Tenant " + def.Name + " defined twice, the database definition is ignored")
+			continue
+		}
+		t, err := newTenant(def)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", def.Name, err)
+		}
+		reg.tenants = append(reg.tenants, t)
+		reg.byName[t.Name] = t
+	}
+	return reg, nil
+}
+
+// newTenant checks a tenant definition, loads its certificate and credentials
+func newTenant(def config.Tenant) (*Tenant, error) {
+
+	if !validName.MatchString(def.Name) {
+		return nil, errors.New("the tenant name must be made of at most 64 letters, digits, dots, dashes or underscores")
+	}
+	if def.Provider == "" {
+		return nil, errors.New("missing provider")
+	}
+	if def.Certificate.Cert == "" || def.Certificate.PrivateKey == "" {
+		return nil, errors.New("missing certificate or private key")
+	}
+	cert, err := tls.LoadX509KeyPair(def.Certificate.Cert, def.Certificate.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if def.AuthFile == "" {
+		return nil, errors.New("missing passwords file")
+	}
+	if _, err = os.Stat(def.AuthFile); err != nil {
+		return nil, err
+	}
+
+	// tenant links override the default links of the server
+	configLinks := make(map[string]string)
+	for key, link := range config.Config.License.Links {
+		configLinks[key] = link
+	}
+	for key, link := range def.Links {
+		configLinks[key] = link
+	}
+	links, err := license.BuildLinks(configLinks, def.StoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	htpasswd := auth.HtpasswdFileProvider(def.AuthFile)
+	return &Tenant{
+		Name:          def.Name,
+		Provider:      def.Provider,
+		Certificate:   &cert,
+		Links:         links,
+		StoragePrefix: def.StoragePrefix,
+		authenticator: auth.NewBasicAuthenticator("Readium License Content Protection Server", htpasswd),
+	}, nil
+}
+
+// Len returns the number of tenants
+func (reg *Registry) Len() int {
+	return len(reg.tenants)
+}
+
+// All returns the tenants, in the order of their definitions
+func (reg *Registry) All() []*Tenant {
+	return reg.tenants
+}
+
+// Get returns a tenant by name, nil if unknown or if there is no registry
+func (reg *Registry) Get(name string) *Tenant {
+	if reg == nil {
+		return nil
+	}
+	return reg.byName[name]
+}
+
+// Authenticate returns the tenant for which the request holds valid credentials, nil if none.
+// User names should therefore be unique across tenants.
+func (reg *Registry) Authenticate(r *http.Request) *Tenant {
+	for _, t := range reg.tenants {
+		if t.CheckAuth(r) != "" {
+			return t
+		}
+	}
+	return nil
+}
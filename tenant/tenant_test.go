@@ -0,0 +1,107 @@
+// Copyright 2026 Readium Foundation. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file exposed on Github (readium) in the project repository.
+
+package tenant
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/readium/readium-lcp-server/config"
+)
+
+// writeAuthFile creates an htpasswd file with a single user
+func writeAuthFile(t *testing.T, dir, user, password string) string {
+	hash := sha1.Sum([]byte(password))
+	path := filepath.Join(dir, user+".htpasswd")
+	err := os.WriteFile(path, []byte(user+":{SHA}"+base64.StdEncoding.EncodeToString(hash[:])+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	cert := config.Certificate{
+		Cert:       "../test/cert/cert-edrlab-test.pem",
+		PrivateKey: "../test/cert/privkey-edrlab-test.pem",
+	}
+
+	config.Config.LcpServer.Database = "sqlite3://:memory:"
+	config.Config.Storage.FileSystem.URL = "http://localhost/files"
+	config.Config.License.Links = map[string]string{"status": "http://localhost/lsd/licenses/{license_id}/status", "hint": "http://localhost/hint"}
+	config.Config.Tenants = []config.Tenant{
+		{Name: "acme", Provider: "https://acme.org", Certificate: cert, StoragePrefix: "acme/",
+			Links: map[string]string{"hint": "https://acme.org/hint"}, AuthFile: writeAuthFile(t, dir, "acme", "secret")},
+	}
+	defer func() { config.Config.Tenants = nil }()
+
+	driver, cnxn := config.GetDatabase(config.Config.LcpServer.Database)
+	db, err := sql.Open(driver, cnxn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a memory db is bound to its connection
+	db.SetMaxOpenConns(1)
+	st, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO tenant (name, provider, cert, private_key, links, storage_prefix, auth_file) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"books", "https://books.org", cert.Cert, cert.PrivateKey, nil, nil, writeAuthFile(t, dir, "books", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a tenant defined in the configuration takes precedence
+	_, err = db.Exec(`INSERT INTO tenant (name, provider, cert, private_key, links, storage_prefix, auth_file) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"acme", "https://other.org", cert.Cert, cert.PrivateKey, `{"hint":"https://other.org/hint"}`, "", "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := Load(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Len() != 2 {
+		t.Fatalf("Expected 2 tenants, got %d", reg.Len())
+	}
+	acme := reg.Get("acme")
+	if acme == nil || acme.Provider != "https://acme.org" || acme.Certificate == nil {
+		t.Fatalf("Unexpected tenant %+v", acme)
+	}
+	if acme.Links["hint"] != "https://acme.org/hint" || acme.Links["status"] != config.Config.License.Links["status"] {
+		t.Errorf("Unexpected links %v", acme.Links)
+	}
+	if acme.Links["publication"] != "http://localhost/files/acme/{publication_id}" {
+		t.Errorf("Unexpected publication link %s", acme.Links["publication"])
+	}
+	if reg.Get("unknown") != nil {
+		t.Error("Expected no unknown tenant")
+	}
+
+	r, _ := http.NewRequest("GET", "/licenses", nil)
+	r.SetBasicAuth("books", "pass")
+	if tn := reg.Authenticate(r); tn == nil || tn.Name != "books" {
+		t.Errorf("Expected the books tenant, got %+v", tn)
+	}
+	r.SetBasicAuth("books", "wrong")
+	if tn := reg.Authenticate(r); tn != nil {
+		t.Errorf("Expected no tenant, got %s", tn.Name)
+	}
+
+	config.Config.Tenants = []config.Tenant{{Name: "a/b", Provider: "p", Certificate: cert, AuthFile: "x"}}
+	if _, err = Load(nil); err == nil {
+		t.Error("Expected an error on an invalid tenant name")
+	}
+}
@@ -20,6 +20,7 @@ var ErrNotFound = errors.New("Event not found")
 type Transactions interface {
 	Get(id int) (Event, error)
 	Add(e Event, eventType int) error
+	AddTx(tx *sql.Tx, e Event, eventType int) error
 	GetByLicenseStatusId(licenseStatusFk int) func() (Event, error)
 	CheckDeviceStatus(licenseStatusFk int, deviceId string) (string, error)
 	ListRegisteredDevices(licenseStatusFk int) func() (Device, error)
@@ -43,6 +44,10 @@ type Event struct {
 	Type            string    `json:"type"`
 	DeviceId        string    `json:"id"`
 	LicenseStatusFk int       `json:"-"`
+	// reason of a system event, e.g. the transfer of the license
+	Reason string `json:"reason,omitempty"`
+	// id of a license related to the event, e.g. the other license of a transfer
+	RelatedLicense string `json:"related_license,omitempty"`
 }
 
 type dbTransactions struct {
@@ -57,22 +62,50 @@ type dbTransactions struct {
 func (i dbTransactions) Get(id int) (Event, error) {
 
 	row := i.dbGet.QueryRow(id)
-	var e Event
-	var typeInt int
-	err := row.Scan(&e.ID, &e.DeviceName, &e.Timestamp, &typeInt, &e.DeviceId, &e.LicenseStatusFk)
+	e, err := scanEvent(row)
 	if err != nil {
 		return Event{}, err
 	}
-	e.Type = status.EventTypes[typeInt]
 	return e, err
 }
 
+// scanEvent reads an event selected with eventColumns
+func scanEvent(row interface{ Scan(...interface{}) error }) (Event, error) {
+	var e Event
+	var typeInt int
+	var reason, related sql.NullString
+	err := row.Scan(&e.ID, &e.DeviceName, &e.Timestamp, &typeInt, &e.DeviceId, &e.LicenseStatusFk, &reason, &related)
+	if err == nil {
+		e.Type = status.EventTypes[typeInt]
+		e.Reason = reason.String
+		e.RelatedLicense = related.String
+	}
+	return e, err
+}
+
+const eventColumns = "SELECT id, device_name, timestamp, type, device_id, license_status_fk, reason, related_license FROM event "
+
+const insertQuery = `INSERT INTO event (device_name, timestamp, type, device_id, license_status_fk, reason, related_license)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+func insertArgs(e Event, eventType int) []interface{} {
+	return []interface{}{e.DeviceName, e.Timestamp, eventType, e.DeviceId, e.LicenseStatusFk,
+		sql.NullString{String: e.Reason, Valid: e.Reason != ""},
+		sql.NullString{String: e.RelatedLicense, Valid: e.RelatedLicense != ""}}
+}
+
 // Add adds an event in the database,
 // The parameter eventType corresponds to the field 'type' in table 'event'
 func (i dbTransactions) Add(e Event, eventType int) error {
 
-	_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, "INSERT INTO event (device_name, timestamp, type, device_id, license_status_fk) VALUES (?, ?, ?, ?, ?)"),
-		e.DeviceName, e.Timestamp, eventType, e.DeviceId, e.LicenseStatusFk)
+	_, err := i.db.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, insertQuery), insertArgs(e, eventType)...)
+	return err
+}
+
+// AddTx adds an event in a database transaction, e.g. the one updating the license status
+func (i dbTransactions) AddTx(tx *sql.Tx, e Event, eventType int) error {
+
+	_, err := tx.Exec(dbutils.GetParamQuery(config.Config.LsdServer.Database, insertQuery), insertArgs(e, eventType)...)
 	return err
 }
 
@@ -85,13 +118,9 @@ func (i dbTransactions) GetByLicenseStatusId(licenseStatusFk int) func() (Event,
 	return func() (Event, error) {
 		var e Event
 		var err error
-		var typeInt int
 
 		if rows.Next() {
-			err = rows.Scan(&e.ID, &e.DeviceName, &e.Timestamp, &typeInt, &e.DeviceId, &e.LicenseStatusFk)
-			if err == nil {
-				e.Type = status.EventTypes[typeInt]
-			}
+			e, err = scanEvent(rows)
 		} else {
 			rows.Close()
 			err = ErrNotFound
@@ -151,13 +180,23 @@ func Open(db *sql.DB) (t Transactions, err error) {
 		}
 	}
 
+	// events created before the transfer of licenses have no reason and related license
+	err = dbutils.AddColumn(db, config.Config.LsdServer.Database, "event", "reason", "varchar(255) DEFAULT NULL")
+	if err == nil {
+		err = dbutils.AddColumn(db, config.Config.LsdServer.Database, "event", "related_license", "varchar(255) DEFAULT NULL")
+	}
+	if err != nil {
+		log.Println("Error adding columns to the event table")
+		return
+	}
+
 	// select an event by its id
-	dbGet, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT * FROM event WHERE id = ?"))
+	dbGet, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, eventColumns+"WHERE id = ?"))
 	if err != nil {
 		return
 	}
 
-	dbGetByStatusID, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, "SELECT * FROM event WHERE license_status_fk = ?"))
+	dbGetByStatusID, err := db.Prepare(dbutils.GetParamQuery(config.Config.LsdServer.Database, eventColumns+"WHERE license_status_fk = ?"))
 	if err != nil {
 		return
 	}
@@ -192,6 +231,8 @@ const tableDef = "CREATE TABLE IF NOT EXISTS event (" +
 	"type int NOT NULL," +
 	"device_id varchar(255) DEFAULT NULL," +
 	"license_status_fk int NOT NULL," +
+	"reason varchar(255) DEFAULT NULL," +
+	"related_license varchar(255) DEFAULT NULL," +
 	"FOREIGN KEY(license_status_fk) REFERENCES license_status(id)" +
 	");" +
 	"CREATE INDEX IF NOT EXISTS license_status_fk_index on event (license_status_fk);"